@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * `glox ast script` writes the script's parsed tree to stdout as JSON, for
+ * tools that want to work with glox's parse of a program rather than parse
+ * Lox themselves. See lang/astjson.go for the format. Go tools can read the
+ * tree back, edited or not, with FrontEnd.AnalyzeAST and run it.
+ *****************************************************************************/
+
+func runAST(path string) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	errorHandler := newErrorHandler(path)
+	program := lang.NewFrontEnd(errorHandler).Analyze(string(source))
+	if program == nil {
+		os.Exit(65)
+	}
+	encoded, err := lang.EncodeAST(program.Statements)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(70)
+	}
+	fmt.Println(string(encoded))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * `glox compile` parses modules ahead of time and writes each one's .loxc
+ * artifact next to it. Imports pick the artifacts up automatically, and
+ * ignore any that are older than their source.
+ *****************************************************************************/
+
+func runCompile(paths []string) {
+	if len(paths) == 0 {
+		flag.Usage()
+		os.Exit(64)
+	}
+	hadError := false
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		errorHandler := newErrorHandler(path)
+		compiled, err := lang.CompileArtifact(string(source), errorHandler)
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			hadError = true
+			continue
+		}
+		output := strings.TrimSuffix(path, filepath.Ext(path)) + lang.ArtifactExtension
+		if err := os.WriteFile(output, compiled, 0644); err != nil {
+			fmt.Println(err)
+			os.Exit(74)
+		}
+	}
+	if hadError {
+		os.Exit(65)
+	}
+}
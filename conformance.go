@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+/******************************************************************************
+ * `glox conformance` runs the Lox test suite from Crafting Interpreters
+ * (the test directory of github.com/munificent/craftinginterpreters) and
+ * reports how many tests pass in each chapter of the book. make conformance
+ * fetches the suite at a pinned commit and runs it. Each test is a script
+ * whose comments say what it should do:
+ *
+ *     // expect: output                  a line the script prints
+ *     // expect runtime error: message   the runtime error it stops with
+ *     // Error at 'x': message           a static error on this line
+ *     // [line 3] Error at 'x': message  a static error on another line
+ *
+ * Every test runs in its own glox process, so a crash or a hang only fails
+ * that one test. Some tests check behaviour glox deliberately does its own
+ * way, like "" and 0 being false, so --expected-failures names a file
+ * listing the tests that are known to fail, one path relative to the test
+ * directory per line, with # starting a comment. They are still run and
+ * reported, but only failures of other tests make the exit code 1. A listed
+ * test that passes is reported too, so the list can be kept short. glox adds a diagnostic code to its messages and writes
+ * runtime errors on one line, both are taken into account when comparing.
+ * Warnings are ignored.
+ *
+ * The scanning and expressions tests need the book's test harnesses for
+ * chapters 4 to 7, the limit tests are about the book's bytecode VM, and the
+ * benchmarks aren't tests, so they are all skipped.
+ *****************************************************************************/
+
+type conformanceChapter struct {
+	number int
+	title  string
+}
+
+// conformanceChapters maps each test directory to the chapter that introduces what it tests
+var conformanceChapters = map[string]conformanceChapter{
+	"":                 {8, "Statements and State"},
+	"assignment":       {8, "Statements and State"},
+	"block":            {8, "Statements and State"},
+	"bool":             {8, "Statements and State"},
+	"comments":         {8, "Statements and State"},
+	"nil":              {8, "Statements and State"},
+	"number":           {8, "Statements and State"},
+	"operator":         {8, "Statements and State"},
+	"print":            {8, "Statements and State"},
+	"string":           {8, "Statements and State"},
+	"variable":         {8, "Statements and State"},
+	"if":               {9, "Control Flow"},
+	"logical_operator": {9, "Control Flow"},
+	"while":            {9, "Control Flow"},
+	"for":              {9, "Control Flow"},
+	"call":             {10, "Functions"},
+	"function":         {10, "Functions"},
+	"return":           {10, "Functions"},
+	"closure":          {11, "Resolving and Binding"},
+	"class":            {12, "Classes"},
+	"constructor":      {12, "Classes"},
+	"field":            {12, "Classes"},
+	"method":           {12, "Classes"},
+	"this":             {12, "Classes"},
+	"inheritance":      {13, "Inheritance"},
+	"super":            {13, "Inheritance"},
+	"regression":       {13, "Inheritance"},
+}
+
+var skippedConformanceDirs = map[string]bool{"scanning": true, "expressions": true, "limit": true, "benchmark": true}
+
+const conformanceTimeout = 10 * time.Second
+
+var (
+	expectOutputPattern       = regexp.MustCompile(`// expect: ?(.*)`)
+	expectRuntimeErrorPattern = regexp.MustCompile(`// expect runtime error: (.+)`)
+	expectErrorPattern        = regexp.MustCompile(`// (Error.*)`)
+	expectErrorLinePattern    = regexp.MustCompile(`// \[(?:java )?line (\d+)\] (Error.*)`)
+	otherImplementation       = regexp.MustCompile(`// \[c line \d+\]`)
+	diagnosticCodePattern     = regexp.MustCompile(`^(\[line \d+\] Error) [EW]\d{4}`)
+	runtimeErrorPattern       = regexp.MustCompile(`^\[line (\d+)\] Error [EW]\d{4}: (.*)$`)
+)
+
+type conformanceTest struct {
+	output       []string
+	staticErrors []string
+	runtimeError string
+	runtimeLine  int
+}
+
+func runConformance(args []string) {
+	expectedFailures := make(map[string]bool)
+	if len(args) == 3 && args[0] == "--expected-failures" {
+		var err error
+		expectedFailures, err = readExpectedFailures(args[1])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		args = args[2:]
+	}
+	if len(args) != 1 {
+		flag.Usage()
+		os.Exit(64)
+	}
+	dir := args[0]
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	type tally struct{ passed, total int }
+	tallies := make(map[conformanceChapter]*tally)
+	failed := 0
+	reported := false // whether anything was printed above the summary
+	err = filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, _ := filepath.Rel(dir, path)
+		if entry.IsDir() {
+			if skippedConformanceDirs[relative] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".lox" {
+			return nil
+		}
+		test, isTest, err := readConformanceTest(path)
+		if err != nil || !isTest {
+			return err
+		}
+		chapter, found := conformanceChapters[filepath.Dir(relative)]
+		if filepath.Dir(relative) == "." {
+			chapter, found = conformanceChapters[""], true
+		}
+		if !found {
+			chapter = conformanceChapter{0, "Other"}
+		}
+		if tallies[chapter] == nil {
+			tallies[chapter] = &tally{}
+		}
+		tallies[chapter].total++
+		expected := expectedFailures[filepath.ToSlash(relative)]
+		delete(expectedFailures, filepath.ToSlash(relative))
+		problem := runConformanceTest(executable, path, test)
+		reported = reported || problem != "" || expected
+		if problem == "" {
+			tallies[chapter].passed++
+			if expected {
+				fmt.Printf("PASS %s: it is listed as an expected failure, take it off the list\n", path)
+			}
+		} else if expected {
+			fmt.Printf("EXPECTED FAIL %s: %s\n", path, problem)
+		} else {
+			fmt.Printf("FAIL %s: %s\n", path, problem)
+			failed++
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	chapters := make([]conformanceChapter, 0, len(tallies))
+	for chapter := range tallies {
+		chapters = append(chapters, chapter)
+	}
+	if len(chapters) == 0 {
+		fmt.Printf("No tests found in %s.\n", dir)
+		os.Exit(2)
+	}
+	missing := make([]string, 0, len(expectedFailures))
+	for name := range expectedFailures {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		fmt.Printf("MISSING %s: it is listed as an expected failure but isn't in %s\n", name, dir)
+		reported = true
+	}
+	sort.Slice(chapters, func(a, b int) bool { return chapters[a].number < chapters[b].number })
+	if reported {
+		fmt.Println()
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	passed, total := 0, 0
+	for _, chapter := range chapters {
+		t := tallies[chapter]
+		name := chapter.title
+		if chapter.number > 0 {
+			name = fmt.Sprintf("%d. %s", chapter.number, chapter.title)
+		}
+		fmt.Fprintf(w, "%s\t%d/%d\t%.1f%%\n", name, t.passed, t.total, percent(t.passed, t.total))
+		passed += t.passed
+		total += t.total
+	}
+	fmt.Fprintf(w, "Total\t%d/%d\t%.1f%%\n", passed, total, percent(passed, total))
+	w.Flush()
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// readExpectedFailures reads a list of tests that are known to fail, see runConformance
+func readExpectedFailures(path string) (map[string]bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	expectedFailures := make(map[string]bool)
+	for _, line := range lines(string(content)) {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			expectedFailures[line] = true
+		}
+	}
+	return expectedFailures, nil
+}
+
+func percent(part int, whole int) float64 {
+	return 100 * float64(part) / float64(whole)
+}
+
+// readConformanceTest collects what a test expects, isTest is false for scripts marked as not being tests
+func readConformanceTest(path string) (test conformanceTest, isTest bool, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return test, false, err
+	}
+	test, isTest = parseConformanceTest(string(source))
+	return test, isTest, nil
+}
+
+func parseConformanceTest(source string) (test conformanceTest, isTest bool) {
+	for i, line := range strings.Split(source, "\n") {
+		if strings.Contains(line, "// nontest") {
+			return test, false
+		}
+		if match := expectOutputPattern.FindStringSubmatch(line); match != nil {
+			test.output = append(test.output, match[1])
+		} else if match := expectRuntimeErrorPattern.FindStringSubmatch(line); match != nil {
+			test.runtimeError, test.runtimeLine = match[1], i+1
+		} else if match := expectErrorLinePattern.FindStringSubmatch(line); match != nil {
+			test.staticErrors = append(test.staticErrors, fmt.Sprintf("[line %s] %s", match[1], match[2]))
+		} else if otherImplementation.MatchString(line) {
+			continue
+		} else if match := expectErrorPattern.FindStringSubmatch(line); match != nil {
+			test.staticErrors = append(test.staticErrors, fmt.Sprintf("[line %d] %s", i+1, match[1]))
+		}
+	}
+	return test, true
+}
+
+// expectsAnything reports whether a script has any expect comments at all
+func (test conformanceTest) expectsAnything() bool {
+	return len(test.output) > 0 || len(test.staticErrors) > 0 || test.runtimeError != ""
+}
+
+// runConformanceTest runs one test and describes the first way it went wrong, or returns "" if it passed
+func runConformanceTest(executable string, path string, test conformanceTest) string {
+	ctx, cancel := context.WithTimeout(context.Background(), conformanceTimeout)
+	defer cancel()
+	args := []string{path}
+	if *useVM {
+		args = []string{"--vm", path}
+	}
+	cmd := exec.CommandContext(ctx, executable, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Sprintf("still running after %s", conformanceTimeout)
+	}
+	exitCode := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return err.Error()
+	}
+	return test.check(stdout.String(), stderr.String(), exitCode)
+}
+
+// check compares what a test printed and reported, and how it exited, with what it expects, see runConformanceTest
+func (test conformanceTest) check(stdout string, stderr string, exitCode int) string {
+	// the source snippets and backtraces printed under a diagnostic are left out, the suite doesn't expect them
+	errorLines := make([]string, 0)
+	for _, line := range lines(stderr) {
+		if strings.HasPrefix(line, "[") && !strings.Contains(line, "] Warning ") {
+			errorLines = append(errorLines, line)
+		}
+	}
+	if len(test.staticErrors) > 0 {
+		for i, expected := range test.staticErrors {
+			if i >= len(errorLines) {
+				return fmt.Sprintf("missing error '%s'", expected)
+			}
+			if actual := diagnosticCodePattern.ReplaceAllString(errorLines[i], "$1"); actual != expected {
+				return fmt.Sprintf("expected error '%s', got '%s'", expected, actual)
+			}
+		}
+		if len(errorLines) > len(test.staticErrors) {
+			return fmt.Sprintf("unexpected error '%s'", errorLines[len(test.staticErrors)])
+		}
+		return expectExitCode(exitCode, 65)
+	}
+	if test.runtimeError != "" {
+		if len(errorLines) == 0 {
+			return fmt.Sprintf("expected runtime error '%s', got none", test.runtimeError)
+		}
+		match := runtimeErrorPattern.FindStringSubmatch(errorLines[0])
+		if match == nil || match[2] != test.runtimeError {
+			return fmt.Sprintf("expected runtime error '%s', got '%s'", test.runtimeError, errorLines[0])
+		}
+		if line, _ := strconv.Atoi(match[1]); line != test.runtimeLine {
+			return fmt.Sprintf("expected runtime error on line %d, got line %d", test.runtimeLine, line)
+		}
+	} else if len(errorLines) > 0 {
+		return fmt.Sprintf("unexpected error '%s'", errorLines[0])
+	}
+
+	output := lines(stdout)
+	for i, expected := range test.output {
+		if i >= len(output) {
+			return fmt.Sprintf("missing output '%s'", expected)
+		}
+		if output[i] != expected {
+			return fmt.Sprintf("expected output '%s', got '%s'", expected, output[i])
+		}
+	}
+	if len(output) > len(test.output) {
+		return fmt.Sprintf("unexpected output '%s'", output[len(test.output)])
+	}
+	if test.runtimeError != "" {
+		return expectExitCode(exitCode, 70)
+	}
+	return expectExitCode(exitCode, 0)
+}
+
+func expectExitCode(actual int, expected int) string {
+	if actual != expected {
+		return fmt.Sprintf("expected exit code %d, got %d", expected, actual)
+	}
+	return ""
+}
+
+func lines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * Branches counted with --coverage are saved to the file it names. When the
+ * file already has counts, from earlier runs or other scripts, the new ones
+ * are added to them, so running each script in a suite, or glox test, with
+ * the same file collects coverage for all of them. `glox coverage` reads the
+ * file back and reports the branches that were never taken.
+ *****************************************************************************/
+
+// loadCoverage reads the counts already in the --coverage file, if it exists yet
+func loadCoverage() *lang.Coverage {
+	file, err := os.Open(*coveragePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lang.NewCoverage()
+	} else if err != nil {
+		fmt.Println(err)
+		os.Exit(74)
+	}
+	defer file.Close()
+	coverage, err := lang.ReadCoverage(file)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(65)
+	}
+	return coverage
+}
+
+func saveCoverage(coverage *lang.Coverage) {
+	file, err := os.Create(*coveragePath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(74)
+	}
+	defer file.Close()
+	if err := lang.WriteCoverage(file, coverage); err != nil {
+		fmt.Println(err)
+		os.Exit(74)
+	}
+}
+
+func runCoverageReport(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	coverage, err := lang.ReadCoverage(file)
+	file.Close()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(65)
+	}
+	if err := coverage.WriteReport(os.Stdout); err != nil {
+		fmt.Println(err)
+		os.Exit(74)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * Debugging from an editor with the Debug Adapter Protocol, see
+ * lang/debugadapter.go. `glox dap` is an adapter an editor starts itself,
+ * speaking the protocol over stdin and stdout, and the editor's launch
+ * request says which script to run. Its output is sent to the editor's
+ * debug console. `glox --dap address script.lox` instead waits for an
+ * editor to connect to the address and attach, then runs the script with
+ * its output going to the terminal as usual.
+ *****************************************************************************/
+
+func runDAP() {
+	os.Exit(lang.NewDebugAdapter(os.Stdin, os.Stdout).Serve())
+}
+
+func runAttachedDAP(path string, address string) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	fmt.Fprintf(os.Stderr, "Waiting for a debugger to attach at %s.\n", listener.Addr())
+	connection, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	adapter := lang.NewDebugAdapter(connection, connection)
+	adapter.SetProgram(path, stdout)
+	code := adapter.Serve()
+	connection.Close()
+	stdout.Flush()
+	os.Exit(code)
+}
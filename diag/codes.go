@@ -0,0 +1,174 @@
+package diag
+
+/******************************************************************************
+ * Diagnostic codes. Codes are grouped by the stage of the pipeline that
+ * reports them. Once published a code must keep its meaning, new problems
+ * get new codes.
+ *
+ *   E00xx  syntax errors from the scanner and parser
+ *   E01xx  name and scope errors from the resolver and interpreter
+ *   E02xx  runtime type and call errors
+ *   E03xx  limits of the bytecode compiler
+ *   W02xx  warnings
+ *****************************************************************************/
+
+type Code string
+
+const (
+	// scanner
+	UnexpectedCharacter Code = "E0001"
+	UnterminatedString  Code = "E0002"
+	InvalidNumber       Code = "E0003"
+	// parser
+	ExpectedToken           Code = "E0010"
+	ExpectedExpression      Code = "E0011"
+	InvalidAssignmentTarget Code = "E0012"
+	TooManyParameters       Code = "E0013"
+	TooManyArguments        Code = "E0014"
+	TooDeeplyNested         Code = "E0015"
+	InternalParserError     Code = "E0016"
+	PositionalAfterNamed    Code = "E0017"
+	// names and scopes
+	UndefinedVariable      Code = "E0101"
+	AlreadyDeclared        Code = "E0102"
+	ReadInOwnInitializer   Code = "E0103"
+	UndefinedProperty      Code = "E0104"
+	ReturnAtTopLevel       Code = "E0105"
+	ReturnFromInitializer  Code = "E0106"
+	ThisOutsideClass       Code = "E0107"
+	SuperOutsideClass      Code = "E0108"
+	SuperWithoutSuperclass Code = "E0109"
+	InheritFromSelf        Code = "E0110"
+	BreakOutsideLoop       Code = "E0111"
+	ContinueOutsideLoop    Code = "E0112"
+	InitializerGetter      Code = "E0113"
+	TraitMethodConflict    Code = "E0114"
+	DuplicateArgument      Code = "E0115"
+	UnknownParameter       Code = "E0116"
+	// runtime types and calls
+	OperandMustBeNumber        Code = "E0201"
+	InvalidOperands            Code = "E0202"
+	NotCallable                Code = "E0203"
+	ArityMismatch              Code = "E0204"
+	OnlyInstancesHaveFields    Code = "E0205"
+	SuperclassNotClass         Code = "E0206"
+	NativeError                Code = "E0207"
+	StackOverflow              Code = "E0208"
+	StepBudgetExceeded         Code = "E0209"
+	NotSubscriptable           Code = "E0210"
+	InvalidIndex               Code = "E0211"
+	IndexOutOfRange            Code = "E0212"
+	ModuleNotFound             Code = "E0213"
+	ImportFailed               Code = "E0214"
+	TimedOut                   Code = "E0215"
+	Cancelled                  Code = "E0216"
+	InvalidBitwiseOperand      Code = "E0217"
+	NotATrait                  Code = "E0218"
+	NotIterable                Code = "E0219"
+	NamedArgumentsNotSupported Code = "E0220"
+	AssertionFailed            Code = "E0221"
+	// bytecode compiler
+	TooManyLocals       Code = "E0301"
+	TooManyUpvalues     Code = "E0302"
+	TooManyConstants    Code = "E0303"
+	JumpTooLarge        Code = "E0304"
+	TooManyElements     Code = "E0305"
+	ImportsNotSupported Code = "E0306"
+	// warnings
+	AssignmentInCondition Code = "W0201"
+	ConstantCondition     Code = "W0202"
+	InfiniteLoop          Code = "W0203"
+	SelfComparison        Code = "W0204"
+	UnusedExpression      Code = "W0205"
+	UnknownDirective      Code = "W0206"
+	UnreachableCode       Code = "W0207"
+	UnusedVariable        Code = "W0208"
+	ShadowedVariable      Code = "W0209"
+	SelfAssignment        Code = "W0210"
+	EmptyBlock            Code = "W0211"
+	IdenticalBranches     Code = "W0212"
+)
+
+var descriptions = map[Code]string{
+	UnexpectedCharacter:        "The scanner found a character that does not start any Lox token.",
+	UnterminatedString:         "A string literal is missing its closing '\"'.",
+	InvalidNumber:              "A number literal could not be converted to a number.",
+	ExpectedToken:              "The parser needed a specific token, like ';' or ')', and found something else.",
+	ExpectedExpression:         "The parser needed an expression and found something else.",
+	InvalidAssignmentTarget:    "Only variables, instance fields, and list or map elements can be assigned to.",
+	TooManyParameters:          "Functions can't declare more than 255 parameters.",
+	TooManyArguments:           "Calls can't pass more than 255 arguments.",
+	TooDeeplyNested:            "Code is nested too deeply to parse, like thousands of parentheses or blocks inside each other.",
+	InternalParserError:        "The scanner or parser hit a bug in glox itself. The source may be fine, please report it.",
+	PositionalAfterNamed:       "A call passes an argument by position after one passed by name. Positional arguments come first.",
+	UndefinedVariable:          "A variable was used or assigned before it was declared.",
+	AlreadyDeclared:            "A local scope declares the same name twice.",
+	ReadInOwnInitializer:       "A local variable's initializer refers to the variable being declared.",
+	UndefinedProperty:          "An instance has no field or method with the requested name.",
+	ReturnAtTopLevel:           "'return' can only be used inside a function.",
+	ReturnFromInitializer:      "An 'init' method can't return a value, it always returns 'this'.",
+	ThisOutsideClass:           "'this' can only be used inside a method.",
+	SuperOutsideClass:          "'super' can only be used inside a method.",
+	SuperWithoutSuperclass:     "'super' can only be used in a class that has a superclass.",
+	InheritFromSelf:            "A class names itself as its superclass.",
+	BreakOutsideLoop:           "'break' can only be used inside a while or for loop.",
+	ContinueOutsideLoop:        "'continue' can only be used inside a while or for loop.",
+	InitializerGetter:          "An init method is declared as a getter, without a parameter list.",
+	TraitMethodConflict:        "Two traits mixed into a class define the same method and the class doesn't define it itself.",
+	DuplicateArgument:          "A call passes the same parameter more than once, by name or by position and name.",
+	UnknownParameter:           "A call passes an argument by a name the function doesn't have as a parameter.",
+	OperandMustBeNumber:        "An arithmetic or comparison operator was given a value that is not a number.",
+	InvalidOperands:            "An operator was given a combination of operand types it does not support.",
+	NotCallable:                "Only functions and classes can be called.",
+	ArityMismatch:              "A call passed a different number of arguments than the callee declares.",
+	OnlyInstancesHaveFields:    "Properties can only be read from or written to class instances.",
+	SuperclassNotClass:         "The value after '<' in a class declaration is not a class.",
+	NativeError:                "A native function was called with arguments it can't work with.",
+	StackOverflow:              "Too many calls were active at once, usually because of unbounded recursion.",
+	StepBudgetExceeded:         "The program executed more statements than its step budget allows.",
+	NotSubscriptable:           "Only lists and maps can be indexed with '[]'.",
+	InvalidIndex:               "A list index must be a whole number.",
+	IndexOutOfRange:            "A list index is negative or past the end of the list.",
+	ModuleNotFound:             "An imported module could not be found on the search path.",
+	ImportFailed:               "An imported module could not be read or had errors, or modules import each other.",
+	TimedOut:                   "A call made with withTimeout ran past its time limit.",
+	Cancelled:                  "The program was cancelled by the code running it.",
+	InvalidBitwiseOperand:      "A bitwise operand isn't a finite number in the 64-bit integer range, or a shift count is negative.",
+	NotATrait:                  "A class mixes in something that isn't a trait.",
+	NotIterable:                "A for-in loop was given something other than a list, map, string, or instance with done and next methods.",
+	NamedArgumentsNotSupported: "Natives only take their arguments by position, not by name.",
+	AssertionFailed:            "An assertEqual, assertTrue, or assertRaises check didn't hold.",
+	TooManyLocals:              "A function run by the bytecode VM can't have more than 256 local variables in scope at once.",
+	TooManyUpvalues:            "A function run by the bytecode VM can't capture more than 256 variables from enclosing functions.",
+	TooManyConstants:           "A function run by the bytecode VM can't use more than 65536 constants.",
+	JumpTooLarge:               "A branch or loop body is too large for the bytecode VM to jump over.",
+	TooManyElements:            "A list or map literal run by the bytecode VM can't have more than 65535 elements.",
+	ImportsNotSupported:        "Imports are not supported by the bytecode VM.",
+	AssignmentInCondition:      "An assignment is used directly as a condition, where '==' was probably meant.",
+	ConstantCondition:          "An if or while condition always has the same value. glox lint also checks conditional expressions and the left side of 'and' and 'or'.",
+	InfiniteLoop:               "A loop can never end, nothing in it changes its condition or leaves it.",
+	SelfComparison:             "Both sides of an operator are the same expression.",
+	UnusedExpression:           "An expression statement has no side effects and its value is thrown away.",
+	UnknownDirective:           "A glox-lint or glox-fmt comment isn't one glox understands, or names a diagnostic code that doesn't exist.",
+	UnreachableCode:            "A statement comes after a return, break, or continue that always leaves before it.",
+	UnusedVariable:             "A local variable is declared but its value is never read.",
+	ShadowedVariable:           "A declaration has the same name as one in an enclosing scope, which it hides. Reported by glox lint.",
+	SelfAssignment:             "A variable, property, or element is assigned its own value. Reported by glox lint.",
+	EmptyBlock:                 "A block has no statements and no comment saying why. Reported by glox lint.",
+	IdenticalBranches:          "Both branches of a conditional expression are the same, so its condition makes no difference. Reported by glox lint.",
+}
+
+// Describe returns a short explanation of what a diagnostic code means.
+func (c Code) Describe() string {
+	description, found := descriptions[c]
+	if !found {
+		return "Unknown diagnostic code."
+	}
+	return description
+}
+
+// Known reports whether c is a diagnostic code glox reports.
+func (c Code) Known() bool {
+	_, found := descriptions[c]
+	return found
+}
@@ -0,0 +1,107 @@
+package diag
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/******************************************************************************
+ * Package diag describes the problems glox reports about a Lox program. Every
+ * error and warning carries a stable code (see codes.go) so that tooling can
+ * filter or suppress specific diagnostics, and so that each one can be looked
+ * up and explained independent of the exact wording of its message.
+ *****************************************************************************/
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "Warning"
+	}
+	return "Error"
+}
+
+type Diagnostic struct {
+	Code     Code
+	Severity Severity
+	Line     int
+	Where    string // the offending lexeme, if there is one
+	Message  string
+	Trace    []string // the Lox calls that led to a runtime error, innermost first, if they are known
+	// where on the line the problem is, when the source is known, see Snippet
+	SourceLine string
+	Column     int // starting at 1, 0 if the source isn't known
+	Width      int // how many bytes of the line the problem covers
+}
+
+func (d Diagnostic) String() string {
+	if len(d.Where) > 0 {
+		return fmt.Sprintf("[line %d] %s %s at '%s': %s", d.Line, d.Severity, d.Code, d.Where, d.Message)
+	}
+	return fmt.Sprintf("[line %d] %s %s: %s", d.Line, d.Severity, d.Code, d.Message)
+}
+
+/******************************************************************************
+ * Snippet shows the line the problem is on with a caret under it, or
+ * nothing if the source isn't known:
+ *
+ *   3 | print total + "items";
+ *     |             ^
+ *****************************************************************************/
+
+func (d Diagnostic) Snippet() []string {
+	if d.Column < 1 || d.Column-1 > len(d.SourceLine) {
+		return nil
+	}
+	gutter := strings.Repeat(" ", len(strconv.Itoa(d.Line)))
+	// copy the tabs in front of the problem so the caret lines up however wide they are shown
+	var marker strings.Builder
+	for _, c := range []byte(d.SourceLine[:d.Column-1]) {
+		if c == '\t' {
+			marker.WriteByte('\t')
+		} else {
+			marker.WriteByte(' ')
+		}
+	}
+	marker.WriteString(strings.Repeat("^", max(d.Width, 1)))
+	return []string{
+		fmt.Sprintf("  %d | %s", d.Line, d.SourceLine),
+		fmt.Sprintf("  %s | %s", gutter, marker.String()),
+	}
+}
+
+/******************************************************************************
+ * JSON writes the diagnostic as one line of JSON for editors and other tools
+ * to read, with the file it came from:
+ *
+ *   {"file":"shapes.lox","line":3,"column":13,"code":"E0202",...}
+ *
+ * The column is 0 when it isn't known, and the trace is left out unless
+ * there is one.
+ *****************************************************************************/
+
+type jsonDiagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Width    int      `json:"width"`
+	Code     Code     `json:"code"`
+	Severity string   `json:"severity"`
+	Where    string   `json:"where,omitempty"`
+	Message  string   `json:"message"`
+	Trace    []string `json:"trace,omitempty"`
+}
+
+func (d Diagnostic) JSON(file string) string {
+	record, _ := json.Marshal(jsonDiagnostic{File: file, Line: d.Line, Column: d.Column, Width: d.Width,
+		Code: d.Code, Severity: strings.ToLower(d.Severity.String()), Where: d.Where, Message: d.Message,
+		Trace: d.Trace})
+	return string(record)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/******************************************************************************
+ * `glox difftest` runs each script on both the tree-walk interpreter and the
+ * bytecode VM and fails if they behave differently, so the two engines can't
+ * quietly drift apart. Directories are searched for .lox files. The scripts
+ * are compared on everything they print, every diagnostic reported on
+ * stderr, and their exit codes. Each run gets its own glox process, so a
+ * crash or a hang in one engine shows up as a difference instead of ending
+ * the whole run.
+ *
+ * Scripts that import modules are skipped since the VM doesn't support
+ * imports, and scripts whose output depends on the clock or on random
+ * numbers will naturally differ.
+ *****************************************************************************/
+
+const difftestTimeout = 10 * time.Second
+
+type engineRun struct {
+	lines    []string // stdout followed by stderr
+	exitCode int
+}
+
+func runDifftest(paths []string) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	scripts, err := findScripts(paths)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	passed, failed, skipped := 0, 0, 0
+	for _, script := range scripts {
+		treeWalker := runEngine(executable, script, false)
+		vm := runEngine(executable, script, true)
+		if vm.importsNotSupported() {
+			skipped++
+			continue
+		}
+		if difference := compareRuns(treeWalker, vm); difference != "" {
+			fmt.Printf("FAIL %s\n%s", script, difference)
+			failed++
+		} else {
+			passed++
+		}
+	}
+	fmt.Printf("%d passed, %d failed, %d skipped\n", passed, failed, skipped)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// findScripts expands directories into the .lox files inside them
+func findScripts(paths []string) ([]string, error) {
+	scripts := make([]string, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			scripts = append(scripts, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(path string, entry os.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() && filepath.Ext(path) == ".lox" {
+				scripts = append(scripts, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return scripts, nil
+}
+
+func runEngine(executable string, script string, useVM bool) engineRun {
+	ctx, cancel := context.WithTimeout(context.Background(), difftestTimeout)
+	defer cancel()
+	args := []string{script}
+	if useVM {
+		args = []string{"--vm", script}
+	}
+	cmd := exec.CommandContext(ctx, executable, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	run := engineRun{lines: append(lines(stdout.String()), lines(stderr.String())...)}
+	var exitErr *exec.ExitError
+	if ctx.Err() != nil {
+		run.lines = append(run.lines, fmt.Sprintf("(still running after %s)", difftestTimeout))
+		run.exitCode = -1
+	} else if errors.As(err, &exitErr) {
+		run.exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		run.lines = append(run.lines, err.Error())
+		run.exitCode = -1
+	}
+	return run
+}
+
+func (run engineRun) importsNotSupported() bool {
+	for _, line := range run.lines {
+		if strings.Contains(line, "Imports are not supported by the bytecode VM.") {
+			return true
+		}
+	}
+	return false
+}
+
+// compareRuns describes the first line the two runs differ on, or returns "" if they match
+func compareRuns(treeWalker engineRun, vm engineRun) string {
+	for i := 0; i < len(treeWalker.lines) || i < len(vm.lines); i++ {
+		expected, actual := "(nothing)", "(nothing)"
+		if i < len(treeWalker.lines) {
+			expected = treeWalker.lines[i]
+		}
+		if i < len(vm.lines) {
+			actual = vm.lines[i]
+		}
+		if expected != actual {
+			return fmt.Sprintf("    line %d of the output\n    tree-walker: %s\n    vm:          %s\n", i+1, expected, actual)
+		}
+	}
+	if treeWalker.exitCode != vm.exitCode {
+		return fmt.Sprintf("    exit code\n    tree-walker: %d\n    vm:          %d\n", treeWalker.exitCode, vm.exitCode)
+	}
+	return ""
+}
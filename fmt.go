@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * `glox fmt` prints each script in the standard layout, see lang/format.go.
+ * With -w the scripts are rewritten in place instead, and only the ones
+ * whose layout changed are touched. A script with errors is reported and
+ * left alone, and the rest are still formatted.
+ *****************************************************************************/
+
+func runFmt(args []string) {
+	write := len(args) > 0 && args[0] == "-w"
+	paths := args
+	if write {
+		paths = args[1:]
+	}
+	if len(paths) == 0 {
+		flag.Usage()
+		os.Exit(64)
+	}
+	exitCode := 0
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		errorHandler := lang.NewErrorHandler()
+		errorHandler.File = path
+		formatted, err := lang.Format(string(content), errorHandler)
+		if err != nil {
+			if !errorHandler.HadError {
+				fmt.Printf("%s: %s\n", path, err)
+			}
+			exitCode = 65
+			continue
+		}
+		if !write {
+			fmt.Print(formatted)
+		} else if formatted != string(content) {
+			info, err := os.Stat(path)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+			if err := os.WriteFile(path, []byte(formatted), info.Mode().Perm()); err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+		}
+	}
+	os.Exit(exitCode)
+}
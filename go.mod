@@ -1,3 +1,3 @@
 module github.com/skusel/glox
 
-go 1.21.2
+go 1.24
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * The REPL's :inspect command parses an expression and lets you walk the
+ * tree the parser built for it, one node at a time. Each node lists its
+ * children by number. Enter a number to move down to that child, ".." to move
+ * back up, "tree" to print everything below the current node, and "q" to
+ * return to the REPL.
+ *****************************************************************************/
+
+const inspectHelp = `Commands:
+  <number>  go to a child
+  ..        go to the parent
+  tree      print the tree below this node
+  q         return to the REPL`
+
+func runInspect(source string, reader *bufio.Reader) {
+	errorHandler := lang.NewErrorHandler()
+	root := lang.InspectExpression(source, errorHandler)
+	if root == nil {
+		return
+	}
+
+	fmt.Println(inspectHelp)
+	path := []*lang.InspectNode{root}
+	for {
+		printInspectNode(path)
+		fmt.Print("inspect> ")
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Println()
+			return
+		}
+		command := strings.TrimSpace(line)
+		current := path[len(path)-1]
+		switch command {
+		case "..":
+			if len(path) > 1 {
+				path = path[:len(path)-1]
+			} else {
+				fmt.Println("Already at the root.")
+			}
+		case "tree":
+			printInspectTree(current, "")
+		case "q":
+			return
+		default:
+			child, err := strconv.Atoi(command)
+			if err != nil || child < 0 || child >= len(current.Children) {
+				fmt.Println(inspectHelp)
+			} else {
+				path = append(path, current.Children[child])
+			}
+		}
+	}
+}
+
+func printInspectNode(path []*lang.InspectNode) {
+	node := path[len(path)-1]
+	fields := make([]string, 0, len(path))
+	for _, ancestor := range path[1:] {
+		fields = append(fields, ancestor.Field)
+	}
+	fmt.Printf("\n/%s\n", strings.Join(fields, "/"))
+	fmt.Printf("%s  [%s]\n", node, node.Span)
+	for i, child := range node.Children {
+		fmt.Printf("  %d  %s\n", i, child)
+	}
+}
+
+func printInspectTree(node *lang.InspectNode, indent string) {
+	fmt.Println(indent + node.String())
+	for _, child := range node.Children {
+		printInspectTree(child, indent+"  ")
+	}
+}
@@ -0,0 +1,100 @@
+package lang
+
+import (
+	"errors"
+	"math"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The arithmetic and comparison operators, shared by both execution engines
+ * so they agree on how integers and floats mix. Two integers give an integer
+ * for +, -, *, and %, or a float if the result doesn't fit in 64 bits. If
+ * either operand is a float, both are treated as floats. Division always
+ * gives a float. See runtime/number.go.
+ *****************************************************************************/
+
+func arithmetic(operator string, left runtime.Value, right runtime.Value) (runtime.Value, diag.Code, error) {
+	if operator == "+" {
+		if leftString, rightString, bothStrings := stringOperands(left, right); bothStrings {
+			return leftString + rightString, "", nil
+		}
+		if !runtime.IsNumber(left) || !runtime.IsNumber(right) {
+			err := errors.New("Operands must be numbers or strings and be the same type when using the '+' operator.")
+			return nil, diag.InvalidOperands, err
+		}
+	}
+	if !runtime.IsNumber(left) || !runtime.IsNumber(right) {
+		return nil, diag.OperandMustBeNumber, errors.New("Operands must be numbers when using the '" + operator + "' operator.")
+	}
+
+	leftInteger, leftIsInteger := left.(int64)
+	rightInteger, rightIsInteger := right.(int64)
+	if leftIsInteger && rightIsInteger && operator != "/" && !(operator == "%" && rightInteger == 0) {
+		switch operator {
+		case ">":
+			return leftInteger > rightInteger, "", nil
+		case ">=":
+			return leftInteger >= rightInteger, "", nil
+		case "<":
+			return leftInteger < rightInteger, "", nil
+		case "<=":
+			return leftInteger <= rightInteger, "", nil
+		case "+":
+			return runtime.AddIntegers(leftInteger, rightInteger), "", nil
+		case "-":
+			return runtime.SubtractIntegers(leftInteger, rightInteger), "", nil
+		case "*":
+			return runtime.MultiplyIntegers(leftInteger, rightInteger), "", nil
+		case "%":
+			return leftInteger % rightInteger, "", nil
+		}
+	}
+
+	leftFloat, _ := runtime.ToFloat(left)
+	rightFloat, _ := runtime.ToFloat(right)
+	switch operator {
+	case ">":
+		return leftFloat > rightFloat, "", nil
+	case ">=":
+		return leftFloat >= rightFloat, "", nil
+	case "<":
+		return leftFloat < rightFloat, "", nil
+	case "<=":
+		return leftFloat <= rightFloat, "", nil
+	case "+":
+		return leftFloat + rightFloat, "", nil
+	case "-":
+		return leftFloat - rightFloat, "", nil
+	case "*":
+		return leftFloat * rightFloat, "", nil
+	case "/":
+		return leftFloat / rightFloat, "", nil
+	}
+	// using math.Mod instead of '%' to handle floating point numbers correctly
+	return math.Mod(leftFloat, rightFloat), "", nil
+}
+
+func negate(value runtime.Value) (runtime.Value, diag.Code, error) {
+	switch number := value.(type) {
+	case int64:
+		if number == math.MinInt64 {
+			return -float64(number), "", nil
+		}
+		if number == 0 {
+			return runtime.NegativeZero, "", nil
+		}
+		return -number, "", nil
+	case float64:
+		return -number, "", nil
+	}
+	return nil, diag.OperandMustBeNumber, errors.New("Operand must be a number.")
+}
+
+func stringOperands(left, right runtime.Value) (string, string, bool) {
+	leftString, leftIsString := left.(string)
+	rightString, rightIsString := right.(string)
+	return leftString, rightString, leftIsString && rightIsString
+}
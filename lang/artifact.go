@@ -0,0 +1,136 @@
+package lang
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"sort"
+)
+
+/******************************************************************************
+ * A module artifact (a .loxc file) holds a module's parsed AST so importing
+ * it can skip scanning and parsing. Artifacts sit next to the module's
+ * source and are written by `glox compile`. Each one records a hash of the
+ * source it was compiled from. An import only uses the artifact if the hash
+ * still matches, otherwise the source has changed since it was compiled and
+ * it is parsed as usual. A .loxc file without its .lox source is used as is.
+ *
+ * An artifact starts with "loxc", its format's version, and the source's
+ * SHA-256 hash. The glox-lint disable comments come next, since the
+ * resolver's warnings are redone from the artifact and the comments are
+ * gone along with the source, as a count of lines followed by each line
+ * number and the codes and rule names disabled on it. Then comes the AST in
+ * the binary encoding from astbinary.go, which is smaller than the source
+ * and quicker to load than parsing it. Resolution isn't stored, it is cheap
+ * and always redone when the module is loaded.
+ *****************************************************************************/
+
+const (
+	ArtifactExtension = ".loxc"
+	artifactMagic     = "loxc"
+	artifactVersion   = 4
+)
+
+/******************************************************************************
+ * CompileArtifact parses source and returns the contents of its .loxc file.
+ * Static errors are reported through the error handler, in which case no
+ * artifact is produced.
+ *****************************************************************************/
+
+func CompileArtifact(source string, errorHandler *ErrorHandler) ([]byte, error) {
+	scanner := NewScanner(source, errorHandler)
+	statements := NewParser(scanner.ScanTokens(), errorHandler).Parse()
+	if errorHandler.HadError || resolveProgram(statements, scanner.Directives(), errorHandler) == nil {
+		return nil, errors.New("source has errors")
+	}
+	ast, err := encodeBinaryAST(statements)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(source))
+	data := append([]byte(artifactMagic), artifactVersion)
+	data = append(data, hash[:]...)
+	data = encodeDisabled(data, scanner.Directives())
+	return append(data, ast...), nil
+}
+
+// loadArtifact returns the statements and lint directives in a module's artifact, if it has a usable one
+func loadArtifact(path string, source string, hasSource bool) ([]Stmt, *Directives, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	header := len(artifactMagic) + 1 + sha256.Size
+	if len(data) < header || string(data[:len(artifactMagic)]) != artifactMagic ||
+		data[len(artifactMagic)] != artifactVersion {
+		return nil, nil, false
+	}
+	if hasSource {
+		hash := sha256.Sum256([]byte(source))
+		if !bytes.Equal(data[len(artifactMagic)+1:header], hash[:]) {
+			return nil, nil, false
+		}
+	}
+	directives, size, ok := decodeDisabled(data[header:])
+	if !ok {
+		return nil, nil, false
+	}
+	statements, err := decodeBinaryAST(data[header+size:], source)
+	if err != nil {
+		return nil, nil, false
+	}
+	return statements, directives, true
+}
+
+// encodeDisabled appends the codes and rule names glox-lint comments disable, line by line
+func encodeDisabled(data []byte, directives *Directives) []byte {
+	lines := make([]int, 0, len(directives.disabled))
+	for line := range directives.disabled {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	data = binary.AppendUvarint(data, uint64(len(lines)))
+	for _, line := range lines {
+		data = binary.AppendUvarint(data, uint64(line))
+		data = binary.AppendUvarint(data, uint64(len(directives.disabled[line])))
+		for _, name := range directives.disabled[line] {
+			data = binary.AppendUvarint(data, uint64(len(name)))
+			data = append(data, name...)
+		}
+	}
+	return data
+}
+
+// decodeDisabled reads what encodeDisabled wrote and returns the directives and the number of bytes they took
+func decodeDisabled(data []byte) (*Directives, int, bool) {
+	directives := newDirectives()
+	offset := 0
+	next := func() (int, bool) {
+		n, size := binary.Uvarint(data[offset:])
+		if size <= 0 || n > math.MaxInt32 {
+			return 0, false
+		}
+		offset += size
+		return int(n), true
+	}
+	lines, ok := next()
+	for i := 0; ok && i < lines; i++ {
+		var line, count int
+		if line, ok = next(); ok {
+			count, ok = next()
+		}
+		for j := 0; ok && j < count; j++ {
+			var length int
+			if length, ok = next(); ok && length <= len(data)-offset {
+				directives.disabled[line] = append(directives.disabled[line], string(data[offset:offset+length]))
+				offset += length
+			} else {
+				ok = false
+			}
+		}
+	}
+	return directives, offset, ok
+}
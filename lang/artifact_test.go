@@ -0,0 +1,147 @@
+package lang
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// largeModule returns the source of a module about size bytes long, using every kind of node
+func largeModule(size int) string {
+	var source strings.Builder
+	for i := 0; source.Len() < size; i++ {
+		fmt.Fprintf(&source, `fun f%d(a, b, ...rest) {
+  var total = 0;
+  for (var j = 0; j < a; j = j + 1) {
+    if (j %% 2 == 0 and b != nil) total = total + j * b; else total = total - len("s%d");
+    while (a < 0) { break; }
+  }
+  var m = {"k": [a, -b, !true, 1.5, 12345678901]};
+  m["k"][0] = j ? 1 : 2;
+  return fun () { return total; };
+}
+trait T%d { describe() { return "t"; } }
+class C%d < Object with T%d {
+  init(x) { this.x = x; }
+  get() { return this.x + super.get() + %d; }
+}
+`, i, i, i, i, i, i)
+	}
+	return source.String()
+}
+
+func TestArtifactRoundTrip(t *testing.T) {
+	source := largeModule(10_000)
+	program := NewFrontEnd(NewErrorHandler()).Analyze(source)
+	if program == nil {
+		t.Fatal("the module has static errors")
+	}
+	compiled, err := CompileArtifact(source, NewErrorHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compiled) > 4*len(source) {
+		t.Errorf("the artifact is %d bytes for %d bytes of source", len(compiled), len(source))
+	}
+	path := filepath.Join(t.TempDir(), "module.loxc")
+	if err := os.WriteFile(path, compiled, 0644); err != nil {
+		t.Fatal(err)
+	}
+	statements, _, loaded := loadArtifact(path, source, true)
+	if !loaded {
+		t.Fatal("the artifact wasn't loaded")
+	}
+	parsed, _ := EncodeAST(program.Statements)
+	decoded, _ := EncodeAST(statements)
+	if !bytes.Equal(parsed, decoded) {
+		t.Error("the artifact's AST differs from the parsed one")
+	}
+	if statements[0].Span().source != source {
+		t.Error("spans decoded along with their source don't point into it")
+	}
+
+	if _, _, loaded := loadArtifact(path, source+"\n", true); loaded {
+		t.Error("an artifact was used for source that has changed")
+	}
+	if _, _, loaded := loadArtifact(path, "", false); !loaded {
+		t.Error("an artifact without its source wasn't loaded")
+	}
+	for _, size := range []int{0, 10, len(compiled) / 2, len(compiled) - 1} {
+		if err := os.WriteFile(path, compiled[:size], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, loaded := loadArtifact(path, source, true); loaded {
+			t.Errorf("an artifact cut off after %d bytes was loaded", size)
+		}
+	}
+}
+
+/******************************************************************************
+ * Loading a module from its artifact has to beat parsing its source, or the
+ * artifact isn't worth having. Compare:
+ *
+ *   go test ./lang -run '^$' -bench LoadModule
+ *****************************************************************************/
+
+func BenchmarkLoadModuleFromSource(b *testing.B) {
+	benchmarkLoadModule(b, false)
+}
+
+func BenchmarkLoadModuleFromArtifact(b *testing.B) {
+	benchmarkLoadModule(b, true)
+}
+
+func benchmarkLoadModule(b *testing.B, compiled bool) {
+	source := largeModule(1_000_000)
+	dir := b.TempDir()
+	path := filepath.Join(dir, "module.lox")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		b.Fatal(err)
+	}
+	if compiled {
+		artifact, err := CompileArtifact(source, NewErrorHandler())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "module.loxc"), artifact, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(len(source)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := loadModule(path, NewErrorHandler()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestArtifactDirectives checks that glox-lint comments still silence warnings in a module loaded from its artifact
+func TestArtifactDirectives(t *testing.T) {
+	source := "fun f() {\n  var unused = 1; // glox-lint disable:W0208\n}\n"
+	compiled, err := CompileArtifact(source, NewErrorHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	withSource := filepath.Join(dir, "module.lox")
+	alone := filepath.Join(dir, "alone.loxc")
+	for path, content := range map[string][]byte{withSource: []byte(source), withSource + "c": compiled, alone: compiled} {
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{withSource, alone} {
+		errorHandler := &ErrorHandler{Output: io.Discard}
+		if _, err := loadModule(path, errorHandler); err != nil {
+			t.Fatal(err)
+		}
+		if len(errorHandler.Diagnostics) > 0 {
+			t.Errorf("loading %s reported %v", filepath.Base(path), errorHandler.Diagnostics)
+		}
+	}
+}
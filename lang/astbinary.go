@@ -0,0 +1,413 @@
+package lang
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+/******************************************************************************
+ * A compact binary encoding of a parsed program, for module artifacts. The
+ * JSON encoding in astjson.go is the one to read, this one is meant to be
+ * small and quick to decode, and decoding it is quicker than scanning and
+ * parsing the source again (see BenchmarkLoadArtifact).
+ *
+ * Numbers are written as varints. A node is written as its kind followed by
+ * its span and then its fields, see astbinarynodes.go, which is generated by
+ * tool/generateast. A position is written as the difference from the one
+ * written before it, so the positions of neighbouring nodes take a byte or
+ * two. Each distinct string, a lexeme or a string literal, is written once
+ * in a table ahead of the nodes, and tokens refer to it by its index.
+ *
+ * As with the JSON encoding, expression IDs aren't part of it, the decoder
+ * assigns fresh ones as it rebuilds the tree.
+ *****************************************************************************/
+
+// the kinds of literal value
+const (
+	binaryNil byte = iota
+	binaryFalse
+	binaryTrue
+	binaryString
+	binaryInteger
+	binaryFloat
+)
+
+func encodeBinaryAST(statements []Stmt) ([]byte, error) {
+	e := &binaryEncoder{indexes: make(map[string]uint64)}
+	e.stmts(statements)
+	if e.err != nil {
+		return nil, e.err
+	}
+	data := binary.AppendUvarint(nil, uint64(len(e.strings)))
+	for _, s := range e.strings {
+		data = binary.AppendUvarint(data, uint64(len(s)))
+		data = append(data, s...)
+	}
+	return append(data, e.body...), nil
+}
+
+/******************************************************************************
+ * decodeBinaryAST decodes the statements encodeBinaryAST wrote. If the
+ * source they were parsed from is known, the decoded spans point into it,
+ * so diagnostics can show the lines they are about.
+ *****************************************************************************/
+
+func decodeBinaryAST(data []byte, source string) ([]Stmt, error) {
+	d := &binaryDecoder{data: data, source: source}
+	count := d.count()
+	d.strings = make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		length := d.count()
+		if d.err != nil {
+			break
+		}
+		d.strings = append(d.strings, string(d.data[d.offset:d.offset+length]))
+		d.offset += length
+	}
+	statements := d.stmts()
+	if d.err == nil && d.offset != len(d.data) {
+		d.fail(errors.New("unexpected data after the program"))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return statements, nil
+}
+
+type binaryEncoder struct {
+	body    []byte
+	strings []string
+	indexes map[string]uint64 // index of each string in strings
+	last    Position
+	err     error
+}
+
+func (e *binaryEncoder) uint(n uint64) {
+	e.body = binary.AppendUvarint(e.body, n)
+}
+
+func (e *binaryEncoder) int(n int) {
+	e.body = binary.AppendVarint(e.body, int64(n))
+}
+
+func (e *binaryEncoder) kind(kind uint64) {
+	e.uint(kind)
+}
+
+func (e *binaryEncoder) string(s string) {
+	index, found := e.indexes[s]
+	if !found {
+		index = uint64(len(e.strings))
+		e.indexes[s] = index
+		e.strings = append(e.strings, s)
+	}
+	e.uint(index)
+}
+
+func (e *binaryEncoder) position(p Position) {
+	e.int(p.Offset - e.last.Offset)
+	e.int(p.Line - e.last.Line)
+	e.int(p.Column - e.last.Column)
+	e.last = p
+}
+
+func (e *binaryEncoder) span(s Span) {
+	e.position(s.Start)
+	e.position(s.End)
+}
+
+func (e *binaryEncoder) token(t Token) {
+	e.uint(uint64(t.tokenType))
+	e.string(t.lexeme)
+	e.literal(t.literal)
+	e.span(t.span)
+	e.int(t.line - t.span.Start.Line)
+}
+
+func (e *binaryEncoder) tokens(tokens []Token) {
+	e.uint(uint64(len(tokens)))
+	for _, t := range tokens {
+		e.token(t)
+	}
+}
+
+func (e *binaryEncoder) expr(expr Expr) {
+	if expr == nil {
+		e.kind(0)
+		return
+	}
+	acceptExpr(expr, e)
+}
+
+func (e *binaryEncoder) exprs(exprs []Expr) {
+	e.uint(uint64(len(exprs)))
+	for _, expr := range exprs {
+		e.expr(expr)
+	}
+}
+
+func (e *binaryEncoder) stmt(stmt Stmt) {
+	if stmt == nil {
+		e.kind(0)
+		return
+	}
+	acceptStmt(stmt, e)
+}
+
+func (e *binaryEncoder) stmts(statements []Stmt) {
+	e.uint(uint64(len(statements)))
+	for _, stmt := range statements {
+		e.stmt(stmt)
+	}
+}
+
+func (e *binaryEncoder) variable(v VariableExpr) {
+	if v.getId() == 0 { // an uninitialized VariableExpr (e.g. no superclass)
+		e.kind(0)
+		return
+	}
+	e.visitVariableExpr(v)
+}
+
+func (e *binaryEncoder) functions(functions []FunctionStmt) {
+	e.uint(uint64(len(functions)))
+	for _, function := range functions {
+		e.visitFunctionStmt(function)
+	}
+}
+
+func (e *binaryEncoder) flag(b bool) {
+	if b {
+		e.body = append(e.body, 1)
+	} else {
+		e.body = append(e.body, 0)
+	}
+}
+
+func (e *binaryEncoder) literal(value any) {
+	switch value := value.(type) {
+	case nil:
+		e.body = append(e.body, binaryNil)
+	case bool:
+		if value {
+			e.body = append(e.body, binaryTrue)
+		} else {
+			e.body = append(e.body, binaryFalse)
+		}
+	case string:
+		e.body = append(e.body, binaryString)
+		e.string(value)
+	case int64:
+		e.body = append(e.body, binaryInteger)
+		e.body = binary.AppendVarint(e.body, value)
+	case float64:
+		e.body = append(e.body, binaryFloat)
+		e.body = binary.LittleEndian.AppendUint64(e.body, math.Float64bits(value))
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("can't encode a literal of type %T", value)
+		}
+	}
+}
+
+type binaryDecoder struct {
+	data       []byte
+	offset     int
+	strings    []string
+	source     string
+	last       Position
+	nextExprId int
+	err        error
+}
+
+func (d *binaryDecoder) nextId() int {
+	d.nextExprId++
+	return d.nextExprId
+}
+
+func (d *binaryDecoder) fail(err error) {
+	// only the first error is reported, and decoding stops at it
+	if d.err == nil {
+		d.err = err
+		d.offset = len(d.data)
+	}
+}
+
+func (d *binaryDecoder) uint() uint64 {
+	n, size := binary.Uvarint(d.data[d.offset:])
+	if size <= 0 {
+		d.fail(errors.New("truncated or malformed number"))
+		return 0
+	}
+	d.offset += size
+	return n
+}
+
+func (d *binaryDecoder) int() int {
+	n, size := binary.Varint(d.data[d.offset:])
+	if size <= 0 {
+		d.fail(errors.New("truncated or malformed number"))
+		return 0
+	}
+	d.offset += size
+	return int(n)
+}
+
+func (d *binaryDecoder) byte() byte {
+	if d.offset >= len(d.data) {
+		d.fail(errors.New("truncated data"))
+		return 0
+	}
+	b := d.data[d.offset]
+	d.offset++
+	return b
+}
+
+// count reads the length of a list, which can't be longer than the data left, since every element takes a byte
+func (d *binaryDecoder) count() int {
+	n := d.uint()
+	if n > uint64(len(d.data)-d.offset) {
+		d.fail(errors.New("list is longer than the data"))
+		return 0
+	}
+	return int(n)
+}
+
+func (d *binaryDecoder) string() string {
+	index := d.uint()
+	if index >= uint64(len(d.strings)) {
+		d.fail(fmt.Errorf("unknown string %d", index))
+		return ""
+	}
+	return d.strings[index]
+}
+
+func (d *binaryDecoder) position() Position {
+	d.last = Position{Offset: d.last.Offset + d.int(), Line: d.last.Line + d.int(), Column: d.last.Column + d.int()}
+	return d.last
+}
+
+func (d *binaryDecoder) span() Span {
+	start := d.position()
+	end := d.position()
+	span := Span{Start: start, End: end}
+	if d.source != "" && 0 <= start.Offset && start.Offset <= end.Offset && end.Offset <= len(d.source) {
+		span.source = d.source
+	}
+	return span
+}
+
+func (d *binaryDecoder) token() Token {
+	t := Token{tokenType: TokenType(d.uint()), lexeme: d.string(), literal: d.literal(), span: d.span()}
+	t.line = t.span.Start.Line + d.int()
+	if int(t.tokenType) >= len(tokenTypeNames) {
+		d.fail(fmt.Errorf("unknown token type %d", t.tokenType))
+	}
+	return t
+}
+
+func (d *binaryDecoder) tokens() []Token {
+	count := d.count()
+	tokens := make([]Token, 0, count)
+	for i := 0; i < count; i++ {
+		tokens = append(tokens, d.token())
+	}
+	return tokens
+}
+
+func (d *binaryDecoder) expr() Expr {
+	kind := d.uint()
+	if kind == 0 || d.err != nil {
+		return nil
+	}
+	return d.decodeExpr(kind)
+}
+
+func (d *binaryDecoder) exprs() []Expr {
+	count := d.count()
+	exprs := make([]Expr, 0, count)
+	for i := 0; i < count; i++ {
+		exprs = append(exprs, d.expr())
+	}
+	return exprs
+}
+
+func (d *binaryDecoder) stmt() Stmt {
+	kind := d.uint()
+	if kind == 0 || d.err != nil {
+		return nil
+	}
+	return d.decodeStmt(kind)
+}
+
+func (d *binaryDecoder) stmts() []Stmt {
+	count := d.count()
+	statements := make([]Stmt, 0, count)
+	for i := 0; i < count; i++ {
+		statements = append(statements, d.stmt())
+	}
+	return statements
+}
+
+func (d *binaryDecoder) variable() VariableExpr {
+	expr := d.expr()
+	if expr == nil {
+		return VariableExpr{}
+	}
+	variable, isVariable := expr.(VariableExpr)
+	if !isVariable {
+		d.fail(errors.New("expected a VariableExpr"))
+	}
+	return variable
+}
+
+func (d *binaryDecoder) functions() []FunctionStmt {
+	count := d.count()
+	functions := make([]FunctionStmt, 0, count)
+	for i := 0; i < count; i++ {
+		function, isFunction := d.stmt().(FunctionStmt)
+		if !isFunction {
+			d.fail(errors.New("expected a FunctionStmt"))
+		}
+		functions = append(functions, function)
+	}
+	return functions
+}
+
+func (d *binaryDecoder) flag() bool {
+	return d.byte() != 0
+}
+
+func (d *binaryDecoder) literal() any {
+	switch kind := d.byte(); kind {
+	case binaryNil:
+		return nil
+	case binaryFalse:
+		return false
+	case binaryTrue:
+		return true
+	case binaryString:
+		return d.string()
+	case binaryInteger:
+		n, size := binary.Varint(d.data[d.offset:])
+		if size <= 0 {
+			d.fail(errors.New("truncated or malformed number"))
+			return nil
+		}
+		d.offset += size
+		return n
+	case binaryFloat:
+		if len(d.data)-d.offset < 8 {
+			d.fail(errors.New("truncated data"))
+			return nil
+		}
+		bits := binary.LittleEndian.Uint64(d.data[d.offset:])
+		d.offset += 8
+		return math.Float64frombits(bits)
+	default:
+		d.fail(fmt.Errorf("unknown literal kind %d", kind))
+		return nil
+	}
+}
@@ -0,0 +1,340 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/******************************************************************************
+ * Converts a parsed program to and from JSON. This lets external tools
+ * inspect or transform a program and hand the result back to the resolver
+ * and interpreter.
+ *
+ * Every node is encoded as an object whose "type" member names the node
+ * (e.g. "BinaryExpr") and whose remaining members are the node's fields.
+ * Nodes and tokens both carry a "span" member holding their source location.
+ * Tokens are encoded as objects with "type", "lexeme", "literal", "line", and
+ * "span" members. Missing expressions and statements are encoded as null.
+ * Float literals are always written with a decimal point or an exponent, so
+ * they stay floats when decoded. Numbers without one decode as integers.
+ *
+ * Expression IDs are not part of the encoding. They only need to be unique
+ * within a program, so the decoder assigns fresh IDs as it rebuilds the tree.
+ *
+ * The per-node code lives in astjsonnodes.go, which is generated by
+ * tool/generateast alongside the node definitions.
+ *****************************************************************************/
+
+func EncodeAST(statements []Stmt) ([]byte, error) {
+	return json.MarshalIndent(astEncoder{}.stmts(statements), "", "  ")
+}
+
+func DecodeAST(data []byte) ([]Stmt, error) {
+	statements, _, err := decodeAST(data, 0)
+	return statements, err
+}
+
+/******************************************************************************
+ * AnalyzeAST is Analyze for a program that was parsed earlier and saved
+ * with EncodeAST. It resolves the decoded tree without scanning or parsing
+ * anything. The error is set if the JSON isn't a valid tree, and like
+ * Analyze it returns a nil program if the resolver found a static error.
+ *****************************************************************************/
+
+func (f *FrontEnd) AnalyzeAST(data []byte) (*Program, error) {
+	statements, lastExprId, err := decodeAST(data, f.nextExprId)
+	if err != nil {
+		return nil, err
+	}
+	f.nextExprId = lastExprId
+	return resolveProgram(statements, nil, f.errorHandler), nil
+}
+
+// decodeAST decodes statements, numbering their expressions after lastExprId, and returns the last ID it used
+func decodeAST(data []byte, lastExprId int) ([]Stmt, int, error) {
+	decoder := &astDecoder{nextExprId: lastExprId}
+	var raw json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	statements := decoder.stmts(raw)
+	if decoder.err != nil {
+		return nil, 0, decoder.err
+	}
+	return statements, decoder.nextExprId, nil
+}
+
+type astEncoder struct{}
+
+type jsonToken struct {
+	Type    string `json:"type"`
+	Lexeme  string `json:"lexeme"`
+	Literal any    `json:"literal"`
+	Line    int    `json:"line"`
+	Span    Span   `json:"span"`
+}
+
+func (e astEncoder) token(t Token) jsonToken {
+	return jsonToken{Type: t.tokenType.String(), Lexeme: t.lexeme, Literal: e.literal(t.literal), Line: t.line,
+		Span: t.span}
+}
+
+func (e astEncoder) tokens(tokens []Token) []jsonToken {
+	encoded := make([]jsonToken, 0, len(tokens))
+	for _, t := range tokens {
+		encoded = append(encoded, e.token(t))
+	}
+	return encoded
+}
+
+func (e astEncoder) expr(expr Expr) any {
+	if expr == nil {
+		return nil
+	}
+	return acceptExpr(expr, e)
+}
+
+func (e astEncoder) exprs(exprs []Expr) []any {
+	encoded := make([]any, 0, len(exprs))
+	for _, expr := range exprs {
+		encoded = append(encoded, e.expr(expr))
+	}
+	return encoded
+}
+
+func (e astEncoder) stmt(stmt Stmt) any {
+	if stmt == nil {
+		return nil
+	}
+	return acceptStmt(stmt, e)
+}
+
+func (e astEncoder) stmts(statements []Stmt) []any {
+	encoded := make([]any, 0, len(statements))
+	for _, stmt := range statements {
+		encoded = append(encoded, e.stmt(stmt))
+	}
+	return encoded
+}
+
+func (e astEncoder) variable(v VariableExpr) any {
+	if v.getId() == 0 { // an uninitialized VariableExpr (e.g. no superclass)
+		return nil
+	}
+	return e.visitVariableExpr(v)
+}
+
+func (e astEncoder) functions(functions []FunctionStmt) []any {
+	encoded := make([]any, 0, len(functions))
+	for _, function := range functions {
+		encoded = append(encoded, e.visitFunctionStmt(function))
+	}
+	return encoded
+}
+
+func (e astEncoder) flag(b bool) bool {
+	return b
+}
+
+func (e astEncoder) literal(value any) any {
+	if number, isFloat := value.(float64); isFloat {
+		text := strconv.FormatFloat(number, 'g', -1, 64)
+		if !strings.ContainsAny(text, ".eIN") { // Inf and NaN have no JSON form, let the encoder reject them
+			text += ".0"
+		}
+		return json.Number(text)
+	}
+	return value
+}
+
+type astDecoder struct {
+	nextExprId int
+	err        error
+}
+
+func (d *astDecoder) nextId() int {
+	d.nextExprId++
+	return d.nextExprId
+}
+
+func (d *astDecoder) fail(err error) {
+	// only the first error is reported, the rest are usually consequences of it
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *astDecoder) unmarshal(raw json.RawMessage, v any) bool {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	err := decoder.Decode(v)
+	if err != nil {
+		d.fail(err)
+		return false
+	}
+	return true
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
+
+func (d *astDecoder) node(raw json.RawMessage) (string, map[string]json.RawMessage) {
+	var fields map[string]json.RawMessage
+	if !d.unmarshal(raw, &fields) {
+		return "", nil
+	}
+	var nodeType string
+	if !d.unmarshal(fields["type"], &nodeType) {
+		return "", nil
+	}
+	return nodeType, fields
+}
+
+func (d *astDecoder) token(raw json.RawMessage) Token {
+	var t jsonToken
+	if !d.unmarshal(raw, &t) {
+		return Token{}
+	}
+	for tokenType, name := range tokenTypeNames {
+		if name == t.Type {
+			return Token{tokenType: TokenType(tokenType), lexeme: t.Lexeme, literal: d.number(t.Literal), line: t.Line,
+				span: t.Span}
+		}
+	}
+	d.fail(fmt.Errorf("unknown token type %q", t.Type))
+	return Token{}
+}
+
+func (d *astDecoder) span(raw json.RawMessage) Span {
+	var span Span
+	if !isJSONNull(raw) {
+		d.unmarshal(raw, &span)
+	}
+	return span
+}
+
+func (d *astDecoder) tokens(raw json.RawMessage) []Token {
+	var elements []json.RawMessage
+	if !d.unmarshal(raw, &elements) {
+		return nil
+	}
+	tokens := make([]Token, 0, len(elements))
+	for _, element := range elements {
+		tokens = append(tokens, d.token(element))
+	}
+	return tokens
+}
+
+func (d *astDecoder) expr(raw json.RawMessage) Expr {
+	if isJSONNull(raw) {
+		return nil
+	}
+	nodeType, fields := d.node(raw)
+	if fields == nil {
+		return nil
+	}
+	return d.decodeExpr(nodeType, fields)
+}
+
+func (d *astDecoder) exprs(raw json.RawMessage) []Expr {
+	var elements []json.RawMessage
+	if !d.unmarshal(raw, &elements) {
+		return nil
+	}
+	exprs := make([]Expr, 0, len(elements))
+	for _, element := range elements {
+		exprs = append(exprs, d.expr(element))
+	}
+	return exprs
+}
+
+func (d *astDecoder) stmt(raw json.RawMessage) Stmt {
+	if isJSONNull(raw) {
+		return nil
+	}
+	nodeType, fields := d.node(raw)
+	if fields == nil {
+		return nil
+	}
+	return d.decodeStmt(nodeType, fields)
+}
+
+func (d *astDecoder) stmts(raw json.RawMessage) []Stmt {
+	var elements []json.RawMessage
+	if !d.unmarshal(raw, &elements) {
+		return nil
+	}
+	statements := make([]Stmt, 0, len(elements))
+	for _, element := range elements {
+		statements = append(statements, d.stmt(element))
+	}
+	return statements
+}
+
+func (d *astDecoder) variable(raw json.RawMessage) VariableExpr {
+	if isJSONNull(raw) {
+		return VariableExpr{}
+	}
+	variable, isVariable := d.expr(raw).(VariableExpr)
+	if !isVariable {
+		d.fail(errors.New("expected a VariableExpr"))
+	}
+	return variable
+}
+
+func (d *astDecoder) functions(raw json.RawMessage) []FunctionStmt {
+	var elements []json.RawMessage
+	if !d.unmarshal(raw, &elements) {
+		return nil
+	}
+	functions := make([]FunctionStmt, 0, len(elements))
+	for _, element := range elements {
+		function, isFunction := d.stmt(element).(FunctionStmt)
+		if !isFunction {
+			d.fail(errors.New("expected a FunctionStmt"))
+		}
+		functions = append(functions, function)
+	}
+	return functions
+}
+
+// flag decodes a bool field, which is false when it is missing
+func (d *astDecoder) flag(raw json.RawMessage) bool {
+	var b bool
+	if !isJSONNull(raw) {
+		d.unmarshal(raw, &b)
+	}
+	return b
+}
+
+func (d *astDecoder) literal(raw json.RawMessage) any {
+	var value any
+	if isJSONNull(raw) || !d.unmarshal(raw, &value) {
+		return nil
+	}
+	return d.number(value)
+}
+
+// number turns a decoded JSON number into an integer or a float, leaving other values alone
+func (d *astDecoder) number(value any) any {
+	number, isNumber := value.(json.Number)
+	if !isNumber {
+		return value
+	}
+	if !strings.ContainsAny(string(number), ".eE") {
+		if integer, err := number.Int64(); err == nil {
+			return integer
+		}
+	}
+	float, err := number.Float64()
+	if err != nil {
+		d.fail(err)
+	}
+	return float
+}
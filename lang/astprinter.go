@@ -1,75 +1,273 @@
 package lang
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 /******************************************************************************
- * Helper struct to display the AST and expression operation precendence in
- * the earlier stages of development.
+ * Helper struct to display the AST and expression operation precendence.
+ * Every node is printed as a parenthesized form, its kind followed by its
+ * parts, so the tree's shape can be read straight off the output:
+ *
+ *   (fun area ()
+ *     (return (* (. this width) (. this height))))
+ *
+ * Expressions are printed on one line. Statements nested in another
+ * statement, like the body of a function or the branches of an if, each
+ * start a line of their own, indented one level further than their parent.
  *****************************************************************************/
 
-type AstPrinter struct{}
+type AstPrinter struct {
+	depth int // how many statements the one being printed is nested in
+}
 
 func (printer AstPrinter) Print(expr Expr) string {
-	return expr.accept(printer).(string)
+	return acceptExpr(expr, printer)
 }
 
-func (printer AstPrinter) visitAssignExpr(expr AssignExpr) any {
-	panic("AstPrinter is not able to print assignment expressions at this time.")
+// PrintProgram prints each top level statement, one after another
+func (printer AstPrinter) PrintProgram(statements []Stmt) string {
+	printed := make([]string, len(statements))
+	for i, stmt := range statements {
+		printed[i] = acceptStmt(stmt, printer)
+	}
+	return strings.Join(printed, "\n")
 }
 
-func (printer AstPrinter) visitBinaryExpr(expr BinaryExpr) any {
+func (printer AstPrinter) visitAssignExpr(expr AssignExpr) string {
+	return "(= " + expr.name.lexeme + " " + printer.Print(expr.value) + ")"
+}
+
+func (printer AstPrinter) visitBinaryExpr(expr BinaryExpr) string {
 	return printer.parenthesize(expr.operator.lexeme, expr.left, expr.right)
 }
 
-func (printer AstPrinter) visitCallExpr(expr CallExpr) any {
-	panic("AstPrinter is not able to print call expressions at this time.")
+func (printer AstPrinter) visitCallExpr(expr CallExpr) string {
+	parts := []string{printer.Print(expr.callee)}
+	positional := len(expr.args) - len(expr.names)
+	for i, arg := range expr.args {
+		if i >= positional {
+			parts = append(parts, "(: "+expr.names[i-positional].lexeme+" "+printer.Print(arg)+")")
+		} else {
+			parts = append(parts, printer.Print(arg))
+		}
+	}
+	return printer.form("call", parts...)
+}
+
+func (printer AstPrinter) visitConditionalExpr(expr ConditionalExpr) string {
+	return printer.parenthesize("?:", expr.condition, expr.thenBranch, expr.elseBranch)
+}
+
+func (printer AstPrinter) visitFunctionExpr(expr FunctionExpr) string {
+	return printer.block("(fun "+printer.params(expr.params, expr.variadic), expr.body...)
 }
 
-func (printer AstPrinter) visitGetExpr(expr GetExpr) any {
-	panic("AstPrinter is not able to print get expressions at this time.")
+func (printer AstPrinter) visitGetExpr(expr GetExpr) string {
+	return printer.form(".", printer.Print(expr.object), expr.name.lexeme)
 }
 
-func (printer AstPrinter) visitGroupingExpr(expr GroupingExpr) any {
+func (printer AstPrinter) visitGroupingExpr(expr GroupingExpr) string {
 	return printer.parenthesize("group", expr.expression)
 }
 
-func (printer AstPrinter) visitLiteralExpr(expr LiteralExpr) any {
-	if expr.value == nil {
+func (printer AstPrinter) visitListExpr(expr ListExpr) string {
+	return printer.parenthesize("list", expr.elements...)
+}
+
+func (printer AstPrinter) visitLiteralExpr(expr LiteralExpr) string {
+	switch value := expr.value.(type) {
+	case nil:
 		return "nil"
+	case string:
+		return strconv.Quote(value)
+	case float64:
+		// keep the decimal point, so floats and integers can be told apart
+		return formatFloat(value)
 	}
 	return fmt.Sprint(expr.value)
 }
 
-func (printer AstPrinter) visitLogicalExpr(expr LogicalExpr) any {
+func (printer AstPrinter) visitLogicalExpr(expr LogicalExpr) string {
 	return printer.parenthesize(expr.operator.lexeme, expr.left, expr.right)
 }
 
-func (printer AstPrinter) visitSetExpr(expr SetExpr) any {
-	panic("AstPrinter is not able to print set expressions at this time.")
+func (printer AstPrinter) visitMapExpr(expr MapExpr) string {
+	entries := make([]string, len(expr.keys))
+	for i, key := range expr.keys {
+		entries[i] = "(" + printer.Print(key) + " " + printer.Print(expr.values[i]) + ")"
+	}
+	return printer.form("map", entries...)
+}
+
+func (printer AstPrinter) visitSetExpr(expr SetExpr) string {
+	return printer.form(".=", printer.Print(expr.object), expr.name.lexeme, printer.Print(expr.value))
+}
+
+func (printer AstPrinter) visitSubscriptExpr(expr SubscriptExpr) string {
+	return printer.parenthesize("[]", expr.object, expr.index)
+}
+
+func (printer AstPrinter) visitSubscriptSetExpr(expr SubscriptSetExpr) string {
+	return printer.parenthesize("[]=", expr.object, expr.index, expr.value)
 }
 
-func (printer AstPrinter) visitSuperExpr(expr SuperExpr) any {
-	panic(("AstPrinter is not able to print super expressions at this time."))
+func (printer AstPrinter) visitSuperExpr(expr SuperExpr) string {
+	return printer.form("super", expr.method.lexeme)
 }
 
-func (printer AstPrinter) visitThisExpr(expr ThisExpr) any {
-	panic("AstPrinter is not able to print this expressions at this time.")
+func (printer AstPrinter) visitThisExpr(expr ThisExpr) string {
+	return "this"
 }
 
-func (printer AstPrinter) visitUnaryExpr(expr UnaryExpr) any {
+func (printer AstPrinter) visitUnaryExpr(expr UnaryExpr) string {
 	return printer.parenthesize(expr.operator.lexeme, expr.right)
 }
 
-func (printer AstPrinter) visitVariableExpr(expr VariableExpr) any {
-	panic("AstPrinter is not able to print variable expressions at this time.")
+func (printer AstPrinter) visitVariableExpr(expr VariableExpr) string {
+	return expr.name.lexeme
+}
+
+func (printer AstPrinter) visitBlockStmt(stmt BlockStmt) string {
+	return printer.block("(block", stmt.statements...)
+}
+
+func (printer AstPrinter) visitBreakStmt(stmt BreakStmt) string {
+	return "(break)"
+}
+
+func (printer AstPrinter) visitClassStmt(stmt ClassStmt) string {
+	header := "(class " + stmt.name.lexeme
+	if stmt.superclass.getId() != 0 { // id will be unset if there is not superclass
+		header += " (< " + stmt.superclass.name.lexeme + ")"
+	}
+	if len(stmt.traits) > 0 {
+		header += " " + printer.parenthesize("with", stmt.traits...)
+	}
+	return printer.block(header, printer.methods(stmt.methods)...)
+}
+
+func (printer AstPrinter) visitContinueStmt(stmt ContinueStmt) string {
+	return "(continue)"
+}
+
+func (printer AstPrinter) visitErrorStmt(stmt ErrorStmt) string {
+	lexemes := make([]string, len(stmt.tokens))
+	for i, token := range stmt.tokens {
+		lexemes[i] = token.lexeme
+	}
+	return printer.form("error", lexemes...)
+}
+
+func (printer AstPrinter) visitExprStmt(stmt ExprStmt) string {
+	return printer.parenthesize(";", stmt.expr)
+}
+
+func (printer AstPrinter) visitForEachStmt(stmt ForEachStmt) string {
+	return printer.block("(for-in "+stmt.name.lexeme+" "+printer.Print(stmt.collection), stmt.body)
+}
+
+func (printer AstPrinter) visitFunctionStmt(stmt FunctionStmt) string {
+	return printer.function(stmt)
+}
+
+func (printer AstPrinter) visitIfStmt(stmt IfStmt) string {
+	header := "(if " + printer.Print(stmt.condition)
+	if stmt.elseBranch == nil {
+		return printer.block(header, stmt.thenBranch)
+	}
+	return printer.block(header, stmt.thenBranch, stmt.elseBranch)
+}
+
+func (printer AstPrinter) visitImportStmt(stmt ImportStmt) string {
+	return printer.form("import", stmt.path.lexeme, stmt.name.lexeme)
+}
+
+func (printer AstPrinter) visitPrintStmt(stmt PrintStmt) string {
+	return printer.parenthesize("print", stmt.expr)
+}
+
+func (printer AstPrinter) visitReturnStmt(stmt ReturnStmt) string {
+	if stmt.value == nil {
+		return "(return)"
+	}
+	return printer.parenthesize("return", stmt.value)
+}
+
+func (printer AstPrinter) visitTraitStmt(stmt TraitStmt) string {
+	return printer.block("(trait "+stmt.name.lexeme, printer.methods(stmt.methods)...)
+}
+
+func (printer AstPrinter) visitVarStmt(stmt VarStmt) string {
+	if stmt.initializer == nil {
+		return printer.form("var", stmt.name.lexeme)
+	}
+	return printer.form("var", stmt.name.lexeme, printer.Print(stmt.initializer))
+}
+
+func (printer AstPrinter) visitWhileStmt(stmt WhileStmt) string {
+	if stmt.increment != nil {
+		// a for loop, its initializer is in a block around it
+		return printer.block("(for "+printer.Print(stmt.condition)+" "+printer.Print(stmt.increment), stmt.body)
+	}
+	return printer.block("(while "+printer.Print(stmt.condition), stmt.body)
 }
 
 func (printer AstPrinter) parenthesize(name string, exprs ...Expr) string {
 	prettyString := "(" + name
 	for _, expr := range exprs {
 		prettyString += " "
-		prettyString += expr.accept(printer).(string)
+		prettyString += acceptExpr(expr, printer)
 	}
 	prettyString += ")"
 	return prettyString
 }
+
+// form prints a node whose parts have already been printed
+func (printer AstPrinter) form(name string, parts ...string) string {
+	if len(parts) == 0 {
+		return "(" + name + ")"
+	}
+	return "(" + name + " " + strings.Join(parts, " ") + ")"
+}
+
+// block prints the unclosed header of a node followed by its statements, each on a line of its own
+func (printer AstPrinter) block(header string, statements ...Stmt) string {
+	nested := AstPrinter{depth: printer.depth + 1}
+	indent := strings.Repeat("  ", nested.depth)
+	var sb strings.Builder
+	sb.WriteString(header)
+	for _, stmt := range statements {
+		sb.WriteString("\n" + indent + acceptStmt(stmt, nested))
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func (printer AstPrinter) function(stmt FunctionStmt) string {
+	if stmt.isGetter {
+		return printer.block("(getter "+stmt.name.lexeme, stmt.body...)
+	}
+	return printer.block("(fun "+stmt.name.lexeme+" "+printer.params(stmt.params, stmt.variadic), stmt.body...)
+}
+
+func (printer AstPrinter) methods(methods []FunctionStmt) []Stmt {
+	statements := make([]Stmt, len(methods))
+	for i, method := range methods {
+		statements[i] = method
+	}
+	return statements
+}
+
+func (printer AstPrinter) params(params []Token, variadic bool) string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.lexeme
+	}
+	if variadic {
+		names[len(names)-1] = "..." + names[len(names)-1]
+	}
+	return "(" + strings.Join(names, " ") + ")"
+}
@@ -0,0 +1,94 @@
+package lang
+
+/******************************************************************************
+ * Copies a parsed program while rewriting where its nodes and tokens sit in
+ * the source. AST nodes are values, so changing a nested span means
+ * rebuilding every node above it. The rewriter does that in one pass and
+ * leaves everything else about the tree, including expression IDs, alone.
+ *
+ * The per-node code lives in astrewritenodes.go, which is generated by
+ * tool/generateast alongside the node definitions.
+ *****************************************************************************/
+
+type astRewriter struct {
+	rewriteSpan func(span Span) Span
+}
+
+func (r astRewriter) token(t Token) Token {
+	span := r.rewriteSpan(t.span)
+	// a token's line is where it ends, which may be past its first line for multi-line strings
+	t.line += span.Start.Line - t.span.Start.Line
+	t.span = span
+	if len(t.leadingComments) > 0 {
+		comments := make([]Comment, len(t.leadingComments))
+		for i, comment := range t.leadingComments {
+			comments[i] = Comment{Text: comment.Text, Span: r.rewriteSpan(comment.Span)}
+		}
+		t.leadingComments = comments
+	}
+	if t.trailingComment != nil {
+		t.trailingComment = &Comment{Text: t.trailingComment.Text, Span: r.rewriteSpan(t.trailingComment.Span)}
+	}
+	return t
+}
+
+func (r astRewriter) tokens(tokens []Token) []Token {
+	rewritten := make([]Token, 0, len(tokens))
+	for _, t := range tokens {
+		rewritten = append(rewritten, r.token(t))
+	}
+	return rewritten
+}
+
+func (r astRewriter) expr(expr Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+	return acceptExpr[Expr](expr, r)
+}
+
+func (r astRewriter) exprs(exprs []Expr) []Expr {
+	rewritten := make([]Expr, 0, len(exprs))
+	for _, expr := range exprs {
+		rewritten = append(rewritten, r.expr(expr))
+	}
+	return rewritten
+}
+
+func (r astRewriter) stmt(stmt Stmt) Stmt {
+	if stmt == nil {
+		return nil
+	}
+	return acceptStmt[Stmt](stmt, r)
+}
+
+func (r astRewriter) stmts(statements []Stmt) []Stmt {
+	rewritten := make([]Stmt, 0, len(statements))
+	for _, stmt := range statements {
+		rewritten = append(rewritten, r.stmt(stmt))
+	}
+	return rewritten
+}
+
+func (r astRewriter) variable(v VariableExpr) VariableExpr {
+	if v.getId() == 0 { // an uninitialized VariableExpr (e.g. no superclass)
+		return v
+	}
+	return r.visitVariableExpr(v).(VariableExpr)
+}
+
+func (r astRewriter) functions(functions []FunctionStmt) []FunctionStmt {
+	rewritten := make([]FunctionStmt, 0, len(functions))
+	for _, function := range functions {
+		rewritten = append(rewritten, r.visitFunctionStmt(function).(FunctionStmt))
+	}
+	return rewritten
+}
+
+func (r astRewriter) flag(b bool) bool {
+	return b
+}
+
+func (r astRewriter) literal(value any) any {
+	return value
+}
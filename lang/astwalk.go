@@ -0,0 +1,68 @@
+package lang
+
+/******************************************************************************
+ * Walks a parsed program depth first, calling visit for every expression and
+ * statement, parents before their children. When visit returns false the
+ * node's children are skipped. This is for checks that only care about a few
+ * kinds of node and would otherwise need a visitor method for every one.
+ * Checks that track scopes can also set leave, which is called once a
+ * node's children have all been walked.
+ *
+ * The per-node code lives in astwalknodes.go, which is generated by
+ * tool/generateast alongside the node definitions.
+ *****************************************************************************/
+
+type astWalker struct {
+	visit func(node any) bool
+	leave func(node any) // nil if nothing needs to know, not called for nodes whose children were skipped
+}
+
+func walkExpr(expr Expr, visit func(node any) bool) {
+	astWalker{visit: visit}.expr(expr)
+}
+
+func walkStmt(stmt Stmt, visit func(node any) bool) {
+	astWalker{visit: visit}.stmt(stmt)
+}
+
+func (w astWalker) expr(expr Expr) {
+	if expr != nil && w.visit(expr) {
+		acceptExpr[none](expr, w)
+		if w.leave != nil {
+			w.leave(expr)
+		}
+	}
+}
+
+func (w astWalker) exprs(exprs []Expr) {
+	for _, expr := range exprs {
+		w.expr(expr)
+	}
+}
+
+func (w astWalker) stmt(stmt Stmt) {
+	if stmt != nil && w.visit(stmt) {
+		acceptStmt[none](stmt, w)
+		if w.leave != nil {
+			w.leave(stmt)
+		}
+	}
+}
+
+func (w astWalker) stmts(statements []Stmt) {
+	for _, stmt := range statements {
+		w.stmt(stmt)
+	}
+}
+
+func (w astWalker) variable(v VariableExpr) {
+	if v.getId() != 0 { // an uninitialized VariableExpr (e.g. no superclass)
+		w.expr(v)
+	}
+}
+
+func (w astWalker) functions(functions []FunctionStmt) {
+	for _, function := range functions {
+		w.stmt(function)
+	}
+}
@@ -0,0 +1,62 @@
+package lang
+
+import (
+	"errors"
+	"math"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The bitwise and shift operators work on 64-bit integers and always give
+ * an integer. Float operands are truncated first, the fractional part is
+ * dropped, rounding toward zero. Floats that aren't finite or don't fit in a
+ * 64-bit integer are runtime errors rather than being silently wrapped, and
+ * so are negative shift counts. Shifting by 64 or more shifts every bit out.
+ *
+ * Both execution engines evaluate the operators here so they agree on
+ * every edge case.
+ *****************************************************************************/
+
+func bitwise(operator string, left runtime.Value, right runtime.Value) (runtime.Value, diag.Code, error) {
+	if !runtime.IsNumber(left) || !runtime.IsNumber(right) {
+		return nil, diag.OperandMustBeNumber, errors.New("Operands must be numbers when using the '" + operator + "' operator.")
+	}
+	leftInt, leftOk := toInt64(left)
+	rightInt, rightOk := toInt64(right)
+	if !leftOk || !rightOk {
+		err := errors.New("Operands must be finite numbers within the 64-bit integer range when using the '" +
+			operator + "' operator.")
+		return nil, diag.InvalidBitwiseOperand, err
+	}
+	switch operator {
+	case "&":
+		return leftInt & rightInt, "", nil
+	case "|":
+		return leftInt | rightInt, "", nil
+	case "^":
+		return leftInt ^ rightInt, "", nil
+	}
+	if rightInt < 0 {
+		return nil, diag.InvalidBitwiseOperand, errors.New("Shift count can't be negative.")
+	}
+	if operator == "<<" {
+		return leftInt << uint64(rightInt), "", nil
+	}
+	return leftInt >> uint64(rightInt), "", nil
+}
+
+// toInt64 truncates a number toward zero, reporting false if it has no 64-bit integer equivalent
+func toInt64(value runtime.Value) (int64, bool) {
+	if integer, isInteger := value.(int64); isInteger {
+		return integer, true
+	}
+	number, _ := runtime.ToFloat(value)
+	truncated := math.Trunc(number)
+	// 2^63 is exactly representable as a float64, but one past the largest int64
+	if math.IsNaN(truncated) || truncated < -(1<<63) || truncated >= 1<<63 {
+		return 0, false
+	}
+	return int64(truncated), true
+}
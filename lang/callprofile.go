@@ -0,0 +1,154 @@
+package lang
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+/******************************************************************************
+ * A call profile counts the calls to every Lox function and native while
+ * the tree-walk interpreter runs, and times them on the wall clock. Unlike
+ * the sampling profiler in profile.go it sees every call, however short,
+ * which is what counts need, at the price of reading the clock twice for
+ * each one.
+ *
+ * Each function gets its total time, from when it was called until it
+ * returned, and its self time, the part of that not spent in the functions
+ * it called. A recursive function's total only counts its outermost call,
+ * so it never comes to more than the run took. The script's top level is
+ * counted as a function called <script>, and methods are named after their
+ * class, like Point.init.
+ *
+ * The time is also kept for every distinct chain of calls, which is what
+ * WritePprof needs to write a profile pprof can show as a call graph.
+ *****************************************************************************/
+
+type CallProfile struct {
+	functions map[string]*profiledFunction // by name
+	stacks    map[string]*profiledStack    // by the names of the functions in it, outermost first
+	active    []activeCall
+	elapsed   time.Duration // total time of the calls made with nothing else running
+	started   time.Time     // when the first call was made
+}
+
+type profiledFunction struct {
+	name   string
+	file   string // where the function was declared, empty for natives
+	native bool
+	calls  int64
+	total  time.Duration
+	self   time.Duration
+	depth  int // how many calls to the function are active, so recursive calls aren't counted twice in its total
+}
+
+type profiledStack struct {
+	functions []*profiledFunction // outermost first
+	calls     int64
+	self      time.Duration
+}
+
+type activeCall struct {
+	function *profiledFunction
+	stack    string
+	start    time.Time
+	children time.Duration // time spent in calls made from this one
+}
+
+// ProfileCalls counts and times the calls to every function and native while the interpreter runs a program.
+func (interpreter *Interpreter) ProfileCalls() *CallProfile {
+	profile := &CallProfile{functions: make(map[string]*profiledFunction), stacks: make(map[string]*profiledStack)}
+	interpreter.watch().calls = profile
+	return profile
+}
+
+// enter records a call starting, call leave once it has returned
+func (profile *CallProfile) enter(name string, file string, native bool) {
+	function, seen := profile.functions[name]
+	if !seen {
+		function = &profiledFunction{name: name, file: file, native: native}
+		profile.functions[name] = function
+	}
+	function.calls++
+	function.depth++
+	key := name
+	if len(profile.active) > 0 {
+		key = profile.active[len(profile.active)-1].stack + ";" + name
+	}
+	stack, seen := profile.stacks[key]
+	if !seen {
+		stack = &profiledStack{}
+		for _, call := range profile.active {
+			stack.functions = append(stack.functions, call.function)
+		}
+		stack.functions = append(stack.functions, function)
+		profile.stacks[key] = stack
+	}
+	stack.calls++
+	now := time.Now()
+	if profile.started.IsZero() {
+		profile.started = now
+	}
+	profile.active = append(profile.active, activeCall{function: function, stack: key, start: now})
+}
+
+func (profile *CallProfile) leave() {
+	call := profile.active[len(profile.active)-1]
+	profile.active = profile.active[:len(profile.active)-1]
+	elapsed := time.Since(call.start)
+	call.function.depth--
+	if call.function.depth == 0 {
+		call.function.total += elapsed
+	}
+	call.function.self += elapsed - call.children
+	profile.stacks[call.stack].self += elapsed - call.children
+	if len(profile.active) > 0 {
+		profile.active[len(profile.active)-1].children += elapsed
+	} else {
+		profile.elapsed += elapsed
+	}
+}
+
+/******************************************************************************
+ * WriteReport writes a table of the functions called, the ones that took
+ * the most time themselves first, so the hot spots are at the top:
+ *
+ *        calls    total ms     self ms  self %  function
+ *       242785     812.604     795.106   97.8%  fib
+ *            1     813.021       0.417    0.1%  <script>
+ *****************************************************************************/
+
+func (profile *CallProfile) WriteReport(w io.Writer) error {
+	functions := make([]*profiledFunction, 0, len(profile.functions))
+	for _, function := range profile.functions {
+		functions = append(functions, function)
+	}
+	sort.Slice(functions, func(a, b int) bool {
+		if functions[a].self != functions[b].self {
+			return functions[a].self > functions[b].self
+		}
+		return functions[a].name < functions[b].name
+	})
+	var report strings.Builder
+	fmt.Fprintf(&report, "%12s  %10s  %10s  %6s  %s\n", "calls", "total ms", "self ms", "self %", "function")
+	for _, function := range functions {
+		share := 0.0
+		if profile.elapsed > 0 {
+			share = 100 * float64(function.self) / float64(profile.elapsed)
+		}
+		name := function.name
+		if function.native {
+			name += " (native)"
+		}
+		fmt.Fprintf(&report, "%12d  %10.3f  %10.3f  %5.1f%%  %s\n", function.calls, milliseconds(function.total),
+			milliseconds(function.self), share, name)
+	}
+	_, err := io.WriteString(w, report.String())
+	return err
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
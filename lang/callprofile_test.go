@@ -0,0 +1,36 @@
+package lang
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProfileTailCalls checks that a function returning a tail call is charged for the time the call takes
+func TestProfileTailCalls(t *testing.T) {
+	source := `fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); }
+		fun main() { return fib(20); }
+		main();`
+	errorHandler := &ErrorHandler{Output: io.Discard}
+	program := NewFrontEnd(errorHandler).Analyze(source)
+	interpreter := NewInterpreter(errorHandler)
+	calls := interpreter.ProfileCalls()
+	samples := interpreter.Profile(time.Microsecond)
+	interpreter.Compile(program)
+	interpreter.Run()
+	if len(errorHandler.Diagnostics) > 0 {
+		t.Fatal(errorHandler.Diagnostics)
+	}
+	if main, fib := calls.functions["main"], calls.functions["fib"]; main.total < fib.total {
+		t.Errorf("main took %v in total, less than the %v of the fib call it returned", main.total, fib.total)
+	}
+	if _, seen := calls.stacks["<script>;main;fib"]; !seen {
+		t.Error("fib wasn't profiled as called from main")
+	}
+	for stack := range samples.stacks {
+		if strings.Contains(stack, "fib:") && !strings.Contains(stack, ";main:") {
+			t.Errorf("fib was sampled without main under it: %s", stack)
+		}
+	}
+}
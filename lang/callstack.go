@@ -0,0 +1,186 @@
+package lang
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+/******************************************************************************
+ * The call stack tracks which Lox functions are running and which line each
+ * of them is on. Go's own stack is no help here, it is full of visitor
+ * methods that say nothing about the script. The bottom frame is the script
+ * itself. The stack is shared with the interpreters of imported modules, so a
+ * call into a module's function shows up on top of the code that called it.
+ * Each frame also remembers the interpreter running it and the environment
+ * it was last in, which is everything the debugger needs to look at a frame
+ * that is waiting on a call.
+ *
+ * The stack also enforces the call depth limit. Every Lox call nests Go
+ * calls too, so without a limit a runaway recursion would crash glox with a
+ * Go stack overflow long before it reported anything useful.
+ *****************************************************************************/
+
+// the tree-walker's call depth limit unless SetMaxCallDepth changes it, well short of overflowing Go's stack
+const defaultMaxCallDepth = 10000
+
+/******************************************************************************
+ * MaxCallDepth is the highest limit SetMaxCallDepth accepts for the
+ * tree-walker, higher ones are lowered to it. Every call nests Go calls,
+ * taking up to tens of kB of Go stack for a function with a lot of nesting
+ * in its body, and Go stops the whole process if its stack outgrows its
+ * limit. So a limit above the default raises Go's stack limit as far as it
+ * goes (see runtime/debug.SetMaxStack), letting the stack grow to 1 GB, and
+ * MaxCallDepth leaves each call about 40 kB of that.
+ *****************************************************************************/
+
+const MaxCallDepth = 25_000
+
+// the runtime lets a goroutine's stack double in size up to 1 GB if its limit is at least this
+const goStackLimit = 2_000_000_000
+
+// fitCallDepth lowers a call depth limit to MaxCallDepth, and makes sure Go's stack can hold that many calls
+func fitCallDepth(depth int) int {
+	depth = min(depth, MaxCallDepth)
+	if depth > defaultMaxCallDepth {
+		if previous := debug.SetMaxStack(goStackLimit); previous > goStackLimit {
+			debug.SetMaxStack(previous)
+		}
+	}
+	return depth
+}
+
+/******************************************************************************
+ * Counting calls isn't enough on its own, a function whose body nests
+ * expressions hundreds deep takes that many Go calls to evaluate on every
+ * Lox call. So the interpreter also counts the evaluate and execute calls
+ * running at once, whatever nests them, and stops with a stack overflow past
+ * maxNesting. Each takes about 1.5 kB of Go stack, so even at a few times
+ * that the limit stays well under the 1 GB the stack can grow to, while
+ * leaving a simple recursive function room for MaxCallDepth calls.
+ *****************************************************************************/
+
+const maxNesting = 200_000
+
+type stackFrame struct {
+	name        string
+	line        int // line of the statement the frame is executing
+	interpreter *Interpreter
+	env         *environment
+}
+
+type callStack struct {
+	frames  []stackFrame
+	limit   int // most frames there can be on top of the script's
+	nesting int // evaluate and execute calls running, see Interpreter.nest
+}
+
+func newCallStack(script *Interpreter) *callStack {
+	return &callStack{frames: []stackFrame{{name: "<script>", interpreter: script, env: script.globals}},
+		limit: defaultMaxCallDepth}
+}
+
+// full reports whether pushing another frame would go over the call depth limit
+func (s *callStack) full() bool {
+	return len(s.frames)-1 >= s.limit
+}
+
+// unnest undoes Interpreter.nest once the statement or expression is done
+func (s *callStack) unnest() {
+	s.nesting--
+}
+
+func (s *callStack) push(name string, interpreter *Interpreter) {
+	s.frames = append(s.frames, stackFrame{name: name, interpreter: interpreter, env: interpreter.env})
+}
+
+func (s *callStack) pop() {
+	// clear the frame so its environment doesn't keep values alive
+	s.frames[len(s.frames)-1] = stackFrame{}
+	s.frames = s.frames[:len(s.frames)-1]
+}
+
+// at moves the innermost frame to the statement it is about to execute
+func (s *callStack) at(line int, env *environment) {
+	frame := &s.frames[len(s.frames)-1]
+	frame.line = line
+	frame.env = env
+}
+
+// folded joins the frames outermost first as name:line entries separated by semicolons
+func (s *callStack) folded() string {
+	var sb strings.Builder
+	for i, frame := range s.frames {
+		if i > 0 {
+			sb.WriteByte(';')
+		}
+		sb.WriteString(frame.name)
+		sb.WriteByte(':')
+		sb.WriteString(strconv.Itoa(frame.line))
+	}
+	return sb.String()
+}
+
+// backtrace describes the frames innermost first, see formatBacktrace
+func (s *callStack) backtrace() []string {
+	frames := make([]traceFrame, 0, len(s.frames))
+	for i := len(s.frames) - 1; i >= 0; i-- {
+		frames = append(frames, traceFrame{name: s.frames[i].name, line: s.frames[i].line})
+	}
+	return formatBacktrace(frames)
+}
+
+/******************************************************************************
+ * formatBacktrace turns the frames of a call stack, innermost first, into
+ * the lines printed under a runtime error. Both engines use it, so their
+ * backtraces look the same. A recursive call repeated over and over is
+ * shown once with a count, and if the trace is still too long only its two
+ * ends are kept:
+ *
+ *   at countDown (line 3)
+ *   ... the same call 9998 more times
+ *   at <script> (line 6)
+ *****************************************************************************/
+
+type traceFrame struct {
+	name string
+	line int
+}
+
+const maxTraceEntries = 20
+
+func formatBacktrace(frames []traceFrame) []string {
+	type entry struct {
+		text   string
+		frames int // how many frames the entry stands for
+	}
+	entries := make([]entry, 0)
+	for i := 0; i < len(frames); {
+		end := i + 1
+		for end < len(frames) && frames[end] == frames[i] {
+			end++
+		}
+		entries = append(entries, entry{text: fmt.Sprintf("  at %s (line %d)", frames[i].name, frames[i].line), frames: 1})
+		if end-i > 1 {
+			entries = append(entries, entry{text: fmt.Sprintf("  ... the same call %d more times", end-i-1),
+				frames: end - i - 1})
+		}
+		i = end
+	}
+	kept := entries
+	omitted := 0
+	if len(entries) > maxTraceEntries {
+		kept = append([]entry{}, entries[:maxTraceEntries/2]...)
+		for _, e := range entries[maxTraceEntries/2 : len(entries)-maxTraceEntries/2] {
+			omitted += e.frames
+		}
+		kept = append(kept, entry{text: fmt.Sprintf("  ... %d more calls", omitted)})
+		kept = append(kept, entries[len(entries)-maxTraceEntries/2:]...)
+	}
+	lines := make([]string, len(kept))
+	for i, e := range kept {
+		lines[i] = e.text
+	}
+	return lines
+}
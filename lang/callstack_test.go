@@ -0,0 +1,101 @@
+package lang
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/skusel/glox/diag"
+)
+
+// runOn runs source on the engine newEngine makes and returns the diagnostics it reported
+func runOn(source string, newEngine func(*ErrorHandler) Engine) []diag.Diagnostic {
+	errorHandler := &ErrorHandler{Output: io.Discard}
+	program := NewFrontEnd(errorHandler).Analyze(source)
+	if program == nil {
+		return errorHandler.Diagnostics
+	}
+	engine := newEngine(errorHandler)
+	if engine.Compile(program) == nil {
+		engine.Run()
+	}
+	return errorHandler.Diagnostics
+}
+
+// TestMaxCallDepth recurses past the highest call depth limits, which must stop with a stack overflow, not crash
+func TestMaxCallDepth(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		newEngine func(*ErrorHandler) Engine
+	}{
+		{"interpreter", "fun f(n) { if (n == 0) return 0; return f(n - 1) + 1; } print f(30000);",
+			func(errorHandler *ErrorHandler) Engine {
+				interpreter := NewInterpreter(errorHandler)
+				interpreter.SetMaxCallDepth(1 << 30)
+				if interpreter.stack.limit != MaxCallDepth {
+					t.Errorf("the limit is %d, not MaxCallDepth", interpreter.stack.limit)
+				}
+				return interpreter
+			}},
+		// natives calling back into Lox nest Go calls on the VM too
+		{"vm natives", `fun f(n) {
+			  if (n == 0) return 0;
+			  return protect(fun() { return f(n - 1) + 1; }, fun(error) { return error; });
+			}
+			print f(30000);`,
+			func(errorHandler *ErrorHandler) Engine {
+				vm := NewVM(errorHandler)
+				vm.SetMaxCallDepth(1 << 30)
+				if vm.maxCallDepth != MaxVMCallDepth {
+					t.Errorf("the limit is %d, not MaxVMCallDepth", vm.maxCallDepth)
+				}
+				return vm
+			}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diagnostics := runOn(test.source, test.newEngine)
+			if len(diagnostics) != 1 || diagnostics[0].Code != diag.StackOverflow {
+				t.Errorf("expected a stack overflow, got %v", diagnostics)
+			}
+		})
+	}
+}
+
+// TestNestedCallDepth recurses with deeply nested expressions in the function's body, which take far more Go stack per call
+func TestNestedCallDepth(t *testing.T) {
+	recurse := func(parens, depth int) string {
+		return "fun f(n) { if (n == 0) return 0; return " + strings.Repeat("(", parens) + "f(n - 1) + 1" +
+			strings.Repeat(")", parens) + "; } print f(" + strconv.Itoa(depth) + ");"
+	}
+	tests := []struct {
+		name         string
+		source       string
+		maxCallDepth int // 0 for the default
+		overflows    bool
+	}{
+		{"default limit", recurse(100, 9990), 0, true},
+		{"highest limit", recurse(300, 24000), MaxCallDepth, true},
+		{"within the parser's nesting limit", recurse(990, 1000), 0, true},
+		{"shallow nesting", recurse(5, 9990), 0, false},
+		{"shallow nesting at the highest limit", recurse(2, 24000), MaxCallDepth, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diagnostics := runOn(test.source, func(errorHandler *ErrorHandler) Engine {
+				interpreter := NewInterpreter(errorHandler)
+				interpreter.output = NewBufferedOutput(io.Discard)
+				if test.maxCallDepth != 0 {
+					interpreter.SetMaxCallDepth(test.maxCallDepth)
+				}
+				return interpreter
+			})
+			overflowed := len(diagnostics) == 1 && diagnostics[0].Code == diag.StackOverflow
+			if overflowed != test.overflows || (!test.overflows && len(diagnostics) > 0) {
+				t.Errorf("expected a stack overflow: %v, got %v", test.overflows, diagnostics)
+			}
+		})
+	}
+}
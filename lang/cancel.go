@@ -0,0 +1,116 @@
+package lang
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * A running program can be stopped from outside, either by the Go code that
+ * embeds the interpreter calling Cancel from another goroutine or by a time
+ * limit set with the withTimeout native expiring. Both raise a flag the
+ * engines check before every statement (the tree-walker) or every call and
+ * backward jump (the VM). Checking one atomic flag keeps the common case,
+ * nothing to stop, cheap. Once the flag is up, interruption works out why
+ * and the engine raises the matching runtime error.
+ *****************************************************************************/
+
+type interrupts struct {
+	raised    atomic.Bool
+	cancelled atomic.Bool
+	mutex     sync.Mutex
+	timeouts  []*timeout  // active withTimeout calls, innermost last
+	sample    atomic.Bool // the profiler wants a sample, see profile.go
+	signalled atomic.Bool // a signal with a handler arrived, see signal.go
+	signals   signalHandlers
+}
+
+type timeout struct {
+	limit   time.Duration
+	expired atomic.Bool
+	timer   *time.Timer
+}
+
+/******************************************************************************
+ * Cancel stops the program the interpreter is running with a runtime error
+ * as soon as it finishes the statement it is on. It is safe to call from any
+ * goroutine. Cancelling when nothing is running stops the next program to
+ * run instead.
+ *****************************************************************************/
+
+func (interpreter *Interpreter) Cancel() {
+	interpreter.interrupts.cancelled.Store(true)
+	interpreter.interrupts.raised.Store(true)
+	wakeLockWaiters()
+}
+
+// startTimeout begins a time limit for a withTimeout call, stop it when the call returns
+func (interpreter *Interpreter) startTimeout(limit time.Duration) func() {
+	i := interpreter.interrupts
+	t := &timeout{limit: limit}
+	i.mutex.Lock()
+	i.timeouts = append(i.timeouts, t)
+	i.mutex.Unlock()
+	t.timer = time.AfterFunc(limit, func() {
+		t.expired.Store(true)
+		i.raised.Store(true)
+		wakeLockWaiters()
+	})
+	return func() {
+		t.timer.Stop()
+		i.mutex.Lock()
+		for index, active := range i.timeouts {
+			if active == t {
+				i.timeouts = append(i.timeouts[:index], i.timeouts[index+1:]...)
+				break
+			}
+		}
+		i.mutex.Unlock()
+	}
+}
+
+// timeoutExpired reports whether a withTimeout call that is still running has run out of time
+func (interpreter *Interpreter) timeoutExpired() bool {
+	i := interpreter.interrupts
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, t := range i.timeouts {
+		if t.expired.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// interruption returns the error to stop the program with, if it should be stopped, after running any signal handlers that are due
+func (interpreter *Interpreter) interruption() (diag.Code, error) {
+	i := interpreter.interrupts
+	if !i.raised.Load() {
+		return "", nil
+	}
+	i.raised.Store(false)
+	if i.sample.Swap(false) && interpreter.hooks != nil && interpreter.hooks.profile != nil {
+		interpreter.hooks.profile.sample(interpreter.stack)
+	}
+	if i.signalled.Swap(false) {
+		interpreter.handleSignals()
+	}
+	if i.cancelled.Swap(false) {
+		return diag.Cancelled, errors.New("Execution was cancelled.")
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, t := range i.timeouts {
+		if t.expired.Load() {
+			ms := strconv.FormatInt(t.limit.Milliseconds(), 10)
+			return diag.TimedOut, errors.New("Call timed out after " + ms + " ms.")
+		}
+	}
+	// a timer fired just after its call returned
+	return "", nil
+}
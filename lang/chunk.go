@@ -0,0 +1,101 @@
+package lang
+
+import (
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * A chunk is a sequence of bytecode instructions for the VM along with the
+ * constants they refer to. Every function gets its own chunk. Each
+ * instruction is a single opcode byte followed by its operands, if it has
+ * any. Operands are one byte (local slots, upvalue indexes, argument counts)
+ * or two bytes, big endian (constant indexes and jump offsets).
+ *
+ * The source line of every byte is recorded so runtime errors can report the
+ * same line the tree-walk interpreter would.
+ *****************************************************************************/
+
+type opCode byte
+
+const (
+	opConstant     opCode = iota // constant index (2)
+	opNil                        //
+	opTrue                       //
+	opFalse                      //
+	opPop                        //
+	opGetLocal                   // slot (1)
+	opSetLocal                   // slot (1)
+	opGetGlobal                  // name constant (2)
+	opDefineGlobal               // name constant (2)
+	opSetGlobal                  // name constant (2)
+	opGetUpvalue                 // upvalue index (1)
+	opSetUpvalue                 // upvalue index (1)
+	opGetProperty                // name constant (2)
+	opSetProperty                // name constant (2)
+	opGetSuper                   // name constant (2)
+	opGetSubscript               //
+	opSetSubscript               //
+	opEqual                      //
+	opGreater                    //
+	opGreaterEqual               //
+	opLess                       //
+	opLessEqual                  //
+	opAdd                        //
+	opSubtract                   //
+	opMultiply                   //
+	opDivide                     //
+	opModulo                     //
+	opBitAnd                     //
+	opBitOr                      //
+	opBitXor                     //
+	opShiftLeft                  //
+	opShiftRight                 //
+	opNot                        //
+	opNegate                     //
+	opPrint                      //
+	opJump                       // forward offset (2)
+	opJumpIfFalse                // forward offset (2)
+	opLoop                       // backward offset (2)
+	opCall                       // argument count (1)
+	opClosure                    // function constant (2), then an (isLocal, index) byte pair per upvalue
+	opCloseUpvalue               //
+	opReturn                     //
+	opList                       // element count (2)
+	opMap                        // entry count (2)
+	opClass                      // name constant (2), has superclass (1), trait count (2), method count (2), method name constants (2 each)
+	opTrait                      // name constant (2), method count (2), method name constants (2 each)
+	opIterator                   //
+	opIterate                    // forward offset (2) taken once the iterator is used up
+	opCallNamed                  // argument count (1), constant holding the names of the last arguments (2)
+)
+
+type chunk struct {
+	code      []byte
+	lines     []int
+	spans     []Span // of the token each instruction's errors are reported at, see locate
+	constants []runtime.Value
+}
+
+func (c *chunk) write(b byte, line int, span Span) {
+	c.code = append(c.code, b)
+	c.lines = append(c.lines, line)
+	c.spans = append(c.spans, span)
+}
+
+// addConstant returns the index of the constant, reusing an existing entry for equal strings and numbers
+func (c *chunk) addConstant(value runtime.Value) int {
+	switch value.(type) {
+	case string, int64, float64:
+		for i, constant := range c.constants {
+			if constant == value {
+				return i
+			}
+		}
+	}
+	c.constants = append(c.constants, value)
+	return len(c.constants) - 1
+}
+
+func (c *chunk) readShort(offset int) int {
+	return int(c.code[offset])<<8 | int(c.code[offset+1])
+}
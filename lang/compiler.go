@@ -0,0 +1,824 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * The compiler lowers a resolved AST into bytecode for the VM. It is a single
+ * pass over the tree, much like the interpreter, but instead of executing
+ * each node it emits the instructions that will execute it later.
+ *
+ * The resolver has already rejected invalid programs, so the compiler only
+ * has to worry about the limits of the bytecode format itself (e.g. one byte
+ * operands for local slots). Local variables live in stack slots, and
+ * variables captured by closures are reached through upvalues, the same
+ * design used by clox in Crafting Interpreters.
+ *****************************************************************************/
+
+type Compiler struct {
+	current      *functionCompiler
+	line         int  // line of the instructions currently being emitted
+	span         Span // the token runtime errors in them are reported at
+	errorHandler *ErrorHandler
+}
+
+type functionCompiler struct {
+	enclosing    *functionCompiler
+	function     *vmFunction
+	functionType FunctionType
+	locals       []local
+	upvalues     []upvalueRef
+	scopeDepth   int
+	loop         *loopContext
+}
+
+type local struct {
+	name       string
+	depth      int // -1 until the variable's initializer has been compiled
+	isCaptured bool
+}
+
+type upvalueRef struct {
+	index   byte
+	isLocal bool
+}
+
+type loopContext struct {
+	enclosing     *loopContext
+	scopeDepth    int
+	breakJumps    []int
+	continueJumps []int
+}
+
+const maxLocals = 256
+const maxUpvalues = 256
+
+func NewCompiler(errorHandler *ErrorHandler) *Compiler {
+	return &Compiler{errorHandler: errorHandler}
+}
+
+// Compile returns the top level function of the program, it is called to run the program
+func (c *Compiler) Compile(statements []Stmt) (script *vmFunction, err error) {
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			staticError, isStaticError := recovered.(staticError)
+			if isStaticError {
+				// the error handler has already reported the error
+				script = nil
+				err = errors.New(staticError.diagnostic.String())
+			} else {
+				// this is not a panic thrown by us - pass it on
+				panic(recovered)
+			}
+		}
+	}()
+
+	c.beginFunction("", ftNone)
+	for _, stmt := range statements {
+		c.compileStatement(stmt)
+	}
+	return c.endFunction(), nil
+}
+
+func (c *Compiler) error(code diag.Code, msg string) {
+	c.errorHandler.reportStatic(locate(diag.Diagnostic{Code: code, Severity: diag.SeverityError, Line: c.line,
+		Message: msg}, c.span), true)
+}
+
+/******************************************************************************
+ * Functions
+ *****************************************************************************/
+
+func (c *Compiler) beginFunction(name string, functionType FunctionType) {
+	fc := &functionCompiler{enclosing: c.current, function: &vmFunction{name: name}, functionType: functionType}
+	// slot zero holds the function being called, or "this" in methods
+	slotZero := ""
+	if functionType == ftMethod || functionType == ftInitializer {
+		slotZero = "this"
+	}
+	fc.locals = append(fc.locals, local{name: slotZero, depth: 0})
+	c.current = fc
+}
+
+func (c *Compiler) endFunction() *vmFunction {
+	c.emitReturn()
+	function := c.current.function
+	function.upvalueCount = len(c.current.upvalues)
+	c.current = c.current.enclosing
+	return function
+}
+
+func (c *Compiler) function(name string, params []Token, variadic bool, body []Stmt,
+	functionType FunctionType) *vmFunction {
+	line, span := c.line, c.span
+	c.beginFunction(name, functionType)
+	c.beginScope()
+	for _, param := range params {
+		c.declareLocal(param.lexeme)
+		c.markInitialized()
+	}
+	c.current.function.arity = len(params)
+	c.current.function.variadic = variadic
+	c.current.function.paramNames = parameterNames(params, variadic)
+	if variadic {
+		c.current.function.arity--
+	}
+	for _, stmt := range body {
+		c.compileStatement(stmt)
+	}
+	// no need to end the scope, returning discards the whole frame
+	fc := c.current
+	function := c.endFunction()
+
+	c.line, c.span = line, span
+	c.emitOp(opClosure)
+	c.emitShort(c.makeConstant(function))
+	for _, upvalue := range fc.upvalues {
+		if upvalue.isLocal {
+			c.emitByte(1)
+		} else {
+			c.emitByte(0)
+		}
+		c.emitByte(upvalue.index)
+	}
+	return function
+}
+
+/******************************************************************************
+ * Scopes and variables
+ *****************************************************************************/
+
+func (c *Compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+func (c *Compiler) endScope() {
+	c.current.scopeDepth--
+	locals := c.current.locals
+	for len(locals) > 0 && locals[len(locals)-1].depth > c.current.scopeDepth {
+		c.popLocal(locals[len(locals)-1])
+		locals = locals[:len(locals)-1]
+	}
+	c.current.locals = locals
+}
+
+func (c *Compiler) popLocal(l local) {
+	if l.isCaptured {
+		c.emitOp(opCloseUpvalue)
+	} else {
+		c.emitOp(opPop)
+	}
+}
+
+func (c *Compiler) declareLocal(name string) {
+	if len(c.current.locals) == maxLocals {
+		c.error(diag.TooManyLocals, "Too many local variables in function.")
+	}
+	c.current.locals = append(c.current.locals, local{name: name, depth: -1})
+}
+
+func (c *Compiler) markInitialized() {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.current.locals[len(c.current.locals)-1].depth = c.current.scopeDepth
+}
+
+// declareVariable reserves a local slot for a new variable, globals are late bound and need nothing
+func (c *Compiler) declareVariable(name Token) {
+	if c.current.scopeDepth > 0 {
+		c.declareLocal(name.lexeme)
+	}
+}
+
+// defineVariable stores the value on top of the stack in a newly declared variable
+func (c *Compiler) defineVariable(name Token) {
+	if c.current.scopeDepth > 0 {
+		// the value is already sitting in the local's stack slot
+		c.markInitialized()
+		return
+	}
+	c.at(name)
+	c.emitOp(opDefineGlobal)
+	c.emitShort(c.makeConstant(name.lexeme))
+}
+
+func (c *Compiler) namedVariable(name Token, isAssignment bool) {
+	c.at(name)
+	getOp, setOp := opGetGlobal, opSetGlobal
+	var operand int
+	if slot, found := resolveLocal(c.current, name.lexeme); found {
+		getOp, setOp = opGetLocal, opSetLocal
+		operand = slot
+	} else if index, found := c.resolveUpvalue(c.current, name.lexeme); found {
+		getOp, setOp = opGetUpvalue, opSetUpvalue
+		operand = index
+	} else {
+		operand = c.makeConstant(name.lexeme)
+	}
+	op := getOp
+	if isAssignment {
+		op = setOp
+	}
+	c.emitOp(op)
+	if getOp == opGetGlobal {
+		c.emitShort(operand)
+	} else {
+		c.emitByte(byte(operand))
+	}
+}
+
+func resolveLocal(fc *functionCompiler, name string) (int, bool) {
+	for i := len(fc.locals) - 1; i >= 0; i-- {
+		// the resolver has already rejected reads of a local in its own initializer
+		if fc.locals[i].name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (c *Compiler) resolveUpvalue(fc *functionCompiler, name string) (int, bool) {
+	if fc.enclosing == nil {
+		return 0, false
+	}
+	if slot, found := resolveLocal(fc.enclosing, name); found {
+		fc.enclosing.locals[slot].isCaptured = true
+		return c.addUpvalue(fc, byte(slot), true), true
+	}
+	if index, found := c.resolveUpvalue(fc.enclosing, name); found {
+		return c.addUpvalue(fc, byte(index), false), true
+	}
+	return 0, false
+}
+
+func (c *Compiler) addUpvalue(fc *functionCompiler, index byte, isLocal bool) int {
+	for i, upvalue := range fc.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return i
+		}
+	}
+	if len(fc.upvalues) == maxUpvalues {
+		c.error(diag.TooManyUpvalues, "Too many closure variables in function.")
+	}
+	fc.upvalues = append(fc.upvalues, upvalueRef{index: index, isLocal: isLocal})
+	return len(fc.upvalues) - 1
+}
+
+// at has the instructions emitted from here on report errors at token
+func (c *Compiler) at(token Token) {
+	c.line = token.line
+	c.span = token.span
+}
+
+// syntheticToken names a variable the compiler refers to on its own, like "this" or "super"
+func (c *Compiler) syntheticToken(lexeme string) Token {
+	return Token{tokenType: tokenTypeIdentifier, lexeme: lexeme, line: c.line}
+}
+
+/******************************************************************************
+ * Emitting bytecode
+ *****************************************************************************/
+
+func (c *Compiler) chunk() *chunk {
+	return &c.current.function.chunk
+}
+
+func (c *Compiler) emitByte(b byte) {
+	c.chunk().write(b, c.line, c.span)
+}
+
+func (c *Compiler) emitOp(op opCode) {
+	c.emitByte(byte(op))
+}
+
+func (c *Compiler) emitShort(value int) {
+	c.emitByte(byte(value >> 8))
+	c.emitByte(byte(value))
+}
+
+func (c *Compiler) emitReturn() {
+	if c.current.functionType == ftInitializer {
+		// initializers always return "this"
+		c.emitOp(opGetLocal)
+		c.emitByte(0)
+	} else {
+		c.emitOp(opNil)
+	}
+	c.emitOp(opReturn)
+}
+
+// checkElementCount makes sure a list or map literal's size fits in its operand
+func (c *Compiler) checkElementCount(count int) {
+	if count > 0xffff {
+		c.error(diag.TooManyElements, "Too many elements in literal.")
+	}
+}
+
+func (c *Compiler) makeConstant(value any) int {
+	index := c.chunk().addConstant(value)
+	if index > 0xffff {
+		c.error(diag.TooManyConstants, "Too many constants in one chunk.")
+	}
+	return index
+}
+
+func (c *Compiler) emitConstant(value any) {
+	c.emitOp(opConstant)
+	c.emitShort(c.makeConstant(value))
+}
+
+// emitJump returns the offset of the jump's operand so it can be patched once the target is known
+func (c *Compiler) emitJump(op opCode) int {
+	c.emitOp(op)
+	c.emitShort(0xffff)
+	return len(c.chunk().code) - 2
+}
+
+func (c *Compiler) patchJump(offset int) {
+	// -2 to adjust for the jump offset itself
+	jump := len(c.chunk().code) - offset - 2
+	if jump > 0xffff {
+		c.error(diag.JumpTooLarge, "Too much code to jump over.")
+	}
+	c.chunk().code[offset] = byte(jump >> 8)
+	c.chunk().code[offset+1] = byte(jump)
+}
+
+func (c *Compiler) emitLoop(loopStart int) {
+	c.emitOp(opLoop)
+	offset := len(c.chunk().code) - loopStart + 2
+	if offset > 0xffff {
+		c.error(diag.JumpTooLarge, "Loop body too large.")
+	}
+	c.emitShort(offset)
+}
+
+/******************************************************************************
+ * Statements
+ *****************************************************************************/
+
+func (c *Compiler) compileStatement(stmt Stmt) {
+	acceptStmt(stmt, c)
+}
+
+func (c *Compiler) compileExpression(expr Expr) {
+	acceptExpr(expr, c)
+}
+
+func (c *Compiler) visitBlockStmt(stmt BlockStmt) none {
+	c.beginScope()
+	for _, statement := range stmt.statements {
+		c.compileStatement(statement)
+	}
+	c.endScope()
+	return none{}
+}
+
+// exitLoopScopes discards the locals declared inside the innermost loop without forgetting them
+func (c *Compiler) exitLoopScopes() {
+	locals := c.current.locals
+	for i := len(locals) - 1; i >= 0 && locals[i].depth > c.current.loop.scopeDepth; i-- {
+		c.popLocal(locals[i])
+	}
+}
+
+func (c *Compiler) visitBreakStmt(stmt BreakStmt) none {
+	c.at(stmt.keyword)
+	c.exitLoopScopes()
+	c.current.loop.breakJumps = append(c.current.loop.breakJumps, c.emitJump(opJump))
+	return none{}
+}
+
+func (c *Compiler) visitClassStmt(stmt ClassStmt) none {
+	c.at(stmt.name)
+	// the class name is defined as nil while the methods are compiled, just like the interpreter does
+	c.declareVariable(stmt.name)
+	c.emitOp(opNil)
+	c.defineVariable(stmt.name)
+
+	hasSuperclass := stmt.superclass.getId() != 0 // id will be unset if there is no superclass
+	if hasSuperclass {
+		c.compileExpression(stmt.superclass)
+		// methods capture the superclass through a local named "super"
+		c.beginScope()
+		c.declareLocal("super")
+		c.markInitialized()
+	}
+
+	for _, trait := range stmt.traits {
+		c.compileExpression(trait)
+	}
+	c.methods(stmt.methods)
+
+	c.at(stmt.name)
+	if hasSuperclass {
+		c.at(stmt.superclass.name) // superclass errors are reported where it is named
+	}
+	c.emitOp(opClass)
+	c.emitShort(c.makeConstant(stmt.name.lexeme))
+	if hasSuperclass {
+		c.emitByte(1)
+	} else {
+		c.emitByte(0)
+	}
+	c.emitShort(len(stmt.traits))
+	c.methodNames(stmt.methods)
+	c.namedVariable(stmt.name, true)
+	c.emitOp(opPop)
+
+	if hasSuperclass {
+		c.endScope()
+	}
+	return none{}
+}
+
+// methods leaves a closure on the stack for each method of a class or trait
+func (c *Compiler) methods(methods []FunctionStmt) {
+	for _, method := range methods {
+		functionType := ftMethod
+		if method.name.lexeme == "init" {
+			functionType = ftInitializer
+		}
+		c.at(method.name)
+		c.function(method.name.lexeme, method.params, method.variadic, method.body, functionType).isGetter = method.isGetter
+	}
+}
+
+// methodNames emits the operands naming the methods methods left on the stack
+func (c *Compiler) methodNames(methods []FunctionStmt) {
+	c.emitShort(len(methods))
+	for _, method := range methods {
+		c.emitShort(c.makeConstant(method.name.lexeme))
+	}
+}
+
+func (c *Compiler) visitContinueStmt(stmt ContinueStmt) none {
+	c.at(stmt.keyword)
+	c.exitLoopScopes()
+	c.current.loop.continueJumps = append(c.current.loop.continueJumps, c.emitJump(opJump))
+	return none{}
+}
+
+func (c *Compiler) visitErrorStmt(stmt ErrorStmt) none {
+	// programs with syntax errors are never compiled
+	return none{}
+}
+
+func (c *Compiler) visitExprStmt(stmt ExprStmt) none {
+	c.compileExpression(stmt.expr)
+	c.emitOp(opPop)
+	return none{}
+}
+
+/******************************************************************************
+ * A for-in loop keeps its iterator in a hidden local below the loop
+ * variable. opIterate pushes the next value, which becomes the loop variable
+ * for one pass through the body, or jumps out once there are no more. The
+ * loop variable is in a scope of its own that ends every pass, so closures
+ * capture each value separately, as they do in the tree-walker.
+ *****************************************************************************/
+
+func (c *Compiler) visitForEachStmt(stmt ForEachStmt) none {
+	c.beginScope()
+	c.compileExpression(stmt.collection)
+	c.at(stmt.keyword)
+	c.emitOp(opIterator)
+	c.declareLocal(" iterator") // the space keeps it from ever matching a variable
+	c.markInitialized()
+
+	loop := &loopContext{enclosing: c.current.loop, scopeDepth: c.current.scopeDepth}
+	c.current.loop = loop
+	loopStart := len(c.chunk().code)
+	c.at(stmt.keyword)
+	exitJump := c.emitJump(opIterate)
+	c.beginScope()
+	c.declareVariable(stmt.name)
+	c.defineVariable(stmt.name)
+	c.compileStatement(stmt.body)
+	c.endScope()
+	// break and continue have already discarded the loop variable
+	for _, jump := range loop.continueJumps {
+		c.patchJump(jump)
+	}
+	c.emitLoop(loopStart)
+	c.patchJump(exitJump)
+	for _, jump := range loop.breakJumps {
+		c.patchJump(jump)
+	}
+	c.current.loop = loop.enclosing
+
+	c.endScope()
+	return none{}
+}
+
+func (c *Compiler) visitFunctionStmt(stmt FunctionStmt) none {
+	c.at(stmt.name)
+	c.declareVariable(stmt.name)
+	// mark the function initialized before compiling its body to allow self recursion
+	c.markInitialized()
+	c.function(stmt.name.lexeme, stmt.params, stmt.variadic, stmt.body, ftFunction)
+	c.defineVariable(stmt.name)
+	return none{}
+}
+
+func (c *Compiler) visitIfStmt(stmt IfStmt) none {
+	c.compileExpression(stmt.condition)
+	thenJump := c.emitJump(opJumpIfFalse)
+	c.emitOp(opPop)
+	c.compileStatement(stmt.thenBranch)
+	elseJump := c.emitJump(opJump)
+	c.patchJump(thenJump)
+	c.emitOp(opPop)
+	if stmt.elseBranch != nil {
+		c.compileStatement(stmt.elseBranch)
+	}
+	c.patchJump(elseJump)
+	return none{}
+}
+
+func (c *Compiler) visitPrintStmt(stmt PrintStmt) none {
+	c.compileExpression(stmt.expr)
+	c.emitOp(opPrint)
+	return none{}
+}
+
+func (c *Compiler) visitReturnStmt(stmt ReturnStmt) none {
+	c.at(stmt.keyword)
+	if stmt.value == nil || c.current.functionType == ftInitializer {
+		// the resolver only allows a bare return in initializers
+		c.emitReturn()
+		return none{}
+	}
+	c.compileExpression(stmt.value)
+	c.emitOp(opReturn)
+	return none{}
+}
+
+func (c *Compiler) visitTraitStmt(stmt TraitStmt) none {
+	c.at(stmt.name)
+	c.declareVariable(stmt.name)
+	c.methods(stmt.methods)
+	c.at(stmt.name)
+	c.emitOp(opTrait)
+	c.emitShort(c.makeConstant(stmt.name.lexeme))
+	c.methodNames(stmt.methods)
+	c.defineVariable(stmt.name)
+	return none{}
+}
+
+func (c *Compiler) visitImportStmt(stmt ImportStmt) none {
+	c.at(stmt.keyword)
+	c.error(diag.ImportsNotSupported, "Imports are not supported by the bytecode VM.")
+	return none{}
+}
+
+func (c *Compiler) visitVarStmt(stmt VarStmt) none {
+	c.declareVariable(stmt.name)
+	if stmt.initializer != nil {
+		c.compileExpression(stmt.initializer)
+	} else {
+		c.at(stmt.name)
+		c.emitOp(opNil)
+	}
+	c.defineVariable(stmt.name)
+	return none{}
+}
+
+func (c *Compiler) visitWhileStmt(stmt WhileStmt) none {
+	loop := &loopContext{enclosing: c.current.loop, scopeDepth: c.current.scopeDepth}
+	c.current.loop = loop
+
+	loopStart := len(c.chunk().code)
+	c.compileExpression(stmt.condition)
+	exitJump := c.emitJump(opJumpIfFalse)
+	c.emitOp(opPop)
+	c.compileStatement(stmt.body)
+	// continue skips the rest of the body but still runs the increment
+	for _, jump := range loop.continueJumps {
+		c.patchJump(jump)
+	}
+	if stmt.increment != nil {
+		c.compileExpression(stmt.increment)
+		c.emitOp(opPop)
+	}
+	// an interrupted loop reports the line it starts on, like the tree-walker
+	c.line, c.span = stmt.span.Start.Line, Span{}
+	c.emitLoop(loopStart)
+	c.patchJump(exitJump)
+	c.emitOp(opPop)
+	// break jumps land after the condition has been popped
+	for _, jump := range loop.breakJumps {
+		c.patchJump(jump)
+	}
+
+	c.current.loop = loop.enclosing
+	return none{}
+}
+
+/******************************************************************************
+ * Expressions
+ *****************************************************************************/
+
+func (c *Compiler) visitAssignExpr(expr AssignExpr) none {
+	c.compileExpression(expr.value)
+	c.namedVariable(expr.name, true)
+	return none{}
+}
+
+var binaryOps = map[TokenType]opCode{
+	tokenTypeGreater:        opGreater,
+	tokenTypeGreaterEqual:   opGreaterEqual,
+	tokenTypeLess:           opLess,
+	tokenTypeLessEqual:      opLessEqual,
+	tokenTypeMinus:          opSubtract,
+	tokenTypePlus:           opAdd,
+	tokenTypeSlash:          opDivide,
+	tokenTypeStar:           opMultiply,
+	tokenTypeMod:            opModulo,
+	tokenTypeAmpersand:      opBitAnd,
+	tokenTypePipe:           opBitOr,
+	tokenTypeCaret:          opBitXor,
+	tokenTypeLessLess:       opShiftLeft,
+	tokenTypeGreaterGreater: opShiftRight,
+	tokenTypeEqualEqual:     opEqual,
+	tokenTypeBangEqual:      opEqual, // followed by opNot
+}
+
+func (c *Compiler) visitBinaryExpr(expr BinaryExpr) none {
+	c.compileExpression(expr.left)
+	c.compileExpression(expr.right)
+	c.at(expr.operator)
+	c.emitOp(binaryOps[expr.operator.tokenType])
+	if expr.operator.tokenType == tokenTypeBangEqual {
+		c.emitOp(opNot)
+	}
+	return none{}
+}
+
+func (c *Compiler) visitCallExpr(expr CallExpr) none {
+	c.compileExpression(expr.callee)
+	for _, arg := range expr.args {
+		c.compileExpression(arg)
+	}
+	c.at(expr.paren)
+	if len(expr.names) > 0 {
+		c.emitOp(opCallNamed)
+		c.emitByte(byte(len(expr.args)))
+		c.emitShort(c.makeConstant(argumentNames(expr.names)))
+		return none{}
+	}
+	c.emitOp(opCall)
+	c.emitByte(byte(len(expr.args)))
+	return none{}
+}
+
+func (c *Compiler) visitConditionalExpr(expr ConditionalExpr) none {
+	c.compileExpression(expr.condition)
+	thenJump := c.emitJump(opJumpIfFalse)
+	c.emitOp(opPop)
+	c.compileExpression(expr.thenBranch)
+	elseJump := c.emitJump(opJump)
+	c.patchJump(thenJump)
+	c.emitOp(opPop)
+	c.compileExpression(expr.elseBranch)
+	c.patchJump(elseJump)
+	return none{}
+}
+
+func (c *Compiler) visitFunctionExpr(expr FunctionExpr) none {
+	c.at(expr.keyword)
+	c.function("", expr.params, expr.variadic, expr.body, ftFunction)
+	return none{}
+}
+
+func (c *Compiler) visitGetExpr(expr GetExpr) none {
+	c.compileExpression(expr.object)
+	c.at(expr.name)
+	c.emitOp(opGetProperty)
+	c.emitShort(c.makeConstant(expr.name.lexeme))
+	return none{}
+}
+
+func (c *Compiler) visitGroupingExpr(expr GroupingExpr) none {
+	c.compileExpression(expr.expression)
+	return none{}
+}
+
+func (c *Compiler) visitListExpr(expr ListExpr) none {
+	for _, element := range expr.elements {
+		c.compileExpression(element)
+	}
+	c.at(expr.bracket)
+	c.checkElementCount(len(expr.elements))
+	c.emitOp(opList)
+	c.emitShort(len(expr.elements))
+	return none{}
+}
+
+func (c *Compiler) visitLiteralExpr(expr LiteralExpr) none {
+	switch expr.value {
+	case nil:
+		c.emitOp(opNil)
+	case true:
+		c.emitOp(opTrue)
+	case false:
+		c.emitOp(opFalse)
+	default:
+		c.emitConstant(expr.value)
+	}
+	return none{}
+}
+
+func (c *Compiler) visitLogicalExpr(expr LogicalExpr) none {
+	c.compileExpression(expr.left)
+	if expr.operator.tokenType == tokenTypeOr {
+		// short circuit when the left operand is truthy
+		elseJump := c.emitJump(opJumpIfFalse)
+		endJump := c.emitJump(opJump)
+		c.patchJump(elseJump)
+		c.emitOp(opPop)
+		c.compileExpression(expr.right)
+		c.patchJump(endJump)
+	} else {
+		// short circuit when the left operand is falsey
+		endJump := c.emitJump(opJumpIfFalse)
+		c.emitOp(opPop)
+		c.compileExpression(expr.right)
+		c.patchJump(endJump)
+	}
+	return none{}
+}
+
+func (c *Compiler) visitMapExpr(expr MapExpr) none {
+	for i := range expr.keys {
+		c.compileExpression(expr.keys[i])
+		c.compileExpression(expr.values[i])
+	}
+	c.at(expr.brace)
+	c.checkElementCount(len(expr.keys))
+	c.emitOp(opMap)
+	c.emitShort(len(expr.keys))
+	return none{}
+}
+
+func (c *Compiler) visitSetExpr(expr SetExpr) none {
+	c.compileExpression(expr.object)
+	c.compileExpression(expr.value)
+	c.at(expr.name)
+	c.emitOp(opSetProperty)
+	c.emitShort(c.makeConstant(expr.name.lexeme))
+	return none{}
+}
+
+func (c *Compiler) visitSubscriptExpr(expr SubscriptExpr) none {
+	c.compileExpression(expr.object)
+	c.compileExpression(expr.index)
+	c.at(expr.bracket)
+	c.emitOp(opGetSubscript)
+	return none{}
+}
+
+func (c *Compiler) visitSubscriptSetExpr(expr SubscriptSetExpr) none {
+	c.compileExpression(expr.object)
+	c.compileExpression(expr.index)
+	c.compileExpression(expr.value)
+	c.at(expr.bracket)
+	c.emitOp(opSetSubscript)
+	return none{}
+}
+
+func (c *Compiler) visitSuperExpr(expr SuperExpr) none {
+	c.at(expr.keyword)
+	c.namedVariable(c.syntheticToken("this"), false)
+	c.namedVariable(c.syntheticToken("super"), false)
+	c.at(expr.method)
+	c.emitOp(opGetSuper)
+	c.emitShort(c.makeConstant(expr.method.lexeme))
+	return none{}
+}
+
+func (c *Compiler) visitThisExpr(expr ThisExpr) none {
+	c.namedVariable(expr.keyword, false)
+	return none{}
+}
+
+func (c *Compiler) visitUnaryExpr(expr UnaryExpr) none {
+	c.compileExpression(expr.right)
+	c.at(expr.operator)
+	if expr.operator.tokenType == tokenTypeBang {
+		c.emitOp(opNot)
+	} else {
+		c.emitOp(opNegate)
+	}
+	return none{}
+}
+
+func (c *Compiler) visitVariableExpr(expr VariableExpr) none {
+	c.namedVariable(expr.name, false)
+	return none{}
+}
@@ -0,0 +1,198 @@
+package lang
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+/******************************************************************************
+ * Coverage counts which way the tree-walk interpreter went at each branch:
+ * how many times the condition of an if, while, or for came out true and
+ * how many times it came out false. A direction that was never taken is
+ * code, or a way out of a loop, that the runs so far haven't tested.
+ * Conditions that are just a literal, like while (true), always go the same
+ * way and aren't counted.
+ *
+ * Coverage is saved as JSON. A saved coverage can be read back and run
+ * again, adding to its counts, so it can collect the branches taken across
+ * many runs of a script, or across a whole test suite.
+ *****************************************************************************/
+
+type Coverage struct {
+	Branches []CoverageBranch    `json:"branches"`
+	index    map[coverageKey]int // index of each branch in Branches
+}
+
+// CoverageBranch is the condition of one if, while, or for and the number of times it was true and false.
+type CoverageBranch struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Kind   string `json:"kind"`   // if, while, or for
+	Source string `json:"source"` // the line the condition starts on
+	True   int64  `json:"true"`
+	False  int64  `json:"false"`
+}
+
+type coverageKey struct {
+	file         string
+	line, column int
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{Branches: make([]CoverageBranch, 0)}
+}
+
+// SetCoverage counts the branches taken while the interpreter runs programs, adding to coverage's counts.
+func (interpreter *Interpreter) SetCoverage(coverage *Coverage) {
+	interpreter.watch().coverage = coverage
+}
+
+func WriteCoverage(w io.Writer, coverage *Coverage) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	// keep the source lines readable, they are never put into HTML
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(coverage)
+}
+
+func ReadCoverage(r io.Reader) (*Coverage, error) {
+	coverage := NewCoverage()
+	if err := json.NewDecoder(r).Decode(coverage); err != nil {
+		return nil, err
+	}
+	return coverage, nil
+}
+
+// branch counts the condition of an if or a loop coming out one way
+func (c *Coverage) branch(file string, stmt Stmt, condition Expr, value bool) {
+	if _, isLiteral := condition.(LiteralExpr); isLiteral {
+		return
+	}
+	if c.index == nil {
+		c.index = make(map[coverageKey]int, len(c.Branches))
+		for i, branch := range c.Branches {
+			c.index[coverageKey{branch.File, branch.Line, branch.Column}] = i
+		}
+	}
+	span := condition.Span()
+	key := coverageKey{file, span.Start.Line, span.Start.Column}
+	i, seen := c.index[key]
+	if !seen {
+		i = len(c.Branches)
+		c.index[key] = i
+		c.Branches = append(c.Branches, CoverageBranch{File: file, Line: span.Start.Line, Column: span.Start.Column,
+			Kind: branchKind(stmt), Source: sourceLine(span)})
+	}
+	if value {
+		c.Branches[i].True++
+	} else {
+		c.Branches[i].False++
+	}
+}
+
+// branchKind tells a for loop from a while loop by its keyword, the parser turns both into a WhileStmt
+func branchKind(stmt Stmt) string {
+	if _, isIf := stmt.(IfStmt); isIf {
+		return "if"
+	}
+	if strings.HasPrefix(traceSource(stmt.Span()), "for") {
+		return "for"
+	}
+	return "while"
+}
+
+// sourceLine returns the line a span starts on, or "" if the span wasn't scanned from source
+func sourceLine(span Span) string {
+	if span.source == "" || span.Start.Offset > len(span.source) {
+		return ""
+	}
+	start := strings.LastIndexByte(span.source[:span.Start.Offset], '\n') + 1
+	end := strings.IndexByte(span.source[span.Start.Offset:], '\n')
+	if end < 0 {
+		return span.source[start:]
+	}
+	return span.source[start : span.Start.Offset+end]
+}
+
+/******************************************************************************
+ * WriteReport lists the branches that were never taken, by file and line,
+ * each with the line the condition is on, and ends with how many of the
+ * branches were taken. Every condition has two, the way it goes when it is
+ * true and the way it goes when it is false:
+ *
+ *   shop.lox:14: if condition was never false (true 6 times)
+ *     14 |     if (item.price > 0) total = total + item.price;
+ *        |         ^
+ *   9 of 10 branches taken (90.0%)
+ *****************************************************************************/
+
+func (c *Coverage) WriteReport(w io.Writer) error {
+	branches := make([]CoverageBranch, len(c.Branches))
+	copy(branches, c.Branches)
+	sort.Slice(branches, func(a, b int) bool {
+		if branches[a].File != branches[b].File {
+			return branches[a].File < branches[b].File
+		}
+		if branches[a].Line != branches[b].Line {
+			return branches[a].Line < branches[b].Line
+		}
+		return branches[a].Column < branches[b].Column
+	})
+	var report strings.Builder
+	taken := 0
+	for _, branch := range branches {
+		if branch.True > 0 {
+			taken++
+		}
+		if branch.False > 0 {
+			taken++
+		}
+		var problem string
+		switch {
+		case branch.True == 0:
+			problem = fmt.Sprintf("was never true (false %s)", times(branch.False))
+		case branch.False == 0:
+			problem = fmt.Sprintf("was never false (true %s)", times(branch.True))
+		default:
+			continue
+		}
+		fmt.Fprintf(&report, "%s:%d: %s condition %s\n", branch.File, branch.Line, branch.Kind, problem)
+		if branch.Source != "" {
+			gutter := strings.Repeat(" ", len(fmt.Sprint(branch.Line)))
+			fmt.Fprintf(&report, "  %d | %s\n", branch.Line, branch.Source)
+			fmt.Fprintf(&report, "  %s | %s^\n", gutter, caretIndent(branch.Source, branch.Column))
+		}
+	}
+	total := 2 * len(branches)
+	share := 100.0
+	if total > 0 {
+		share = 100 * float64(taken) / float64(total)
+	}
+	fmt.Fprintf(&report, "%d of %d branches taken (%.1f%%)\n", taken, total, share)
+	_, err := io.WriteString(w, report.String())
+	return err
+}
+
+func times(count int64) string {
+	if count == 1 {
+		return "once"
+	}
+	return fmt.Sprintf("%d times", count)
+}
+
+// caretIndent returns the space in front of a column of a line, keeping its tabs so a caret lines up under it
+func caretIndent(line string, column int) string {
+	var indent strings.Builder
+	for i := 0; i < column-1 && i < len(line); i++ {
+		if line[i] == '\t' {
+			indent.WriteByte('\t')
+		} else {
+			indent.WriteByte(' ')
+		}
+	}
+	return indent.String()
+}
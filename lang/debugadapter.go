@@ -0,0 +1,575 @@
+package lang
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * A DebugAdapter lets an editor like VS Code drive the debugger with the
+ * Debug Adapter Protocol: JSON messages, each after a Content-Length header,
+ * that set breakpoints, resume and step the program, and look at its call
+ * stack and variables while it is paused. The session goes:
+ *
+ *   initialize               the adapter says what it supports
+ *   launch or attach         picks the script, and whether to stop on entry
+ *   setBreakpoints ...       one request per file
+ *   configurationDone        the script starts running
+ *   stopped events           with stackTrace, scopes, variables, and
+ *                            evaluate requests answered while paused
+ *   exited and terminated    events once the script is over
+ *
+ * "launch" names the script to run. "attach" debugs the script the adapter
+ * was given up front with SetProgram, for when glox was started with the
+ * script and a port to listen on, and the editor connects to it.
+ *
+ * The protocol is read on one goroutine and the script runs on another.
+ * When the script pauses, its goroutine waits for a resume command, and
+ * until then the stack and environments hold still, so requests about them
+ * are answered straight from the protocol's goroutine. Stack frames are
+ * numbered from 1 at the script's frame, and each environment in a frame's
+ * chain is a scope. Lists, maps, and instances can be opened up to show
+ * what they hold. The references handed out for them only last until the
+ * script resumes, as the protocol expects.
+ *****************************************************************************/
+
+type DebugAdapter struct {
+	in        *bufio.Reader
+	out       io.Writer
+	writing   sync.Mutex // messages are written by both goroutines
+	seq       int
+	debugger  *Debugger
+	program   string    // path of the script to debug
+	output    io.Writer // where the script's output goes, nil for output events
+	entry     bool      // pause before the first statement
+	run       func()    // runs the script once configuration is done
+	script    *Interpreter
+	done      chan int // receives the exit code once the script is over
+	mutex     sync.Mutex
+	paused    *Interpreter // the interpreter waiting in stopped, nil while the script runs
+	resume    chan func()  // run on the script's goroutine as it resumes
+	variables []any        // what each variables reference, starting at 1, stands for while paused
+}
+
+type dapMessage struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+func NewDebugAdapter(in io.Reader, out io.Writer) *DebugAdapter {
+	adapter := &DebugAdapter{in: bufio.NewReader(in), out: out, done: make(chan int, 1), resume: make(chan func())}
+	adapter.debugger = NewDebugger(bufio.NewReader(strings.NewReader("")), dapOutput{adapter, "console"})
+	adapter.debugger.adapter = adapter
+	return adapter
+}
+
+// SetProgram picks the script for an editor that attaches, and where its output goes, nil for output events.
+func (a *DebugAdapter) SetProgram(path string, output io.Writer) {
+	a.program, a.output = path, output
+}
+
+/******************************************************************************
+ * Serve answers requests until the editor disconnects or closes the
+ * connection, and returns the script's exit code, or 0 if it never ran. A
+ * script that is still running then is stopped.
+ *****************************************************************************/
+
+func (a *DebugAdapter) Serve() int {
+	for {
+		message, err := a.read()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, "glox dap:", err)
+			}
+			return a.stop()
+		}
+		if message.Type != "request" {
+			continue
+		}
+		body, err := a.handle(message)
+		response := dapResponse{Type: "response", RequestSeq: message.Seq, Success: err == nil,
+			Command: message.Command, Body: body}
+		if err != nil {
+			response.Message = err.Error()
+		}
+		a.write(&response)
+		switch message.Command {
+		case "initialize":
+			a.event("initialized", nil)
+		case "configurationDone":
+			if err == nil {
+				go a.run()
+			}
+		case "disconnect", "terminate":
+			return a.stop()
+		}
+	}
+}
+
+// stop ends the script if it is still running and waits for it to finish
+func (a *DebugAdapter) stop() int {
+	if a.script == nil {
+		return 0
+	}
+	a.script.Cancel()
+	for {
+		select {
+		case code := <-a.done:
+			return code
+		case a.resume <- func() {}:
+			// it was paused, and stopped will let it go straight on from now
+		}
+	}
+}
+
+func (a *DebugAdapter) handle(message *dapMessage) (any, error) {
+	switch message.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest":  true,
+			"supportsConditionalBreakpoints":    true,
+			"supportsHitConditionalBreakpoints": true,
+			"supportsEvaluateForHovers":         true,
+			"supportsTerminateRequest":          true,
+		}, nil
+	case "launch", "attach":
+		var arguments struct {
+			Program     string `json:"program"`
+			StopOnEntry bool   `json:"stopOnEntry"`
+		}
+		json.Unmarshal(message.Arguments, &arguments)
+		if message.Command == "launch" {
+			a.program, a.output = arguments.Program, nil
+		}
+		if a.program == "" {
+			return nil, fmt.Errorf("There is no program to %s, give its path as \"program\".", message.Command)
+		}
+		a.entry = arguments.StopOnEntry
+		return nil, nil
+	case "setBreakpoints":
+		return a.setBreakpoints(message.Arguments)
+	case "configurationDone":
+		return nil, a.start()
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": 1, "name": "main"}}}, nil
+	case "continue", "next", "stepIn", "stepOut":
+		return map[string]any{"allThreadsContinued": true}, a.step(message.Command)
+	case "pause":
+		a.debugger.interrupt.Store(true)
+		return nil, nil
+	case "stackTrace":
+		return a.stackTrace()
+	case "scopes":
+		return a.scopes(message.Arguments)
+	case "variables":
+		return a.listVariables(message.Arguments)
+	case "evaluate":
+		return a.evaluate(message.Arguments)
+	case "disconnect", "terminate":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("glox doesn't support %s.", message.Command)
+}
+
+/******************************************************************************
+ * Breakpoints are set a whole file at a time, replacing the ones the file
+ * had. A hit condition is the number of the hit to first pause on, so "3"
+ * lets the line run twice before pausing.
+ *****************************************************************************/
+
+func (a *DebugAdapter) setBreakpoints(raw json.RawMessage) (any, error) {
+	var arguments struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line         int    `json:"line"`
+			Condition    string `json:"condition"`
+			HitCondition string `json:"hitCondition"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &arguments); err != nil {
+		return nil, err
+	}
+	file := arguments.Source.Path
+	if absolute, err := filepath.Abs(file); err == nil {
+		file = absolute
+	}
+	d := a.debugger
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	kept := make([]*breakpoint, 0, len(d.breakpoints))
+	for _, b := range d.breakpoints {
+		if b.file != file {
+			kept = append(kept, b)
+		}
+	}
+	results := make([]map[string]any, 0, len(arguments.Breakpoints))
+	for _, requested := range arguments.Breakpoints {
+		d.nextId++
+		b := &breakpoint{id: d.nextId, file: file, line: requested.Line, condition: strings.TrimSpace(requested.Condition)}
+		result := map[string]any{"id": b.id, "line": b.line, "verified": true}
+		if hits, err := strconv.Atoi(strings.TrimSpace(requested.HitCondition)); err == nil && hits > 1 {
+			b.ignore = hits - 1
+		} else if requested.HitCondition != "" && err != nil {
+			result["verified"], result["message"] = false, "The hit condition has to be a number."
+		}
+		if b.condition != "" {
+			d.errorHandler.HadError = false
+			if _, program := d.frontEnd.analyzeExpression(b.condition); program == nil {
+				result["verified"], result["message"] = false, "The condition isn't a valid expression."
+			}
+		}
+		if result["verified"] == true {
+			kept = append(kept, b)
+		}
+		results = append(results, result)
+	}
+	d.breakpoints = kept
+	return map[string]any{"breakpoints": results}, nil
+}
+
+// start gets the script ready to run on a goroutine of its own
+func (a *DebugAdapter) start() error {
+	source, err := os.ReadFile(a.program)
+	if err != nil {
+		return err
+	}
+	errorHandler := NewErrorHandler()
+	errorHandler.File = a.program
+	interpreter := NewInterpreter(errorHandler)
+	interpreter.SetScriptPath(a.program)
+	if a.output != nil {
+		interpreter.SetOutput(a.output)
+		errorHandler.Output = a.output
+	} else {
+		interpreter.SetOutput(dapOutput{a, "stdout"})
+		interpreter.SetInput(strings.NewReader(""))
+		errorHandler.Output = dapOutput{a, "stderr"}
+	}
+	interpreter.SetDebugger(a.debugger)
+	if a.entry {
+		a.debugger.Step()
+	}
+	a.script = interpreter
+	a.run = func() {
+		code := 0
+		if program := NewFrontEnd(errorHandler).Analyze(string(source)); program == nil {
+			code = 65
+		} else if interpreter.Compile(program) == nil {
+			err := interpreter.Run()
+			if hookErr := interpreter.RunExitHooks(); hookErr != nil {
+				if _, isExit := hookErr.(ExitError); isExit {
+					err = hookErr
+				}
+			}
+			if exit, isExit := err.(ExitError); isExit {
+				code = exit.Code
+			} else if errorHandler.HadRuntimeError {
+				code = 70
+			}
+		}
+		interpreter.flushOutput()
+		a.event("exited", map[string]any{"exitCode": code})
+		a.event("terminated", nil)
+		a.done <- code
+	}
+	return nil
+}
+
+/******************************************************************************
+ * stopped is where the script's goroutine waits while it is paused, after
+ * telling the editor why it stopped.
+ *****************************************************************************/
+
+func (a *DebugAdapter) stopped(interpreter *Interpreter, reason string) {
+	if interpreter.interrupts.cancelled.Load() {
+		return // the editor has disconnected
+	}
+	interpreter.flushOutput()
+	a.mutex.Lock()
+	a.paused = interpreter
+	a.mutex.Unlock()
+	event := map[string]any{"reason": reason, "threadId": 1, "allThreadsStopped": true}
+	if a.entry {
+		event["reason"] = "entry"
+		a.entry = false
+	} else if strings.HasPrefix(reason, "breakpoint") {
+		event["reason"] = "breakpoint"
+		event["description"] = "Paused on " + reason
+	}
+	a.event("stopped", event)
+	resume := <-a.resume
+	a.mutex.Lock()
+	a.paused = nil
+	a.variables = nil
+	a.mutex.Unlock()
+	resume()
+}
+
+// step resumes the paused script, setting up the debugger to pause again where the command says
+func (a *DebugAdapter) step(command string) error {
+	a.mutex.Lock()
+	paused := a.paused
+	a.mutex.Unlock()
+	if paused == nil {
+		return nil
+	}
+	d := a.debugger
+	depth := len(paused.stack.frames)
+	a.resume <- func() {
+		switch command {
+		case "next":
+			d.stepping, d.stepDepth, d.stepLines = true, depth, true
+		case "stepIn":
+			d.stepping, d.stepDepth, d.stepLines = true, 0, true
+		case "stepOut":
+			d.stepping, d.stepDepth, d.stepLines = true, depth-1, true
+		}
+	}
+	return nil
+}
+
+// pausedStack returns the call stack of the paused script, or an error if it is running
+func (a *DebugAdapter) pausedStack() (*callStack, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.paused == nil {
+		return nil, fmt.Errorf("The program isn't paused.")
+	}
+	return a.paused.stack, nil
+}
+
+func (a *DebugAdapter) stackTrace() (any, error) {
+	stack, err := a.pausedStack()
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]map[string]any, 0, len(stack.frames))
+	for i := len(stack.frames) - 1; i >= 0; i-- {
+		frame := stack.frames[i]
+		frames = append(frames, map[string]any{
+			"id": i + 1, "name": frame.name, "line": frame.line, "column": 1,
+			"source": map[string]any{"name": filepath.Base(frame.interpreter.file), "path": frame.interpreter.file},
+		})
+	}
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+// frame returns the stack frame with an id handed out by stackTrace, the innermost one for 0
+func (a *DebugAdapter) frame(id int) (stackFrame, error) {
+	stack, err := a.pausedStack()
+	if err != nil {
+		return stackFrame{}, err
+	}
+	if id == 0 {
+		id = len(stack.frames)
+	}
+	if id < 1 || id > len(stack.frames) {
+		return stackFrame{}, fmt.Errorf("There is no frame %d.", id)
+	}
+	return stack.frames[id-1], nil
+}
+
+func (a *DebugAdapter) scopes(raw json.RawMessage) (any, error) {
+	var arguments struct {
+		FrameID int `json:"frameId"`
+	}
+	json.Unmarshal(raw, &arguments)
+	frame, err := a.frame(arguments.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]map[string]any, 0)
+	for env := frame.env; env != nil; env = env.enclosing {
+		name := "Enclosing"
+		if env.enclosing == nil {
+			name = "Globals"
+		} else if env == frame.env {
+			name = "Locals"
+		}
+		scopes = append(scopes, map[string]any{"name": name, "variablesReference": a.reference(env),
+			"expensive": env.enclosing == nil})
+	}
+	return map[string]any{"scopes": scopes}, nil
+}
+
+// reference hands out a variables reference for a scope or a value with parts, 0 for a value without any
+func (a *DebugAdapter) reference(value any) int {
+	switch value.(type) {
+	case *environment, *runtime.List, *runtime.Map, *runtime.Instance:
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		a.variables = append(a.variables, value)
+		return len(a.variables)
+	}
+	return 0
+}
+
+func (a *DebugAdapter) listVariables(raw json.RawMessage) (any, error) {
+	var arguments struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	json.Unmarshal(raw, &arguments)
+	a.mutex.Lock()
+	if arguments.VariablesReference < 1 || arguments.VariablesReference > len(a.variables) {
+		a.mutex.Unlock()
+		return nil, fmt.Errorf("The program has resumed since those variables were listed.")
+	}
+	value := a.variables[arguments.VariablesReference-1]
+	a.mutex.Unlock()
+
+	variables := make([]dapVariable, 0)
+	add := func(name string, value runtime.Value) {
+		variables = append(variables, dapVariable{Name: name, Value: debugValue(value),
+			VariablesReference: a.reference(value)})
+	}
+	switch value := value.(type) {
+	case *environment:
+		names := make([]string, 0, len(value.values))
+		for name, variable := range value.values {
+			if _, isNative := variable.(*runtime.NativeFunction); !isNative {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(name, value.values[name])
+		}
+	case *runtime.List:
+		for i, element := range value.Elements() {
+			add(strconv.Itoa(i), element)
+		}
+	case *runtime.Map:
+		for _, key := range value.Keys() {
+			element, _ := value.Get(key)
+			add(debugValue(key), element)
+		}
+	case *runtime.Instance:
+		for _, name := range value.FieldNames() {
+			field, _ := value.Field(name)
+			add(name, field)
+		}
+	}
+	return map[string]any{"variables": variables}, nil
+}
+
+// evaluate evaluates an expression in a paused frame, for the debug console, watches, and hovers
+func (a *DebugAdapter) evaluate(raw json.RawMessage) (any, error) {
+	var arguments struct {
+		Expression string `json:"expression"`
+		FrameID    int    `json:"frameId"`
+	}
+	json.Unmarshal(raw, &arguments)
+	frame, err := a.frame(arguments.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	d := a.debugger
+	output := d.errorHandler.Output
+	d.errorHandler.Output = io.Discard
+	reported := len(d.errorHandler.Diagnostics)
+	value, ok := d.evaluate(frame, arguments.Expression)
+	d.errorHandler.Output = output
+	if !ok {
+		if len(d.errorHandler.Diagnostics) > reported {
+			return nil, fmt.Errorf("%s", d.errorHandler.Diagnostics[len(d.errorHandler.Diagnostics)-1].Message)
+		}
+		return nil, fmt.Errorf("'%s' couldn't be evaluated.", arguments.Expression)
+	}
+	return map[string]any{"result": debugValue(value), "variablesReference": a.reference(value)}, nil
+}
+
+/******************************************************************************
+ * Reading and writing messages, each a JSON object after a Content-Length
+ * header, the same framing the Language Server Protocol uses.
+ *****************************************************************************/
+
+func (a *DebugAdapter) read() (*dapMessage, error) {
+	headers, err := textproto.NewReader(a.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length header '%s'", headers.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(a.in, body); err != nil {
+		return nil, err
+	}
+	message := &dapMessage{}
+	if err := json.Unmarshal(body, message); err != nil {
+		return nil, fmt.Errorf("bad message: %v", err)
+	}
+	return message, nil
+}
+
+func (a *DebugAdapter) write(message any) {
+	a.writing.Lock()
+	defer a.writing.Unlock()
+	a.seq++
+	switch message := message.(type) {
+	case *dapResponse:
+		message.Seq = a.seq
+	case *dapEvent:
+		message.Seq = a.seq
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glox dap:", err)
+		return
+	}
+	fmt.Fprintf(a.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (a *DebugAdapter) event(name string, body any) {
+	a.write(&dapEvent{Type: "event", Event: name, Body: body})
+}
+
+// dapOutput sends what is written to it to the editor as output events
+type dapOutput struct {
+	adapter  *DebugAdapter
+	category string // stdout, stderr, or console
+}
+
+func (o dapOutput) Write(p []byte) (int, error) {
+	o.adapter.event("output", map[string]any{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,488 @@
+package lang
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The debugger pauses a running program and gives the user a prompt to look
+ * around from. While paused, expressions are evaluated in the selected frame
+ * of the call stack, the innermost one to begin with, so they see the same
+ * variables the code on that line does.
+ *
+ * Expressions typed at the prompt are resolved on their own, without the
+ * scopes of the code they are evaluated in, so every variable they use is
+ * looked up by name through the frame's environment chain. This finds the
+ * same variable the frame would, since a frame's environments only hold the
+ * variables its code can see.
+ *
+ * Besides calls to the breakpoint native, the program pauses at breakpoints
+ * set on a line from the prompt. A breakpoint can have a condition, a Lox
+ * expression evaluated in the frame about to run the line, and only pauses
+ * when it is true. It can also be told to ignore its next few hits, which
+ * together make it practical to stop on the one iteration of a loop that
+ * goes wrong. A line counts as hit when a frame moves onto it, so a line
+ * holding several statements only pauses once.
+ *
+ * Watch expressions are evaluated again every time the program pauses, in
+ * the frame it paused in. Variables in the selected frame can be given new
+ * values with set before resuming, which is handy for trying out a fix
+ * without starting over.
+ *
+ * An editor can drive the debugger in place of the prompt, through a
+ * DebugAdapter (see debugadapter.go). It can also step over a line or out
+ * of a function, and ask a running program to pause.
+ *****************************************************************************/
+
+const debuggerHelp = `Commands:
+  c, continue     resume the program
+  s, step         pause again before the next statement
+  b, break <line> [if <condition>]
+                  pause before a line runs, the line can be given as file:line
+  ignore <n> <count>
+                  let breakpoint n be hit count times before it pauses
+  delete <n>      remove breakpoint n
+  breakpoints     list the breakpoints
+  p, print <expr> evaluate an expression in the selected frame
+  <expr>          the same as print
+  watch [<expr>]  show an expression's value every time the program pauses,
+                  or list the watch expressions
+  unwatch <n>     remove watch expression n
+  set <name> = <expr>
+                  assign a variable in the selected frame
+  vars            list the variables in scope in the selected frame
+  bt, where       show the call stack
+  up, down        select the frame that called, or was called by, the selected one
+  q, quit         stop the program
+  h, help         show this message`
+
+type Debugger struct {
+	in           *bufio.Reader
+	out          io.Writer
+	errorHandler *ErrorHandler // reports problems with what is typed at the prompt
+	frontEnd     *FrontEnd
+	adapter      *DebugAdapter // takes the place of the prompt for an editor, see debugadapter.go
+	selected     int           // index of the selected frame while paused
+	mutex        sync.Mutex    // guards breakpoints, which an adapter changes while the program runs
+	breakpoints  []*breakpoint
+	nextId       int
+	stepping     bool
+	stepDepth    int  // when stepping, only pause in a frame this deep or shallower, 0 for any frame
+	stepLines    bool // when stepping, only pause on a new line
+	interrupt    atomic.Bool
+	evaluating   bool // set while running code for the prompt, which shouldn't pause
+	lastLine     int  // line and stack depth of the last statement checked
+	lastDepth    int
+	watches      []string
+}
+
+type breakpoint struct {
+	id        int
+	file      string // empty for the script being run
+	line      int
+	condition string // empty to always pause
+	ignore    int    // hits left to ignore
+	hits      int
+}
+
+func NewDebugger(in *bufio.Reader, out io.Writer) *Debugger {
+	errorHandler := NewErrorHandler()
+	errorHandler.Output = out
+	return &Debugger{in: in, out: out, errorHandler: errorHandler, frontEnd: NewFrontEnd(errorHandler)}
+}
+
+// SetDebugger lets the program pause, nil turns debugging off.
+func (interpreter *Interpreter) SetDebugger(debugger *Debugger) {
+	interpreter.watch().debugger = debugger
+}
+
+// Step pauses the program before the next statement it executes, e.g. to set breakpoints before it starts.
+func (d *Debugger) Step() {
+	d.stepping = true
+}
+
+// check is called before every statement to see whether the program should pause there
+func (d *Debugger) check(interpreter *Interpreter) {
+	if d.evaluating {
+		return
+	}
+	stack := interpreter.stack
+	frame := stack.frames[len(stack.frames)-1]
+	newLine := frame.line != d.lastLine || len(stack.frames) != d.lastDepth
+	d.lastLine, d.lastDepth = frame.line, len(stack.frames)
+	if d.interrupt.Swap(false) {
+		d.pause(interpreter, "pause")
+		return
+	}
+	if d.stepping && (d.stepDepth == 0 || len(stack.frames) <= d.stepDepth) && (newLine || !d.stepLines) {
+		d.pause(interpreter, "step")
+		return
+	}
+	if !newLine {
+		return
+	}
+	d.mutex.Lock()
+	breakpoints := d.breakpoints
+	d.mutex.Unlock()
+	for _, b := range breakpoints {
+		if b.line != frame.line || !b.matches(interpreter, stack) {
+			continue
+		}
+		reason := "breakpoint " + strconv.Itoa(b.id)
+		if b.condition != "" {
+			value, ok := d.evaluate(frame, b.condition)
+			if !ok {
+				reason += ", its condition failed"
+			} else if !runtime.IsTruthy(value) {
+				continue
+			}
+		}
+		b.hits++
+		if b.ignore > 0 {
+			b.ignore--
+			continue
+		}
+		d.pause(interpreter, reason)
+		return
+	}
+}
+
+// matches reports whether the breakpoint is in the file the interpreter is running
+func (b *breakpoint) matches(interpreter *Interpreter, stack *callStack) bool {
+	if b.file == "" {
+		return interpreter.file == stack.frames[0].interpreter.file
+	}
+	return interpreter.file == b.file || strings.HasSuffix(interpreter.file, string(filepath.Separator)+b.file)
+}
+
+// pause stops the program and runs the debugger's prompt until the user resumes it
+func (d *Debugger) pause(interpreter *Interpreter, reason string) {
+	d.stepping, d.stepDepth, d.stepLines = false, 0, false
+	if d.adapter != nil {
+		d.adapter.stopped(interpreter, reason)
+		return
+	}
+	stack := interpreter.stack
+	d.selected = len(stack.frames) - 1
+	fmt.Fprintf(d.out, "Paused at line %d in %s (%s).\n", stack.frames[d.selected].line,
+		stack.frames[d.selected].name, reason)
+	d.printWatches(stack.frames[d.selected])
+	for {
+		fmt.Fprint(d.out, "(debug) ")
+		line, err := d.in.ReadString('\n')
+		if err != nil {
+			// nothing more can be typed, so let the program finish
+			fmt.Fprintln(d.out)
+			return
+		}
+		command, argument, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch command {
+		case "":
+		case "c", "continue":
+			return
+		case "s", "step":
+			d.stepping = true
+			return
+		case "b", "break":
+			d.addBreakpoint(argument)
+		case "ignore":
+			d.ignoreBreakpoint(argument)
+		case "delete":
+			d.deleteBreakpoint(argument)
+		case "breakpoints":
+			d.printBreakpoints()
+		case "q", "quit":
+			interpreter.Cancel()
+			return
+		case "h", "help":
+			fmt.Fprintln(d.out, debuggerHelp)
+		case "vars":
+			d.printVariables(stack.frames[d.selected])
+		case "bt", "where":
+			d.printStack(stack)
+		case "up":
+			d.selectFrame(stack, d.selected-1)
+		case "down":
+			d.selectFrame(stack, d.selected+1)
+		case "watch":
+			d.addWatch(stack.frames[d.selected], argument)
+		case "unwatch":
+			d.removeWatch(argument)
+		case "set":
+			d.setVariable(stack.frames[d.selected], argument)
+		case "p", "print":
+			d.printExpression(stack.frames[d.selected], argument)
+		default:
+			d.printExpression(stack.frames[d.selected], strings.TrimSpace(line))
+		}
+	}
+}
+
+// addBreakpoint sets a breakpoint from a "[file:]line [if condition]" description
+func (d *Debugger) addBreakpoint(description string) {
+	location, condition, hasCondition := strings.Cut(strings.TrimSpace(description), " if ")
+	location = strings.TrimSpace(location)
+	file := ""
+	if colon := strings.LastIndex(location, ":"); colon >= 0 {
+		file, location = location[:colon], location[colon+1:]
+	}
+	line, err := strconv.Atoi(location)
+	if err != nil || line < 1 {
+		fmt.Fprintln(d.out, "Expect a line number, optionally preceded by a file and ':'.")
+		return
+	}
+	condition = strings.TrimSpace(condition)
+	if hasCondition {
+		// catch syntax errors now rather than every time the line runs
+		d.errorHandler.HadError = false
+		if _, program := d.frontEnd.analyzeExpression(condition); program == nil {
+			return
+		}
+	}
+	d.nextId++
+	b := &breakpoint{id: d.nextId, file: file, line: line, condition: condition}
+	d.breakpoints = append(d.breakpoints, b)
+	fmt.Fprintf(d.out, "Breakpoint %d at %s.\n", b.id, b.location())
+}
+
+func (d *Debugger) ignoreBreakpoint(arguments string) {
+	fields := strings.Fields(arguments)
+	if len(fields) != 2 {
+		fmt.Fprintln(d.out, "Expect a breakpoint number and a count.")
+		return
+	}
+	b := d.findBreakpoint(fields[0])
+	count, err := strconv.Atoi(fields[1])
+	if b == nil {
+		return
+	} else if err != nil || count < 0 {
+		fmt.Fprintln(d.out, "Expect the count to be a whole number.")
+		return
+	}
+	b.ignore = count
+	fmt.Fprintf(d.out, "Breakpoint %d will ignore its next %d hits.\n", b.id, count)
+}
+
+func (d *Debugger) deleteBreakpoint(argument string) {
+	b := d.findBreakpoint(argument)
+	if b == nil {
+		return
+	}
+	for i, other := range d.breakpoints {
+		if other == b {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			break
+		}
+	}
+	fmt.Fprintf(d.out, "Deleted breakpoint %d.\n", b.id)
+}
+
+func (d *Debugger) findBreakpoint(argument string) *breakpoint {
+	id, _ := strconv.Atoi(strings.TrimSpace(argument))
+	for _, b := range d.breakpoints {
+		if b.id == id {
+			return b
+		}
+	}
+	fmt.Fprintln(d.out, "There is no breakpoint "+strings.TrimSpace(argument)+".")
+	return nil
+}
+
+func (d *Debugger) printBreakpoints() {
+	if len(d.breakpoints) == 0 {
+		fmt.Fprintln(d.out, "There are no breakpoints.")
+	}
+	for _, b := range d.breakpoints {
+		fmt.Fprintf(d.out, "%d: %s", b.id, b.location())
+		if b.condition != "" {
+			fmt.Fprintf(d.out, " if %s", b.condition)
+		}
+		fmt.Fprintf(d.out, ", hit %d times", b.hits)
+		if b.ignore > 0 {
+			fmt.Fprintf(d.out, ", ignoring the next %d", b.ignore)
+		}
+		fmt.Fprintln(d.out)
+	}
+}
+
+func (b *breakpoint) location() string {
+	if b.file == "" {
+		return "line " + strconv.Itoa(b.line)
+	}
+	return b.file + ":" + strconv.Itoa(b.line)
+}
+
+func (d *Debugger) addWatch(frame stackFrame, source string) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		for i, watch := range d.watches {
+			fmt.Fprintf(d.out, "%d: %s\n", i+1, watch)
+		}
+		return
+	}
+	d.errorHandler.HadError = false
+	if _, program := d.frontEnd.analyzeExpression(source); program == nil {
+		return
+	}
+	d.watches = append(d.watches, source)
+	d.printWatch(frame, len(d.watches))
+}
+
+func (d *Debugger) removeWatch(argument string) {
+	n, err := strconv.Atoi(strings.TrimSpace(argument))
+	if err != nil || n < 1 || n > len(d.watches) {
+		fmt.Fprintln(d.out, "There is no watch expression "+strings.TrimSpace(argument)+".")
+		return
+	}
+	d.watches = append(d.watches[:n-1], d.watches[n:]...)
+}
+
+func (d *Debugger) printWatches(frame stackFrame) {
+	for n := range d.watches {
+		d.printWatch(frame, n+1)
+	}
+}
+
+// printWatch shows the value of watch expression n, or the error evaluating it ran into
+func (d *Debugger) printWatch(frame stackFrame, n int) {
+	fmt.Fprintf(d.out, "%d: %s = ", n, d.watches[n-1])
+	if value, ok := d.evaluate(frame, d.watches[n-1]); ok {
+		fmt.Fprintln(d.out, debugValue(value))
+	}
+}
+
+// setVariable assigns to the variable a name refers to in the frame, from a "name = expr" description
+func (d *Debugger) setVariable(frame stackFrame, description string) {
+	name, source, hasValue := strings.Cut(description, "=")
+	name = strings.TrimSpace(name)
+	if !hasValue || !isIdentifier(name) {
+		fmt.Fprintln(d.out, "Expect a variable name, '=', and a value.")
+		return
+	}
+	distance := 0
+	env := frame.env
+	for ; env != nil; env = env.enclosing {
+		if _, found := env.values[name]; found {
+			break
+		}
+		distance++
+	}
+	if env == nil {
+		fmt.Fprintln(d.out, "Undefined variable '"+name+"'.")
+		return
+	}
+	value, ok := d.evaluate(frame, source)
+	if !ok {
+		return
+	}
+	frame.env.assignAt(distance, Token{tokenType: tokenTypeIdentifier, lexeme: name, line: frame.line}, value)
+	fmt.Fprintln(d.out, name+" = "+debugValue(value))
+}
+
+func (d *Debugger) selectFrame(stack *callStack, index int) {
+	if index < 0 || index >= len(stack.frames) {
+		fmt.Fprintln(d.out, "There is no frame in that direction.")
+		return
+	}
+	d.selected = index
+	frame := stack.frames[index]
+	fmt.Fprintf(d.out, "%s at line %d\n", frame.name, frame.line)
+}
+
+// printStack lists the frames innermost first, marking the selected one
+func (d *Debugger) printStack(stack *callStack) {
+	for i := len(stack.frames) - 1; i >= 0; i-- {
+		marker := "  "
+		if i == d.selected {
+			marker = "> "
+		}
+		frame := stack.frames[i]
+		fmt.Fprintf(d.out, "%s%s at line %d\n", marker, frame.name, frame.line)
+	}
+}
+
+// printVariables lists each scope of the frame's environment chain, innermost first
+func (d *Debugger) printVariables(frame stackFrame) {
+	for env := frame.env; env != nil; env = env.enclosing {
+		scope := "local"
+		if env.enclosing == nil {
+			scope = "global"
+		}
+		names := make([]string, 0, len(env.values))
+		for name, value := range env.values {
+			if _, isNative := value.(*runtime.NativeFunction); !isNative {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(d.out, "  %s %s = %s\n", scope, name, debugValue(env.values[name]))
+		}
+	}
+}
+
+func (d *Debugger) printExpression(frame stackFrame, source string) {
+	value, ok := d.evaluate(frame, source)
+	if ok {
+		fmt.Fprintln(d.out, debugValue(value))
+	}
+}
+
+/******************************************************************************
+ * evaluate runs an expression against a frame with a copy of the frame's
+ * interpreter. The copy treats the frame's environment as its globals, so
+ * variables that weren't resolved to a scope are looked up through the
+ * frame's whole environment chain. Errors are reported at the prompt and
+ * don't count against the program.
+ *****************************************************************************/
+
+func (d *Debugger) evaluate(frame stackFrame, source string) (value runtime.Value, ok bool) {
+	d.errorHandler.HadError = false
+	expr, program := d.frontEnd.analyzeExpression(source)
+	if program == nil {
+		return nil, false
+	}
+	d.evaluating = true
+	defer func() {
+		d.evaluating = false
+	}()
+	evaluator := *frame.interpreter
+	evaluator.globals = frame.env
+	evaluator.env = frame.env
+	evaluator.locals = program.locals
+	if evaluator.hooks != nil {
+		// what the debugger evaluates isn't part of the recorded run
+		watched := *evaluator.hooks
+		watched.recorder = nil
+		evaluator.hooks = &watched
+	}
+	evaluator.errorHandler = d.errorHandler
+	hadRuntimeError := frame.interpreter.errorHandler.HadRuntimeError
+	defer func() {
+		frame.interpreter.errorHandler.HadRuntimeError = hadRuntimeError
+	}()
+	var err error
+	func() {
+		defer evaluator.catchRuntimeError(&err)
+		value = evaluator.evaluate(expr)
+	}()
+	return value, err == nil
+}
+
+// debugValue formats a value the way it would be written in code, so strings are quoted
+func debugValue(value runtime.Value) string {
+	if str, isString := value.(string); isString {
+		return strconv.Quote(str)
+	}
+	return runtime.Stringify(value)
+}
@@ -0,0 +1,199 @@
+package lang
+
+import (
+	"fmt"
+	"strings"
+)
+
+/******************************************************************************
+ * unifiedDiff compares two texts line by line and describes how to turn the
+ * first into the second in the unified format diff -u and git use. Changed
+ * lines are grouped into hunks with up to three unchanged lines around
+ * them, each under a header giving the lines it covers:
+ *
+ *   --- a
+ *   +++ b
+ *   @@ -2,3 +2,3 @@
+ *    two
+ *   -three
+ *   +3
+ *    four
+ *
+ * A last line without a newline is marked as such, so texts that differ
+ * only there still show a difference. The edits come from Myers' algorithm,
+ * which finds the fewest lines to delete and insert, after the lines the
+ * texts start and end with in common are set aside.
+ *****************************************************************************/
+
+const diffContext = 3
+
+type diffEdit struct {
+	kind byte // ' ' for a line in both, '-' for one only in a, '+' for one only in b
+	a, b int  // indexes of the line in a and b, or of the next one where it isn't in that text
+}
+
+func unifiedDiff(a string, b string) string {
+	aLines, bLines := diffLines(a), diffLines(b)
+	edits := diffEdits(aLines, bLines)
+	var sb strings.Builder
+	for start := 0; start < len(edits); {
+		// find the next change, then extend the hunk until the changes are far enough apart
+		for start < len(edits) && edits[start].kind == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		end := start
+		for i := start; i < len(edits); i++ {
+			if edits[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+		first, last := max(start-diffContext, 0), min(end+diffContext, len(edits))
+		if sb.Len() == 0 {
+			sb.WriteString("--- a\n+++ b\n")
+		}
+		writeHunk(&sb, edits[first:last], aLines, bLines)
+		start = last
+	}
+	return sb.String()
+}
+
+// diffLines splits text into lines, each keeping its newline so a missing one at the end counts as a change
+func diffLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func writeHunk(sb *strings.Builder, edits []diffEdit, aLines []string, bLines []string) {
+	aCount, bCount := 0, 0
+	for _, edit := range edits {
+		if edit.kind != '+' {
+			aCount++
+		}
+		if edit.kind != '-' {
+			bCount++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(edits[0].a, aCount), hunkRange(edits[0].b, bCount))
+	for _, edit := range edits {
+		var line string
+		if edit.kind == '+' {
+			line = bLines[edit.b]
+		} else {
+			line = aLines[edit.a]
+		}
+		sb.WriteByte(edit.kind)
+		sb.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the first line and number of lines of a hunk, leaving the number out when it is 1
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		// an empty range names the line before it
+		return fmt.Sprintf("%d,0", start)
+	} else if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func diffEdits(a []string, b []string) []diffEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	edits := make([]diffEdit, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, diffEdit{' ', i, i})
+	}
+	for _, edit := range myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		edits = append(edits, diffEdit{edit.kind, edit.a + prefix, edit.b + prefix})
+	}
+	for i := suffix; i > 0; i-- {
+		edits = append(edits, diffEdit{' ', len(a) - i, len(b) - i})
+	}
+	return edits
+}
+
+/******************************************************************************
+ * myersDiff follows every path through the edit graph that uses d deletions
+ * and insertions, for d = 0, 1, 2, and so on, until one reaches the end of
+ * both texts. Along each diagonal k it only keeps the furthest x reached, in
+ * v[k]. The v of each round is saved so the path can be walked back from
+ * the end, and only the diagonals a round can reach are saved, which keeps
+ * the memory used to the square of the number of edits.
+ *****************************************************************************/
+
+func myersDiff(a []string, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	trace := make([][]int, 0)
+	x, y := 0, 0
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down, inserting from b
+			} else {
+				x = v[offset+k-1] + 1 // right, deleting from a
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x == n && y == m {
+				break search
+			}
+		}
+	}
+
+	edits := make([]diffEdit, 0, n+m)
+	for d := len(trace) - 1; d >= 0; d-- {
+		previous := trace[d] // v before round d, indexed from diagonal -d-1
+		k := x - y
+		previousK := k - 1
+		if k == -d || (k != d && previous[k-1+d+1] < previous[k+1+d+1]) {
+			previousK = k + 1
+		}
+		previousX := previous[previousK+d+1]
+		previousY := previousX - previousK
+		for x > previousX && y > previousY {
+			x--
+			y--
+			edits = append(edits, diffEdit{' ', x, y})
+		}
+		if d > 0 {
+			if x == previousX {
+				y--
+				edits = append(edits, diffEdit{'+', x, y})
+			} else {
+				x--
+				edits = append(edits, diffEdit{'-', x, y})
+			}
+		}
+		x, y = previousX, previousY
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
@@ -0,0 +1,118 @@
+package lang
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * Directive comments are escape hatches for code that tools shouldn't touch
+ * or complain about, like generated code or code that is odd on purpose.
+ *
+ *     // glox-lint disable:W0203,self-assignment
+ *         suppresses those warnings, named by diagnostic code or, for the
+ *         rules glox lint runs, by rule name. At the end of a line of code it
+ *         applies to that line, on a line of its own it applies to the next
+ *         line of code.
+ *     // glox-fmt off
+ *     // glox-fmt on
+ *         leave the lines between them, the comments included, exactly as
+ *         they are written. A region left open runs to the end of the file.
+ *
+ * The scanner finds directives whether or not it is preserving comments. A
+ * directive it doesn't understand is reported as a warning rather than being
+ * silently ignored, so a typo doesn't leave a warning switched on.
+ *****************************************************************************/
+
+type Directives struct {
+	disabled      map[int][]string // codes and lint rule names of the suppressed warnings by line
+	pending       []string         // suppressions waiting for the next line of code
+	formatOff     []lineRange
+	formatOffLine int // line of the open glox-fmt off comment, 0 if there isn't one
+}
+
+type lineRange struct {
+	first, last int
+}
+
+func newDirectives() *Directives {
+	return &Directives{disabled: make(map[int][]string)}
+}
+
+// Suppressed reports whether a glox-lint comment disables a warning on a line.
+func (d *Directives) Suppressed(code diag.Code, line int) bool {
+	return d.disables(string(code), line)
+}
+
+// disables reports whether a glox-lint comment names a diagnostic code or lint rule on a line
+func (d *Directives) disables(name string, line int) bool {
+	if d == nil {
+		return false
+	}
+	for _, disabled := range d.disabled[line] {
+		if disabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FormattingOff reports whether a line is inside a glox-fmt off region.
+func (d *Directives) FormattingOff(line int) bool {
+	if d == nil {
+		return false
+	}
+	for _, region := range d.formatOff {
+		if line >= region.first && line <= region.last {
+			return true
+		}
+	}
+	return d.formatOffLine > 0 && line >= d.formatOffLine
+}
+
+// directive records the directive in a comment, if it has one
+func (s *Scanner) directive(comment string, line int, trailing bool) {
+	text := strings.TrimSpace(strings.TrimPrefix(comment, "//"))
+	tool, setting, _ := strings.Cut(text, " ")
+	setting = strings.TrimSpace(setting)
+	switch tool {
+	case "glox-lint":
+		rules, found := strings.CutPrefix(setting, "disable:")
+		if !found || rules == "" {
+			s.badDirective(line, fmt.Errorf("Expected 'disable:' and diagnostic codes or rule names after 'glox-lint', not '%s'.", setting))
+			return
+		}
+		names := make([]string, 0)
+		for _, rule := range strings.Split(rules, ",") {
+			name := strings.TrimSpace(rule)
+			if _, isRule := lintRules[name]; !isRule && !diag.Code(name).Known() {
+				s.badDirective(line, fmt.Errorf("'%s' isn't a diagnostic code or lint rule.", name))
+				continue
+			}
+			names = append(names, name)
+		}
+		if trailing {
+			s.directives.disabled[line] = append(s.directives.disabled[line], names...)
+		} else {
+			s.directives.pending = append(s.directives.pending, names...)
+		}
+	case "glox-fmt":
+		switch {
+		case setting == "off" && s.directives.formatOffLine == 0:
+			s.directives.formatOffLine = line
+		case setting == "on" && s.directives.formatOffLine > 0:
+			s.directives.formatOff = append(s.directives.formatOff, lineRange{s.directives.formatOffLine, line})
+			s.directives.formatOffLine = 0
+		case setting == "off" || setting == "on":
+			s.badDirective(line, fmt.Errorf("Formatting is already %s.", setting))
+		default:
+			s.badDirective(line, fmt.Errorf("Expected 'off' or 'on' after 'glox-fmt', not '%s'.", setting))
+		}
+	}
+}
+
+func (s *Scanner) badDirective(line int, err error) {
+	s.errorHandler.reportWarning(diag.UnknownDirective, line, err)
+}
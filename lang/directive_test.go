@@ -0,0 +1,48 @@
+package lang
+
+import (
+	"io"
+	"testing"
+
+	"github.com/skusel/glox/diag"
+)
+
+// TestLintDirective checks that glox-lint comments silence lint warnings by code and by rule name
+func TestLintDirective(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		codes  []diag.Code
+	}{
+		{"no directive", "var x = 1;\nx = x;\n", []diag.Code{diag.SelfAssignment}},
+		{"code", "var x = 1;\nx = x; // glox-lint disable:W0210\n", nil},
+		{"rule name", "var x = 1;\nx = x; // glox-lint disable:self-assignment\n", nil},
+		{"rule name on the line before", "var x = 1;\n// glox-lint disable:W0205, self-assignment\nx = x;\n", nil},
+		{"only the next line", "var x = 1;\n// glox-lint disable:self-assignment\nx = x;\nx = x;\n", []diag.Code{diag.SelfAssignment}},
+		{"another rule's name", "var x = 1;\nx = x; // glox-lint disable:empty-block\n", []diag.Code{diag.SelfAssignment}},
+		{"unknown name", "var x = 1;\nx = x; // glox-lint disable:self-assign\n", []diag.Code{diag.UnknownDirective, diag.SelfAssignment}},
+		{"identical branches", "var x = 1;\nprint x ? 2 : 2;\n", []diag.Code{diag.IdenticalBranches}},
+		{"identical branches by name", "var x = 1;\nprint x ? 2 : 2; // glox-lint disable:identical-branches\n", nil},
+		{"assignment condition once", "var x = 1;\nif (x = 2) print x;\n", []diag.Code{diag.AssignmentInCondition}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errorHandler := &ErrorHandler{Output: io.Discard}
+			if err := Lint(test.source, nil, errorHandler); err != nil {
+				t.Fatal(err)
+			}
+			codes := make([]diag.Code, 0)
+			for _, diagnostic := range errorHandler.Diagnostics {
+				codes = append(codes, diagnostic.Code)
+			}
+			if len(codes) != len(test.codes) {
+				t.Fatalf("reported %v, expected %v", codes, test.codes)
+			}
+			for i := range codes {
+				if codes[i] != test.codes[i] {
+					t.Errorf("reported %v, expected %v", codes, test.codes)
+				}
+			}
+		})
+	}
+}
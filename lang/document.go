@@ -0,0 +1,248 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * A Document is a file open in an editor, kept analyzed as it is edited for
+ * a language server. Each edit is parsed incrementally (see Reparse), then
+ * the whole tree is resolved again, since globals are late bound and an
+ * edit anywhere can change what a name refers to. Resolving also builds the
+ * cross reference that go-to-definition, hover, and rename are answered
+ * from.
+ *
+ * While the source has a syntax error the incremental tree isn't usable, so
+ * the document is parsed again from the start in partial mode (see
+ * Parser.SetPartialMode), which still gives a tree the resolver can check.
+ * The scanner only finds glox-lint comments in a full scan, so one is done
+ * whenever the source mentions them.
+ *
+ * Editors give positions as a line and a character counting from 0, where a
+ * character is a UTF-16 code unit, so a document also maps between those
+ * and byte offsets. Like ParseProgram, a document never lets a panic out: a
+ * bug in glox shows up as an InternalParserError diagnostic instead.
+ *****************************************************************************/
+
+type Document struct {
+	parsed      *ParsedSource
+	Diagnostics []diag.Diagnostic
+	xref        *CrossReference
+	lineStarts  []int // offset of the first byte of each line
+}
+
+func NewDocument(source string) *Document {
+	document := &Document{}
+	document.analyze(func() *ParsedSource { return ParseSource(source, silentErrorHandler()) }, source)
+	return document
+}
+
+func (d *Document) Source() string {
+	return d.parsed.Source
+}
+
+// Edit replaces the text from edit.Start to edit.End with edit.Text and analyzes the document again.
+func (d *Document) Edit(edit TextEdit) {
+	previous := d.parsed
+	source := previous.Source[:edit.Start] + edit.Text + previous.Source[edit.End:]
+	d.analyze(func() *ParsedSource { return Reparse(previous, edit, silentErrorHandler()) }, source)
+}
+
+func (d *Document) analyze(parse func() *ParsedSource, source string) {
+	d.lineStarts = []int{0}
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+	errorHandler := silentErrorHandler()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			d.parsed = &ParsedSource{Source: source, HadError: true}
+			d.xref = &CrossReference{}
+			d.Diagnostics = append(errorHandler.Diagnostics, diag.Diagnostic{Code: diag.InternalParserError,
+				Severity: diag.SeverityError, Line: 1, Message: fmt.Sprintf("Internal parser error: %v", recovered)})
+		}
+	}()
+	d.parsed = parse()
+	statements := d.parsed.Statements
+	var directives *Directives
+	if d.parsed.HadError || strings.Contains(source, "glox-lint") {
+		scanner := NewScanner(source, errorHandler)
+		tokens := scanner.ScanTokens()
+		if d.parsed.HadError {
+			parser := NewParser(tokens, errorHandler)
+			parser.SetPartialMode(true)
+			statements = parser.Parse()
+		}
+		directives = scanner.Directives()
+	}
+	d.xref = resolveCrossReference(statements, directives, errorHandler)
+	d.Diagnostics = errorHandler.Diagnostics
+}
+
+/******************************************************************************
+ * Offset and Position convert between byte offsets and editor positions. A
+ * position past the end of its line is taken as the end of the line, and
+ * one past the last line as the end of the source.
+ *****************************************************************************/
+
+func (d *Document) Offset(line int, character int) int {
+	source := d.Source()
+	if line < 0 {
+		return 0
+	} else if line >= len(d.lineStarts) {
+		return len(source)
+	}
+	offset := d.lineStarts[line]
+	for units := 0; offset < len(source) && source[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(source[offset:])
+		units += utf16.RuneLen(r)
+		if units > character {
+			break
+		}
+		offset += size
+	}
+	return offset
+}
+
+func (d *Document) Position(offset int) (line int, character int) {
+	offset = max(0, min(offset, len(d.Source())))
+	line = sort.Search(len(d.lineStarts), func(i int) bool { return d.lineStarts[i] > offset }) - 1
+	return line, utf16Length(d.Source()[d.lineStarts[line]:offset])
+}
+
+// DiagnosticSpan returns the offsets a diagnostic covers, its whole line when it doesn't say where on the line it is.
+func (d *Document) DiagnosticSpan(diagnostic diag.Diagnostic) (start int, end int) {
+	line := max(0, min(diagnostic.Line-1, len(d.lineStarts)-1))
+	lineEnd := len(d.Source())
+	if line+1 < len(d.lineStarts) {
+		lineEnd = d.lineStarts[line+1] - 1
+	}
+	if diagnostic.Column < 1 {
+		return d.lineStarts[line], lineEnd
+	}
+	start = min(d.lineStarts[line]+diagnostic.Column-1, lineEnd)
+	return start, min(start+max(diagnostic.Width, 1), lineEnd)
+}
+
+/******************************************************************************
+ * Definition and Hover look up the name at an offset in the cross
+ * reference, whether the offset is on its declaration or on a use of it.
+ *****************************************************************************/
+
+func (d *Document) symbolAt(offset int) (*Symbol, Span, bool) {
+	for _, symbol := range d.xref.Symbols {
+		if symbol.Kind != "undeclared" && symbol.Declared.contains(offset) {
+			return symbol, symbol.Declared, true
+		}
+		for _, reference := range symbol.References {
+			if reference.Span.contains(offset) {
+				return symbol, reference.Span, true
+			}
+		}
+	}
+	return nil, Span{}, false
+}
+
+// Definition returns where the name at an offset is declared.
+func (d *Document) Definition(offset int) (Span, bool) {
+	symbol, _, found := d.symbolAt(offset)
+	if !found || symbol.Kind == "undeclared" {
+		return Span{}, false
+	}
+	return symbol.Declared, true
+}
+
+// Rename renames the name at an offset, refusing the same renames Rename does, and returns the edits that make it.
+func (d *Document) Rename(offset int, newName string) ([]TextEdit, error) {
+	if _, err := Rename(d.Source(), offset, newName); err != nil {
+		return nil, err
+	}
+	symbol, _, found := d.symbolAt(offset)
+	if !found {
+		return nil, errors.New("There is no variable, function, class, or trait there to rename.")
+	}
+	spans := append([]Span{symbol.Declared}, referenceSpans(symbol)...)
+	edits := make([]TextEdit, len(spans))
+	for i, span := range spans {
+		edits[i] = TextEdit{Start: span.Start.Offset, End: span.End.Offset, Text: newName}
+	}
+	sort.Slice(edits, func(i, j int) bool { return edits[i].Start < edits[j].Start })
+	return edits, nil
+}
+
+/******************************************************************************
+ * Hover describes the name at an offset in Markdown: its declaration, with
+ * the parameters of a function or the superclass of a class, then where it
+ * was declared and how often it is used. A native is described with the
+ * module it comes from, and any other undeclared name as undeclared. It
+ * also returns the span of the name, for the editor to highlight.
+ *****************************************************************************/
+
+func (d *Document) Hover(offset int) (string, Span, bool) {
+	symbol, span, found := d.symbolAt(offset)
+	if !found {
+		return "", Span{}, false
+	}
+	usesText := "used " + plural(len(symbol.References), "time")
+	if len(symbol.References) == 0 {
+		usesText = "never used"
+	}
+	if symbol.Kind == "undeclared" {
+		for _, module := range sortedNativeModules() {
+			if definition, isNative := module.natives[symbol.Name]; isNative {
+				if definition.fn == nil {
+					return fmt.Sprintf("```lox\n%s\n```\nnative constant from the \"%s\" module", symbol.Name, module.name),
+						span, true
+				}
+				return fmt.Sprintf("```lox\n%s()\n```\nnative function from the \"%s\" module, takes %s", symbol.Name,
+					module.name, plural(definition.arity, "argument")), span, true
+			}
+		}
+		return fmt.Sprintf("```lox\n%s\n```\nundeclared, %s", symbol.Name, usesText), span, true
+	}
+	scope := "local"
+	if symbol.Global {
+		scope = "global"
+	}
+	return fmt.Sprintf("```lox\n%s\n```\n%s %s declared on line %d, %s", d.declaration(symbol), scope, symbol.Kind,
+		symbol.Declared.Start.Line, usesText), span, true
+}
+
+// declaration returns how a symbol's declaration starts, like "fun area(shape)" or "var total"
+func (d *Document) declaration(symbol *Symbol) string {
+	switch symbol.Kind {
+	case "class", "function", "trait":
+		// the declaration from its keyword up to the body
+		source := d.Source()
+		keyword := map[string]string{"class": "class", "function": "fun", "trait": "trait"}[symbol.Kind]
+		start := d.lineStarts[symbol.Declared.Start.Line-1]
+		start += max(0, strings.LastIndex(source[start:symbol.Declared.Start.Offset], keyword))
+		end := symbol.Declared.End.Offset
+		for end < len(source) && source[end] != '\n' && source[end] != '{' {
+			end++
+		}
+		return strings.TrimSpace(source[start:end])
+	case "parameter":
+		return "(parameter) " + symbol.Name
+	case "import":
+		return "import " + symbol.Name
+	}
+	return "var " + symbol.Name
+}
+
+// plural formats a count of things, like "1 argument" or "2 arguments"
+func plural(count int, thing string) string {
+	if count == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", count, thing)
+}
@@ -0,0 +1,207 @@
+package lang
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * Runtime is the entry point for Go programs that embed glox. It keeps one
+ * tree-walk interpreter alive across calls, so globals defined by one call
+ * to Run can be used by the next, the way they can in the REPL.
+ *
+ * Problems are returned rather than printed. Print statements still write to
+ * stdout, use Interpreter().SetOutput to send them somewhere else.
+ *
+ * Values passed in and out are runtime.Values. SetGlobal also accepts Go's
+ * other integer and float types and converts them to Lox numbers, and
+ * converts slices, arrays, and maps into new Lox lists and maps, element by
+ * element. Any other Go value is stored as it is, for Go code to get back
+ * later, as long as it can be compared with ==, since scripts can compare
+ * it. A func or a struct holding a slice can't, and SetGlobal returns an
+ * error for it.
+ *****************************************************************************/
+
+type Runtime struct {
+	errorHandler *ErrorHandler
+	frontEnd     *FrontEnd
+	interpreter  *Interpreter
+}
+
+// Error holds the diagnostics for everything that went wrong in a call to Run or Eval.
+type Error struct {
+	Diagnostics []diag.Diagnostic
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, 0, len(e.Diagnostics))
+	for _, diagnostic := range e.Diagnostics {
+		messages = append(messages, diagnostic.String())
+	}
+	return strings.Join(messages, "\n")
+}
+
+func NewRuntime() *Runtime {
+	errorHandler := NewErrorHandler()
+	errorHandler.Output = io.Discard
+	return &Runtime{errorHandler: errorHandler, frontEnd: NewFrontEnd(errorHandler),
+		interpreter: NewInterpreter(errorHandler)}
+}
+
+// Interpreter gives access to the interpreter's settings, like its output and native filter.
+func (r *Runtime) Interpreter() *Interpreter {
+	return r.interpreter
+}
+
+// SetMaxCallDepth limits how deep scripts can recurse, see Interpreter.SetMaxCallDepth.
+func (r *Runtime) SetMaxCallDepth(depth int) {
+	r.interpreter.SetMaxCallDepth(depth)
+}
+
+func (r *Runtime) Run(source string) error {
+	r.reset()
+	program := r.frontEnd.Analyze(source)
+	if program == nil {
+		return r.failure()
+	}
+	r.interpreter.Compile(program)
+	if err := r.interpreter.Run(); err != nil {
+		if exit, isExit := err.(ExitError); isExit {
+			return exit
+		}
+		return r.failure()
+	}
+	return nil
+}
+
+// RunExitHooks runs the functions scripts registered with atExit, see Interpreter.RunExitHooks.
+func (r *Runtime) RunExitHooks() error {
+	r.reset()
+	if err := r.interpreter.RunExitHooks(); err != nil {
+		if exit, isExit := err.(ExitError); isExit {
+			return exit
+		}
+		return r.failure()
+	}
+	return nil
+}
+
+// Eval evaluates a single expression, e.g. "total / count", and returns its value.
+func (r *Runtime) Eval(source string) (value runtime.Value, err error) {
+	r.reset()
+	expr, program := r.frontEnd.analyzeExpression(source)
+	if program == nil {
+		return nil, r.failure()
+	}
+	r.interpreter.Compile(program)
+	defer func() {
+		if err != nil {
+			err = r.failure()
+		}
+	}()
+	defer r.interpreter.catchRuntimeError(&err)
+	return r.interpreter.evaluate(expr), nil
+}
+
+func (r *Runtime) SetGlobal(name string, value any) error {
+	converted, err := toValue(value)
+	if err != nil {
+		return fmt.Errorf("Can't set '%s': %w", name, err)
+	}
+	r.interpreter.globals.define(name, converted)
+	return nil
+}
+
+// GetGlobal returns the value of a global, which can be a native the scripts haven't used yet.
+func (r *Runtime) GetGlobal(name string) (runtime.Value, bool) {
+	globals := r.interpreter.globals
+	if _, found := globals.values[name]; !found && !globals.defineLazily(name) {
+		return nil, false
+	}
+	return globals.values[name], true
+}
+
+func (r *Runtime) reset() {
+	r.errorHandler.HadError = false
+	r.errorHandler.HadRuntimeError = false
+	r.errorHandler.Diagnostics = nil
+}
+
+func (r *Runtime) failure() error {
+	return &Error{Diagnostics: r.errorHandler.Diagnostics}
+}
+
+// toValue converts Go numbers, slices, and maps to Lox values and leaves every other value alone
+func toValue(value any) (runtime.Value, error) {
+	switch number := value.(type) {
+	case nil, bool, int64, float64, string:
+		return value, nil
+	case int:
+		return int64(number), nil
+	case int8:
+		return int64(number), nil
+	case int16:
+		return int64(number), nil
+	case int32:
+		return int64(number), nil
+	case uint:
+		if uint64(number) > math.MaxInt64 {
+			return float64(number), nil
+		}
+		return int64(number), nil
+	case uint8:
+		return int64(number), nil
+	case uint16:
+		return int64(number), nil
+	case uint32:
+		return int64(number), nil
+	case uint64:
+		if number > math.MaxInt64 {
+			return float64(number), nil
+		}
+		return int64(number), nil
+	case float32:
+		return float64(number), nil
+	}
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Slice, reflect.Array:
+		elements := make([]runtime.Value, reflected.Len())
+		for i := range elements {
+			element, err := toValue(reflected.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return runtime.NewList(elements), nil
+	case reflect.Map:
+		m := runtime.NewMap()
+		keys := reflected.MapKeys()
+		// Go maps have no order, Lox maps keep the order keys were added in, so add them in a predictable one
+		sort.Slice(keys, func(a, b int) bool { return fmt.Sprint(keys[a]) < fmt.Sprint(keys[b]) })
+		for _, key := range keys {
+			k, err := toValue(key.Interface())
+			if err != nil {
+				return nil, err
+			}
+			v, err := toValue(reflected.MapIndex(key).Interface())
+			if err != nil {
+				return nil, err
+			}
+			m.Set(k, v)
+		}
+		return m, nil
+	}
+	if !reflected.Type().Comparable() {
+		return nil, fmt.Errorf("a %s can't be compared, so it can't be a Lox value.", reflected.Type())
+	}
+	return value, nil
+}
@@ -0,0 +1,40 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skusel/glox/runtime"
+)
+
+// TestRuntimeGlobals checks which Go values SetGlobal converts, stores as they are, or refuses, and that GetGlobal finds natives
+func TestRuntimeGlobals(t *testing.T) {
+	r := NewRuntime()
+	var output strings.Builder
+	r.Interpreter().SetOutput(&output)
+	type handle struct{ id int }
+	for name, value := range map[string]any{"xs": []int{1, 2}, "m": map[string]float32{"b": 2, "a": 1}, "h": &handle{1}} {
+		if err := r.SetGlobal(name, value); err != nil {
+			t.Fatalf("SetGlobal(%q) failed: %v", name, err)
+		}
+	}
+	if err := r.Run(`print xs == xs; print xs; print len(xs); print m; print h == h;`); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "true\n[1, 2]\n2\n{\"a\": 1, \"b\": 2}\ntrue\n"; output.String() != expected {
+		t.Errorf("printed %q, expected %q", output.String(), expected)
+	}
+	if err := r.SetGlobal("f", func() {}); err == nil {
+		t.Error("SetGlobal accepted a func, which scripts can't compare")
+	}
+	if err := r.SetGlobal("s", struct{ xs []int }{}); err == nil {
+		t.Error("SetGlobal accepted a struct holding a slice, which scripts can't compare")
+	}
+	clock, found := r.GetGlobal("clock")
+	if _, isCallable := clock.(runtime.Callable); !found || !isCallable {
+		t.Errorf("GetGlobal(\"clock\") gave %v, %v", clock, found)
+	}
+	if _, found := r.GetGlobal("undefined"); found {
+		t.Error("GetGlobal found a global that was never defined")
+	}
+}
@@ -0,0 +1,131 @@
+package lang
+
+/******************************************************************************
+ * Lox source code always goes through the same front end: the scanner, the
+ * parser, and then the resolver. The result is a Program, a resolved AST.
+ * An Engine takes it from there. Compile lowers the program into whatever
+ * form the engine executes and Run executes it. The tree-walk Interpreter is
+ * the reference engine, it simply walks the AST it is given.
+ *
+ * Problems found along the way, static or runtime, are reported through the
+ * shared ErrorHandler so every engine produces the same diagnostics.
+ *****************************************************************************/
+
+type Engine interface {
+	Compile(program *Program) error
+	Run() error
+}
+
+type Program struct {
+	Statements []Stmt
+	// resolved scope distances of local variables, keyed by expression ID
+	locals map[int]int
+	// IDs of the calls in tail position, see Resolver.markTailCalls
+	tailCalls map[int]bool
+}
+
+// Functions returns the names of the functions the program declares at its top level, in the order they are declared.
+func (program *Program) Functions() []string {
+	names := make([]string, 0)
+	for _, stmt := range program.Statements {
+		if function, isFunction := stmt.(FunctionStmt); isFunction {
+			names = append(names, function.name.lexeme)
+		}
+	}
+	return names
+}
+
+type FrontEnd struct {
+	errorHandler *ErrorHandler
+	nextExprId   int
+	replMode     bool
+}
+
+func NewFrontEnd(errorHandler *ErrorHandler) *FrontEnd {
+	return &FrontEnd{errorHandler: errorHandler}
+}
+
+/******************************************************************************
+ * Analyze scans, parses, and resolves source code. It returns nil if a static
+ * error was found. Expression IDs keep counting up across calls so programs
+ * analyzed by the same front end (e.g. lines typed into the REPL) can be run
+ * by the same engine without their resolved locals colliding.
+ *****************************************************************************/
+
+func (f *FrontEnd) Analyze(source string) *Program {
+	scanner := NewScanner(source, f.errorHandler)
+	tokens := scanner.ScanTokens()
+	parser := NewParser(tokens, f.errorHandler)
+	parser.nextExprId = f.nextExprId
+	parser.SetREPLMode(f.replMode)
+	statements := parser.Parse()
+	f.nextExprId = parser.nextExprId
+
+	if f.errorHandler.HadError {
+		return nil
+	}
+
+	return resolveProgram(statements, scanner.Directives(), f.errorHandler)
+}
+
+// SetREPLMode parses source the way Parser.SetREPLMode describes
+func (f *FrontEnd) SetREPLMode(replMode bool) {
+	f.replMode = replMode
+}
+
+/******************************************************************************
+ * Check reports every static problem it can find in source without running
+ * it. Analyze gives up after a syntax error, Check carries on: the parser
+ * runs in partial mode (see Parser.SetPartialMode) and the resolver checks
+ * the tree it built, placeholders and all, so an editor can show the
+ * resolver's errors and warnings for the rest of the file too. It returns
+ * that tree.
+ *****************************************************************************/
+
+func Check(source string, errorHandler *ErrorHandler) []Stmt {
+	scanner := NewScanner(source, errorHandler)
+	parser := NewParser(scanner.ScanTokens(), errorHandler)
+	parser.SetPartialMode(true)
+	statements := parser.Parse()
+
+	resolver := NewResolver(errorHandler)
+	resolver.SetDirectives(scanner.Directives())
+	resolver.ResolveStatements(statements)
+	return statements
+}
+
+// resolveProgram runs the resolver over statements that have already been parsed
+func resolveProgram(statements []Stmt, directives *Directives, errorHandler *ErrorHandler) *Program {
+	resolver := NewResolver(errorHandler)
+	resolver.SetDirectives(directives)
+	resolver.ResolveStatements(statements)
+
+	if errorHandler.HadError {
+		return nil
+	}
+
+	return &Program{Statements: statements, locals: resolver.locals, tailCalls: resolver.tailCalls}
+}
+
+// analyzeExpression is Analyze for source holding a single expression, like Parser.ParseExpression
+func (f *FrontEnd) analyzeExpression(source string) (Expr, *Program) {
+	scanner := NewScanner(source, f.errorHandler)
+	tokens := scanner.ScanTokens()
+	parser := NewParser(tokens, f.errorHandler)
+	parser.nextExprId = f.nextExprId
+	expr := parser.ParseExpression()
+	f.nextExprId = parser.nextExprId
+
+	if f.errorHandler.HadError {
+		return nil, nil
+	}
+
+	resolver := NewResolver(f.errorHandler)
+	resolver.SetDirectives(scanner.Directives())
+	resolver.ResolveExpression(expr)
+	if f.errorHandler.HadError {
+		return nil, nil
+	}
+	return expr, &Program{Statements: []Stmt{ExprStmt{span: expr.Span(), expr: expr}}, locals: resolver.locals,
+		tailCalls: resolver.tailCalls}
+}
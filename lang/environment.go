@@ -1,6 +1,11 @@
 package lang
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
 
 /******************************************************************************
  * The language's environment tracks and stores variables and their values.
@@ -12,6 +17,8 @@ type environment struct {
 	enclosing    *environment
 	values       map[string]any
 	errorHandler *ErrorHandler
+	// supplies globals that are defined on first use, like natives
+	lazyGlobals func(name string) (runtime.Value, bool)
 }
 
 func newEnvironment(errorHandler *ErrorHandler) *environment {
@@ -26,6 +33,17 @@ func (env *environment) define(name string, value any) {
 	env.values[name] = value
 }
 
+func (env *environment) defineLazily(name string) bool {
+	if env.lazyGlobals == nil {
+		return false
+	}
+	value, found := env.lazyGlobals(name)
+	if found {
+		env.values[name] = value
+	}
+	return found
+}
+
 func (env *environment) ancestor(distance int) *environment {
 	ancestorEnv := env
 	for i := 0; i < distance; i++ {
@@ -39,7 +57,8 @@ func (env *environment) getAt(distance int, name Token) any {
 	if found {
 		return value
 	} else {
-		env.errorHandler.reportRuntimeError(name.line, errors.New("Undefined variable '"+name.lexeme+"'."))
+		env.errorHandler.reportRuntimeErrorAt(diag.UndefinedVariable, name,
+			errors.New("Undefined variable '"+name.lexeme+"'."))
 		return nil
 	}
 }
@@ -60,8 +79,11 @@ func (env *environment) get(name Token) any {
 		return value
 	} else if env.enclosing != nil {
 		return env.enclosing.get(name)
+	} else if env.defineLazily(name.lexeme) {
+		return env.values[name.lexeme]
 	} else {
-		env.errorHandler.reportRuntimeError(name.line, errors.New("Undefined variable '"+name.lexeme+"'."))
+		env.errorHandler.reportRuntimeErrorAt(diag.UndefinedVariable, name,
+			errors.New("Undefined variable '"+name.lexeme+"'."))
 		return nil
 	}
 }
@@ -76,7 +98,10 @@ func (env *environment) assign(name Token, value any) {
 		env.values[name.lexeme] = value
 	} else if env.enclosing != nil {
 		env.enclosing.assign(name, value)
+	} else if env.defineLazily(name.lexeme) {
+		env.values[name.lexeme] = value
 	} else {
-		env.errorHandler.reportRuntimeError(name.line, errors.New("Undefined variable '"+name.lexeme+"'."))
+		env.errorHandler.reportRuntimeErrorAt(diag.UndefinedVariable, name,
+			errors.New("Undefined variable '"+name.lexeme+"'."))
 	}
 }
@@ -1,13 +1,20 @@
 package lang
 
 import (
-	"fmt"
+	"io"
 	"os"
+
+	"github.com/skusel/glox/diag"
 )
 
 /******************************************************************************
  * Helper struct to assist with error reporting.
  *
+ * Every reported problem is recorded as a diag.Diagnostic, which carries a
+ * stable code, and is written to Output (stderr unless changed). With JSON
+ * set each one is written as a line of JSON instead, naming File as where it
+ * came from.
+ *
  * Panics are used in a few spots in the interpreter implementation to unwind
  * the call stack. This unwinding is often the easiest solution given the
  * recursive nature of the parser, reolver, and interpreter implementations.
@@ -16,41 +23,97 @@ import (
 type ErrorHandler struct {
 	HadError        bool
 	HadRuntimeError bool
+	Diagnostics     []diag.Diagnostic
+	Output          io.Writer
+	JSON            bool
+	File            string
+	// WarningsAsErrors reports warnings as errors, so the program doesn't run if it has any
+	WarningsAsErrors bool
 }
 
 type staticError struct {
-	msg string
+	diagnostic diag.Diagnostic
 }
 
 type runtimeError struct {
-	msg string
+	diagnostic diag.Diagnostic
+}
+
+func (e runtimeError) Error() string {
+	return e.diagnostic.String()
 }
 
 func NewErrorHandler() *ErrorHandler {
-	return &ErrorHandler{HadError: false, HadRuntimeError: false}
+	return &ErrorHandler{HadError: false, HadRuntimeError: false, Output: os.Stderr}
 }
 
-func (h *ErrorHandler) reportStaticError(line int, where string, err error, synchronize bool) {
-	h.HadError = true
-	var errorMsg string
-	if len(where) > 0 {
-		errorMsg = fmt.Sprintf("[line %d] Error %s: %s\n", line, where, err)
-	} else {
-		errorMsg = fmt.Sprintf("[line %d] Error: %s\n", line, err)
+func (h *ErrorHandler) report(diagnostic diag.Diagnostic) {
+	h.Diagnostics = append(h.Diagnostics, diagnostic)
+	if h.JSON {
+		io.WriteString(h.Output, diagnostic.JSON(h.File)+"\n")
+		return
+	}
+	io.WriteString(h.Output, diagnostic.String()+"\n")
+	for _, line := range diagnostic.Snippet() {
+		io.WriteString(h.Output, line+"\n")
+	}
+	for _, line := range diagnostic.Trace {
+		io.WriteString(h.Output, line+"\n")
 	}
-	staticError := staticError{msg: errorMsg}
+}
+
+func (h *ErrorHandler) reportStaticError(code diag.Code, line int, where string, err error, synchronize bool) {
+	h.reportStatic(diag.Diagnostic{Code: code, Severity: diag.SeverityError, Line: line, Where: where,
+		Message: err.Error()}, synchronize)
+}
+
+// reportStaticErrorAt reports a static error at a token, showing where it is on its line
+func (h *ErrorHandler) reportStaticErrorAt(code diag.Code, token Token, err error, synchronize bool) {
+	h.reportStatic(locate(diag.Diagnostic{Code: code, Severity: diag.SeverityError, Line: token.line,
+		Where: token.lexeme, Message: err.Error()}, token.span), synchronize)
+}
+
+func (h *ErrorHandler) reportStatic(diagnostic diag.Diagnostic, synchronize bool) {
+	h.HadError = true
+	h.report(diagnostic)
 	if synchronize {
 		// panic will unwind the call stack and we can "catch" the error with recover()
-		panic(staticError)
-	} else {
-		// if we are not syncing, immediately report the error to stderr
-		os.Stderr.WriteString(staticError.msg)
+		panic(staticError{diagnostic: diagnostic})
+	}
+}
+
+// reportWarning reports a likely mistake that doesn't stop the program from running
+func (h *ErrorHandler) reportWarning(code diag.Code, line int, err error) {
+	h.warning(diag.Diagnostic{Code: code, Severity: diag.SeverityWarning, Line: line, Message: err.Error()})
+}
+
+// reportWarningAt is reportWarning for a problem with a known place in the source
+func (h *ErrorHandler) reportWarningAt(code diag.Code, span Span, err error) {
+	h.warning(locate(diag.Diagnostic{Code: code, Severity: diag.SeverityWarning, Line: span.Start.Line,
+		Message: err.Error()}, span))
+}
+
+// warning reports a warning, as an error that stops the program when WarningsAsErrors is set
+func (h *ErrorHandler) warning(diagnostic diag.Diagnostic) {
+	if h.WarningsAsErrors {
+		diagnostic.Severity = diag.SeverityError
+		h.HadError = true
 	}
+	h.report(diagnostic)
+}
+
+func (h *ErrorHandler) reportRuntimeError(code diag.Code, line int, err error) {
+	h.raise(diag.Diagnostic{Code: code, Severity: diag.SeverityError, Line: line, Message: err.Error()})
+}
+
+// reportRuntimeErrorAt reports a runtime error at a token, showing where it is on its line
+func (h *ErrorHandler) reportRuntimeErrorAt(code diag.Code, token Token, err error) {
+	h.raise(locate(diag.Diagnostic{Code: code, Severity: diag.SeverityError, Line: token.line, Message: err.Error()},
+		token.span))
 }
 
-func (h *ErrorHandler) reportRuntimeError(line int, err error) {
+// raise unwinds the call stack with a runtime error, which the engine reports once it is caught
+func (h *ErrorHandler) raise(diagnostic diag.Diagnostic) {
 	h.HadRuntimeError = true
-	runtimeError := runtimeError{msg: fmt.Sprintf("[line %d] %s\n", line, err)}
-	// we always want to unwind the call stack and recover for runtime errors
-	panic(runtimeError)
+	panic(runtimeError{diagnostic: diagnostic})
 }
@@ -0,0 +1,80 @@
+package lang
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * A script can end itself early with exit(code), which unwinds everything
+ * that is running and comes out of Run as an ExitError carrying the code.
+ * Runtime errors can't catch it, protect() lets it pass. exit() in a worker
+ * only ends the worker.
+ *
+ * Functions passed to atExit run once the script is over, whether it got to
+ * the end, called exit(), or stopped with a runtime error. They run last
+ * registered first, the way deferred calls do. Engines don't run them on
+ * their own, since a REPL keeps one engine for many programs. The command
+ * line calls RunExitHooks when the script ends or the REPL closes.
+ *****************************************************************************/
+
+type ExitError struct {
+	Code int
+}
+
+func (e ExitError) Error() string {
+	return "exit(" + strconv.Itoa(e.Code) + ")"
+}
+
+type exitHooks struct {
+	mutex sync.Mutex
+	hooks []runtime.Callable
+}
+
+func (h *exitHooks) add(hook runtime.Callable) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.hooks = append(h.hooks, hook)
+}
+
+// pop removes and returns the most recently added hook, or nil if there are none left
+func (h *exitHooks) pop() runtime.Callable {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.hooks) == 0 {
+		return nil
+	}
+	hook := h.hooks[len(h.hooks)-1]
+	h.hooks = h.hooks[:len(h.hooks)-1]
+	return hook
+}
+
+/******************************************************************************
+ * RunExitHooks runs the functions registered with atExit. A hook that fails
+ * has its runtime error reported and the rest still run. The result is an
+ * ExitError if a hook called exit(), or the first runtime error otherwise.
+ *****************************************************************************/
+
+func (interpreter *Interpreter) RunExitHooks() error {
+	var result error
+	for hook := interpreter.exits.pop(); hook != nil; hook = interpreter.exits.pop() {
+		err := interpreter.runExitHook(hook)
+		if _, isExit := err.(ExitError); isExit || result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+func (interpreter *Interpreter) runExitHook(hook runtime.Callable) (err error) {
+	defer interpreter.catchRuntimeError(&err)
+	if _, err := hook.Call(nil); err != nil {
+		// a native hook failed, there's no call to point at so report it where the script left off
+		stack := interpreter.stack
+		interpreter.errorHandler.reportRuntimeError(diag.NativeError, stack.frames[len(stack.frames)-1].line, err)
+	}
+	return nil
+}
@@ -0,0 +1,576 @@
+package lang
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+/******************************************************************************
+ * Format reprints a script in the one layout glox fmt gives every script:
+ * one statement per line, blocks indented by four spaces with the opening
+ * brace at the end of the line that starts them, and single spaces around
+ * binary operators and after commas. It works from the parsed tree, so how
+ * the original was laid out mostly doesn't matter. A few choices are left
+ * to whoever wrote it:
+ *
+ *   - comments stay where they were, on a line of their own or at the end
+ *     of the line they followed
+ *   - one blank line is kept wherever there was at least one
+ *   - a list, map, or call whose first element starts on a new line is
+ *     written one element per line
+ *   - parentheses are kept as they were written, and none are added
+ *   - numbers and strings are written exactly as they were
+ *
+ * A comment inside a statement that is joined onto one line, like one after
+ * an operator, is moved to the end of the statement. Lines between glox-fmt
+ * off and glox-fmt on comments are copied as they are, along with the rest
+ * of any statement that runs into them.
+ *
+ * Scripts with errors aren't formatted. Neither is a script whose formatted
+ * version doesn't parse into the same tree with the same comments, that
+ * would be a bug in the formatter and it is better to leave the script
+ * alone than to change what it does.
+ *****************************************************************************/
+
+func Format(source string, errorHandler *ErrorHandler) (string, error) {
+	scanner := NewScanner(source, errorHandler)
+	scanner.PreserveComments()
+	tokens := scanner.ScanTokens()
+	statements := NewParser(tokens, errorHandler).Parse()
+	if errorHandler.HadError {
+		return "", errors.New("The source has errors, fix them before formatting.")
+	}
+	f := newFormatter(source, tokens, scanner.Directives())
+	formatted := f.statements(statements, len(source), f.statement)
+	if formatted != "" {
+		formatted += "\n"
+	}
+	if !sameProgram(statements, f.comments, formatted) {
+		return "", errors.New("Formatting would have changed the program, so it was left as it was. This is a bug in the formatter.")
+	}
+	return formatted, nil
+}
+
+type formatter struct {
+	source    string
+	lines     []string // the source split into lines, for copying glox-fmt off regions
+	tokens    []Token
+	comments  []sourceComment
+	next      int // the first comment not written yet
+	formatOff []lineRange
+	rawUntil  int // the last line copied as it was, statements starting before it were copied too
+	indent    int
+}
+
+type sourceComment struct {
+	Comment
+	trailing bool // whether it follows code on the same line
+}
+
+func newFormatter(source string, tokens []Token, directives *Directives) *formatter {
+	f := &formatter{source: source, lines: strings.Split(strings.TrimSuffix(source, "\n"), "\n"), tokens: tokens,
+		formatOff: directives.formatOff}
+	if directives.formatOffLine > 0 {
+		f.formatOff = append(f.formatOff[:len(f.formatOff):len(f.formatOff)], lineRange{directives.formatOffLine, math.MaxInt})
+	}
+	for _, token := range tokens {
+		for _, comment := range token.leadingComments {
+			f.comments = append(f.comments, sourceComment{Comment: comment})
+		}
+		if token.trailingComment != nil {
+			f.comments = append(f.comments, sourceComment{Comment: *token.trailingComment, trailing: true})
+		}
+	}
+	return f
+}
+
+func (c sourceComment) text() string {
+	return strings.TrimRight(c.Text, " \t\r")
+}
+
+// statements lays out statements a line or more each, with the comments among them and any after them up to end
+func (f *formatter) statements(statements []Stmt, end int, write func(Stmt) string) string {
+	indent := strings.Repeat("    ", f.indent)
+	lines := make([]string, 0, len(statements))
+	lastLine := 0 // the source line the last statement or comment ended on, 0 before the first
+	add := func(text string, first int, last int) {
+		if lastLine > 0 && first > lastLine+1 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, text)
+		lastLine = last
+	}
+	leading := func(before int, rest []Stmt) {
+		for f.next < len(f.comments) && f.comments[f.next].Span.Start.Offset < before {
+			comment := f.comments[f.next]
+			line := comment.Span.Start.Line
+			if region, isOff := f.offRegion(line, line); isOff {
+				add(f.raw(region, rest))
+				continue
+			}
+			f.next++
+			add(indent+comment.text(), line, line)
+		}
+	}
+	for i, stmt := range statements {
+		span := stmt.Span()
+		leading(span.Start.Offset, statements[i:])
+		if span.Start.Line <= f.rawUntil {
+			continue
+		}
+		// a region inside the body of a statement is left for the body to copy
+		region, isOff := f.offRegion(span.Start.Line, span.End.Line)
+		if isOff && (region.first <= span.Start.Line || region.last >= span.End.Line || !hasBody(stmt)) {
+			add(f.raw(region, statements[i:]))
+			continue
+		}
+		add(indent+write(stmt)+f.trailing(span.End, indent), span.Start.Line, span.End.Line)
+	}
+	leading(end, nil)
+	return strings.Join(lines, "\n")
+}
+
+func (f *formatter) statement(stmt Stmt) string {
+	return acceptStmt(stmt, f)
+}
+
+// offRegion finds the glox-fmt off region overlapping the lines from first to last, if there is one
+func (f *formatter) offRegion(first int, last int) (lineRange, bool) {
+	for _, region := range f.formatOff {
+		if region.first <= last && region.last >= first {
+			return region, true
+		}
+	}
+	return lineRange{}, false
+}
+
+// raw copies the lines of a glox-fmt off region as they were, widened to take in whole statements
+func (f *formatter) raw(region lineRange, rest []Stmt) (string, int, int) {
+	if len(rest) > 0 {
+		region.first = min(region.first, rest[0].Span().Start.Line)
+	}
+	for _, stmt := range rest {
+		if stmt.Span().Start.Line <= region.last {
+			region.last = max(region.last, stmt.Span().End.Line)
+		}
+	}
+	region.last = min(region.last, len(f.lines))
+	for f.next < len(f.comments) && f.comments[f.next].Span.Start.Line <= region.last {
+		f.next++
+	}
+	f.rawUntil = region.last
+	return strings.Join(f.lines[region.first-1:region.last], "\n"), region.first, region.last
+}
+
+/******************************************************************************
+ * trailing returns the comments that go at the end of a line of code ending
+ * at end: any left inside the code, which has nowhere else for them, and the
+ * one that followed it on the same line in the source. Only the first can
+ * share the line, the rest go on lines of their own after it.
+ *****************************************************************************/
+
+func (f *formatter) trailing(end Position, indent string) string {
+	texts := make([]string, 0)
+	for f.next < len(f.comments) && f.comments[f.next].Span.Start.Offset < end.Offset {
+		texts = append(texts, f.comments[f.next].text())
+		f.next++
+	}
+	if f.next < len(f.comments) {
+		comment := f.comments[f.next]
+		if comment.trailing && comment.Span.Start.Line == end.Line &&
+			f.tokenAt(end.Offset).span.Start.Offset > comment.Span.Start.Offset {
+			texts = append(texts, comment.text())
+			f.next++
+		}
+	}
+	if len(texts) == 0 {
+		return ""
+	}
+	return " " + strings.Join(texts, "\n"+indent)
+}
+
+// commentLines returns the comments before an offset, each on a line of its own
+func (f *formatter) commentLines(before int, indent string) string {
+	var sb strings.Builder
+	for f.next < len(f.comments) && f.comments[f.next].Span.Start.Offset < before {
+		sb.WriteString("\n" + indent + f.comments[f.next].text())
+		f.next++
+	}
+	return sb.String()
+}
+
+// tokenAt returns the first token starting at or after an offset
+func (f *formatter) tokenAt(offset int) Token {
+	i := sort.Search(len(f.tokens), func(i int) bool { return f.tokens[i].span.Start.Offset >= offset })
+	return f.tokens[min(i, len(f.tokens)-1)]
+}
+
+// find returns the first token of a type starting at or after an offset
+func (f *formatter) find(tokenType TokenType, offset int) Token {
+	i := sort.Search(len(f.tokens), func(i int) bool { return f.tokens[i].span.Start.Offset >= offset })
+	for ; i < len(f.tokens)-1 && f.tokens[i].tokenType != tokenType; i++ {
+	}
+	return f.tokens[i]
+}
+
+// block lays out statements between braces, the opening brace going at the end of the current line
+func (f *formatter) block(open Token, statements []Stmt, end int, write func(Stmt) string) string {
+	indent := strings.Repeat("    ", f.indent)
+	f.indent++
+	header := "{" + f.trailing(open.span.End, indent+"    ")
+	body := f.statements(statements, end, write)
+	f.indent--
+	if body == "" {
+		if header == "{" {
+			return "{}"
+		}
+		return header + "\n" + indent + "}"
+	}
+	return header + "\n" + body + "\n" + indent + "}"
+}
+
+// body lays out the statement an if or a loop controls, on the same line if it is a block
+func (f *formatter) body(stmt Stmt) string {
+	if block, isBlock := f.isBlock(stmt); isBlock {
+		return " " + f.block(f.tokenAt(block.span.Start.Offset), block.statements, block.span.End.Offset, f.statement)
+	}
+	f.indent++
+	defer func() { f.indent-- }()
+	return "\n" + f.statements([]Stmt{stmt}, stmt.Span().End.Offset, f.statement)
+}
+
+// isBlock reports whether a statement is a block written with braces, rather than a for loop put in one
+func (f *formatter) isBlock(stmt Stmt) (BlockStmt, bool) {
+	block, isBlock := stmt.(BlockStmt)
+	return block, isBlock && !f.isForLoop(block.span)
+}
+
+func (f *formatter) isForLoop(span Span) bool {
+	return strings.HasPrefix(f.source[span.Start.Offset:], "for")
+}
+
+func (f *formatter) forLoop(initializer Stmt, loop WhileStmt) string {
+	header := "for ("
+	if initializer == nil {
+		header += ";"
+	} else {
+		header += acceptStmt(initializer, f)
+	}
+	// a for loop without a condition gets an empty true literal in its place
+	if literal, isLiteral := loop.condition.(LiteralExpr); !isLiteral || literal.span.End.Offset > literal.span.Start.Offset {
+		header += " " + f.expr(loop.condition)
+	}
+	header += ";"
+	if loop.increment != nil {
+		header += " " + f.expr(loop.increment)
+	}
+	return header + ")" + f.body(loop.body)
+}
+
+func (f *formatter) function(stmt FunctionStmt) string {
+	open := f.find(tokenTypeLeftBrace, stmt.name.span.End.Offset)
+	body := f.block(open, stmt.body, stmt.span.End.Offset, f.statement)
+	if stmt.isGetter {
+		return stmt.name.lexeme + " " + body
+	}
+	return stmt.name.lexeme + f.params(stmt.params, stmt.variadic) + " " + body
+}
+
+func (f *formatter) methods(name Token, methods []FunctionStmt, end int) string {
+	statements := make([]Stmt, len(methods))
+	for i, method := range methods {
+		statements[i] = method
+	}
+	open := f.find(tokenTypeLeftBrace, name.span.End.Offset)
+	return f.block(open, statements, end, func(method Stmt) string {
+		return f.function(method.(FunctionStmt))
+	})
+}
+
+func (f *formatter) params(params []Token, variadic bool) string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.lexeme
+	}
+	if variadic {
+		names[len(names)-1] = "..." + names[len(names)-1]
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func hasBody(stmt Stmt) bool {
+	switch stmt.(type) {
+	case BlockStmt, ClassStmt, ForEachStmt, FunctionStmt, IfStmt, TraitStmt, WhileStmt:
+		return true
+	}
+	return false
+}
+
+func (f *formatter) visitBlockStmt(stmt BlockStmt) string {
+	if f.isForLoop(stmt.span) {
+		return f.forLoop(stmt.statements[0], stmt.statements[1].(WhileStmt))
+	}
+	return f.block(f.tokenAt(stmt.span.Start.Offset), stmt.statements, stmt.span.End.Offset, f.statement)
+}
+
+func (f *formatter) visitBreakStmt(stmt BreakStmt) string {
+	return "break;"
+}
+
+func (f *formatter) visitClassStmt(stmt ClassStmt) string {
+	header := "class " + stmt.name.lexeme
+	if stmt.superclass.getId() != 0 {
+		header += " < " + stmt.superclass.name.lexeme
+	}
+	if len(stmt.traits) > 0 {
+		header += " with " + f.list(stmt.traits)
+	}
+	return header + " " + f.methods(stmt.name, stmt.methods, stmt.span.End.Offset)
+}
+
+func (f *formatter) visitContinueStmt(stmt ContinueStmt) string {
+	return "continue;"
+}
+
+func (f *formatter) visitErrorStmt(stmt ErrorStmt) string {
+	// scripts with errors aren't formatted, but just in case
+	return f.source[stmt.span.Start.Offset:stmt.span.End.Offset]
+}
+
+func (f *formatter) visitExprStmt(stmt ExprStmt) string {
+	return f.expr(stmt.expr) + ";"
+}
+
+func (f *formatter) visitForEachStmt(stmt ForEachStmt) string {
+	return "for (var " + stmt.name.lexeme + " in " + f.expr(stmt.collection) + ")" + f.body(stmt.body)
+}
+
+func (f *formatter) visitFunctionStmt(stmt FunctionStmt) string {
+	return "fun " + f.function(stmt)
+}
+
+func (f *formatter) visitIfStmt(stmt IfStmt) string {
+	text := "if (" + f.expr(stmt.condition) + ")" + f.body(stmt.thenBranch)
+	if stmt.elseBranch == nil {
+		return text
+	}
+	if _, isBlock := f.isBlock(stmt.thenBranch); isBlock {
+		text += " else"
+	} else {
+		text += "\n" + strings.Repeat("    ", f.indent) + "else"
+	}
+	if elseIf, isIf := stmt.elseBranch.(IfStmt); isIf {
+		return text + " " + f.visitIfStmt(elseIf)
+	}
+	return text + f.body(stmt.elseBranch)
+}
+
+func (f *formatter) visitImportStmt(stmt ImportStmt) string {
+	if stmt.name.span.Start.Offset == stmt.path.span.Start.Offset {
+		// named after its path, without "as"
+		return "import " + stmt.path.lexeme + ";"
+	}
+	return "import " + stmt.path.lexeme + " as " + stmt.name.lexeme + ";"
+}
+
+func (f *formatter) visitPrintStmt(stmt PrintStmt) string {
+	return "print " + f.expr(stmt.expr) + ";"
+}
+
+func (f *formatter) visitReturnStmt(stmt ReturnStmt) string {
+	if stmt.value == nil {
+		return "return;"
+	}
+	return "return " + f.expr(stmt.value) + ";"
+}
+
+func (f *formatter) visitTraitStmt(stmt TraitStmt) string {
+	return "trait " + stmt.name.lexeme + " " + f.methods(stmt.name, stmt.methods, stmt.span.End.Offset)
+}
+
+func (f *formatter) visitVarStmt(stmt VarStmt) string {
+	if stmt.initializer == nil {
+		return "var " + stmt.name.lexeme + ";"
+	}
+	return "var " + stmt.name.lexeme + " = " + f.expr(stmt.initializer) + ";"
+}
+
+func (f *formatter) visitWhileStmt(stmt WhileStmt) string {
+	if f.isForLoop(stmt.span) {
+		return f.forLoop(nil, stmt)
+	}
+	return "while (" + f.expr(stmt.condition) + ")" + f.body(stmt.body)
+}
+
+func (f *formatter) expr(expr Expr) string {
+	return acceptExpr(expr, f)
+}
+
+func (f *formatter) list(exprs []Expr) string {
+	printed := make([]string, len(exprs))
+	for i, expr := range exprs {
+		printed[i] = f.expr(expr)
+	}
+	return strings.Join(printed, ", ")
+}
+
+/******************************************************************************
+ * elements lays out the elements of a list, map, or call between its
+ * brackets. They go one per line if the first of them was written on a line
+ * after the opening bracket, with any comments among them kept, and all on
+ * the same line otherwise.
+ *****************************************************************************/
+
+func (f *formatter) elements(open Token, spans []Span, element func(int) string, close int) string {
+	closing := map[TokenType]string{tokenTypeLeftParen: ")", tokenTypeLeftBracket: "]", tokenTypeLeftBrace: "}"}[open.tokenType]
+	if len(spans) == 0 || spans[0].Start.Line == open.span.End.Line {
+		printed := make([]string, len(spans))
+		for i := range spans {
+			printed[i] = element(i)
+		}
+		return open.lexeme + strings.Join(printed, ", ") + closing
+	}
+	outer := strings.Repeat("    ", f.indent)
+	f.indent++
+	defer func() { f.indent-- }()
+	indent := outer + "    "
+	var sb strings.Builder
+	sb.WriteString(open.lexeme)
+	for i, span := range spans {
+		sb.WriteString(f.commentLines(span.Start.Offset, indent))
+		sb.WriteString("\n" + indent + element(i))
+		end := span.End
+		if i < len(spans)-1 {
+			sb.WriteString(",")
+			end = f.find(tokenTypeComma, end.Offset).span.End
+		}
+		sb.WriteString(f.trailing(end, indent))
+	}
+	sb.WriteString(f.commentLines(close, indent))
+	return sb.String() + "\n" + outer + closing
+}
+
+func (f *formatter) visitAssignExpr(expr AssignExpr) string {
+	return expr.name.lexeme + " = " + f.expr(expr.value)
+}
+
+func (f *formatter) visitBinaryExpr(expr BinaryExpr) string {
+	return f.expr(expr.left) + " " + expr.operator.lexeme + " " + f.expr(expr.right)
+}
+
+func (f *formatter) visitCallExpr(expr CallExpr) string {
+	positional := len(expr.args) - len(expr.names)
+	spans := make([]Span, len(expr.args))
+	for i, arg := range expr.args {
+		spans[i] = arg.Span()
+		if i >= positional {
+			spans[i] = joinSpans(expr.names[i-positional].span, arg.Span())
+		}
+	}
+	open := f.find(tokenTypeLeftParen, expr.callee.Span().End.Offset)
+	return f.expr(expr.callee) + f.elements(open, spans, func(i int) string {
+		if i >= positional {
+			return expr.names[i-positional].lexeme + ": " + f.expr(expr.args[i])
+		}
+		return f.expr(expr.args[i])
+	}, expr.paren.span.Start.Offset)
+}
+
+func (f *formatter) visitConditionalExpr(expr ConditionalExpr) string {
+	return f.expr(expr.condition) + " ? " + f.expr(expr.thenBranch) + " : " + f.expr(expr.elseBranch)
+}
+
+func (f *formatter) visitFunctionExpr(expr FunctionExpr) string {
+	open := f.find(tokenTypeLeftBrace, expr.keyword.span.End.Offset)
+	return "fun" + f.params(expr.params, expr.variadic) + " " + f.block(open, expr.body, expr.span.End.Offset, f.statement)
+}
+
+func (f *formatter) visitGetExpr(expr GetExpr) string {
+	return f.expr(expr.object) + "." + expr.name.lexeme
+}
+
+func (f *formatter) visitGroupingExpr(expr GroupingExpr) string {
+	return "(" + f.expr(expr.expression) + ")"
+}
+
+func (f *formatter) visitListExpr(expr ListExpr) string {
+	spans := make([]Span, len(expr.elements))
+	for i, element := range expr.elements {
+		spans[i] = element.Span()
+	}
+	return f.elements(expr.bracket, spans, func(i int) string {
+		return f.expr(expr.elements[i])
+	}, expr.span.End.Offset-1)
+}
+
+func (f *formatter) visitLiteralExpr(expr LiteralExpr) string {
+	// written as it was, so 1e3 stays 1e3
+	return f.source[expr.span.Start.Offset:expr.span.End.Offset]
+}
+
+func (f *formatter) visitLogicalExpr(expr LogicalExpr) string {
+	return f.expr(expr.left) + " " + expr.operator.lexeme + " " + f.expr(expr.right)
+}
+
+func (f *formatter) visitMapExpr(expr MapExpr) string {
+	spans := make([]Span, len(expr.keys))
+	for i, key := range expr.keys {
+		spans[i] = joinSpans(key.Span(), expr.values[i].Span())
+	}
+	return f.elements(expr.brace, spans, func(i int) string {
+		return f.expr(expr.keys[i]) + ": " + f.expr(expr.values[i])
+	}, expr.span.End.Offset-1)
+}
+
+func (f *formatter) visitSetExpr(expr SetExpr) string {
+	return f.expr(expr.object) + "." + expr.name.lexeme + " = " + f.expr(expr.value)
+}
+
+func (f *formatter) visitSubscriptExpr(expr SubscriptExpr) string {
+	return f.expr(expr.object) + "[" + f.expr(expr.index) + "]"
+}
+
+func (f *formatter) visitSubscriptSetExpr(expr SubscriptSetExpr) string {
+	return f.expr(expr.object) + "[" + f.expr(expr.index) + "] = " + f.expr(expr.value)
+}
+
+func (f *formatter) visitSuperExpr(expr SuperExpr) string {
+	return "super." + expr.method.lexeme
+}
+
+func (f *formatter) visitThisExpr(expr ThisExpr) string {
+	return "this"
+}
+
+func (f *formatter) visitUnaryExpr(expr UnaryExpr) string {
+	return expr.operator.lexeme + f.expr(expr.right)
+}
+
+func (f *formatter) visitVariableExpr(expr VariableExpr) string {
+	return expr.name.lexeme
+}
+
+// sameProgram reports whether formatted parses into the same tree, with the same comments, as the original
+func sameProgram(statements []Stmt, comments []sourceComment, formatted string) bool {
+	errorHandler := silentErrorHandler()
+	scanner := NewScanner(formatted, errorHandler)
+	scanner.PreserveComments()
+	tokens := scanner.ScanTokens()
+	reparsed := NewParser(tokens, errorHandler).Parse()
+	printer := AstPrinter{}
+	if errorHandler.HadError || printer.PrintProgram(reparsed) != printer.PrintProgram(statements) {
+		return false
+	}
+	reformatted := newFormatter(formatted, tokens, scanner.Directives())
+	if len(reformatted.comments) != len(comments) {
+		return false
+	}
+	for i, comment := range comments {
+		if reformatted.comments[i].text() != comment.text() {
+			return false
+		}
+	}
+	return true
+}
@@ -1,65 +1,181 @@
 package lang
 
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
 /******************************************************************************
- * function implements the callable interface. It is used to represent
+ * function implements the runtime.Function interface. It is used to represent
  * function, method, and constructor calls in the interpreter's runtime.
  *****************************************************************************/
 
 type returnContent struct {
-	value any
+	value    any
+	tailCall *tailCall // set instead of value when the value is what a call in tail position returns
+}
+
+type tailCall struct {
+	callee *function
+	args   []runtime.Value
 }
 
 type function struct {
-	declaration   FunctionStmt
+	name          string // empty for anonymous functions
+	params        []Token
+	body          []Stmt
 	closure       *environment
 	isInitializer bool
+	isGetter      bool
+	variadic      bool // whether the last parameter collects the extra arguments
+	interpreter   *Interpreter
+	receiver      *runtime.Instance // the instance a method is bound to
+	unbound       *function         // the method before it was bound
+}
+
+func (fun *function) Arity() int {
+	if fun.variadic {
+		return len(fun.params) - 1
+	}
+	return len(fun.params)
 }
 
-func (fun function) arity() int {
-	return len(fun.declaration.params)
+func (fun *function) IsVariadic() bool {
+	return fun.variadic
 }
 
-func (fun function) call(interpreter *Interpreter, args []any) (value any) {
+func (fun *function) ParameterNames() []string {
+	return parameterNames(fun.params, fun.variadic)
+}
+
+/******************************************************************************
+ * Call runs the function and then each function it tail calls in turn, see
+ * Resolver.markTailCalls. A tail call returns from the function making it
+ * before the callee runs, so however long the chain of tail calls gets, only
+ * one of them is on the Go stack (and on the call stack) at a time.
+ *****************************************************************************/
+
+func (fun *function) Call(args []runtime.Value) (runtime.Value, error) {
+	for {
+		value, next := fun.run(args)
+		if next == nil {
+			return value, nil
+		}
+		fun, args = next.callee, next.args
+	}
+}
+
+// run runs the function once, returning either its value or the tail call it ended with
+func (fun *function) run(args []runtime.Value) (value runtime.Value, next *tailCall) {
+	stack := fun.interpreter.stack
+	if stack.full() {
+		err := errors.New("Stack overflow.")
+		fun.interpreter.errorHandler.reportRuntimeError(diag.StackOverflow, stack.frames[len(stack.frames)-1].line, err)
+	}
+	stack.push(fun.frameName(), fun.interpreter)
+	if h := fun.interpreter.hooks; h != nil && h.calls != nil {
+		h.calls.enter(fun.profileName(), fun.interpreter.file, false)
+		defer h.calls.leave()
+	}
 	defer func() {
 		/**********************************************************************
 		 * This is a hacky way of unwinding the call stack that is created
 		 * within executeBlock when a return statement is hit.
 		 *********************************************************************/
-		err := recover()
-		if err != nil {
-			returnContent, isReturnContent := err.(returnContent)
+		recovered := recover()
+		if runtimeError, isRuntimeError := recovered.(runtimeError); isRuntimeError && runtimeError.diagnostic.Trace == nil {
+			// the innermost call a runtime error unwinds through records the calls that led to it before they're gone
+			runtimeError.diagnostic.Trace = stack.backtrace()
+			recovered = runtimeError
+		}
+		stack.pop()
+		if recovered != nil {
+			returnContent, isReturnContent := recovered.(returnContent)
 			if isReturnContent {
 				if fun.isInitializer {
 					// blank return statements in initializers should return "this"
 					value = fun.closure.getThisValue()
+				} else if returnContent.tailCall != nil {
+					next = returnContent.tailCall
 				} else {
 					// update the return value to be the called functions return value
 					value = returnContent.value
 				}
 			} else {
 				// this is not a panic thrown by us, pass it on
-				panic(err)
+				panic(recovered)
 			}
 		}
 	}()
 
 	funEnv := newChildEnvironment(fun.closure)
-	for i, param := range fun.declaration.params {
-		funEnv.define(param.lexeme, args[i])
+	for i, param := range fun.params {
+		if fun.variadic && i == len(fun.params)-1 {
+			rest := make([]runtime.Value, len(args)-i)
+			copy(rest, args[i:])
+			funEnv.define(param.lexeme, runtime.NewList(rest))
+		} else {
+			funEnv.define(param.lexeme, args[i])
+		}
 	}
-	interpreter.executeBlock(fun.declaration.body, funEnv)
+	fun.interpreter.executeBlock(fun.body, funEnv)
 	if fun.isInitializer {
-		return fun.closure.getThisValue()
+		return fun.closure.getThisValue(), nil
 	}
-	return nil
+	return nil, nil
 }
 
-func (fun function) bind(inst instance) function {
+func (fun *function) Bind(inst *runtime.Instance) runtime.Function {
 	env := newChildEnvironment(fun.closure)
 	env.define("this", inst)
-	return function{declaration: fun.declaration, closure: env, isInitializer: fun.isInitializer}
+	unbound := fun
+	if fun.unbound != nil {
+		unbound = fun.unbound
+	}
+	return &function{name: fun.name, params: fun.params, body: fun.body, closure: env, isInitializer: fun.isInitializer,
+		isGetter: fun.isGetter, variadic: fun.variadic, interpreter: fun.interpreter, receiver: inst, unbound: unbound}
+}
+
+func (fun *function) Receiver() *runtime.Instance {
+	return fun.receiver
+}
+
+func (fun *function) Unbound() runtime.Function {
+	if fun.unbound == nil {
+		return fun
+	}
+	return fun.unbound
+}
+
+func (fun *function) Name() string {
+	return fun.name
 }
 
-func (fun function) toString() string {
-	return "<fun " + fun.declaration.name.lexeme + ">"
+func (fun *function) IsGetter() bool {
+	return fun.isGetter
+}
+
+// frameName is how the function appears on the call stack
+func (fun *function) frameName() string {
+	if fun.name == "" {
+		return "<fun>"
+	}
+	return fun.name
+}
+
+// profileName is the name a call profile counts the function under, methods are named after their class
+func (fun *function) profileName() string {
+	if fun.receiver != nil {
+		return fun.receiver.Class().Name() + "." + fun.frameName()
+	}
+	return fun.frameName()
+}
+
+func (fun *function) String() string {
+	if fun.name == "" {
+		return "<fun>"
+	}
+	return "<fun " + fun.name + ">"
 }
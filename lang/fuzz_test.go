@@ -0,0 +1,115 @@
+package lang
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/******************************************************************************
+ * Fuzz targets for the front end and interpreter. go test runs each of them
+ * over its seed corpus, the snippets below and the fixtures in test/, and
+ * go test -fuzz goes on to generate inputs of its own, e.g.
+ *
+ *   go test ./lang -run '^$' -fuzz FuzzParser
+ *
+ * Lox errors are expected, any other panic is a bug and fails the target.
+ *****************************************************************************/
+
+// fuzzStepBudget keeps generated programs with infinite loops or unbounded recursion from hanging the fuzzer
+const fuzzStepBudget = 10000
+
+// fuzzSeeds cover each kind of statement and expression, along with source that stops in the middle of a token
+var fuzzSeeds = []string{
+	"",
+	"print 1 + 2 * 3 - -4 / 5;",
+	"var a = \"s\"; a = a + \"t\"; print a;",
+	"var m = {\"k\": [1, 2.5, nil, true, false]}; m[\"k\"][0] = 3; print m;",
+	"if (1 < 2 and 3 >= 4 or !nil) print 1; else print 2;",
+	"var i = 0; while (i < 3) { i = i + 1; if (i == 2) break; }",
+	"for (var i = 0; i < 3; i = i + 1) { continue; }",
+	"fun f(a, b, ...rest) { return a == nil ? b : f(nil, a); } print f(1, 2, 3);",
+	"var g = fun (x) { return x; }; print g(1);",
+	"class A { init(x) { this.x = x; } get() { return this.x; } } class B < A { get() { return super.get(); } } print B(1).get();",
+	"trait T { describe() { return \"t\"; } } class C with T {} print C().describe();",
+	"fun f(n) { return f(n + 1); } f(0);",
+	"while (true) {}",
+	"print protect(fun() { return 1 / nil; }, fun(error) { return error; });",
+	"print substring(\"héllo\", 0, 2) + toUpper(\"x\") + len([1, 2]);",
+	"/* unterminated",
+	"// comment",
+	"\"unterminated",
+	"1.",
+	"a.b.c(",
+	"{",
+	"print",
+}
+
+// addFuzzSeeds adds fuzzSeeds and the test/ fixtures to the seed corpus
+func addFuzzSeeds(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	fixtures, _ := filepath.Glob(filepath.Join("..", "test", "*.lox"))
+	for _, path := range fixtures {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(source))
+	}
+}
+
+func fuzzErrorHandler() *ErrorHandler {
+	return &ErrorHandler{Output: io.Discard}
+}
+
+func FuzzScanner(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		NewScanner(source, fuzzErrorHandler()).ScanTokens()
+	})
+}
+
+func FuzzParser(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		errorHandler := fuzzErrorHandler()
+		NewParser(NewScanner(source, errorHandler).ScanTokens(), errorHandler).Parse()
+	})
+}
+
+// FuzzInterpret runs input with only the pure natives installed, so it can't touch the file system, the terminal, or the process
+func FuzzInterpret(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		errorHandler := fuzzErrorHandler()
+		program := NewFrontEnd(errorHandler).Analyze(source)
+		if program == nil {
+			return
+		}
+		interpreter := NewInterpreter(errorHandler)
+		interpreter.SetOutput(io.Discard)
+		interpreter.SetNativeFilter(PureNatives)
+		interpreter.SetStepBudget(fuzzStepBudget)
+		if interpreter.Compile(program) == nil {
+			interpreter.Run()
+		}
+	})
+}
+
+// FuzzRoundTrip checks that input that parses survives being printed and parsed again, see RoundTrip
+func FuzzRoundTrip(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		errorHandler := fuzzErrorHandler()
+		statements := NewParser(NewScanner(source, errorHandler).ScanTokens(), errorHandler).Parse()
+		if errorHandler.HadError {
+			return
+		}
+		if err := RoundTrip(statements); err != nil {
+			t.Error(err)
+		}
+	})
+}
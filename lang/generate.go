@@ -0,0 +1,16 @@
+package lang
+
+/******************************************************************************
+ * The AST node definitions in expr.go and stmt.go, along with their JSON
+ * encoding in astjsonnodes.go, their binary encoding in astbinarynodes.go,
+ * their rewriting in astrewritenodes.go, their inspection in
+ * astinspectnodes.go, and the walking of their children in astwalknodes.go,
+ * are generated from the node specifications in tool/generateast. Edit the
+ * specifications there and run "go generate ./..." to add or change node
+ * types.
+ *****************************************************************************/
+
+//go:generate go run ../tool/generateast .
+
+// none is the result type of visitors that only walk the AST for side effects
+type none = struct{}
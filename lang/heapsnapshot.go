@@ -0,0 +1,198 @@
+package lang
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * A heap snapshot lists every Lox object a program can still reach, starting
+ * from its roots: the global variables, the variables in scope where the
+ * snapshot was taken, and the globals of imported modules. Objects are found
+ * breadth first, so the retention path recorded for each one is the shortest
+ * chain of references that keeps it alive. When a long-running script grows
+ * without bound, the objects it didn't expect to keep and the paths holding
+ * on to them are usually the answer.
+ *
+ * Variables of functions that are still running further down the call stack
+ * are only found if something reachable closed over them. Values held by
+ * weak references aren't followed, they don't keep anything alive.
+ *****************************************************************************/
+
+type HeapSnapshot struct {
+	Objects []HeapObject `json:"objects"`
+}
+
+type HeapObject struct {
+	Id         int               `json:"id"`
+	Kind       string            `json:"kind"` // class, environment, function, instance, list, map, module, or trait
+	Name       string            `json:"name"`
+	Size       int               `json:"size"`             // number of fields, variables, methods, or elements
+	Fields     map[string]string `json:"fields,omitempty"` // a summary of what each one holds
+	RetainedBy string            `json:"retainedBy"`       // the shortest path from a root
+}
+
+func WriteHeapSnapshot(w io.Writer, snapshot *HeapSnapshot) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(snapshot)
+}
+
+type heapWalker struct {
+	ids     map[any]int
+	pending []any // objects found but not yet looked inside, in the order they were found
+	objects []HeapObject
+}
+
+// snapshotHeap walks everything reachable from the interpreter's current position in the program
+func (interpreter *Interpreter) snapshotHeap() *HeapSnapshot {
+	w := &heapWalker{ids: make(map[any]int)}
+	w.environment(interpreter.globals, "global ")
+	for env := interpreter.env; env != nil && env != interpreter.globals; env = env.enclosing {
+		w.environment(env, "local ")
+	}
+	paths := make([]string, 0, len(interpreter.importer.modules))
+	for path := range interpreter.importer.modules {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		m := interpreter.importer.modules[path]
+		w.reference(m, "module "+m.name)
+	}
+	for len(w.pending) > 0 {
+		object := w.pending[0]
+		w.pending = w.pending[1:]
+		w.expand(object)
+	}
+	return &HeapSnapshot{Objects: w.objects}
+}
+
+// environment adds the variables of a root environment as roots of their own
+func (w *heapWalker) environment(env *environment, prefix string) {
+	for _, name := range sortedNames(env.values) {
+		w.reference(env.values[name], prefix+name)
+	}
+}
+
+// reference returns a summary of a value, recording it as an object first if it is one that hasn't been seen
+func (w *heapWalker) reference(value any, path string) string {
+	var kind string
+	switch value := value.(type) {
+	case *runtime.Class:
+		kind = "class"
+	case *function:
+		kind = "function"
+	case *runtime.Instance:
+		kind = "instance"
+	case *runtime.List:
+		kind = "list"
+	case *runtime.Map:
+		kind = "map"
+	case *module:
+		kind = "module"
+	case *runtime.Trait:
+		kind = "trait"
+	case *environment:
+		kind = "environment"
+	case string:
+		return strconv.Quote(value)
+	default:
+		return runtime.Stringify(value)
+	}
+	id, seen := w.ids[value]
+	if !seen {
+		id = len(w.objects) + 1
+		w.ids[value] = id
+		w.pending = append(w.pending, value)
+		name := kind
+		if kind != "environment" {
+			name = runtime.Stringify(value)
+		}
+		w.objects = append(w.objects, HeapObject{Id: id, Kind: kind, Name: name, RetainedBy: path})
+	}
+	return "#" + strconv.Itoa(id) + " " + w.objects[id-1].Name
+}
+
+// expand fills in what an object refers to
+func (w *heapWalker) expand(value any) {
+	id := w.ids[value]
+	path := w.objects[id-1].RetainedBy + " > "
+	fields := make(map[string]string)
+	size := 0
+	switch value := value.(type) {
+	case *runtime.Class:
+		if superclass := value.Superclass(); superclass != nil {
+			fields["superclass"] = w.reference(superclass, path+"superclass")
+		}
+		methods := value.Methods()
+		for _, name := range sortedNames(methods) {
+			fields[name] = w.reference(methods[name], path+"method "+name)
+		}
+		size = len(methods)
+	case *runtime.Trait:
+		methods := value.Methods()
+		for _, name := range sortedNames(methods) {
+			fields[name] = w.reference(methods[name], path+"method "+name)
+		}
+		size = len(methods)
+	case *function:
+		if value.closure != nil && value.closure.enclosing != nil {
+			fields["closure"] = w.reference(value.closure, path+"closure")
+		}
+	case *environment:
+		for _, name := range sortedNames(value.values) {
+			fields[name] = w.reference(value.values[name], path+"variable "+name)
+		}
+		size = len(value.values)
+		if value.enclosing != nil && value.enclosing.enclosing != nil {
+			fields["enclosing"] = w.reference(value.enclosing, path+"enclosing")
+		}
+	case *runtime.Instance:
+		fields["class"] = w.reference(value.Class(), path+"class")
+		instanceFields := value.Fields()
+		for _, name := range sortedNames(instanceFields) {
+			fields["."+name] = w.reference(instanceFields[name], path+"field "+name)
+		}
+		size = len(instanceFields)
+	case *runtime.List:
+		for i, element := range value.Elements() {
+			index := strconv.Itoa(i)
+			fields["["+index+"]"] = w.reference(element, path+"element "+index)
+		}
+		size = value.Len()
+	case *runtime.Map:
+		for _, key := range value.Keys() {
+			element, _ := value.Get(key)
+			keySummary := w.reference(key, path+"key "+runtime.Stringify(key))
+			fields["["+keySummary+"]"] = w.reference(element, path+"value "+keySummary)
+		}
+		size = value.Len()
+	case *module:
+		globals := value.globals.Load()
+		for _, name := range sortedNames(globals.values) {
+			fields[name] = w.reference(globals.values[name], path+"global "+name)
+		}
+		size = len(globals.values)
+	}
+	// looking inside can find new objects and move the slice, so only hold on to it now
+	object := &w.objects[id-1]
+	object.Size = size
+	if len(fields) > 0 {
+		object.Fields = fields
+	}
+}
+
+func sortedNames[V any](values map[string]V) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,80 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * Hooks are the ways a run can be watched: recording a trace, tracing,
+ * debugging, counting branches and calls, sampling the stack, and a step
+ * budget. They all live behind one pointer that stays nil until one of them
+ * is set, so a run that isn't being watched pays for a single nil check per
+ * statement and takes the plain path through execute, rather than checking
+ * each hook in turn. Imported modules get a copy of the hooks, see import.go.
+ *****************************************************************************/
+
+type hooks struct {
+	recorder   *recorder    // nil unless a trace is being recorded
+	tracer     *Tracer      // nil unless the program is being traced
+	debugger   *Debugger    // nil unless the program can be paused
+	coverage   *Coverage    // nil unless branches are being counted
+	calls      *CallProfile // nil unless calls are being counted
+	profile    *Profile     // nil unless the program is being profiled
+	stepBudget int          // maximum number of statements to execute, 0 for no limit
+	steps      int
+}
+
+// watch returns the interpreter's hooks, creating them when the first one is set
+func (interpreter *Interpreter) watch() *hooks {
+	if interpreter.hooks == nil {
+		interpreter.hooks = &hooks{}
+	}
+	return interpreter.hooks
+}
+
+// keepCallers reports whether a hook times or samples calls, which needs tail calls made as ordinary calls so their callers stay on the stack
+func (h *hooks) keepCallers() bool {
+	return h != nil && (h.calls != nil || h.profile != nil)
+}
+
+// executeWatched is execute for a run with hooks, calling each hook that is set around the statement
+func (interpreter *Interpreter) executeWatched(stmt Stmt) {
+	h := interpreter.hooks
+	if h.recorder != nil {
+		defer h.recorder.begin(stmt.Span().Start.Line)()
+	}
+	if h.tracer != nil {
+		defer h.tracer.statement(stmt, interpreter.stack)()
+	}
+	interpreter.stack.at(stmt.Span().Start.Line, interpreter.env)
+	if h.debugger != nil {
+		h.debugger.check(interpreter)
+	}
+	interpreter.checkInterruption(stmt)
+	h.steps++
+	if h.stepBudget > 0 && h.steps > h.stepBudget {
+		err := errors.New("Step budget exceeded.")
+		interpreter.errorHandler.reportRuntimeError(diag.StepBudgetExceeded, stmt.Span().Start.Line, err)
+	}
+	acceptStmt(stmt, interpreter)
+}
+
+// branch counts which way the condition of an if or loop went, if coverage is being recorded
+func (h *hooks) branch(file string, stmt Stmt, condition Expr, value bool) {
+	if h.coverage != nil {
+		h.coverage.branch(file, stmt, condition, value)
+	}
+}
+
+// moduleHooks returns the hooks for a module imported by a run with hooks, which isn't recorded and has steps of its own
+func (h *hooks) moduleHooks() *hooks {
+	if h == nil {
+		return nil
+	}
+	copied := *h
+	copied.recorder = nil
+	copied.steps = 0
+	return &copied
+}
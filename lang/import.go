@@ -0,0 +1,257 @@
+package lang
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * Modules are Lox files loaded with an import statement. A module runs once,
+ * the first time it is imported, in its own global environment. The import
+ * binds a module value whose properties are the module's globals.
+ *
+ * Where a module is looked for depends on its path:
+ *   - Paths starting with "./" or "../" are relative imports, found relative
+ *     to the directory of the file doing the importing.
+ *   - Absolute paths are used as they are.
+ *   - Anything else is looked for in the project's lib/ directory, next to
+ *     the script being run, and then in each directory listed in the
+ *     LOXPATH environment variable.
+ * The ".lox" extension may be left off. A compiled module (see artifact.go)
+ * is used in place of its source when it is up to date, or when it was
+ * shipped without its source. If a module can't be found the error lists
+ * every file that was tried.
+ *****************************************************************************/
+
+type module struct {
+	name    string
+	path    string
+	globals atomic.Pointer[environment] // replaced as a whole when the module is reloaded
+	loading bool                        // set while the module's top level code runs, to catch import cycles
+}
+
+func (m *module) Get(name string) (runtime.Value, bool) {
+	value, found := m.globals.Load().values[name]
+	return value, found
+}
+
+func (m *module) String() string {
+	return "<module " + m.name + ">"
+}
+
+// importer is shared by an interpreter and every module it imports
+type importer struct {
+	searchPath []string
+	modules    map[string]*module // keyed by absolute file path
+}
+
+func newImporter(projectDir string) *importer {
+	searchPath := []string{filepath.Join(projectDir, "lib")}
+	for _, dir := range filepath.SplitList(os.Getenv("LOXPATH")) {
+		if dir != "" {
+			searchPath = append(searchPath, dir)
+		}
+	}
+	return &importer{searchPath: searchPath, modules: make(map[string]*module)}
+}
+
+// find returns the file a module path refers to, or "" and the files that were tried
+func (imp *importer) find(fromDir string, path string) (string, []string) {
+	var candidates []string
+	if strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") {
+		candidates = []string{filepath.Join(fromDir, path)}
+	} else if filepath.IsAbs(path) {
+		candidates = []string{path}
+	} else {
+		for _, dir := range imp.searchPath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	tried := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		if filepath.Ext(candidate) == "" {
+			candidate += ".lox"
+		}
+		tried = append(tried, candidate)
+		if isFile(candidate) {
+			return candidate, tried
+		}
+		if filepath.Ext(candidate) == ".lox" {
+			compiled := candidate + "c"
+			tried = append(tried, compiled)
+			if isFile(compiled) {
+				return compiled, tried
+			}
+		}
+	}
+	return "", tried
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// loadModule returns a module's resolved program, from its artifact if it has a usable one
+func loadModule(file string, errorHandler *ErrorHandler) (*Program, error) {
+	if filepath.Ext(file) == ArtifactExtension {
+		statements, directives, loaded := loadArtifact(file, "", false)
+		if !loaded {
+			return nil, errors.New("is not a valid compiled module")
+		}
+		return checkModule(resolveProgram(statements, directives, errorHandler))
+	}
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	compiled := strings.TrimSuffix(file, filepath.Ext(file)) + ArtifactExtension
+	statements, directives, loaded := loadArtifact(compiled, string(source), true)
+	if loaded {
+		return checkModule(resolveProgram(statements, directives, errorHandler))
+	}
+	return checkModule(NewFrontEnd(errorHandler).Analyze(string(source)))
+}
+
+func checkModule(program *Program) (*Program, error) {
+	if program == nil {
+		// the static errors have already been reported
+		return nil, errors.New("has errors")
+	}
+	return program, nil
+}
+
+/******************************************************************************
+ * SetScriptPath tells the interpreter which file it is running. Relative
+ * imports are found from the file's directory and the project's lib/
+ * directory is assumed to sit next to it. Without a script path, e.g. in
+ * the REPL, the working directory is used.
+ *****************************************************************************/
+
+func (interpreter *Interpreter) SetScriptPath(path string) {
+	interpreter.file = path
+	if absolute, err := filepath.Abs(path); err == nil {
+		interpreter.file = absolute
+	}
+	interpreter.dir = filepath.Dir(path)
+	if absolute, err := filepath.Abs(interpreter.dir); err == nil {
+		interpreter.dir = absolute
+	}
+	interpreter.importer = newImporter(interpreter.dir)
+}
+
+func (interpreter *Interpreter) importModule(stmt ImportStmt) *module {
+	path := stmt.path.literal.(string)
+	file, tried := interpreter.importer.find(interpreter.dir, path)
+	if file == "" {
+		msg := "Module '" + path + "' not found. Searched:\n    " + strings.Join(tried, "\n    ")
+		interpreter.errorHandler.reportRuntimeErrorAt(diag.ModuleNotFound, stmt.path, errors.New(msg))
+	}
+	absolute, err := filepath.Abs(file)
+	if err == nil {
+		file = absolute
+	}
+
+	imported, found := interpreter.importer.modules[file]
+	if found {
+		if imported.loading {
+			err := errors.New("Module '" + path + "' imports itself through its own imports.")
+			interpreter.errorHandler.reportRuntimeErrorAt(diag.ImportFailed, stmt.path, err)
+		}
+		return imported
+	}
+
+	program, err := loadModule(file, interpreter.errorHandler)
+	if err != nil {
+		err := errors.New("Module '" + path + "' " + err.Error() + ".")
+		interpreter.errorHandler.reportRuntimeErrorAt(diag.ImportFailed, stmt.path, err)
+	}
+
+	imported = &module{name: stmt.name.lexeme, path: file, loading: true}
+	interpreter.importer.modules[file] = imported
+	defer func() {
+		imported.loading = false
+	}()
+	imported.globals.Store(interpreter.executeModule(program, file))
+	return imported
+}
+
+/******************************************************************************
+ * Each module gets an interpreter of its own, so it has its own globals and
+ * resolved locals. Functions remember the interpreter that declared them, so
+ * the module's functions keep running against its globals when they are
+ * called from the importing code.
+ *****************************************************************************/
+
+func (interpreter *Interpreter) executeModule(program *Program, file string) *environment {
+	moduleInterpreter := NewInterpreter(interpreter.errorHandler)
+	moduleInterpreter.file = file
+	moduleInterpreter.dir = filepath.Dir(file)
+	moduleInterpreter.importer = interpreter.importer
+	moduleInterpreter.output = interpreter.output
+	moduleInterpreter.input = interpreter.input
+	moduleInterpreter.nativeFilter = interpreter.nativeFilter
+	moduleInterpreter.interrupts = interpreter.interrupts
+	moduleInterpreter.stack = interpreter.stack
+	moduleInterpreter.exits = interpreter.exits
+	moduleInterpreter.assertions = interpreter.assertions
+	moduleInterpreter.mocks = interpreter.mocks
+	moduleInterpreter.hooks = interpreter.hooks.moduleHooks()
+	moduleInterpreter.worker = interpreter.worker
+	moduleInterpreter.Compile(program)
+	moduleInterpreter.stack.push("<"+filepath.Base(file)+">", moduleInterpreter)
+	defer moduleInterpreter.stack.pop()
+	for _, statement := range moduleInterpreter.statements {
+		moduleInterpreter.execute(statement)
+	}
+	return moduleInterpreter.globals
+}
+
+/******************************************************************************
+ * reloadModule runs a module again from the current contents of its file and
+ * then swaps its globals for the new ones in a single step. Code holding the
+ * module sees either every old binding or every new one, never a mix. If the
+ * module fails to load or run, it keeps its old bindings and the error is
+ * returned instead of being raised.
+ *****************************************************************************/
+
+func (interpreter *Interpreter) reloadModule(m *module) (err error) {
+	if m.loading {
+		return errors.New("Module '" + m.name + "' can't be reloaded while it is loading.")
+	}
+	// static errors are still printed, but don't fail the program that is reloading
+	scratch := &ErrorHandler{Output: interpreter.errorHandler.Output}
+	program, err := loadModule(m.path, scratch)
+	if err != nil {
+		return errors.New("Module '" + m.name + "' " + err.Error() + ".")
+	}
+
+	hadRuntimeError := interpreter.errorHandler.HadRuntimeError
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			runtimeError, isRuntimeError := recovered.(runtimeError)
+			if isRuntimeError {
+				interpreter.errorHandler.HadRuntimeError = hadRuntimeError
+				err = errors.New("Module '" + m.name + "' failed to reload: " + runtimeError.diagnostic.String())
+			} else {
+				// this is not a panic thrown by us - pass it on
+				panic(recovered)
+			}
+		}
+	}()
+	m.loading = true
+	defer func() {
+		m.loading = false
+	}()
+	m.globals.Store(interpreter.executeModule(program, m.path))
+	return nil
+}
@@ -0,0 +1,155 @@
+package lang
+
+import (
+	"io"
+)
+
+/******************************************************************************
+ * Incremental parsing for editors. Parsing a large file again on every
+ * keystroke is slow, so Reparse only scans and parses the top level
+ * statements an edit touches. Statements before the edit are reused as is,
+ * and statements after it are reused with their spans shifted to wherever
+ * the edit moved them.
+ *
+ * The statement just before the edit is always parsed again too, since text
+ * typed after a complete statement can still extend it (an "else" after an
+ * if statement). An edit can also change where a comment or a string ends,
+ * e.g. deleting the newline that ended a comment makes it swallow the code
+ * after it, so the statements after the edit are only reused from the first
+ * one the new tokens still start at. If the edited region doesn't parse
+ * cleanly on its own, for example because a '}' was deleted and a block now
+ * runs into the statements after it, everything from the edit to the end of
+ * the file is parsed again.
+ * The same happens after any edit to a source that had errors before.
+ *
+ * Reused nodes keep their expression IDs and new nodes get IDs that don't
+ * collide with them, so a resolver can still tell every expression apart.
+ *****************************************************************************/
+
+type TextEdit struct {
+	Start int    // offset of the first replaced byte in the old source
+	End   int    // offset just past the last replaced byte in the old source
+	Text  string // the replacement
+}
+
+type ParsedSource struct {
+	Source     string
+	Statements []Stmt
+	HadError   bool
+	nextExprId int
+}
+
+func ParseSource(source string, errorHandler *ErrorHandler) *ParsedSource {
+	parsed := &ParsedSource{Source: source}
+	parsed.Statements, _, parsed.HadError = parsed.parseRegion(Position{Offset: 0, Line: 1, Column: 1},
+		len(source), errorHandler)
+	return parsed
+}
+
+func Reparse(previous *ParsedSource, edit TextEdit, errorHandler *ErrorHandler) *ParsedSource {
+	source := previous.Source[:edit.Start] + edit.Text + previous.Source[edit.End:]
+	parsed := &ParsedSource{Source: source, nextExprId: previous.nextExprId}
+	if previous.HadError {
+		parsed.Statements, _, parsed.HadError = parsed.parseRegion(Position{Offset: 0, Line: 1, Column: 1},
+			len(source), errorHandler)
+		return parsed
+	}
+
+	statements := previous.Statements
+	// the first statement touching the edit, and the one before it
+	first := 0
+	for first < len(statements) && statements[first].Span().End.Offset < edit.Start {
+		first++
+	}
+	if first > 0 {
+		first--
+	}
+	// the first statement starting after the edit, it and everything after it can be reused
+	after := first
+	for after < len(statements) && statements[after].Span().Start.Offset <= edit.End {
+		after++
+	}
+
+	regionStart := Position{Offset: 0, Line: 1, Column: 1}
+	if first > 0 {
+		regionStart = statements[first-1].Span().End
+	}
+	delta := len(edit.Text) - (edit.End - edit.Start)
+	regionEnd := len(source)
+	if after < len(statements) {
+		regionEnd = statements[after].Span().Start.Offset + delta
+	}
+
+	// parse into a scratch error handler first, the region may have to grow
+	scratch := &ErrorHandler{Output: io.Discard}
+	region, newStart, hadError := parsed.parse(func() []Token {
+		scanner := NewScanner(source, scratch)
+		scanner.startAt(regionStart)
+		for scanner.scanUntil(regionEnd) > regionEnd {
+			// a token or comment ran on into the statements after the region, which can't be reused as they are
+			for after < len(statements) && statements[after].Span().Start.Offset+delta < scanner.current {
+				after++
+			}
+			regionEnd = len(source)
+			if after < len(statements) {
+				regionEnd = statements[after].Span().Start.Offset + delta
+			}
+		}
+		return scanner.finish()
+	}, scratch)
+	if hadError && after < len(statements) {
+		scratch = &ErrorHandler{Output: io.Discard}
+		after = len(statements)
+		region, _, hadError = parsed.parseRegion(regionStart, len(source), scratch)
+	}
+	for _, diagnostic := range scratch.Diagnostics {
+		errorHandler.report(diagnostic)
+	}
+	errorHandler.HadError = errorHandler.HadError || hadError
+
+	parsed.Statements = make([]Stmt, 0, first+len(region)+len(statements)-after)
+	parsed.Statements = append(parsed.Statements, statements[:first]...)
+	parsed.Statements = append(parsed.Statements, region...)
+	if after < len(statements) {
+		oldStart := statements[after].Span().Start
+		shifter := astRewriter{rewriteSpan: func(span Span) Span {
+			return Span{Start: shiftPosition(span.Start, oldStart, newStart),
+				End: shiftPosition(span.End, oldStart, newStart), source: parsed.Source}
+		}}
+		parsed.Statements = append(parsed.Statements, shifter.stmts(statements[after:])...)
+	}
+	parsed.HadError = hadError
+	return parsed
+}
+
+// parseRegion returns the region's statements, the position of its end, and whether it had errors
+func (parsed *ParsedSource) parseRegion(start Position, end int, errorHandler *ErrorHandler) ([]Stmt, Position,
+	bool) {
+	return parsed.parse(func() []Token {
+		return NewScanner(parsed.Source, errorHandler).scanRange(start, end)
+	}, errorHandler)
+}
+
+// parse parses the tokens scan returns, like parseRegion
+func (parsed *ParsedSource) parse(scan func() []Token, errorHandler *ErrorHandler) ([]Stmt, Position, bool) {
+	hadError := errorHandler.HadError
+	errorHandler.HadError = false
+	tokens := scan()
+	parser := NewParser(tokens, errorHandler)
+	parser.nextExprId = parsed.nextExprId
+	statements := parser.Parse()
+	parsed.nextExprId = parser.nextExprId
+	regionHadError := errorHandler.HadError
+	errorHandler.HadError = hadError || regionHadError
+	return statements, tokens[len(tokens)-1].span.Start, regionHadError
+}
+
+// shiftPosition moves a position that was at or after oldStart by the same amount oldStart moved to newStart
+func shiftPosition(p Position, oldStart Position, newStart Position) Position {
+	if p.Line == oldStart.Line {
+		p.Column += newStart.Column - oldStart.Column
+	}
+	p.Line += newStart.Line - oldStart.Line
+	p.Offset += newStart.Offset - oldStart.Offset
+	return p
+}
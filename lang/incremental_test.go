@@ -0,0 +1,54 @@
+package lang
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestReparse checks that reparsing after an edit gives the same tree, spans and all, as parsing the new source
+func TestReparse(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		old    string // the text the edit replaces, found in source
+		new    string
+	}{
+		{"change an expression", "var a = 1;\nvar b = 2;\nprint a + b;\n", "2", "20"},
+		{"add a statement", "var a = 1;\nprint a;\n", "print a;", "a = 2;\nprint a;"},
+		{"delete a statement", "var a = 1;\na = 2;\nprint a;\n", "a = 2;\n", ""},
+		{"extend the statement before", "if (true) print 1;\nprint 2;\n", "\nprint 2;", " else print 2;"},
+		{"delete a brace", "fun f() {\n  print 1;\n}\nprint 2;\nprint 3;\n", "}\n", ""},
+		{"join a comment to the line after it", "// c\nx;print 1;", "\n", ""},
+		{"comment out a statement", "var a = 1;\nprint a;\nprint 2;\n", "print a;", "// print a;"},
+		{"uncomment a statement", "var a = 1;\n// print a;\nprint 2;\n", "// ", ""},
+		{"open a string", "var s = 1;\nprint s;\nprint 2;\n", "1;", "\"1;"},
+		{"close a string", "var s = \"a;\nprint s;\nprint \"b\";\n", "\"a;", "\"a\";"},
+		{"join identifiers", "var ab = 1;\nab;cd;\nprint 2;\n", "ab;", "ab"},
+		{"edit the last statement", "print 1;\nprint 2;", "2", "3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := strings.Index(test.source, test.old)
+			if start < 0 {
+				t.Fatalf("%q isn't in the source", test.old)
+			}
+			edit := TextEdit{Start: start, End: start + len(test.old), Text: test.new}
+			silent := &ErrorHandler{Output: io.Discard}
+			reparsed := Reparse(ParseSource(test.source, silent), edit, silent)
+			parsed := ParseSource(reparsed.Source, &ErrorHandler{Output: io.Discard})
+			if reparsed.HadError != parsed.HadError {
+				t.Errorf("reparsing had errors: %v, parsing had errors: %v", reparsed.HadError, parsed.HadError)
+			}
+			if parsed.HadError {
+				return
+			}
+			expected, _ := EncodeAST(parsed.Statements)
+			actual, _ := EncodeAST(reparsed.Statements)
+			if !bytes.Equal(expected, actual) {
+				t.Errorf("reparsing %q gave\n%s\nparsing it gave\n%s", reparsed.Source, actual, expected)
+			}
+		})
+	}
+}
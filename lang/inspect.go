@@ -0,0 +1,206 @@
+package lang
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * Turns a parsed expression into a tree of InspectNodes that can be browsed
+ * one node at a time, like the REPL's :inspect command does. Every AST node,
+ * token, list field, and literal value gets its own InspectNode, so the tree
+ * shows exactly what the parser built. Variable references also show how the
+ * resolver resolved them, either to a local some number of scopes out or to
+ * a global.
+ *
+ * The per-node code lives in astinspectnodes.go, which is generated by
+ * tool/generateast alongside the node definitions.
+ *****************************************************************************/
+
+type InspectNode struct {
+	Kind       string // the node type, e.g. "BinaryExpr", or "Token", "List", or "Value"
+	Field      string // the name of the field the node is in, or its index in a list
+	Span       Span
+	Summary    string // a short description of tokens and values
+	Resolution string // how the resolver resolved a variable reference, if the node is one
+	Children   []*InspectNode
+}
+
+func (node *InspectNode) String() string {
+	str := node.Kind
+	if node.Field != "" {
+		str = node.Field + ": " + str
+	}
+	if node.Summary != "" {
+		str += " " + node.Summary
+	}
+	if node.Resolution != "" {
+		str += " (" + node.Resolution + ")"
+	}
+	return str
+}
+
+/******************************************************************************
+ * InspectExpression parses and resolves a single expression and returns its
+ * tree. It returns nil if the source isn't a valid expression, after the
+ * problem has been reported through the error handler.
+ *****************************************************************************/
+
+func InspectExpression(source string, errorHandler *ErrorHandler) *InspectNode {
+	scanner := NewScanner(source, errorHandler)
+	tokens := scanner.ScanTokens()
+	parser := NewParser(tokens, errorHandler)
+	expr := parser.ParseExpression()
+	if errorHandler.HadError {
+		return nil
+	}
+
+	resolver := NewResolver(errorHandler)
+	resolver.SetDirectives(scanner.Directives())
+	resolver.ResolveExpression(expr)
+	if errorHandler.HadError {
+		return nil
+	}
+
+	return astInspector{locals: resolver.locals}.expr(expr)
+}
+
+type astInspector struct {
+	locals map[int]int
+}
+
+func (i astInspector) node(kind string, span Span, children ...*InspectNode) *InspectNode {
+	return &InspectNode{Kind: kind, Span: span, Children: children}
+}
+
+func (i astInspector) field(name string, node *InspectNode) *InspectNode {
+	node.Field = name
+	return node
+}
+
+func (i astInspector) list(children []*InspectNode) *InspectNode {
+	list := &InspectNode{Kind: "List", Summary: fmt.Sprintf("(%d)", len(children)), Children: children}
+	for index, child := range children {
+		child.Field = strconv.Itoa(index)
+		if index == 0 {
+			list.Span = child.Span
+		} else {
+			list.Span = joinSpans(list.Span, child.Span)
+		}
+	}
+	return list
+}
+
+// resolve records the resolver's answer for the expressions that refer to variables
+func (i astInspector) resolve(node *InspectNode, id int) {
+	switch node.Kind {
+	case "AssignExpr", "SuperExpr", "ThisExpr", "VariableExpr":
+		depth, isLocal := i.locals[id]
+		if isLocal {
+			node.Resolution = fmt.Sprintf("local, depth %d", depth)
+		} else {
+			node.Resolution = "global"
+		}
+	}
+}
+
+func (i astInspector) token(t Token) *InspectNode {
+	return &InspectNode{Kind: "Token", Span: t.span, Summary: t.tokenType.String() + " " + strconv.Quote(t.lexeme)}
+}
+
+func (i astInspector) tokens(tokens []Token) *InspectNode {
+	children := make([]*InspectNode, 0, len(tokens))
+	for _, t := range tokens {
+		children = append(children, i.token(t))
+	}
+	return i.list(children)
+}
+
+func (i astInspector) expr(expr Expr) *InspectNode {
+	if expr == nil {
+		return &InspectNode{Kind: "Value", Summary: "nil"}
+	}
+	return acceptExpr[*InspectNode](expr, i)
+}
+
+func (i astInspector) exprs(exprs []Expr) *InspectNode {
+	children := make([]*InspectNode, 0, len(exprs))
+	for _, expr := range exprs {
+		children = append(children, i.expr(expr))
+	}
+	return i.list(children)
+}
+
+func (i astInspector) stmt(stmt Stmt) *InspectNode {
+	if stmt == nil {
+		return &InspectNode{Kind: "Value", Summary: "nil"}
+	}
+	return acceptStmt[*InspectNode](stmt, i)
+}
+
+func (i astInspector) stmts(statements []Stmt) *InspectNode {
+	children := make([]*InspectNode, 0, len(statements))
+	for _, stmt := range statements {
+		children = append(children, i.stmt(stmt))
+	}
+	return i.list(children)
+}
+
+func (i astInspector) variable(v VariableExpr) *InspectNode {
+	if v.getId() == 0 { // an uninitialized VariableExpr (e.g. no superclass)
+		return &InspectNode{Kind: "Value", Summary: "nil"}
+	}
+	return i.visitVariableExpr(v)
+}
+
+func (i astInspector) functions(functions []FunctionStmt) *InspectNode {
+	children := make([]*InspectNode, 0, len(functions))
+	for _, function := range functions {
+		children = append(children, i.visitFunctionStmt(function))
+	}
+	return i.list(children)
+}
+
+func (i astInspector) flag(b bool) *InspectNode {
+	return &InspectNode{Kind: "Value", Summary: strconv.FormatBool(b)}
+}
+
+func (i astInspector) literal(value any) *InspectNode {
+	summary := fmt.Sprint(value)
+	switch value := value.(type) {
+	case nil:
+		summary = "nil"
+	case string:
+		summary = strconv.Quote(value)
+	}
+	return &InspectNode{Kind: "Value", Summary: summary}
+}
+
+/******************************************************************************
+ * ParseExpression parses source that should hold exactly one expression,
+ * rather than a program. It returns nil if there was a syntax error.
+ *****************************************************************************/
+
+func (p *Parser) ParseExpression() (expr Expr) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			_, isStaticError := err.(staticError)
+			if isStaticError {
+				// the error handler has already reported the error
+				expr = nil
+			} else {
+				// this is not a panic thrown by us - pass it on
+				panic(err)
+			}
+		}
+	}()
+
+	expr = p.expression()
+	if !p.isAtEnd() {
+		p.createError(p.peek(), diag.ExpectedToken, "Expect end of expression.", true)
+	}
+	return expr
+}
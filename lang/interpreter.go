@@ -1,11 +1,14 @@
 package lang
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
-	"math"
+	"io"
 	"os"
-	"reflect"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
 )
 
 /******************************************************************************
@@ -15,61 +18,167 @@ import (
  * where the code comes to life.
  *****************************************************************************/
 
+type loopControl struct {
+	isBreak bool // false for continue
+}
+
 type Interpreter struct {
 	globals      *environment
 	env          *environment
 	locals       map[int]int
+	tailCalls    map[int]bool
+	statements   []Stmt
+	nativeFilter func(module string, name string) bool
+	output       io.Writer
+	input        *bufio.Reader // where the prompt natives read from, stdin when nil
+	hooks        *hooks        // nil unless the run is being watched, see hooks.go
+	file         string        // file being run, empty when there isn't one
+	dir          string        // directory relative imports are found from
+	importer     *importer
+	interrupts   *interrupts              // shared with the interpreters of imported modules
+	stack        *callStack               // shared with the interpreters of imported modules
+	exits        *exitHooks               // shared with the interpreters of imported modules
+	assertions   *AssertionCounts         // shared with the interpreters of imported modules
+	mocks        *mocks                   // shared with the interpreters of imported modules
+	worker       *workerLink              // nil unless running in a worker
+	hostsVM      bool                     // set when the interpreter only supplies natives to a VM
+	vmGlobals    map[string]runtime.Value // the globals of the VM it supplies natives to
 	errorHandler *ErrorHandler
 }
 
 func NewInterpreter(errorHandler *ErrorHandler) *Interpreter {
 	globals := newEnvironment(errorHandler)
-	return &Interpreter{globals: globals, env: globals, locals: make(map[int]int),
-		errorHandler: errorHandler}
+	interpreter := &Interpreter{globals: globals, env: globals, locals: make(map[int]int), tailCalls: make(map[int]bool), output: os.Stdout,
+		dir: ".", importer: newImporter("."), interrupts: &interrupts{}, exits: &exitHooks{},
+		assertions: &AssertionCounts{}, mocks: &mocks{}, errorHandler: errorHandler}
+	interpreter.stack = newCallStack(interpreter)
+	globals.lazyGlobals = interpreter.lookUpNative
+	return interpreter
+}
+
+func (interpreter *Interpreter) Compile(program *Program) error {
+	// there is nothing to lower, the tree-walker runs the resolved AST as is
+	for id, depth := range program.locals {
+		interpreter.locals[id] = depth
+	}
+	for id := range program.tailCalls {
+		interpreter.tailCalls[id] = true
+	}
+	interpreter.statements = program.Statements
+	return nil
 }
 
-func (interpreter *Interpreter) Interpret(statements []Stmt) {
-	defer func() {
-		err := recover()
-		if err != nil {
-			/******************************************************************
-			 * Gracefully print runtime errors to stderr and return from the
-			 * function. Handling runtime errors in this deferred function
-			 * allows us to exit the application with the runtime error exit
-			 * code (70).
-			 *****************************************************************/
-			runtimeError, isRuntimeError := err.(runtimeError)
-			if isRuntimeError {
-				os.Stderr.WriteString(runtimeError.msg)
-			} else {
-				// this is not a panic thrown by us - pass it on
-				panic(err)
-			}
-		}
-	}()
+func (interpreter *Interpreter) Run() (err error) {
+	defer interpreter.catchRuntimeError(&err)
+	if h := interpreter.hooks; h != nil && h.profile != nil {
+		defer h.profile.start(interpreter.interrupts)()
+	}
+	if h := interpreter.hooks; h != nil && h.calls != nil {
+		h.calls.enter("<script>", interpreter.file, false)
+		defer h.calls.leave()
+	}
 
-	interpreter.defineNativeFunctions()
-	for _, statement := range statements {
+	for _, statement := range interpreter.statements {
 		interpreter.execute(statement)
 	}
+	return nil
 }
 
-func (interpreter *Interpreter) resolve(expr Expr, depth int) {
-	interpreter.locals[expr.getId()] = depth
+// catchRuntimeError is deferred by entry points into the interpreter to turn a runtime error into an error result
+func (interpreter *Interpreter) catchRuntimeError(err *error) {
+	recovered := recover()
+	if recovered != nil {
+		/**********************************************************************
+		 * Gracefully print runtime errors to stderr and return from the
+		 * function. Handling runtime errors in this deferred function
+		 * allows us to exit the application with the runtime error exit
+		 * code (70).
+		 *********************************************************************/
+		runtimeError, isRuntimeError := recovered.(runtimeError)
+		exit, isExit := recovered.(ExitError)
+		if isRuntimeError {
+			interpreter.errorHandler.report(runtimeError.diagnostic)
+			*err = runtimeError
+		} else if isExit {
+			*err = exit
+		} else {
+			// this is not a panic thrown by us - pass it on
+			panic(recovered)
+		}
+	}
 }
 
-func (interpreter *Interpreter) lookUpVariable(name Token, expr Expr) any {
-	distance, hasDistance := interpreter.locals[expr.getId()]
+// SetOutput redirects what print statements write, which is stdout by default.
+func (interpreter *Interpreter) SetOutput(output io.Writer) {
+	interpreter.output = output
+}
+
+/******************************************************************************
+ * Record starts recording a trace of every statement the interpreter
+ * executes from here on. The returned trace fills in as the program runs and
+ * is complete once Run returns, even if the program hit a runtime error.
+ *****************************************************************************/
+
+func (interpreter *Interpreter) Record(source string) *Trace {
+	trace := &Trace{Source: source}
+	interpreter.watch().recorder = &recorder{trace: trace}
+	return trace
+}
+
+/******************************************************************************
+ * SetStepBudget limits how many statements the interpreter will execute
+ * before giving up with a runtime error. This keeps programs that never
+ * finish, like ones generated by a fuzzer, from running forever or
+ * recursing until the Go stack overflows.
+ *****************************************************************************/
+
+func (interpreter *Interpreter) SetStepBudget(steps int) {
+	interpreter.watch().stepBudget = steps
+}
+
+/******************************************************************************
+ * SetMaxCallDepth limits how many Lox function calls can be active at once
+ * before the program stops with a "Stack overflow." runtime error. Calls
+ * into imported modules count towards the same limit. The limit can't be
+ * more than MaxCallDepth.
+ *****************************************************************************/
+
+func (interpreter *Interpreter) SetMaxCallDepth(depth int) {
+	interpreter.stack.limit = fitCallDepth(depth)
+}
+
+func (interpreter *Interpreter) lookUpVariable(name Token, id int) runtime.Value {
+	distance, hasDistance := interpreter.locals[id]
 	// resolved only local variables so if there is no distance, check the global map
+	var value runtime.Value
 	if hasDistance {
-		return interpreter.env.getAt(distance, name)
+		value = interpreter.env.getAt(distance, name)
 	} else {
-		return interpreter.globals.get(name)
+		value = interpreter.globals.get(name)
+	}
+	if interpreter.hooks != nil && interpreter.hooks.recorder != nil {
+		interpreter.hooks.recorder.touch(name.lexeme, value, false)
+	}
+	return value
+}
+
+// globalValue looks up a global variable of the running program without reporting an error if there is none
+func (interpreter *Interpreter) globalValue(name string) (runtime.Value, bool) {
+	if interpreter.hostsVM {
+		value, found := interpreter.vmGlobals[name]
+		return value, found
 	}
+	value, found := interpreter.globals.values[name]
+	return value, found
 }
 
-func (interperter *Interpreter) defineNativeFunctions() {
-	interperter.globals.define("clock", clock{})
+// setGlobal gives a global variable of the running program a new value, defining it if there is none
+func (interpreter *Interpreter) setGlobal(name string, value runtime.Value) {
+	if interpreter.hostsVM {
+		interpreter.vmGlobals[name] = value
+		return
+	}
+	interpreter.globals.define(name, value)
 }
 
 func (interpreter *Interpreter) executeBlock(statements []Stmt, blockEnv *environment) {
@@ -88,75 +197,163 @@ func (interpreter *Interpreter) executeBlock(statements []Stmt, blockEnv *enviro
 	}
 }
 
-func (interpreter *Interpreter) execute(stmt Stmt) any {
-	return stmt.accept(interpreter)
+func (interpreter *Interpreter) execute(stmt Stmt) {
+	defer interpreter.stack.unnest()
+	interpreter.nest(stmt)
+	if interpreter.hooks != nil {
+		interpreter.executeWatched(stmt)
+		return
+	}
+	interpreter.stack.at(stmt.Span().Start.Line, interpreter.env)
+	interpreter.checkInterruption(stmt)
+	acceptStmt(stmt, interpreter)
 }
 
-func (interpreter *Interpreter) evaluate(expr Expr) any {
-	return expr.accept(interpreter)
+// checkInterruption stops the program with a runtime error if it was cancelled or a call it is in timed out
+func (interpreter *Interpreter) checkInterruption(stmt Stmt) {
+	if code, err := interpreter.interruption(); err != nil {
+		interpreter.errorHandler.reportRuntimeError(code, stmt.Span().Start.Line, err)
+	}
 }
 
-func (interpreter *Interpreter) visitBlockStmt(stmt BlockStmt) any {
+func (interpreter *Interpreter) evaluate(expr Expr) runtime.Value {
+	defer interpreter.stack.unnest()
+	interpreter.nest(expr)
+	if interpreter.hooks != nil && interpreter.hooks.tracer != nil {
+		return interpreter.hooks.tracer.expression(expr, acceptExpr(expr, interpreter), interpreter.stack)
+	}
+	return acceptExpr(expr, interpreter)
+}
+
+// nest counts a statement or expression starting inside the ones running, stopping with a stack overflow past maxNesting
+func (interpreter *Interpreter) nest(node interface{ Span() Span }) {
+	interpreter.stack.nesting++
+	if interpreter.stack.nesting > maxNesting {
+		interpreter.errorHandler.reportRuntimeError(diag.StackOverflow, node.Span().Start.Line, errors.New("Stack overflow."))
+	}
+}
+
+func (interpreter *Interpreter) visitBlockStmt(stmt BlockStmt) none {
 	interpreter.executeBlock(stmt.statements, newChildEnvironment(interpreter.env))
-	return nil
+	return none{}
 }
 
-func (interpreter *Interpreter) visitClassStmt(stmt ClassStmt) any {
-	var superclass *class
+func (interpreter *Interpreter) visitBreakStmt(stmt BreakStmt) none {
+	// unwind to the enclosing loop the same way return statements unwind calls
+	panic(loopControl{isBreak: true})
+}
+
+func (interpreter *Interpreter) visitClassStmt(stmt ClassStmt) none {
+	var superclass *runtime.Class
 	if stmt.superclass.getId() != 0 { // any Expr with an ID of 0 is unitialized
-		class, isClass := interpreter.evaluate(stmt.superclass).(class)
+		class, isClass := interpreter.evaluate(stmt.superclass).(*runtime.Class)
 		if !isClass {
 			err := errors.New("Superclass must be a class.")
-			interpreter.errorHandler.reportRuntimeError(stmt.superclass.name.line, err)
+			interpreter.errorHandler.reportRuntimeErrorAt(diag.SuperclassNotClass, stmt.superclass.name, err)
 		}
-		superclass = &class
+		superclass = class
+	}
+	traits := make([]runtime.Value, 0, len(stmt.traits))
+	for _, trait := range stmt.traits {
+		traits = append(traits, interpreter.evaluate(trait))
 	}
 	interpreter.env.define(stmt.name.lexeme, nil)
 	if stmt.superclass.getId() != 0 {
 		interpreter.env = newChildEnvironment(interpreter.env)
 		interpreter.env.define("super", superclass)
 	}
-	methods := make(map[string]function)
-	for _, method := range stmt.methods {
-		methods[method.name.lexeme] = function{declaration: method, closure: interpreter.env,
-			isInitializer: method.name.lexeme == "init"}
+	methods, code, err := mixTraits(traits, interpreter.methods(stmt.methods))
+	if err != nil {
+		interpreter.errorHandler.reportRuntimeErrorAt(code, stmt.name, err)
 	}
-	class := class{name: stmt.name.lexeme, superclass: superclass, methods: methods,
-		errorHandler: interpreter.errorHandler}
+	class := runtime.NewClass(stmt.name.lexeme, superclass, methods)
 	if stmt.superclass.getId() != 0 {
 		interpreter.env = interpreter.env.enclosing
 	}
 	interpreter.env.assign(stmt.name, class)
-	return nil
+	return none{}
 }
 
-func (interpreter *Interpreter) visitExprStmt(stmt ExprStmt) any {
+// methods creates the methods of a class or trait, closing over the current environment
+func (interpreter *Interpreter) methods(declarations []FunctionStmt) map[string]runtime.Function {
+	methods := make(map[string]runtime.Function)
+	for _, method := range declarations {
+		methods[method.name.lexeme] = &function{name: method.name.lexeme, params: method.params, body: method.body,
+			closure: interpreter.env, isInitializer: method.name.lexeme == "init", isGetter: method.isGetter,
+			variadic: method.variadic, interpreter: interpreter}
+	}
+	return methods
+}
+
+func (interpreter *Interpreter) visitContinueStmt(stmt ContinueStmt) none {
+	panic(loopControl{isBreak: false})
+}
+
+func (interpreter *Interpreter) visitErrorStmt(stmt ErrorStmt) none {
+	// programs with syntax errors are never run
+	return none{}
+}
+
+func (interpreter *Interpreter) visitExprStmt(stmt ExprStmt) none {
 	interpreter.evaluate(stmt.expr)
-	return nil
+	return none{}
+}
+
+func (interpreter *Interpreter) visitForEachStmt(stmt ForEachStmt) none {
+	collection := interpreter.evaluate(stmt.collection)
+	iterator, code, err := newIterator(collection)
+	if err != nil {
+		interpreter.errorHandler.reportRuntimeErrorAt(code, stmt.keyword, err)
+	}
+	for {
+		value, more, err := iterator.next()
+		if err != nil {
+			interpreter.errorHandler.reportRuntimeErrorAt(diag.NativeError, stmt.keyword, err)
+		}
+		if !more {
+			break
+		}
+		env := newChildEnvironment(interpreter.env)
+		env.define(stmt.name.lexeme, value)
+		if interpreter.executeLoopBody(func() { interpreter.executeBlock([]Stmt{stmt.body}, env) }) {
+			break
+		}
+	}
+	return none{}
 }
 
-func (interpreter *Interpreter) visitFunctionStmt(stmt FunctionStmt) any {
-	function := function{declaration: stmt, closure: interpreter.env, isInitializer: false}
+func (interpreter *Interpreter) visitFunctionStmt(stmt FunctionStmt) none {
+	function := &function{name: stmt.name.lexeme, params: stmt.params, body: stmt.body, closure: interpreter.env,
+		isInitializer: false, variadic: stmt.variadic, interpreter: interpreter}
 	interpreter.env.define(stmt.name.lexeme, function)
-	return nil
+	return none{}
 }
 
-func (interpreter *Interpreter) visitIfStmt(stmt IfStmt) any {
-	if isTruthy(interpreter.evaluate(stmt.condition)) {
+func (interpreter *Interpreter) visitIfStmt(stmt IfStmt) none {
+	condition := runtime.IsTruthy(interpreter.evaluate(stmt.condition))
+	if interpreter.hooks != nil {
+		interpreter.hooks.branch(interpreter.file, stmt, stmt.condition, condition)
+	}
+	if condition {
 		interpreter.execute(stmt.thenBranch)
 	} else if stmt.elseBranch != nil {
 		interpreter.execute(stmt.elseBranch)
 	}
-	return nil
+	return none{}
 }
 
-func (interpreter *Interpreter) visitPrintStmt(stmt PrintStmt) any {
+func (interpreter *Interpreter) visitImportStmt(stmt ImportStmt) none {
+	interpreter.env.define(stmt.name.lexeme, interpreter.importModule(stmt))
+	return none{}
+}
+
+func (interpreter *Interpreter) visitPrintStmt(stmt PrintStmt) none {
 	value := interpreter.evaluate(stmt.expr)
-	fmt.Println(stringify(value))
-	return nil
+	fmt.Fprintln(interpreter.output, runtime.Stringify(value))
+	return none{}
 }
 
-func (interpreter *Interpreter) visitReturnStmt(stmt ReturnStmt) any {
+func (interpreter *Interpreter) visitReturnStmt(stmt ReturnStmt) none {
 	var value any
 	if stmt.value != nil {
 		value = interpreter.evaluate(stmt.value)
@@ -166,23 +363,63 @@ func (interpreter *Interpreter) visitReturnStmt(stmt ReturnStmt) any {
 	panic(returnContent{value: value})
 }
 
-func (interpreter *Interpreter) visitVarStmt(stmt VarStmt) any {
+func (interpreter *Interpreter) visitTraitStmt(stmt TraitStmt) none {
+	interpreter.env.define(stmt.name.lexeme, runtime.NewTrait(stmt.name.lexeme, interpreter.methods(stmt.methods)))
+	return none{}
+}
+
+func (interpreter *Interpreter) visitVarStmt(stmt VarStmt) none {
 	var value any // set variable value to nil if not explicitly initialized
 	if stmt.initializer != nil {
 		value = interpreter.evaluate(stmt.initializer)
 	}
 	interpreter.env.define(stmt.name.lexeme, value)
-	return nil
+	if interpreter.hooks != nil && interpreter.hooks.recorder != nil {
+		interpreter.hooks.recorder.touch(stmt.name.lexeme, value, true)
+	}
+	return none{}
 }
 
-func (interpreter *Interpreter) visitWhileStmt(stmt WhileStmt) any {
-	for isTruthy(interpreter.evaluate(stmt.condition)) {
-		interpreter.execute(stmt.body)
+func (interpreter *Interpreter) visitWhileStmt(stmt WhileStmt) none {
+	for interpreter.loopCondition(stmt) {
+		if interpreter.executeLoopBody(func() { interpreter.execute(stmt.body) }) {
+			break
+		}
+		if stmt.increment != nil {
+			interpreter.evaluate(stmt.increment)
+		}
 	}
-	return nil
+	return none{}
 }
 
-func (interpreter *Interpreter) visitAssignExpr(expr AssignExpr) any {
+// loopCondition evaluates the condition of a while or for, counting which way it went if coverage is being recorded
+func (interpreter *Interpreter) loopCondition(stmt WhileStmt) bool {
+	value := runtime.IsTruthy(interpreter.evaluate(stmt.condition))
+	if interpreter.hooks != nil {
+		interpreter.hooks.branch(interpreter.file, stmt, stmt.condition, value)
+	}
+	return value
+}
+
+// executeLoopBody runs one iteration of a loop and reports whether it hit a break statement
+func (interpreter *Interpreter) executeLoopBody(body func()) (isBreak bool) {
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			loopControl, isLoopControl := recovered.(loopControl)
+			if isLoopControl {
+				isBreak = loopControl.isBreak
+			} else {
+				// this is not a panic thrown by us - pass it on
+				panic(recovered)
+			}
+		}
+	}()
+	body()
+	return false
+}
+
+func (interpreter *Interpreter) visitAssignExpr(expr AssignExpr) runtime.Value {
 	value := interpreter.evaluate(expr.value)
 	distance, hasDistance := interpreter.locals[expr.getId()]
 	if hasDistance {
@@ -190,93 +427,41 @@ func (interpreter *Interpreter) visitAssignExpr(expr AssignExpr) any {
 	} else {
 		interpreter.env.assign(expr.name, value)
 	}
+	if interpreter.hooks != nil && interpreter.hooks.recorder != nil {
+		interpreter.hooks.recorder.touch(expr.name.lexeme, value, true)
+	}
 	return value
 }
 
-func (interpreter *Interpreter) visitBinaryExpr(expr BinaryExpr) any {
+func (interpreter *Interpreter) visitBinaryExpr(expr BinaryExpr) runtime.Value {
 	left := interpreter.evaluate(expr.left)
 	right := interpreter.evaluate(expr.right)
 
 	switch expr.operator.tokenType {
-	case tokenTypeGreater:
-		valid, leftFloat, rightFloat := areValuesValidFloats(left, right)
-		if !valid {
-			err := errors.New("Operands must be numbers when using the '>' operator.")
-			interpreter.errorHandler.reportRuntimeError(expr.operator.line, err)
-		}
-		return leftFloat > rightFloat
-	case tokenTypeGreaterEqual:
-		valid, leftFloat, rightFloat := areValuesValidFloats(left, right)
-		if !valid {
-			err := errors.New("Operands must be numbers when using the '>=' operator.")
-			interpreter.errorHandler.reportRuntimeError(expr.operator.line, err)
-		}
-		return leftFloat >= rightFloat
-	case tokenTypeLess:
-		valid, leftFloat, rightFloat := areValuesValidFloats(left, right)
-		if !valid {
-			err := errors.New("Operands must be numbers when using the '<' operator.")
-			interpreter.errorHandler.reportRuntimeError(expr.operator.line, err)
-		}
-		return leftFloat < rightFloat
-	case tokenTypeLessEqual:
-		valid, leftFloat, rightFloat := areValuesValidFloats(left, right)
-		if !valid {
-			err := errors.New("Operands must be numbers when using the '<=' operator.")
-			interpreter.errorHandler.reportRuntimeError(expr.operator.line, err)
-		}
-		return leftFloat <= rightFloat
-	case tokenTypeMinus:
-		valid, leftFloat, rightFloat := areValuesValidFloats(left, right)
-		if !valid {
-			err := errors.New("Operands must be numbers when using the '-' operator.")
-			interpreter.errorHandler.reportRuntimeError(expr.operator.line, err)
-		}
-		return leftFloat - rightFloat
-	case tokenTypePlus:
-		validFloats, leftFloat, rightFloat := areValuesValidFloats(left, right)
-		if validFloats {
-			return leftFloat + rightFloat
-		}
-		validStrings, leftString, rightString := areValuesValidStrings(left, right)
-		if validStrings {
-			return leftString + rightString
-		}
-		err := errors.New("Operands must be numbers or strings and be the same type when using the '+' operator.")
-		interpreter.errorHandler.reportRuntimeError(expr.operator.line, err)
-	case tokenTypeSlash:
-		valid, leftFloat, rightFloat := areValuesValidFloats(left, right)
-		if !valid {
-			err := errors.New("Operands must be numbers when using the '/' operator.")
-			interpreter.errorHandler.reportRuntimeError(expr.operator.line, err)
-		}
-		return leftFloat / rightFloat
-	case tokenTypeStar:
-		valid, leftFloat, rightFloat := areValuesValidFloats(left, right)
-		if !valid {
-			err := errors.New("Operands must be numbers when using the '*' operator.")
-			interpreter.errorHandler.reportRuntimeError(expr.operator.line, err)
+	case tokenTypeGreater, tokenTypeGreaterEqual, tokenTypeLess, tokenTypeLessEqual, tokenTypeMinus, tokenTypePlus,
+		tokenTypeSlash, tokenTypeStar, tokenTypeMod:
+		value, code, err := arithmetic(expr.operator.lexeme, left, right)
+		if err != nil {
+			interpreter.errorHandler.reportRuntimeErrorAt(code, expr.operator, err)
 		}
-		return leftFloat * rightFloat
-	case tokenTypeMod:
-		valid, leftFloat, rightFloat := areValuesValidFloats(left, right)
-		if !valid {
-			err := errors.New("Operands must be numbers when using the '%' operator.")
-			interpreter.errorHandler.reportRuntimeError(expr.operator.line, err)
+		return value
+	case tokenTypeAmpersand, tokenTypePipe, tokenTypeCaret, tokenTypeLessLess, tokenTypeGreaterGreater:
+		value, code, err := bitwise(expr.operator.lexeme, left, right)
+		if err != nil {
+			interpreter.errorHandler.reportRuntimeErrorAt(code, expr.operator, err)
 		}
-		// using math.Mod instead of '%' to handle floating point numbers correctly
-		return math.Mod(leftFloat, rightFloat)
+		return value
 	case tokenTypeEqualEqual:
-		return reflect.DeepEqual(left, right)
+		return runtime.Equal(left, right)
 	case tokenTypeBangEqual:
-		return !reflect.DeepEqual(left, right)
+		return !runtime.Equal(left, right)
 	}
 
 	// unreachable
 	return nil
 }
 
-func (interpreter *Interpreter) visitCallExpr(expr CallExpr) any {
+func (interpreter *Interpreter) visitCallExpr(expr CallExpr) runtime.Value {
 	callee := interpreter.evaluate(expr.callee)
 
 	args := make([]any, 0, 0)
@@ -284,146 +469,186 @@ func (interpreter *Interpreter) visitCallExpr(expr CallExpr) any {
 		args = append(args, interpreter.evaluate(arg))
 	}
 
-	callable, isCallable := callee.(callable)
+	if len(expr.names) > 0 {
+		bound, code, err := bindNamedArguments(callee, args, argumentNames(expr.names))
+		if err != nil {
+			interpreter.errorHandler.reportRuntimeErrorAt(code, expr.paren, err)
+		}
+		args = bound
+	}
+
+	callable, isCallable := callee.(runtime.Callable)
 	if isCallable {
-		if len(args) != callable.arity() {
-			err := errors.New(fmt.Sprintf("Expected %d arguments but got %d.", callable.arity(), len(args)))
-			interpreter.errorHandler.reportRuntimeError(expr.paren.line, err)
+		if err := runtime.CheckArity(callable, len(args)); err != nil {
+			interpreter.errorHandler.reportRuntimeErrorAt(diag.ArityMismatch, expr.paren, err)
 			return nil
 		}
-		return callable.call(interpreter, args)
+		if _, isFunction := callable.(*function); isFunction && interpreter.stack.full() {
+			interpreter.errorHandler.reportRuntimeErrorAt(diag.StackOverflow, expr.paren, errors.New("Stack overflow."))
+		}
+		if fun, isFunction := callable.(*function); isFunction && interpreter.tailCalls[expr.getId()] && !interpreter.hooks.keepCallers() {
+			// nothing is left to do here once the call returns, so let the function making it return first
+			panic(returnContent{tailCall: &tailCall{callee: fun, args: args}})
+		}
+		result, err := callable.Call(args)
+		if err != nil {
+			interpreter.errorHandler.reportRuntimeErrorAt(nativeErrorCode(err), expr.paren, err)
+		}
+		return result
 	} else {
 		err := errors.New("Can only call functions and classes.")
-		interpreter.errorHandler.reportRuntimeError(expr.paren.line, err)
+		interpreter.errorHandler.reportRuntimeErrorAt(diag.NotCallable, expr.paren, err)
 		return nil
 	}
 }
 
-func (interpreter *Interpreter) visitGetExpr(expr GetExpr) any {
-	object, isInstance := interpreter.evaluate(expr.object).(instance)
-	if isInstance {
-		return object.get(expr.name)
+func (interpreter *Interpreter) visitConditionalExpr(expr ConditionalExpr) runtime.Value {
+	// only the branch that is picked gets evaluated
+	if runtime.IsTruthy(interpreter.evaluate(expr.condition)) {
+		return interpreter.evaluate(expr.thenBranch)
+	}
+	return interpreter.evaluate(expr.elseBranch)
+}
+
+func (interpreter *Interpreter) visitFunctionExpr(expr FunctionExpr) runtime.Value {
+	return &function{params: expr.params, body: expr.body, closure: interpreter.env, isInitializer: false,
+		variadic: expr.variadic, interpreter: interpreter}
+}
+
+func (interpreter *Interpreter) visitGetExpr(expr GetExpr) runtime.Value {
+	object, isObject := interpreter.evaluate(expr.object).(runtime.Object)
+	if isObject {
+		value, found := object.Get(expr.name.lexeme)
+		if !found {
+			err := errors.New("Undefined property '" + expr.name.lexeme + "'.")
+			interpreter.errorHandler.reportRuntimeErrorAt(diag.UndefinedProperty, expr.name, err)
+		}
+		return interpreter.callGetter(value, expr.name.line)
 	}
 	err := errors.New("Only instances have properties.")
-	interpreter.errorHandler.reportRuntimeError(expr.name.line, err)
+	interpreter.errorHandler.reportRuntimeErrorAt(diag.OnlyInstancesHaveFields, expr.name, err)
 	return nil
 }
 
-func (interpreter *Interpreter) visitGroupingExpr(expr GroupingExpr) any {
+func (interpreter *Interpreter) visitGroupingExpr(expr GroupingExpr) runtime.Value {
 	value := interpreter.evaluate(expr.expression)
 	return value
 }
 
-func (interperter *Interpreter) visitLiteralExpr(expr LiteralExpr) any {
+func (interpreter *Interpreter) visitListExpr(expr ListExpr) runtime.Value {
+	elements := make([]runtime.Value, 0, len(expr.elements))
+	for _, element := range expr.elements {
+		elements = append(elements, interpreter.evaluate(element))
+	}
+	return runtime.NewList(elements)
+}
+
+func (interperter *Interpreter) visitLiteralExpr(expr LiteralExpr) runtime.Value {
 	return expr.value
 }
 
-func (interperter *Interpreter) visitLogicalExpr(expr LogicalExpr) any {
+func (interperter *Interpreter) visitLogicalExpr(expr LogicalExpr) runtime.Value {
 	// check if we can short circuit by evaluating left operand first
 	left := interperter.evaluate(expr.left)
 	if expr.operator.tokenType == tokenTypeOr {
-		if isTruthy(left) {
+		if runtime.IsTruthy(left) {
 			return left
 		}
 	} else {
-		if !isTruthy(left) {
+		if !runtime.IsTruthy(left) {
 			return left
 		}
 	}
 	return interperter.evaluate(expr.right)
 }
 
-func (interpreter *Interpreter) visitSetExpr(expr SetExpr) any {
-	object, isInstance := interpreter.evaluate(expr.object).(instance)
+func (interpreter *Interpreter) visitMapExpr(expr MapExpr) runtime.Value {
+	m := runtime.NewMap()
+	for i := range expr.keys {
+		key := interpreter.evaluate(expr.keys[i])
+		m.Set(key, interpreter.evaluate(expr.values[i]))
+	}
+	return m
+}
+
+func (interpreter *Interpreter) visitSetExpr(expr SetExpr) runtime.Value {
+	object, isInstance := interpreter.evaluate(expr.object).(*runtime.Instance)
 	if !isInstance {
 		err := errors.New("Only instances have fields.")
-		interpreter.errorHandler.reportRuntimeError(expr.name.line, err)
+		interpreter.errorHandler.reportRuntimeErrorAt(diag.OnlyInstancesHaveFields, expr.name, err)
 		return nil
 	}
 	value := interpreter.evaluate(expr.value)
-	object.set(expr.name, value)
+	object.Set(expr.name.lexeme, value)
+	return value
+}
+
+func (interpreter *Interpreter) visitSubscriptExpr(expr SubscriptExpr) runtime.Value {
+	object := interpreter.evaluate(expr.object)
+	index := interpreter.evaluate(expr.index)
+	value, code, err := getSubscript(object, index)
+	if err != nil {
+		interpreter.errorHandler.reportRuntimeErrorAt(code, expr.bracket, err)
+	}
+	return value
+}
+
+func (interpreter *Interpreter) visitSubscriptSetExpr(expr SubscriptSetExpr) runtime.Value {
+	object := interpreter.evaluate(expr.object)
+	index := interpreter.evaluate(expr.index)
+	value := interpreter.evaluate(expr.value)
+	code, err := setSubscript(object, index, value)
+	if err != nil {
+		interpreter.errorHandler.reportRuntimeErrorAt(code, expr.bracket, err)
+	}
 	return value
 }
 
-func (interpreter *Interpreter) visitSuperExpr(expr SuperExpr) any {
+func (interpreter *Interpreter) visitSuperExpr(expr SuperExpr) runtime.Value {
 	distance := interpreter.locals[expr.getId()]
-	superclass := interpreter.env.getAt(distance, expr.keyword).(*class)
-	object := interpreter.env.getSubClassThisValue(distance).(instance)
-	method, foundMethod := superclass.findMethod(expr.method.lexeme).(function)
+	superclass := interpreter.env.getAt(distance, expr.keyword).(*runtime.Class)
+	object := interpreter.env.getSubClassThisValue(distance).(*runtime.Instance)
+	method, foundMethod := superclass.FindMethod(expr.method.lexeme)
 	if !foundMethod {
 		err := errors.New("Undefined property '" + expr.method.lexeme + "'.")
-		interpreter.errorHandler.reportRuntimeError(expr.method.line, err)
+		interpreter.errorHandler.reportRuntimeErrorAt(diag.UndefinedProperty, expr.method, err)
 		return nil
 	}
-	return method.bind(object)
+	return interpreter.callGetter(method.Bind(object), expr.method.line)
+}
+
+// callGetter runs a method read as a property if it is a getter, and returns anything else as it is
+func (interpreter *Interpreter) callGetter(value runtime.Value, line int) runtime.Value {
+	getter, isGetter := value.(runtime.Getter)
+	if !isGetter || !getter.IsGetter() {
+		return value
+	}
+	result, err := getter.Call(nil)
+	if err != nil {
+		interpreter.errorHandler.reportRuntimeError(diag.NativeError, line, err)
+	}
+	return result
 }
 
-func (interpreter *Interpreter) visitThisExpr(expr ThisExpr) any {
-	return interpreter.lookUpVariable(expr.keyword, expr)
+func (interpreter *Interpreter) visitThisExpr(expr ThisExpr) runtime.Value {
+	return interpreter.lookUpVariable(expr.keyword, expr.id)
 }
 
-func (interpreter *Interpreter) visitUnaryExpr(expr UnaryExpr) any {
+func (interpreter *Interpreter) visitUnaryExpr(expr UnaryExpr) runtime.Value {
 	right := interpreter.evaluate(expr.right)
 	switch expr.operator.tokenType {
 	case tokenTypeBang:
-		return !isTruthy(right)
+		return !runtime.IsTruthy(right)
 	case tokenTypeMinus:
-		rightFloat, rightFloatValid := right.(float64)
-		if !rightFloatValid {
-			err := errors.New("Operand must be a number.")
-			interpreter.errorHandler.reportRuntimeError(expr.operator.line, err)
+		value, code, err := negate(right)
+		if err != nil {
+			interpreter.errorHandler.reportRuntimeErrorAt(code, expr.operator, err)
 		}
-		return -1 * rightFloat
+		return value
 	}
 	return nil
 }
 
-func (interpreter *Interpreter) visitVariableExpr(expr VariableExpr) any {
-	return interpreter.lookUpVariable(expr.name, expr)
-}
-
-func areValuesValidFloats(left, right any) (bool, float64, float64) {
-	leftFloat, leftFloatValid := left.(float64)
-	rightFloat, rightFloatValid := right.(float64)
-	return leftFloatValid && rightFloatValid, leftFloat, rightFloat
-}
-
-func areValuesValidStrings(left, right any) (bool, string, string) {
-	leftString, leftStringValid := left.(string)
-	rightString, rightStringValid := right.(string)
-	return leftStringValid && rightStringValid, leftString, rightString
-}
-
-func isTruthy(value any) bool {
-	if value == nil {
-		return false
-	}
-	boolVal, isBool := value.(bool)
-	if isBool {
-		return boolVal
-	}
-	strVal, isString := value.(string)
-	if isString {
-		return len(strVal) > 0
-	}
-	number, isNumber := value.(float64)
-	if isNumber {
-		return -1e-9 > number || number > 1e-9
-	}
-	return false
-}
-
-func stringify(value any) string {
-	if value == nil {
-		return "nil"
-	}
-	callable, isCallable := value.(callable)
-	if isCallable {
-		return callable.toString()
-	}
-	instance, isInstance := value.(instance)
-	if isInstance {
-		return instance.toString()
-	}
-	return fmt.Sprint(value)
+func (interpreter *Interpreter) visitVariableExpr(expr VariableExpr) runtime.Value {
+	return interpreter.lookUpVariable(expr.name, expr.id)
 }
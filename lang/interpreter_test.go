@@ -0,0 +1,44 @@
+package lang
+
+import (
+	"io"
+	"testing"
+)
+
+/******************************************************************************
+ * The tree-walker spends most of its time in calls and loops, so it is
+ * benchmarked on fib(25) and a million iterations of a for loop. Runs with no
+ * hooks set should take the plain path through execute, compare:
+ *
+ *   go test ./lang -run '^$' -bench Interpreter
+ *****************************************************************************/
+
+const benchmarkSource = `
+fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); }
+print fib(25);
+var sum = 0;
+for (var i = 0; i < 1000000; i = i + 1) { sum = sum + i; }
+print sum;
+`
+
+func BenchmarkInterpreter(b *testing.B) {
+	benchmarkInterpreter(b, func(*Interpreter) {})
+}
+
+// BenchmarkInterpreterWatched sets a step budget it never reaches, so every statement takes the watched path
+func BenchmarkInterpreterWatched(b *testing.B) {
+	benchmarkInterpreter(b, func(interpreter *Interpreter) { interpreter.SetStepBudget(1 << 40) })
+}
+
+func benchmarkInterpreter(b *testing.B, setUp func(*Interpreter)) {
+	program := NewFrontEnd(NewErrorHandler()).Analyze(benchmarkSource)
+	for i := 0; i < b.N; i++ {
+		interpreter := NewInterpreter(NewErrorHandler())
+		interpreter.SetOutput(io.Discard)
+		setUp(interpreter)
+		interpreter.Compile(program)
+		if err := interpreter.Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
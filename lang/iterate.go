@@ -0,0 +1,83 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * A for-in loop walks a collection through an iterator:
+ *
+ *   - a list gives its elements in order. Elements appended by the loop body
+ *     are reached too, the length is checked before every step.
+ *   - a map gives its keys in insertion order, as they were when the loop
+ *     started.
+ *   - a string gives its characters, each as a string of its own.
+ *   - an instance is its own iterator. Before every step its done() method
+ *     is called, and if that returns something falsey its next() method
+ *     gives the value. Any class with those two methods can be looped over.
+ *
+ * Both execution engines loop through newIterator so they agree on what
+ * can be iterated and in what order.
+ *****************************************************************************/
+
+type iterator struct {
+	next func() (value runtime.Value, more bool, err error)
+}
+
+func newIterator(collection runtime.Value) (*iterator, diag.Code, error) {
+	switch collection := collection.(type) {
+	case *runtime.List:
+		i := 0
+		return &iterator{next: func() (runtime.Value, bool, error) {
+			if i >= collection.Len() {
+				return nil, false, nil
+			}
+			i++
+			return collection.Get(i - 1), true, nil
+		}}, "", nil
+	case *runtime.Map:
+		return sliceIterator(collection.Keys()), "", nil
+	case string:
+		characters := make([]runtime.Value, 0, len(collection))
+		for _, character := range collection {
+			characters = append(characters, string(character))
+		}
+		return sliceIterator(characters), "", nil
+	case *runtime.Instance:
+		done, hasDone := iteratorMethod(collection, "done")
+		next, hasNext := iteratorMethod(collection, "next")
+		if !hasDone || !hasNext {
+			return nil, diag.NotIterable, errors.New("Can only iterate over an instance with done() and next() methods.")
+		}
+		return &iterator{next: func() (runtime.Value, bool, error) {
+			finished, err := done.Call(nil)
+			if err != nil || runtime.IsTruthy(finished) {
+				return nil, false, err
+			}
+			value, err := next.Call(nil)
+			return value, err == nil, err
+		}}, "", nil
+	}
+	return nil, diag.NotIterable, errors.New("Can only iterate over lists, maps, strings, and iterator instances.")
+}
+
+func sliceIterator(values []runtime.Value) *iterator {
+	i := 0
+	return &iterator{next: func() (runtime.Value, bool, error) {
+		if i >= len(values) {
+			return nil, false, nil
+		}
+		i++
+		return values[i-1], true, nil
+	}}
+}
+
+// iteratorMethod looks up a method of the iterator protocol, which takes no arguments
+func iteratorMethod(instance *runtime.Instance, name string) (runtime.Callable, bool) {
+	value, found := instance.Get(name)
+	method, isCallable := value.(runtime.Callable)
+	return method, found && isCallable && runtime.CheckArity(method, 0) == nil
+}
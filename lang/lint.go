@@ -0,0 +1,115 @@
+package lang
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * Lint rules look for code that is legal but probably not what was meant,
+ * going further than the warnings the resolver gives every time a program
+ * runs. They only run when asked for, by glox lint, because some of what
+ * they find is written that way on purpose often enough that warning on
+ * every run would be noise.
+ *
+ * Each rule is a visitor of its own. The linter walks the program once and
+ * shows every node to every rule, on the way into the node and again on the
+ * way out, so a rule can keep track of scopes. Rules register themselves
+ * with registerLintRule from an init function, the same way native modules
+ * do, and a glox-lint disable comment silences them like any warning, by
+ * code or by the rule's name.
+ *****************************************************************************/
+
+type lintRule struct {
+	name        string // what the rule is called on the command line, like "empty-block"
+	description string
+	newChecker  func(report lintReport) lintChecker // called once per program linted
+}
+
+type lintChecker interface {
+	enter(node any)
+	leave(node any)
+}
+
+type lintReport func(code diag.Code, span Span, err error)
+
+var lintRules = make(map[string]lintRule)
+
+func registerLintRule(rule lintRule) {
+	lintRules[rule.name] = rule
+}
+
+// LintRules lists the name and description of every lint rule, sorted by name.
+func LintRules() [][2]string {
+	rules := make([][2]string, 0, len(lintRules))
+	for name, rule := range lintRules {
+		rules = append(rules, [2]string{name, rule.description})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i][0] < rules[j][0] })
+	return rules
+}
+
+/******************************************************************************
+ * Lint reports the problems the front end finds in source, then runs the
+ * named lint rules over it, or every rule if none are named. Everything is
+ * reported through errorHandler. The lint rules don't run if the source has
+ * errors, since the tree they would look at isn't the program that was
+ * meant.
+ *****************************************************************************/
+
+func Lint(source string, ruleNames []string, errorHandler *ErrorHandler) error {
+	if len(ruleNames) == 0 {
+		for name := range lintRules {
+			ruleNames = append(ruleNames, name)
+		}
+		sort.Strings(ruleNames)
+	}
+	rules := make([]lintRule, len(ruleNames))
+	for i, name := range ruleNames {
+		rule, found := lintRules[name]
+		if !found {
+			names := make([]string, 0, len(lintRules))
+			for _, rule := range LintRules() {
+				names = append(names, rule[0])
+			}
+			return fmt.Errorf("There is no lint rule named '%s', the rules are %s.", name, strings.Join(names, ", "))
+		}
+		rules[i] = rule
+	}
+
+	scanner := NewScanner(source, errorHandler)
+	statements := NewParser(scanner.ScanTokens(), errorHandler).Parse()
+	if errorHandler.HadError {
+		return nil
+	}
+	directives := scanner.Directives()
+	if resolveProgram(statements, directives, errorHandler) == nil {
+		return nil
+	}
+	checkers := make([]lintChecker, len(rules))
+	for i, rule := range rules {
+		checkers[i] = rule.newChecker(func(code diag.Code, span Span, err error) {
+			if !directives.Suppressed(code, span.Start.Line) && !directives.disables(rule.name, span.Start.Line) {
+				errorHandler.reportWarningAt(code, span, err)
+			}
+		})
+	}
+	walker := astWalker{
+		visit: func(node any) bool {
+			for _, checker := range checkers {
+				checker.enter(node)
+			}
+			return true
+		},
+		leave: func(node any) {
+			for _, checker := range checkers {
+				checker.leave(node)
+			}
+		},
+	}
+	walker.stmts(statements)
+	return nil
+}
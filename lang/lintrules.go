@@ -0,0 +1,221 @@
+package lang
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The lint rules that only need to look at one node at a time. See lint.go
+ * for how rules are run, and lintshadow.go for the rule that tracks scopes.
+ *****************************************************************************/
+
+func init() {
+	registerLintRule(lintRule{
+		name:        "constant-condition",
+		description: "a condition is always true or always false, judging by the kind of value it makes",
+		newChecker:  func(report lintReport) lintChecker { return constantConditionChecker{report} },
+	})
+	registerLintRule(lintRule{
+		name:        "empty-block",
+		description: "a block has no statements and no comment saying why",
+		newChecker:  func(report lintReport) lintChecker { return emptyBlockChecker{report} },
+	})
+	registerLintRule(lintRule{
+		name:        "identical-branches",
+		description: "both branches of a conditional expression are the same",
+		newChecker:  func(report lintReport) lintChecker { return identicalBranchesChecker{report} },
+	})
+	registerLintRule(lintRule{
+		name:        "self-assignment",
+		description: "a variable, property, or element is assigned its own value",
+		newChecker:  func(report lintReport) lintChecker { return selfAssignmentChecker{report} },
+	})
+}
+
+/******************************************************************************
+ * constant-condition goes further than the resolver, which only folds
+ * literals. Some values are false whatever they hold: only booleans, numbers
+ * other than zero, and strings that aren't empty are true, so a list, a map,
+ * or a function is always false, and "if ([])" or "while (fun () {})" never
+ * depends on anything. The rule checks the conditions of ifs, loops, and
+ * conditional expressions, and the left side of 'and' and 'or', which
+ * decides whether the right side is ever looked at. If and loop conditions
+ * made only of literals are left to the resolver, which already warns about
+ * them, and so are literals on the left of 'and' and 'or', which are more
+ * often switches set by hand than mistakes. An assignment used as a
+ * condition, as in "if (x = 2)", is left alone too, since the resolver
+ * already warns that '==' was probably meant. One wrapped in its own
+ * parentheses is meant, so it is still checked.
+ *****************************************************************************/
+
+type constantConditionChecker struct {
+	report lintReport
+}
+
+func (c constantConditionChecker) enter(node any) {
+	switch node := node.(type) {
+	case IfStmt:
+		c.checkCondition(node.condition, false)
+	case WhileStmt:
+		c.checkCondition(node.condition, false)
+	case ConditionalExpr:
+		c.checkCondition(node.condition, true)
+	case LogicalExpr:
+		if _, isLiteral := constantValue(node.left); isLiteral {
+			return
+		}
+		if truthy, known := knownTruth(node.left); known {
+			if truthy == (node.operator.tokenType == tokenTypeOr) {
+				err := errors.New("Left side of '" + node.operator.lexeme + "' is always " + truthName(truthy) +
+					", so the right side never runs.")
+				c.report(diag.ConstantCondition, node.left.Span(), err)
+			} else {
+				err := errors.New("Left side of '" + node.operator.lexeme + "' is always " + truthName(truthy) +
+					", so the result is always the right side.")
+				c.report(diag.ConstantCondition, node.left.Span(), err)
+			}
+		}
+	}
+}
+
+func (c constantConditionChecker) leave(node any) {}
+
+func (c constantConditionChecker) checkCondition(condition Expr, literalsToo bool) {
+	if _, isLiteral := constantValue(condition); isLiteral && !literalsToo {
+		return
+	}
+	switch condition.(type) {
+	case AssignExpr, SetExpr, SubscriptSetExpr:
+		return // the resolver already reports it as an assignment in a condition
+	}
+	if logical, isLogical := withoutGrouping(condition).(LogicalExpr); isLogical {
+		if _, known := knownTruth(logical.left); known {
+			return // the left side is reported on its own
+		}
+	}
+	if truthy, known := knownTruth(condition); known {
+		c.report(diag.ConstantCondition, condition.Span(), errors.New("Condition is always "+truthName(truthy)+"."))
+	}
+}
+
+// knownTruth works out whether an expression is always true or always false from the kind of value it makes
+func knownTruth(expr Expr) (truthy bool, known bool) {
+	if value, isConstant := constantValue(expr); isConstant {
+		return runtime.IsTruthy(value), true
+	}
+	switch expr := expr.(type) {
+	case GroupingExpr:
+		return knownTruth(expr.expression)
+	case AssignExpr:
+		return knownTruth(expr.value)
+	case ListExpr, MapExpr, FunctionExpr:
+		return false, true // objects are never true
+	case UnaryExpr:
+		// negating a number keeps whether it is zero
+		truthy, known := knownTruth(expr.right)
+		if expr.operator.tokenType == tokenTypeBang {
+			return !truthy, known
+		}
+		return truthy, known
+	case LogicalExpr:
+		leftTruthy, leftKnown := knownTruth(expr.left)
+		rightTruthy, rightKnown := knownTruth(expr.right)
+		// 'or' is true if either side is, 'and' is false if either side is
+		decisive := expr.operator.tokenType == tokenTypeOr
+		if (leftKnown && leftTruthy == decisive) || (rightKnown && rightTruthy == decisive) {
+			return decisive, true
+		}
+		if leftKnown && rightKnown {
+			return !decisive, true
+		}
+	case ConditionalExpr:
+		thenTruthy, thenKnown := knownTruth(expr.thenBranch)
+		elseTruthy, elseKnown := knownTruth(expr.elseBranch)
+		if thenKnown && elseKnown && thenTruthy == elseTruthy {
+			return thenTruthy, true
+		}
+	}
+	return false, false
+}
+
+/******************************************************************************
+ * empty-block reports a block with nothing in it, like the body of an if
+ * that was never finished. A comment inside says the block is meant to be
+ * empty and silences it. Functions and classes with empty bodies aren't
+ * blocks, so they are fine.
+ *****************************************************************************/
+
+type emptyBlockChecker struct {
+	report lintReport
+}
+
+func (c emptyBlockChecker) enter(node any) {
+	block, isBlock := node.(BlockStmt)
+	if !isBlock || len(block.statements) > 0 {
+		return
+	}
+	if span := block.span; span.source == "" || !strings.Contains(span.source[span.Start.Offset:span.End.Offset], "//") {
+		c.report(diag.EmptyBlock, block.span, errors.New("Empty block, add a comment inside it if it is meant to be empty."))
+	}
+}
+
+func (c emptyBlockChecker) leave(node any) {}
+
+/******************************************************************************
+ * identical-branches reports a conditional expression whose two branches
+ * are written the same way, so its condition makes no difference.
+ * Comparisons with the same expression on both sides, as in "x == x", are
+ * reported by the resolver every time a program runs, so glox lint shows
+ * them without a rule of its own.
+ *****************************************************************************/
+
+type identicalBranchesChecker struct {
+	report lintReport
+}
+
+func (c identicalBranchesChecker) enter(node any) {
+	conditional, isConditional := node.(ConditionalExpr)
+	if isConditional && sameExpr(conditional.thenBranch, conditional.elseBranch) {
+		err := errors.New("Both branches of '?:' are the same expression, so the condition makes no difference.")
+		c.report(diag.IdenticalBranches, conditional.elseBranch.Span(), err)
+	}
+}
+
+func (c identicalBranchesChecker) leave(node any) {}
+
+/******************************************************************************
+ * self-assignment reports assigning something its own value, as in "x = x"
+ * or "this.name = this.name", which does nothing and is usually a mistyped
+ * name on one side, like a parameter that was meant to be stored in a field.
+ *****************************************************************************/
+
+type selfAssignmentChecker struct {
+	report lintReport
+}
+
+func (c selfAssignmentChecker) enter(node any) {
+	switch node := node.(type) {
+	case AssignExpr:
+		value, isVariable := withoutGrouping(node.value).(VariableExpr)
+		if isVariable && value.name.lexeme == node.name.lexeme {
+			c.report(diag.SelfAssignment, node.span, errors.New("'"+node.name.lexeme+"' is assigned to itself."))
+		}
+	case SetExpr:
+		value, isGet := withoutGrouping(node.value).(GetExpr)
+		if isGet && value.name.lexeme == node.name.lexeme && isPure(node.object) && sameExpr(node.object, value.object) {
+			c.report(diag.SelfAssignment, node.span, errors.New("Property '"+node.name.lexeme+"' is assigned its own value."))
+		}
+	case SubscriptSetExpr:
+		value, isSubscript := withoutGrouping(node.value).(SubscriptExpr)
+		if isSubscript && isPure(node.object) && isPure(node.index) && sameExpr(node.object, value.object) &&
+			sameExpr(node.index, value.index) {
+			c.report(diag.SelfAssignment, node.span, errors.New("Element is assigned its own value."))
+		}
+	}
+}
+
+func (c selfAssignmentChecker) leave(node any) {}
@@ -0,0 +1,105 @@
+package lang
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * The shadowed-variable lint rule reports a declaration that hides another
+ * of the same name from an enclosing scope, like a parameter named after a
+ * global, which leaves the outer one out of reach inside it and is easy to
+ * mix up with it. Redeclaring a name in the same scope isn't shadowing, and
+ * names starting with an underscore are left alone.
+ *
+ * The rule keeps its own stack of scopes, the way the resolver does, but
+ * with the line and kind of every declaration so the warning can say which
+ * one is hidden. Declarations are seen in source order, so a global
+ * declared after the function that shadows it isn't reported.
+ *****************************************************************************/
+
+func init() {
+	registerLintRule(lintRule{
+		name:        "shadowed-variable",
+		description: "a declaration hides one of the same name from an enclosing scope",
+		newChecker: func(report lintReport) lintChecker {
+			return &shadowChecker{report: report, scopes: []map[string]shadowedName{{}}, methods: make(map[int]bool)}
+		},
+	})
+}
+
+type shadowedName struct {
+	kind string
+	line int
+}
+
+type shadowChecker struct {
+	report  lintReport
+	scopes  []map[string]shadowedName
+	methods map[int]bool // offsets of the names of methods, which aren't variables
+}
+
+func (c *shadowChecker) enter(node any) {
+	switch node := node.(type) {
+	case BlockStmt:
+		c.push()
+	case ClassStmt:
+		c.declare(node.name, "class")
+		for _, method := range node.methods {
+			c.methods[method.name.span.Start.Offset] = true
+		}
+	case ForEachStmt:
+		c.push()
+		c.declare(node.name, "loop variable")
+	case FunctionExpr:
+		c.push()
+		c.declareParams(node.params)
+	case FunctionStmt:
+		if !c.methods[node.name.span.Start.Offset] {
+			c.declare(node.name, "function")
+		}
+		c.push()
+		c.declareParams(node.params)
+	case ImportStmt:
+		c.declare(node.name, "import")
+	case TraitStmt:
+		c.declare(node.name, "trait")
+		for _, method := range node.methods {
+			c.methods[method.name.span.Start.Offset] = true
+		}
+	case VarStmt:
+		c.declare(node.name, "variable")
+	}
+}
+
+func (c *shadowChecker) leave(node any) {
+	switch node.(type) {
+	case BlockStmt, ForEachStmt, FunctionExpr, FunctionStmt:
+		c.scopes = c.scopes[:len(c.scopes)-1]
+	}
+}
+
+func (c *shadowChecker) push() {
+	c.scopes = append(c.scopes, make(map[string]shadowedName))
+}
+
+func (c *shadowChecker) declareParams(params []Token) {
+	for _, param := range params {
+		c.declare(param, "parameter")
+	}
+}
+
+func (c *shadowChecker) declare(name Token, kind string) {
+	if !strings.HasPrefix(name.lexeme, "_") {
+		for i := len(c.scopes) - 2; i >= 0; i-- {
+			if outer, found := c.scopes[i][name.lexeme]; found {
+				err := fmt.Errorf("'%s' shadows the %s declared on line %d.", name.lexeme, outer.kind, outer.line)
+				c.report(diag.ShadowedVariable, name.span, err)
+				break
+			}
+		}
+	}
+	c.scopes[len(c.scopes)-1][name.lexeme] = shadowedName{kind: kind, line: name.line}
+}
@@ -0,0 +1,194 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * Warnings for conditions that can't do their job. A condition built only
+ * from literals has the same value every time, so one branch of an if is
+ * dead code and a while loop either never runs or never stops. The one
+ * exception is "while (true)" (or "for (;;)") with a break or return inside,
+ * which is the usual way to write a loop that exits from the middle.
+ *
+ * A loop can also never stop when nothing in it can change what its
+ * condition reads, as in "while (i < 10) { print i; }". That is only
+ * reported when the loop is simple enough to be sure: the condition reads
+ * nothing but variables, and the body and increment contain no calls, which
+ * could change a variable behind the loop's back, and no break or return.
+ * Nor can a global or a variable that a closure assigns to be counted on to
+ * stay put, an onSignal handler or a Worker can change it while the loop
+ * runs.
+ *****************************************************************************/
+
+func (r *Resolver) checkIfCondition(stmt IfStmt) {
+	if value, isConstant := constantValue(stmt.condition); isConstant {
+		err := errors.New("Condition is always " + truthName(value) + ".")
+		r.warn(diag.ConstantCondition, stmt.condition.Span(), err)
+	}
+}
+
+func (r *Resolver) checkLoop(stmt WhileStmt) {
+	span := stmt.condition.Span()
+	value, isConstant := constantValue(stmt.condition)
+	if isConstant {
+		literal, isLiteral := stmt.condition.(LiteralExpr)
+		switch {
+		case !runtime.IsTruthy(value):
+			err := errors.New("Condition is always false, the loop body never runs.")
+			r.warn(diag.ConstantCondition, span, err)
+		case !isLiteral || literal.value != true:
+			err := errors.New("Condition is always true, write 'while (true)' if the loop is meant to run until a break.")
+			r.warn(diag.ConstantCondition, span, err)
+		case !exitsLoop(stmt.body):
+			err := errors.New("Loop never ends, there is no break or return inside it.")
+			r.warn(diag.InfiniteLoop, span, err)
+		}
+		return
+	}
+
+	variables, understood := conditionVariables(stmt.condition)
+	if !understood || exitsLoop(stmt.body) || r.changedElsewhere(variables) {
+		return
+	}
+	changed := false
+	mightChange := func(node any) bool {
+		switch node := node.(type) {
+		case CallExpr:
+			changed = true
+		case AssignExpr:
+			if variables[node.name.lexeme] {
+				changed = true
+			}
+		}
+		return !changed
+	}
+	walkStmt(stmt.body, mightChange)
+	walkExpr(stmt.increment, mightChange)
+	if !changed {
+		err := errors.New("Loop never ends once it starts, nothing inside it changes " + nameList(variables) + ".")
+		r.warn(diag.InfiniteLoop, span, err)
+	}
+}
+
+// changedElsewhere reports whether any of the variables is a global or a local that a closure assigns to
+func (r *Resolver) changedElsewhere(variables map[string]bool) bool {
+	for name := range variables {
+		scope := len(r.scopes) - 1
+		for ; scope >= 0; scope-- {
+			if _, declared := r.scopes[scope][name]; declared {
+				break
+			}
+		}
+		if scope < 0 || r.closureAssigned[scope][name] {
+			return true
+		}
+	}
+	return false
+}
+
+// constantValue folds an expression made only of literals and operators into the value it always has
+func constantValue(expr Expr) (runtime.Value, bool) {
+	switch expr := expr.(type) {
+	case LiteralExpr:
+		return expr.value, true
+	case GroupingExpr:
+		return constantValue(expr.expression)
+	case UnaryExpr:
+		right, isConstant := constantValue(expr.right)
+		if !isConstant {
+			return nil, false
+		}
+		if expr.operator.tokenType == tokenTypeBang {
+			return !runtime.IsTruthy(right), true
+		}
+		value, _, err := negate(right)
+		return value, err == nil
+	case LogicalExpr:
+		left, isConstant := constantValue(expr.left)
+		if !isConstant {
+			return nil, false
+		}
+		if runtime.IsTruthy(left) == (expr.operator.tokenType == tokenTypeOr) {
+			return left, true
+		}
+		return constantValue(expr.right)
+	case BinaryExpr:
+		left, isLeftConstant := constantValue(expr.left)
+		right, isRightConstant := constantValue(expr.right)
+		if !isLeftConstant || !isRightConstant {
+			return nil, false
+		}
+		switch expr.operator.tokenType {
+		case tokenTypeEqualEqual:
+			return runtime.Equal(left, right), true
+		case tokenTypeBangEqual:
+			return !runtime.Equal(left, right), true
+		case tokenTypeAmpersand, tokenTypePipe, tokenTypeCaret, tokenTypeLessLess, tokenTypeGreaterGreater:
+			value, _, err := bitwise(expr.operator.lexeme, left, right)
+			return value, err == nil
+		}
+		value, _, err := arithmetic(expr.operator.lexeme, left, right)
+		return value, err == nil
+	}
+	return nil, false
+}
+
+// conditionVariables returns the variables a condition reads, or false if it reads anything else
+func conditionVariables(condition Expr) (map[string]bool, bool) {
+	variables := make(map[string]bool)
+	understood := true
+	walkExpr(condition, func(node any) bool {
+		switch node := node.(type) {
+		case VariableExpr:
+			variables[node.name.lexeme] = true
+		case BinaryExpr, GroupingExpr, LiteralExpr, LogicalExpr, UnaryExpr, ConditionalExpr:
+		default:
+			understood = false
+		}
+		return understood
+	})
+	return variables, understood && len(variables) > 0
+}
+
+// exitsLoop reports whether a loop body has a break or return of its own, not one in a nested loop or function
+func exitsLoop(body Stmt) bool {
+	exits := false
+	walkStmt(body, func(node any) bool {
+		switch node.(type) {
+		case BreakStmt, ReturnStmt, ErrorStmt:
+			// a statement with a syntax error might have been a break, better not to warn
+			exits = true
+		case WhileStmt, ForEachStmt, FunctionStmt, FunctionExpr, ClassStmt, TraitStmt:
+			return false
+		}
+		return !exits
+	})
+	return exits
+}
+
+func truthName(value runtime.Value) string {
+	if runtime.IsTruthy(value) {
+		return "true"
+	}
+	return "false"
+}
+
+func nameList(variables map[string]bool) string {
+	names := sortedNames(variables)
+	list := ""
+	for i, name := range names {
+		switch {
+		case i == 0:
+		case i == len(names)-1:
+			list += " or "
+		default:
+			list += ", "
+		}
+		list += "'" + name + "'"
+	}
+	return list
+}
@@ -0,0 +1,42 @@
+package lang
+
+import (
+	"io"
+	"testing"
+
+	"github.com/skusel/glox/diag"
+)
+
+// TestCheckLoop checks which loops are reported as never ending once they start
+func TestCheckLoop(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		warns  bool
+	}{
+		{"unchanged local", "fun f() { var i = 0; while (i < 10) { print i; } }", true},
+		{"local changed in the body", "fun f() { var i = 0; while (i < 10) { i = i + 1; } }", false},
+		{"local changed by the increment", "fun f() { for (var i = 0; i < 10; i = i + 1) { print i; } }", false},
+		{"body with a call", "fun f() { var i = 0; while (i < 10) { print clock(); } }", false},
+		{"global set by a signal handler",
+			`var stop = false; onSignal("INT", fun() { stop = true; }); while (!stop) {}`, false},
+		{"global", "var stop = false; while (!stop) { print 1; }", false},
+		{"local set by a closure", "fun f() { var done = false; var g = fun() { done = true; }; g; while (!done) { print 1; } }", false},
+		{"local set by a named function", "fun f() { var done = false; fun g() { done = true; } g; while (!done) { print 1; } }", false},
+		{"local assigned outside a closure", "fun f() { var i = 0; i = 1; while (i < 10) { print i; } }", true},
+		{"shadowed by a closure's own local", "fun f() { var i = 0; fun g() { var i = 0; i = 1; } g; while (i < 10) { print i; } }", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errorHandler := &ErrorHandler{Output: io.Discard}
+			NewFrontEnd(errorHandler).Analyze(test.source)
+			warned := false
+			for _, diagnostic := range errorHandler.Diagnostics {
+				warned = warned || diagnostic.Code == diag.InfiniteLoop
+			}
+			if warned != test.warns {
+				t.Errorf("warned about a never ending loop: %v, expected %v (%v)", warned, test.warns, errorHandler.Diagnostics)
+			}
+		})
+	}
+}
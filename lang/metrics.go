@@ -0,0 +1,145 @@
+package lang
+
+/******************************************************************************
+ * Code metrics for a parsed program, reported by "glox metrics". Each
+ * function, method, and the top level script itself gets:
+ *
+ *   statements  how many statements its body has, not counting blocks or the
+ *               bodies of functions declared inside it
+ *   nesting     how deeply its if statements and loops are nested
+ *   complexity  its cyclomatic complexity, one more than the number of
+ *               places it branches: if, while, for, ?:, and, and or
+ *
+ * Classes and traits get their number of methods and the number of distinct
+ * fields their methods assign to through "this".
+ *****************************************************************************/
+
+type Metrics struct {
+	Functions []FunctionMetrics
+	Classes   []ClassMetrics
+}
+
+type FunctionMetrics struct {
+	Name       string // methods are named Class.method, anonymous functions <fun>
+	Line       int
+	Statements int
+	Nesting    int
+	Complexity int
+}
+
+type ClassMetrics struct {
+	Name    string
+	Line    int
+	Methods int
+	Fields  int
+}
+
+func MeasureProgram(program *Program) *Metrics {
+	metrics := &Metrics{}
+	metrics.function("<script>", 1, program.Statements)
+	return metrics
+}
+
+// function measures one function body, adding it before any functions declared inside it
+func (metrics *Metrics) function(name string, line int, body []Stmt) {
+	index := len(metrics.Functions)
+	metrics.Functions = append(metrics.Functions, FunctionMetrics{Name: name, Line: line, Complexity: 1})
+	m := &functionMeasurer{metrics: metrics}
+	m.stmts(body, 0)
+	// nested functions were appended while measuring, so only hold on to this one's entry now
+	measured := &metrics.Functions[index]
+	measured.Statements = m.statements
+	measured.Nesting = m.nesting
+	measured.Complexity += m.branches
+}
+
+// class measures a class or trait and then each of its methods
+func (metrics *Metrics) class(name Token, methods []FunctionStmt) {
+	fields := make(map[string]bool)
+	for _, method := range methods {
+		walkStmt(method, func(node any) bool {
+			if set, isSet := node.(SetExpr); isSet {
+				if _, isThis := set.object.(ThisExpr); isThis {
+					fields[set.name.lexeme] = true
+				}
+			}
+			return true
+		})
+	}
+	metrics.Classes = append(metrics.Classes, ClassMetrics{Name: name.lexeme, Line: name.line, Methods: len(methods),
+		Fields: len(fields)})
+	for _, method := range methods {
+		metrics.function(name.lexeme+"."+method.name.lexeme, method.name.line, method.body)
+	}
+}
+
+type functionMeasurer struct {
+	metrics    *Metrics
+	statements int
+	nesting    int
+	branches   int
+}
+
+func (m *functionMeasurer) stmts(statements []Stmt, depth int) {
+	for _, stmt := range statements {
+		m.stmt(stmt, depth)
+	}
+}
+
+func (m *functionMeasurer) stmt(stmt Stmt, depth int) {
+	if stmt == nil {
+		return
+	}
+	if _, isBlock := stmt.(BlockStmt); !isBlock {
+		m.statements++
+	}
+	switch stmt := stmt.(type) {
+	case BlockStmt:
+		m.stmts(stmt.statements, depth)
+	case ClassStmt:
+		m.metrics.class(stmt.name, stmt.methods)
+	case ExprStmt:
+		m.expr(stmt.expr)
+	case ForEachStmt:
+		m.branch(stmt.collection, depth+1)
+		m.stmt(stmt.body, depth+1)
+	case FunctionStmt:
+		m.metrics.function(stmt.name.lexeme, stmt.name.line, stmt.body)
+	case IfStmt:
+		m.branch(stmt.condition, depth+1)
+		m.stmt(stmt.thenBranch, depth+1)
+		m.stmt(stmt.elseBranch, depth+1)
+	case PrintStmt:
+		m.expr(stmt.expr)
+	case ReturnStmt:
+		m.expr(stmt.value)
+	case TraitStmt:
+		m.metrics.class(stmt.name, stmt.methods)
+	case VarStmt:
+		m.expr(stmt.initializer)
+	case WhileStmt:
+		m.branch(stmt.condition, depth+1)
+		m.stmt(stmt.body, depth+1)
+		m.expr(stmt.increment)
+	}
+}
+
+// branch counts a branch at the given depth along with the ones in its condition
+func (m *functionMeasurer) branch(condition Expr, depth int) {
+	m.branches++
+	m.nesting = max(m.nesting, depth)
+	m.expr(condition)
+}
+
+func (m *functionMeasurer) expr(expr Expr) {
+	walkExpr(expr, func(node any) bool {
+		switch node := node.(type) {
+		case ConditionalExpr, LogicalExpr:
+			m.branches++
+		case FunctionExpr:
+			m.metrics.function("<fun>", node.keyword.line, node.body)
+			return false
+		}
+		return true
+	})
+}
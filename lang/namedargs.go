@@ -0,0 +1,173 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * Named arguments. A call can pass arguments by the name of the parameter
+ * they are for, as in makePoint(x: 1, y: 2), after any it passes by
+ * position. Arguments are still evaluated in the order they are written and
+ * are put in parameter order just before the call, so the callee can't tell
+ * how it was called. A rest parameter can't be named, it only ever collects
+ * extra positional arguments.
+ *
+ * Whether a name is one of the callee's parameters can usually only be told
+ * at run time, but the resolver knows the parameters of the functions and
+ * classes declared so far. A call that names one of them directly is checked
+ * while resolving, unless the name has been assigned a new value since.
+ *****************************************************************************/
+
+// bindNamedArguments returns a call's arguments in parameter order, names are for the last len(names) of args
+func bindNamedArguments(callee runtime.Value, args []runtime.Value, names []string) ([]runtime.Value, diag.Code,
+	error) {
+	callable, isCallable := callee.(runtime.Callable)
+	if !isCallable {
+		return nil, diag.NotCallable, errors.New("Can only call functions and classes.")
+	}
+	named, hasNames := callable.(runtime.NamedParameters)
+	if !hasNames {
+		return nil, diag.NamedArgumentsNotSupported, errors.New("Natives only take positional arguments.")
+	}
+	params := named.ParameterNames()
+	positional := len(args) - len(names)
+	bound := make([]runtime.Value, len(params))
+	passed := make([]bool, len(params))
+	extra := make([]runtime.Value, 0)
+	for i, arg := range args[:positional] {
+		if i < len(params) {
+			bound[i] = arg
+			passed[i] = true
+		} else {
+			extra = append(extra, arg)
+		}
+	}
+	for i, name := range names {
+		index := parameterIndex(params, name)
+		if index < 0 {
+			function := "The function"
+			if callable.Name() != "" {
+				function = "'" + callable.Name() + "'"
+			}
+			return nil, diag.UnknownParameter, fmt.Errorf("%s has no parameter named '%s'.", function, name)
+		}
+		if passed[index] {
+			return nil, diag.DuplicateArgument, fmt.Errorf("Argument '%s' is passed more than once.", name)
+		}
+		bound[index] = args[positional+i]
+		passed[index] = true
+	}
+	for i, param := range params {
+		if !passed[i] {
+			return nil, diag.ArityMismatch, fmt.Errorf("Missing argument for parameter '%s'.", param)
+		}
+	}
+	return append(bound, extra...), "", nil
+}
+
+func parameterIndex(params []string, name string) int {
+	for i, param := range params {
+		if param == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// argumentNames returns the lexemes of a call's argument names
+func argumentNames(names []Token) []string {
+	lexemes := make([]string, len(names))
+	for i, name := range names {
+		lexemes[i] = name.lexeme
+	}
+	return lexemes
+}
+
+// parameterNames returns the names of a function's parameters that can be passed by name
+func parameterNames(params []Token, variadic bool) []string {
+	if variadic {
+		params = params[:len(params)-1]
+	}
+	return argumentNames(params)
+}
+
+/******************************************************************************
+ * The resolver's side. Signatures are kept per scope, alongside the scopes
+ * themselves, so a name declared again in an inner scope hides the outer
+ * signature the same way it hides the outer variable.
+ *****************************************************************************/
+
+// currentSignatures returns the signatures of the innermost scope, or the globals at the top level
+func (r *Resolver) currentSignatures() map[string][]string {
+	if len(r.signatures) == 0 {
+		return r.globalSignatures
+	}
+	return r.signatures[len(r.signatures)-1]
+}
+
+// signaturesFor returns the signatures of the scope a name resolves to
+func (r *Resolver) signaturesFor(name string) map[string][]string {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, declared := r.scopes[i][name]; declared {
+			return r.signatures[i]
+		}
+	}
+	return r.globalSignatures
+}
+
+func (r *Resolver) setSignature(name Token, params []Token, variadic bool) {
+	r.currentSignatures()[name.lexeme] = parameterNames(params, variadic)
+}
+
+// forgetSignature is called when a name is given a value that might not be the function it was declared as
+func (r *Resolver) forgetSignature(name Token) {
+	delete(r.signaturesFor(name.lexeme), name.lexeme)
+}
+
+// classSignature records the parameters of a class's initializer, unless it inherits one
+func (r *Resolver) classSignature(stmt ClassStmt) {
+	for _, method := range stmt.methods {
+		if method.name.lexeme == "init" {
+			r.setSignature(stmt.name, method.params, method.variadic)
+			return
+		}
+	}
+	if stmt.superclass.getId() == 0 {
+		r.setSignature(stmt.name, nil, false)
+	}
+}
+
+func (r *Resolver) checkNamedArguments(expr CallExpr) {
+	for i, name := range expr.names {
+		for _, earlier := range expr.names[:i] {
+			if earlier.lexeme == name.lexeme {
+				r.errorHandler.reportStaticErrorAt(diag.DuplicateArgument, name,
+					fmt.Errorf("Argument '%s' is passed more than once.", name.lexeme), false)
+				break
+			}
+		}
+	}
+	variable, isVariable := expr.callee.(VariableExpr)
+	if !isVariable || len(expr.names) == 0 {
+		return
+	}
+	params, known := r.signaturesFor(variable.name.lexeme)[variable.name.lexeme]
+	if !known {
+		return
+	}
+	positional := len(expr.args) - len(expr.names)
+	for _, name := range expr.names {
+		index := parameterIndex(params, name.lexeme)
+		if index < 0 {
+			r.errorHandler.reportStaticErrorAt(diag.UnknownParameter, name,
+				fmt.Errorf("'%s' has no parameter named '%s'.", variable.name.lexeme, name.lexeme), false)
+		} else if index < positional {
+			r.errorHandler.reportStaticErrorAt(diag.DuplicateArgument, name,
+				fmt.Errorf("Argument '%s' is passed more than once.", name.lexeme), false)
+		}
+	}
+}
@@ -1,23 +1,164 @@
 package lang
 
-import "time"
+import (
+	"sort"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * Native functions are functions that are built into the language. They are
+ * grouped into modules (e.g. "time" or "math") which register themselves with
+ * RegisterNativeModule, usually from an init function in their own file.
+ *
+ * Natives are installed lazily. Nothing is copied into an interpreter's
+ * global environment up front, a native is only created the first time a
+ * program refers to its name. An interpreter can also be given a filter to
+ * hide natives, e.g. PureNatives keeps a sandboxed script away from the file
+ * system.
+ *****************************************************************************/
+
+type NativeModule struct {
+	name    string
+	natives map[string]nativeDefinition
+}
+
+type nativeDefinition struct {
+	arity int
+	fn    func(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error)
+	value runtime.Value // set instead of fn for native constants
+}
+
+// NativeInfo describes an installed native for listings such as the REPL's :natives command.
+type NativeInfo struct {
+	Module string
+	Name   string
+	Arity  int // -1 for constants
+}
+
+// codedError is returned by a native whose error has a code of its own, other errors are reported as NativeError
+type codedError struct {
+	code diag.Code
+	err  error
+}
+
+func (e codedError) Error() string {
+	return e.err.Error()
+}
+
+// nativeErrorCode returns the code a call reports an error from a native with
+func nativeErrorCode(err error) diag.Code {
+	if coded, isCoded := err.(codedError); isCoded {
+		return coded.code
+	}
+	return diag.NativeError
+}
+
+var nativeModules = make(map[string]*NativeModule)
+
+func NewNativeModule(name string) *NativeModule {
+	return &NativeModule{name: name, natives: make(map[string]nativeDefinition)}
+}
+
+func (m *NativeModule) Name() string {
+	return m.name
+}
+
+func (m *NativeModule) Define(name string, arity int,
+	fn func(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error)) {
+	m.natives[name] = nativeDefinition{arity: arity, fn: fn}
+}
+
+func (m *NativeModule) DefineValue(name string, value runtime.Value) {
+	m.natives[name] = nativeDefinition{arity: -1, value: value}
+}
+
+// RegisterNativeModule makes a module's natives available to every interpreter.
+func RegisterNativeModule(module *NativeModule) {
+	nativeModules[module.name] = module
+}
+
+func sortedNativeModules() []*NativeModule {
+	modules := make([]*NativeModule, 0, len(nativeModules))
+	for _, module := range nativeModules {
+		modules = append(modules, module)
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].name < modules[j].name })
+	return modules
+}
+
+// isNativeName reports whether any native module defines name, whether or not an interpreter allows it
+func isNativeName(name string) bool {
+	for _, module := range nativeModules {
+		if _, found := module.natives[name]; found {
+			return true
+		}
+	}
+	return false
+}
 
 /******************************************************************************
- * structs in this file should implement the callable interface. Each struct
- * represents a native function call. That is, a function all that is built
- * into the language.
+ * SetNativeFilter limits which natives the interpreter will install. The
+ * filter is asked about each native by module and name, natives it rejects
+ * behave as if they were never defined. A nil filter allows everything.
  *****************************************************************************/
 
-type clock struct{}
+func (interpreter *Interpreter) SetNativeFilter(filter func(module string, name string) bool) {
+	interpreter.nativeFilter = filter
+}
+
+// pureNativeModules only compute values, none of their natives reach the file system, the terminal, the process, or another thread
+var pureNativeModules = map[string]bool{
+	"assert": true, "collections": true, "config": true, "errors": true, "math": true, "mock": true,
+	"reflect": true, "serialize": true, "strings": true, "time": true, "url": true,
+}
+
+// PureNatives is a filter for SetNativeFilter that allows only natives a sandboxed or generated script can't do harm with
+func PureNatives(module string, name string) bool {
+	return pureNativeModules[module] || (module == "debug" && name == "pretty")
+}
 
-func (c clock) arity() int {
-	return 0
+func (interpreter *Interpreter) allowsNative(module string, name string) bool {
+	return interpreter.nativeFilter == nil || interpreter.nativeFilter(module, name)
 }
 
-func (c clock) call(interpreter *Interpreter, args []any) any {
-	return time.Now()
+// Natives lists the natives this interpreter can install, sorted by module and name.
+func (interpreter *Interpreter) Natives() []NativeInfo {
+	infos := make([]NativeInfo, 0)
+	for _, module := range sortedNativeModules() {
+		for name, definition := range module.natives {
+			if interpreter.allowsNative(module.name, name) {
+				infos = append(infos, NativeInfo{Module: module.name, Name: name, Arity: definition.arity})
+			}
+		}
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Module < infos[j].Module ||
+			(infos[i].Module == infos[j].Module && infos[i].Name < infos[j].Name)
+	})
+	return infos
 }
 
-func (c clock) toString() string {
-	return "<native fun>"
+// lookUpNative creates the named native, if it exists and is allowed, for the global environment
+func (interpreter *Interpreter) lookUpNative(name string) (runtime.Value, bool) {
+	// module names are checked in sorted order so the same native always wins a name clash
+	for _, module := range sortedNativeModules() {
+		definition, found := module.natives[name]
+		if !found || !interpreter.allowsNative(module.name, name) {
+			continue
+		}
+		if definition.fn == nil {
+			return definition.value, true
+		}
+		fn := definition.fn
+		return runtime.NewNativeFunction(name, definition.arity, func(args []runtime.Value) (runtime.Value, error) {
+			if h := interpreter.hooks; h != nil && h.calls != nil {
+				h.calls.enter(name, "", true)
+				defer h.calls.leave()
+			}
+			return fn(interpreter, args)
+		}), true
+	}
+	return nil, false
 }
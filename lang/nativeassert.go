@@ -0,0 +1,171 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "assert" native module, for checking a program does what it should.
+ * An assertion that doesn't hold stops the program with an AssertionFailed
+ * error (E0221) saying what was wrong, which protect() can catch like any
+ * other runtime error:
+ *
+ *   [line 4] Error E0221: assertEqual() failed: totals add up
+ *     expected: 6
+ *       actual: 5
+ *
+ * assertRaises() and expectRuntimeError() call a function that should stop
+ * with a runtime error and return an Error instance for it, like the one
+ * protect() passes its handler. expectRuntimeError() also checks the error
+ * has the code it is given, e.g. "E0201".
+ *
+ * assertEqual() compares lists and maps by their contents, so two lists
+ * with equal elements are equal even though == says they aren't. Anything
+ * else is compared like ==. When both values are strings spanning several
+ * lines the error shows a diff of them instead.
+ *
+ * The message passed to an assertion is shown with its failure, nil leaves
+ * it out. The interpreter counts the assertions that passed and failed,
+ * including in imported modules, for a test runner to report. A failure
+ * caught by protect() isn't counted, the program has dealt with it.
+ *****************************************************************************/
+
+// AssertionCounts tallies the assertions a program has made.
+type AssertionCounts struct {
+	Passed int
+	Failed int
+}
+
+func init() {
+	module := NewNativeModule("assert")
+	module.Define("assertEqual", 3, assertEqualNative)
+	module.Define("assertRaises", 1, assertRaisesNative)
+	module.Define("assertTrue", 2, assertTrueNative)
+	module.Define("expectRuntimeError", 2, expectRuntimeErrorNative)
+	RegisterNativeModule(module)
+}
+
+// Assertions returns how many assertions have passed and failed so far.
+func (interpreter *Interpreter) Assertions() AssertionCounts {
+	return *interpreter.assertions
+}
+
+func assertEqualNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	actual, expected := args[0], args[1]
+	if deepEqual(actual, expected, make(map[[2]runtime.Value]bool)) {
+		return interpreter.assertionPassed()
+	}
+	actualStr, actualIsString := actual.(string)
+	expectedStr, expectedIsString := expected.(string)
+	if actualIsString && expectedIsString && (strings.Contains(actualStr, "\n") || strings.Contains(expectedStr, "\n")) {
+		diff := unifiedDiff(expectedStr, actualStr)
+		diff = strings.Replace(diff, "--- a\n+++ b\n", "--- expected\n+++ actual\n", 1)
+		return interpreter.assertionFailed("assertEqual", args[2], strings.TrimSuffix(diff, "\n"))
+	}
+	return interpreter.assertionFailed("assertEqual", args[2],
+		fmt.Sprintf("  expected: %s\n    actual: %s", traceValue(expected), traceValue(actual)))
+}
+
+func assertTrueNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	if runtime.IsTruthy(args[0]) {
+		return interpreter.assertionPassed()
+	}
+	return interpreter.assertionFailed("assertTrue", args[1], "  got: "+traceValue(args[0]))
+}
+
+// assertRaisesNative calls a function that should stop with a runtime error, and returns an Error instance for it
+func assertRaisesNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	return interpreter.expectRuntimeError("assertRaises", args[0], nil)
+}
+
+// expectRuntimeErrorNative is assertRaises() for an error with a particular code, or any code if it is nil
+func expectRuntimeErrorNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	if _, isString := args[1].(string); args[1] != nil && !isString {
+		return nil, errors.New("expectRuntimeError() expects the code of an error, like \"E0201\".")
+	}
+	return interpreter.expectRuntimeError("expectRuntimeError", args[0], args[1])
+}
+
+func (interpreter *Interpreter) expectRuntimeError(native string, callee runtime.Value, code runtime.Value) (runtime.Value,
+	error) {
+	fn, isCallable := callee.(runtime.Callable)
+	if !isCallable || runtime.CheckArity(fn, 0) != nil {
+		return nil, errors.New(native + "() expects a function that takes no arguments.")
+	}
+	value, caught, err := interpreter.protect(fn)
+	if err != nil {
+		return nil, err
+	}
+	if caught == nil {
+		return interpreter.assertionFailed(native, nil, "  returned: "+traceValue(value))
+	}
+	if code != nil && string(caught.diagnostic.Code) != code {
+		return interpreter.assertionFailed(native, nil, fmt.Sprintf("  expected: %s\n    actual: %s %s", code,
+			caught.diagnostic.Code, caught.diagnostic.Message))
+	}
+	interpreter.assertions.Passed++
+	return errorInstance(caught.diagnostic), nil
+}
+
+func (interpreter *Interpreter) assertionPassed() (runtime.Value, error) {
+	interpreter.assertions.Passed++
+	return nil, nil
+}
+
+func (interpreter *Interpreter) assertionFailed(native string, message runtime.Value, details string) (runtime.Value,
+	error) {
+	interpreter.assertions.Failed++
+	text := native + "() failed"
+	if message != nil {
+		text += ": " + runtime.Stringify(message)
+	}
+	return nil, codedError{code: diag.AssertionFailed, err: errors.New(text + "\n" + details)}
+}
+
+// deepEqual compares lists and maps by their contents, and everything else like ==
+func deepEqual(a runtime.Value, b runtime.Value, comparing map[[2]runtime.Value]bool) bool {
+	if runtime.Equal(a, b) {
+		return true
+	}
+	// a pair already being compared further up is taken to be equal, so cycles end
+	pair := [2]runtime.Value{a, b}
+	if comparing[pair] {
+		return true
+	}
+	switch a := a.(type) {
+	case *runtime.List:
+		b, isList := b.(*runtime.List)
+		if !isList || a.Len() != b.Len() {
+			return false
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+		for i := 0; i < a.Len(); i++ {
+			if !deepEqual(a.Get(i), b.Get(i), comparing) {
+				return false
+			}
+		}
+		return true
+	case *runtime.Map:
+		b, isMap := b.(*runtime.Map)
+		if !isMap || a.Len() != b.Len() {
+			return false
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+		for _, key := range a.Keys() {
+			aValue, _ := a.Get(key)
+			bValue, found := b.Get(key)
+			if !found || !deepEqual(aValue, bValue, comparing) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package lang
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "collections" native module, helpers for lists and maps.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("collections")
+	module.Define("append", 2, appendNative)
+	module.Define("has", 2, hasNative)
+	module.Define("keys", 1, keysNative)
+	module.Define("len", 1, lenNative)
+	module.Define("remove", 2, removeNative)
+	module.Define("values", 1, valuesNative)
+	RegisterNativeModule(module)
+}
+
+// appendNative adds a value to the end of a list
+func appendNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	list, isList := args[0].(*runtime.List)
+	if !isList {
+		return nil, errors.New("append() expects a list.")
+	}
+	list.Append(args[1])
+	return nil, nil
+}
+
+// hasNative reports whether a map contains a key
+func hasNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	m, isMap := args[0].(*runtime.Map)
+	if !isMap {
+		return nil, errors.New("has() expects a map.")
+	}
+	_, found := m.Get(args[1])
+	return found, nil
+}
+
+// keysNative returns a list of a map's keys in the order they were added
+func keysNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	m, isMap := args[0].(*runtime.Map)
+	if !isMap {
+		return nil, errors.New("keys() expects a map.")
+	}
+	return runtime.NewList(m.Keys()), nil
+}
+
+// lenNative returns the number of elements in a list or map, or characters in a string
+func lenNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	switch value := args[0].(type) {
+	case *runtime.List:
+		return int64(value.Len()), nil
+	case *runtime.Map:
+		return int64(value.Len()), nil
+	case string:
+		return int64(utf8.RuneCountInString(value)), nil
+	}
+	return nil, errors.New("len() expects a list, map, or string.")
+}
+
+// removeNative deletes a key from a map and returns its value, or nil if it wasn't there
+func removeNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	m, isMap := args[0].(*runtime.Map)
+	if !isMap {
+		return nil, errors.New("remove() expects a map.")
+	}
+	value, _ := m.Delete(args[1])
+	return value, nil
+}
+
+// valuesNative returns a list of a map's values in the order their keys were added
+func valuesNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	m, isMap := args[0].(*runtime.Map)
+	if !isMap {
+		return nil, errors.New("values() expects a map.")
+	}
+	return runtime.NewList(m.Values()), nil
+}
@@ -0,0 +1,38 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "config" native module, for reading the configuration files a
+ * project already has. See toml.go and yaml.go for what each parser
+ * supports.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("config")
+	module.Define("tomlParse", 1, tomlParseNative)
+	module.Define("yamlParse", 1, yamlParseNative)
+	RegisterNativeModule(module)
+}
+
+// tomlParseNative reads a TOML document into a map
+func tomlParseNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	text, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("tomlParse() expects a string.")
+	}
+	return parseTOML(text)
+}
+
+// yamlParseNative reads a YAML document into maps, lists, and scalars
+func yamlParseNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	text, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("yamlParse() expects a string.")
+	}
+	return parseYAML(text)
+}
@@ -0,0 +1,43 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "debug" native module, for pausing a program in the debugger and for
+ * looking inside values. See debugger.go.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("debug")
+	module.Define("breakpoint", 0, breakpointNative)
+	module.Define("pretty", 2, prettyNative)
+	RegisterNativeModule(module)
+}
+
+// breakpointNative pauses the program when it is being debugged and does nothing otherwise
+func breakpointNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	if h := interpreter.hooks; h != nil && h.debugger != nil {
+		h.debugger.pause(interpreter, "breakpoint()")
+	}
+	return nil, nil
+}
+
+// prettyNative formats a value across lines with its contents shown, nil for maxDepth shows every level
+func prettyNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	options := runtime.PrettyOptions{}
+	switch maxDepth := args[1].(type) {
+	case nil:
+	case int64:
+		if maxDepth < 1 {
+			return nil, errors.New("pretty() expects a depth of at least 1.")
+		}
+		options.MaxDepth = int(maxDepth)
+	default:
+		return nil, errors.New("pretty() expects a depth that is an integer or nil.")
+	}
+	return runtime.Pretty(args[0], options), nil
+}
@@ -0,0 +1,87 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "errors" native module lets a script recover from runtime errors.
+ *
+ * protect(fn, handler) calls fn, which takes no arguments, and returns what
+ * it returns. If a runtime error stops fn partway, like an undefined
+ * variable, an operand of the wrong type, or a call with the wrong number of
+ * arguments, the error isn't reported and the program carries on: handler
+ * is called with an Error instance describing it and protect returns what
+ * handler returns. The instance has three fields, message, code (e.g.
+ * "E0201"), and line.
+ *
+ * Errors that enforce limits set by the program's host, a cancellation, a
+ * step budget running out, or the call stack overflowing, can't be caught.
+ * Catching them would let a script ignore the limit. A timeout from
+ * withTimeout is the script's own limit, so it can be caught, but only by a
+ * protect() around the withTimeout call. One inside the call it limits lets
+ * the timeout pass, or the callback it stopped could carry on.
+ *****************************************************************************/
+
+var errorClass = runtime.NewClass("Error", nil, make(map[string]runtime.Function))
+
+var uncatchableErrors = map[diag.Code]bool{
+	diag.Cancelled:          true,
+	diag.StepBudgetExceeded: true,
+	diag.StackOverflow:      true,
+}
+
+func init() {
+	module := NewNativeModule("errors")
+	module.Define("protect", 2, protectNative)
+	RegisterNativeModule(module)
+}
+
+func protectNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	fn, isCallable := args[0].(runtime.Callable)
+	handler, handlerIsCallable := args[1].(runtime.Callable)
+	if !isCallable || !handlerIsCallable || runtime.CheckArity(fn, 0) != nil ||
+		runtime.CheckArity(handler, 1) != nil {
+		return nil, errors.New("protect() expects a function that takes no arguments and a handler that takes an error.")
+	}
+	value, caught, err := interpreter.protect(fn)
+	if caught == nil {
+		return value, err
+	}
+	return handler.Call([]runtime.Value{errorInstance(caught.diagnostic)})
+}
+
+// protect calls fn, returning the runtime error that stopped it if it can be caught
+func (interpreter *Interpreter) protect(fn runtime.Callable) (value runtime.Value, caught *runtimeError, err error) {
+	hadRuntimeError := interpreter.errorHandler.HadRuntimeError
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		runtimeError, isRuntimeError := recovered.(runtimeError)
+		if !isRuntimeError || uncatchableErrors[runtimeError.diagnostic.Code] ||
+			runtimeError.diagnostic.Code == diag.TimedOut && interpreter.timeoutExpired() {
+			panic(recovered)
+		}
+		// the error was never reported, so the program hasn't failed
+		interpreter.errorHandler.HadRuntimeError = hadRuntimeError
+		if runtimeError.diagnostic.Code == diag.AssertionFailed {
+			interpreter.assertions.Failed--
+		}
+		caught = &runtimeError
+	}()
+	value, err = fn.Call(nil)
+	return value, nil, err
+}
+
+func errorInstance(diagnostic diag.Diagnostic) *runtime.Instance {
+	instance := runtime.NewInstance(errorClass)
+	instance.Set("message", diagnostic.Message)
+	instance.Set("code", string(diagnostic.Code))
+	instance.Set("line", int64(diagnostic.Line))
+	return instance
+}
@@ -0,0 +1,199 @@
+package lang
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "files" native module, for finding files without shelling out to
+ * find, and for scratch files that are cleaned up when the script ends.
+ * Relative paths are relative to the directory glox was started in,
+ * the same as they are for a shell.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("files")
+	module.Define("glob", 1, globNative)
+	module.Define("tempDir", 1, tempDirNative)
+	module.Define("tempFile", 1, tempFileNative)
+	module.Define("walk", 2, walkNative)
+	RegisterNativeModule(module)
+}
+
+// globNative returns the sorted paths that match a pattern like "src/**/*.lox". Each part of the pattern between
+// slashes matches one name, with * for any run of characters, ? for any one character, and [a-z] for a character
+// from a set, except that a part that is only ** also matches any number of directories, none included. Like a
+// shell, a wildcard doesn't match a name starting with a dot unless the pattern starts with one too, so ** stays out
+// of directories like .git, and links to directories aren't followed.
+func globNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	pattern, isString := args[0].(string)
+	if !isString || pattern == "" {
+		return nil, errors.New("glob() expects a pattern like \"src/**/*.lox\".")
+	}
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, part := range parts {
+		if _, err := filepath.Match(part, ""); err != nil {
+			return nil, errors.New("glob() expects a pattern like \"src/**/*.lox\", '" + part + "' isn't valid.")
+		}
+	}
+	root := ""
+	if parts[0] == "" {
+		root, parts = "/", parts[1:] // an absolute pattern
+	}
+	matches := make(map[string]bool)
+	globParts(root, parts, matches)
+	paths := make([]string, 0, len(matches))
+	for path := range matches {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	elements := make([]runtime.Value, len(paths))
+	for i, path := range paths {
+		elements[i] = path
+	}
+	return runtime.NewList(elements), nil
+}
+
+// globParts adds the paths under dir that match the rest of a pattern to matches, dir is "" for the current directory
+func globParts(dir string, parts []string, matches map[string]bool) {
+	if len(parts) == 0 {
+		if dir != "" {
+			matches[dir] = true
+		}
+		return
+	}
+	part, rest := parts[0], parts[1:]
+	if part == "" || part == "." {
+		// "a//b" and "a/./b" are just "a/b", and a trailing slash only matches directories
+		if len(rest) == 0 && dir != "" {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				matches[dir] = true
+			}
+			return
+		}
+		globParts(dir, rest, matches)
+		return
+	}
+	if !strings.ContainsAny(part, "*?[\\") {
+		path := filepath.Join(dir, part)
+		if _, err := os.Lstat(path); err == nil {
+			globParts(path, rest, matches)
+		}
+		return
+	}
+	readFrom := dir
+	if readFrom == "" {
+		readFrom = "."
+	}
+	entries, err := os.ReadDir(readFrom)
+	if err != nil {
+		return // not a directory, or one that can't be read, so nothing in it matches
+	}
+	if part == "**" {
+		globParts(dir, rest, matches)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(part, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if part == "**" {
+			if entry.IsDir() {
+				globParts(path, parts, matches)
+			}
+		} else if matched, _ := filepath.Match(part, name); matched {
+			globParts(path, rest, matches)
+		}
+	}
+}
+
+/******************************************************************************
+ * walkNative calls a function with the path of every file and directory
+ * under a directory, in sorted order, each directory before what is in it.
+ * The function can take a second argument, which is true for directories.
+ * Returning false for a directory skips everything in it. Links to
+ * directories aren't followed.
+ *****************************************************************************/
+
+func walkNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	root, isString := args[0].(string)
+	visit, isCallable := args[1].(runtime.Callable)
+	if !isString || !isCallable || (runtime.CheckArity(visit, 1) != nil && runtime.CheckArity(visit, 2) != nil) {
+		return nil, errors.New("walk() expects a directory and a function that takes a path and whether it is a directory.")
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, errors.New("walk() expects a directory, '" + root + "' isn't one.")
+	}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.New("walk() couldn't read '" + path + "'.")
+		}
+		if path == root {
+			return nil
+		}
+		callArgs := []runtime.Value{path}
+		if runtime.CheckArity(visit, 2) == nil {
+			callArgs = append(callArgs, entry.IsDir())
+		}
+		result, err := visit.Call(callArgs)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && result == false {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return nil, err
+}
+
+/******************************************************************************
+ * tempFileNative and tempDirNative create an empty file or directory in the
+ * system's temporary directory, named after a prefix with random characters
+ * after it, and return its path. It is removed, along with anything put in
+ * a directory, when the script ends, by a hook added the way atExit adds
+ * one. So a function the script passes to atExit afterwards still runs
+ * before the removal and can look at what was written.
+ *****************************************************************************/
+
+func tempFileNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	prefix, isString := args[0].(string)
+	if !isString || strings.ContainsAny(prefix, `/\`) {
+		return nil, errors.New("tempFile() expects a prefix for the file's name, without slashes.")
+	}
+	file, err := os.CreateTemp("", prefix+"*")
+	if err != nil {
+		return nil, errors.New("tempFile() couldn't create a file: " + err.Error())
+	}
+	file.Close()
+	removeAtExit(interpreter, file.Name())
+	return file.Name(), nil
+}
+
+func tempDirNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	prefix, isString := args[0].(string)
+	if !isString || strings.ContainsAny(prefix, `/\`) {
+		return nil, errors.New("tempDir() expects a prefix for the directory's name, without slashes.")
+	}
+	dir, err := os.MkdirTemp("", prefix+"*")
+	if err != nil {
+		return nil, errors.New("tempDir() couldn't create a directory: " + err.Error())
+	}
+	removeAtExit(interpreter, dir)
+	return dir, nil
+}
+
+func removeAtExit(interpreter *Interpreter, path string) {
+	interpreter.exits.add(runtime.NewNativeFunction("removeTemp", 0, func(args []runtime.Value) (runtime.Value, error) {
+		os.RemoveAll(path)
+		return nil, nil
+	}))
+}
@@ -0,0 +1,179 @@
+package lang
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "io" native module, for controlling where and when output is written
+ * and for asking the user questions. See output.go and prompt.go.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("io")
+	module.Define("confirm", 1, confirmNative)
+	module.Define("flush", 0, flushNative)
+	module.Define("printTable", 1, printTableNative)
+	module.Define("prompt", 1, promptNative)
+	module.Define("promptSecret", 1, promptSecretNative)
+	RegisterNativeModule(module)
+}
+
+// flushNative writes out anything print has buffered
+func flushNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	return nil, interpreter.flushOutput()
+}
+
+// confirmNative asks a yes or no question until it gets an answer, false if the input ends first
+func confirmNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	question, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("confirm() expects a string.")
+	}
+	for {
+		answer, answered, err := interpreter.ask(question + " [y/n] ")
+		if err != nil || !answered {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// promptNative shows some text and returns the line typed after it, or nil if the input has ended
+func promptNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	question, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("prompt() expects a string.")
+	}
+	answer, answered, err := interpreter.ask(question)
+	if err != nil || !answered {
+		return nil, err
+	}
+	return answer, nil
+}
+
+// promptSecretNative is prompt without showing what is typed, for passwords
+func promptSecretNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	question, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("promptSecret() expects a string.")
+	}
+	answer, answered, err := interpreter.askSecret(question)
+	if err != nil || !answered {
+		return nil, err
+	}
+	return answer, nil
+}
+
+/******************************************************************************
+ * printTable prints rows lined up in columns, two spaces apart, with numbers
+ * aligned to the right of their column and everything else to the left:
+ *
+ *   name   score
+ *   -----  -----
+ *   ada       12
+ *   grace      9
+ *
+ * The rows are either lists, printed as they are, or maps, whose keys head
+ * the columns in the order they first appear. A row without one of the keys
+ * leaves that cell blank.
+ *****************************************************************************/
+
+func printTableNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	rows, err := tableRows(args[0])
+	if err != nil {
+		return nil, err
+	}
+	io.WriteString(interpreter.output, formatTable(rows))
+	return nil, nil
+}
+
+// tableRows turns a list of lists or maps into rows of cells, with a header row first for maps
+func tableRows(value runtime.Value) ([][]runtime.Value, error) {
+	err := errors.New("printTable() expects a list of lists or a list of maps.")
+	list, isList := value.(*runtime.List)
+	if !isList {
+		return nil, err
+	}
+	rows := make([][]runtime.Value, 0, list.Len()+2)
+	if list.Len() == 0 {
+		return rows, nil
+	}
+	if _, isMaps := list.Get(0).(*runtime.Map); !isMaps {
+		for _, element := range list.Elements() {
+			row, isList := element.(*runtime.List)
+			if !isList {
+				return nil, err
+			}
+			rows = append(rows, row.Elements())
+		}
+		return rows, nil
+	}
+	columns := make([]runtime.Value, 0)
+	seen := make(map[runtime.Value]bool)
+	for _, element := range list.Elements() {
+		row, isMap := element.(*runtime.Map)
+		if !isMap {
+			return nil, err
+		}
+		for _, key := range row.Keys() {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	rows = append(rows, columns, nil) // nil is the line under the header
+	for _, element := range list.Elements() {
+		row := make([]runtime.Value, len(columns))
+		for i, key := range columns {
+			row[i], _ = element.(*runtime.Map).Get(key)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func formatTable(rows [][]runtime.Value) string {
+	widths := make([]int, 0)
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		cells[i] = make([]string, len(row))
+		for j, value := range row {
+			if value != nil {
+				cells[i][j] = runtime.Stringify(value)
+			}
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], utf8.RuneCountInString(cells[i][j]))
+		}
+	}
+	var sb strings.Builder
+	for i, row := range rows {
+		line := make([]string, len(widths))
+		for j, width := range widths {
+			switch {
+			case row == nil:
+				line[j] = strings.Repeat("-", width)
+			case j >= len(row):
+			case runtime.IsNumber(row[j]):
+				line[j] = strings.Repeat(" ", width-utf8.RuneCountInString(cells[i][j])) + cells[i][j]
+			default:
+				line[j] = cells[i][j] + strings.Repeat(" ", width-utf8.RuneCountInString(cells[i][j]))
+			}
+		}
+		sb.WriteString(strings.TrimRight(strings.Join(line, "  "), " ") + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,56 @@
+package lang
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "math" native module.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("math")
+	module.DefineValue("E", math.E)
+	module.DefineValue("PI", math.Pi)
+	module.Define("abs", 1, mathFunction("abs", math.Abs))
+	module.Define("ceil", 1, mathFunction("ceil", math.Ceil))
+	module.Define("floor", 1, mathFunction("floor", math.Floor))
+	module.Define("max", 2, mathFunction2("max", math.Max))
+	module.Define("min", 2, mathFunction2("min", math.Min))
+	module.Define("pow", 2, mathFunction2("pow", math.Pow))
+	module.Define("random", 0, randomNative)
+	module.Define("sqrt", 1, mathFunction("sqrt", math.Sqrt))
+	RegisterNativeModule(module)
+}
+
+// mathFunction wraps a Go function of one number as a native
+func mathFunction(name string, fn func(float64) float64) func(*Interpreter, []runtime.Value) (runtime.Value, error) {
+	return func(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+		x, isNumber := runtime.ToFloat(args[0])
+		if !isNumber {
+			return nil, errors.New(name + "() expects a number.")
+		}
+		return fn(x), nil
+	}
+}
+
+// mathFunction2 wraps a Go function of two numbers as a native
+func mathFunction2(name string, fn func(float64, float64) float64) func(*Interpreter, []runtime.Value) (runtime.Value, error) {
+	return func(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+		x, isXNumber := runtime.ToFloat(args[0])
+		y, isYNumber := runtime.ToFloat(args[1])
+		if !isXNumber || !isYNumber {
+			return nil, errors.New(name + "() expects two numbers.")
+		}
+		return fn(x, y), nil
+	}
+}
+
+// randomNative returns a random number from 0 up to, but not including, 1
+func randomNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	return rand.Float64(), nil
+}
@@ -0,0 +1,58 @@
+package lang
+
+import (
+	"errors"
+	"os"
+	goruntime "runtime"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "memory" native module, for programs that care about what stays in
+ * memory.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("memory")
+	module.Define("gc", 0, gcNative)
+	module.Define("heapSnapshot", 1, heapSnapshotNative)
+	module.Define("weakref", 1, weakrefNative)
+	RegisterNativeModule(module)
+}
+
+// gcNative runs the garbage collector, mostly useful to see weak references let go
+func gcNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	goruntime.GC()
+	return nil, nil
+}
+
+// weakrefNative returns a weak reference to an instance, list, or map
+func weakrefNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	ref, ok := runtime.NewWeakRef(args[0])
+	if !ok {
+		return nil, errors.New("weakref() expects an instance, list, or map.")
+	}
+	return ref, nil
+}
+
+// heapSnapshotNative writes the objects the program can reach to a JSON file and returns how many there were
+func heapSnapshotNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	path, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("heapSnapshot() expects a file path.")
+	}
+	if interpreter.hostsVM {
+		return nil, errors.New("heapSnapshot() is only supported by the tree-walk interpreter.")
+	}
+	snapshot := interpreter.snapshotHeap()
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := WriteHeapSnapshot(file, snapshot); err != nil {
+		return nil, err
+	}
+	return int64(len(snapshot.Objects)), nil
+}
@@ -0,0 +1,98 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "mock" native module, for tests that need to keep the code they test
+ * away from what it calls, like a native that goes out to the network.
+ *
+ * mock(name, replacement) gives the global variable name a new value, most
+ * often a function standing in for a function or native, and returns the
+ * value it had so a stand-in can still call through to it. The global is
+ * one of the calling script's or module's. mockMethod(class, name, fn) does
+ * the same for a method of a class, which every instance of the class and
+ * its subclasses then uses, and returns the method it replaced, or nil if
+ * there wasn't one.
+ *
+ * restoreMocks() puts back everything that was replaced, most recently
+ * replaced first. glox test calls it after each test function, once
+ * teardown has run, so one test's stand-ins can't affect the next.
+ *
+ * Code that read a function into a variable before it was mocked keeps
+ * calling the original, the same as when a global is assigned a new value.
+ *****************************************************************************/
+
+// mocks holds a way to undo each replacement made since they were last restored
+type mocks struct {
+	restores []func()
+}
+
+func init() {
+	module := NewNativeModule("mock")
+	module.Define("mock", 2, mockNative)
+	module.Define("mockMethod", 3, mockMethodNative)
+	module.Define("restoreMocks", 0, restoreMocksNative)
+	RegisterNativeModule(module)
+}
+
+func mockNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	name, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("mock() expects the name of a global variable and the value to replace it with.")
+	}
+	original, found := interpreter.globalValue(name)
+	if !found {
+		// natives are only installed once they are used
+		original, found = interpreter.lookUpNative(name)
+	}
+	if !found {
+		return nil, fmt.Errorf("mock() can't replace '%s', there is no global variable by that name.", name)
+	}
+	interpreter.setGlobal(name, args[1])
+	interpreter.mocks.restores = append(interpreter.mocks.restores, func() {
+		interpreter.setGlobal(name, original)
+	})
+	return original, nil
+}
+
+func mockMethodNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	class, isClass := args[0].(*runtime.Class)
+	name, isString := args[1].(string)
+	replacement, isFunction := args[2].(runtime.Function)
+	if !isClass || !isString || !isFunction {
+		return nil, errors.New("mockMethod() expects a class, the name of a method, and a function to replace it with.")
+	}
+	declared, wasDeclared := class.Methods()[name]
+	original, _ := class.FindMethod(name)
+	class.SetMethod(name, replacement)
+	interpreter.mocks.restores = append(interpreter.mocks.restores, func() {
+		if wasDeclared {
+			class.SetMethod(name, declared)
+		} else {
+			class.RemoveMethod(name)
+		}
+	})
+	if original == nil {
+		return nil, nil
+	}
+	return original, nil
+}
+
+func restoreMocksNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	interpreter.RestoreMocks()
+	return nil, nil
+}
+
+// RestoreMocks undoes every replacement made with mock() and mockMethod(), most recent first.
+func (interpreter *Interpreter) RestoreMocks() {
+	restores := interpreter.mocks.restores
+	for i := len(restores) - 1; i >= 0; i-- {
+		restores[i]()
+	}
+	interpreter.mocks.restores = nil
+}
@@ -0,0 +1,38 @@
+package lang
+
+import (
+	"errors"
+	"io"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "modules" native module, for working with imported modules at runtime.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("modules")
+	module.Define("reload", 1, reloadNative)
+	RegisterNativeModule(module)
+}
+
+/******************************************************************************
+ * reloadNative re-runs a module from disk and rebinds its names. It returns
+ * whether that worked. A module that fails to reload keeps its old bindings
+ * and the reason is printed with the program's other errors, so a long
+ * running script can carry on with the code it already had.
+ *****************************************************************************/
+
+func reloadNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	m, isModule := args[0].(*module)
+	if !isModule {
+		return nil, errors.New("reload() expects a module.")
+	}
+	err := interpreter.reloadModule(m)
+	if err != nil {
+		io.WriteString(interpreter.errorHandler.Output, err.Error()+"\n")
+		return false, nil
+	}
+	return true, nil
+}
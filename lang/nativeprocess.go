@@ -0,0 +1,55 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "process" native module, for ending the script, running code when it
+ * ends, and handling signals. See exit.go and signal.go.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("process")
+	module.Define("atExit", 1, atExitNative)
+	module.Define("exit", 1, exitNative)
+	module.Define("onSignal", 2, onSignalNative)
+	RegisterNativeModule(module)
+}
+
+// atExitNative registers a function that takes no arguments to run when the script ends
+func atExitNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	hook, isCallable := args[0].(runtime.Callable)
+	if !isCallable || runtime.CheckArity(hook, 0) != nil {
+		return nil, errors.New("atExit() expects a function that takes no arguments.")
+	}
+	interpreter.exits.add(hook)
+	return nil, nil
+}
+
+// exitNative ends the script with a status code from 0 to 255
+func exitNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	code, isWhole := runtime.ToInteger(args[0])
+	if !isWhole || code < 0 || code > 255 {
+		return nil, errors.New("exit() expects a whole number from 0 to 255.")
+	}
+	panic(ExitError{Code: int(code)})
+}
+
+// onSignalNative runs a function that takes no arguments when the script is sent a signal, or stops handling it for nil
+func onSignalNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	name, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("onSignal() expects a signal name like \"INT\" and a function.")
+	}
+	if args[1] == nil {
+		return nil, interpreter.setSignalHandler(name, nil)
+	}
+	handler, isCallable := args[1].(runtime.Callable)
+	if !isCallable || runtime.CheckArity(handler, 0) != nil {
+		return nil, errors.New("onSignal() expects a function that takes no arguments, or nil.")
+	}
+	return nil, interpreter.setSignalHandler(name, handler)
+}
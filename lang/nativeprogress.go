@@ -0,0 +1,199 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "progress" native module, for showing how far along a long running
+ * script is. A ProgressBar fills in as work is done and a Spinner turns
+ * while work of unknown length goes on:
+ *
+ *   files [##########----------]  50%
+ *
+ * Both redraw the line the cursor is on, with the same escape codes the
+ * terminal natives use, and flush the output each time so the line is
+ * current even while print output is buffered. When stdout isn't a
+ * terminal the redraws would only clutter a log, so nothing is written
+ * until finish(), which writes a single line with the result.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("progress")
+	module.Define("ProgressBar", 2, progressBarNative)
+	module.Define("Spinner", 1, spinnerNative)
+	RegisterNativeModule(module)
+}
+
+// progressBarNative returns a bar that is full once total steps are done
+func progressBarNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	total, isWhole := runtime.ToInteger(args[0])
+	if !isWhole || total < 1 {
+		return nil, errors.New("ProgressBar() expects a total of 1 or more steps.")
+	}
+	return &progressBar{
+		progressLine: newProgressLine(interpreter, runtime.Stringify(args[1])),
+		total:        total,
+	}, nil
+}
+
+func spinnerNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	return &spinner{progressLine: newProgressLine(interpreter, runtime.Stringify(args[0]))}, nil
+}
+
+// progressLine is the line a bar or spinner keeps redrawing
+type progressLine struct {
+	mutex       sync.Mutex // guards drawn and finished, a bar can be shared with workers
+	interpreter *Interpreter
+	label       string
+	live        bool   // whether stdout is a terminal the line can be redrawn on
+	drawn       string // what the line shows now, to skip redraws that change nothing
+	finished    bool
+}
+
+func newProgressLine(interpreter *Interpreter, label string) progressLine {
+	return progressLine{interpreter: interpreter, label: label, live: isTerminal(os.Stdout)}
+}
+
+func (line *progressLine) draw(text string) {
+	if !line.live || line.finished || text == line.drawn {
+		return
+	}
+	line.drawn = text
+	io.WriteString(line.interpreter.output, "\r\x1b[2K"+text)
+	line.interpreter.flushOutput()
+}
+
+// finish replaces the line with text, which is written whether or not stdout is a terminal
+func (line *progressLine) finish(text string) {
+	if line.finished {
+		return
+	}
+	line.finished = true
+	if line.live && line.drawn != "" {
+		io.WriteString(line.interpreter.output, "\r\x1b[2K")
+	}
+	if text != "" {
+		io.WriteString(line.interpreter.output, text+"\n")
+	}
+	line.interpreter.flushOutput()
+}
+
+/******************************************************************************
+ * A progressBar counts steps towards its total. step() does one step and
+ * set(n) jumps to a count, clamped to between 0 and the total. The bar is
+ * sized to leave room for its label and percentage on one terminal line.
+ *****************************************************************************/
+
+type progressBar struct {
+	progressLine
+	total int64
+	done  int64
+}
+
+func (bar *progressBar) Get(name string) (runtime.Value, bool) {
+	switch name {
+	case "step":
+		return runtime.NewNativeFunction("step", 0, func(args []runtime.Value) (runtime.Value, error) {
+			bar.mutex.Lock()
+			defer bar.mutex.Unlock()
+			bar.set(bar.done + 1)
+			return nil, nil
+		}), true
+	case "set":
+		return runtime.NewNativeFunction("set", 1, func(args []runtime.Value) (runtime.Value, error) {
+			done, isWhole := runtime.ToInteger(args[0])
+			if !isWhole {
+				return nil, errors.New("set() expects a whole number of steps.")
+			}
+			bar.mutex.Lock()
+			defer bar.mutex.Unlock()
+			bar.set(done)
+			return nil, nil
+		}), true
+	case "done":
+		return runtime.NewNativeFunction("done", 0, func(args []runtime.Value) (runtime.Value, error) {
+			bar.mutex.Lock()
+			defer bar.mutex.Unlock()
+			return bar.done, nil
+		}), true
+	case "finish":
+		return runtime.NewNativeFunction("finish", 0, func(args []runtime.Value) (runtime.Value, error) {
+			bar.mutex.Lock()
+			defer bar.mutex.Unlock()
+			bar.finish(bar.render())
+			return nil, nil
+		}), true
+	}
+	return nil, false
+}
+
+func (bar *progressBar) set(done int64) {
+	bar.done = max(0, min(done, bar.total))
+	bar.draw(bar.render())
+}
+
+func (bar *progressBar) render() string {
+	percent := bar.done * 100 / bar.total
+	columns, _, known := terminalSize(os.Stdout)
+	if !known {
+		columns = 80
+	}
+	// "label [", "] ", and " 100%" around the bar, with the bar kept between 10 and 50 cells
+	width := min(max(columns-len(bar.label)-9, 10), 50)
+	filled := int(bar.done * int64(width) / bar.total)
+	return fmt.Sprintf("%s [%s%s] %3d%%", bar.label, strings.Repeat("#", filled), strings.Repeat("-", width-filled), percent)
+}
+
+func (bar *progressBar) String() string {
+	return fmt.Sprintf("<progress bar %d/%d>", bar.done, bar.total)
+}
+
+/******************************************************************************
+ * A spinner shows work is going on without saying how much is left. Each
+ * tick() turns it one frame, and finish(message) replaces it with message,
+ * or just clears it if message is nil.
+ *****************************************************************************/
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+type spinner struct {
+	progressLine
+	frame int
+}
+
+func (s *spinner) Get(name string) (runtime.Value, bool) {
+	switch name {
+	case "tick":
+		return runtime.NewNativeFunction("tick", 0, func(args []runtime.Value) (runtime.Value, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			s.draw(spinnerFrames[s.frame] + " " + s.label)
+			s.frame = (s.frame + 1) % len(spinnerFrames)
+			return nil, nil
+		}), true
+	case "finish":
+		return runtime.NewNativeFunction("finish", 1, func(args []runtime.Value) (runtime.Value, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if args[0] == nil {
+				s.finish("")
+			} else {
+				s.finish(runtime.Stringify(args[0]))
+			}
+			return nil, nil
+		}), true
+	}
+	return nil, false
+}
+
+func (s *spinner) String() string {
+	return "<spinner>"
+}
@@ -0,0 +1,147 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "reflect" native module, for code that looks at or changes the shape
+ * of objects at run time.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("reflect")
+	module.Define("arity", 1, arityNative)
+	module.Define("classNamed", 1, classNamedNative)
+	module.Define("deleteField", 2, deleteFieldNative)
+	module.Define("fields", 1, fieldsNative)
+	module.Define("getField", 2, getFieldNative)
+	module.Define("methods", 1, methodsNative)
+	module.Define("name", 1, nameNative)
+	module.Define("newInstance", 2, newInstanceNative)
+	module.Define("setField", 3, setFieldNative)
+	module.Define("superclass", 1, superclassNative)
+	RegisterNativeModule(module)
+}
+
+// arityNative returns how many arguments a function, method, class, or native takes
+func arityNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	callable, isCallable := args[0].(runtime.Callable)
+	if !isCallable {
+		return nil, errors.New("arity() expects a function or class.")
+	}
+	return int64(callable.Arity()), nil
+}
+
+// classNamedNative looks up a class declared at the top level of the calling script or module, giving nil if there isn't one
+func classNamedNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	name, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("classNamed() expects a class name.")
+	}
+	value, _ := interpreter.globalValue(name)
+	if class, isClass := value.(*runtime.Class); isClass {
+		return class, nil
+	}
+	return nil, nil
+}
+
+// deleteFieldNative removes a field from an instance and returns the value it had, or nil if it had none
+func deleteFieldNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	instance, isInstance := args[0].(*runtime.Instance)
+	name, isString := args[1].(string)
+	if !isInstance || !isString {
+		return nil, errors.New("deleteField() expects an instance and a field name.")
+	}
+	value, _ := instance.Delete(name)
+	return value, nil
+}
+
+// fieldsNative returns a list of an instance's field names in the order they were first set
+func fieldsNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	instance, isInstance := args[0].(*runtime.Instance)
+	if !isInstance {
+		return nil, errors.New("fields() expects an instance.")
+	}
+	names := instance.FieldNames()
+	elements := make([]runtime.Value, len(names))
+	for i, name := range names {
+		elements[i] = name
+	}
+	return runtime.NewList(elements), nil
+}
+
+// getFieldNative reads a field by name, giving nil if the instance has no such field, methods aren't fields
+func getFieldNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	instance, isInstance := args[0].(*runtime.Instance)
+	name, isString := args[1].(string)
+	if !isInstance || !isString {
+		return nil, errors.New("getField() expects an instance and a field name.")
+	}
+	value, _ := instance.Field(name)
+	return value, nil
+}
+
+// methodsNative returns a sorted list of the names of a class's methods, inherited ones included
+func methodsNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	class, isClass := args[0].(*runtime.Class)
+	if !isClass {
+		return nil, errors.New("methods() expects a class.")
+	}
+	names := class.MethodNames()
+	elements := make([]runtime.Value, len(names))
+	for i, name := range names {
+		elements[i] = name
+	}
+	return runtime.NewList(elements), nil
+}
+
+// nameNative returns the name a function, method, class, or native was declared with, or nil for anonymous functions
+func nameNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	callable, isCallable := args[0].(runtime.Callable)
+	if !isCallable {
+		return nil, errors.New("name() expects a function or class.")
+	}
+	if callable.Name() == "" {
+		return nil, nil
+	}
+	return callable.Name(), nil
+}
+
+// newInstanceNative calls a class with the elements of a list as its arguments
+func newInstanceNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	class, isClass := args[0].(*runtime.Class)
+	list, isList := args[1].(*runtime.List)
+	if !isClass || !isList {
+		return nil, errors.New("newInstance() expects a class and a list of arguments.")
+	}
+	if err := runtime.CheckArity(class, list.Len()); err != nil {
+		return nil, err
+	}
+	return class.Call(list.Elements())
+}
+
+// setFieldNative sets a field by name, adding it if the instance doesn't have it yet, and returns the value
+func setFieldNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	instance, isInstance := args[0].(*runtime.Instance)
+	name, isString := args[1].(string)
+	if !isInstance || !isString {
+		return nil, errors.New("setField() expects an instance and a field name.")
+	}
+	instance.Set(name, args[2])
+	return args[2], nil
+}
+
+// superclassNative returns the class a class inherits from, or nil if it doesn't inherit from one
+func superclassNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	class, isClass := args[0].(*runtime.Class)
+	if !isClass {
+		return nil, errors.New("superclass() expects a class.")
+	}
+	if class.Superclass() == nil {
+		return nil, nil
+	}
+	return class.Superclass(), nil
+}
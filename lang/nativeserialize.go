@@ -0,0 +1,33 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "serialize" native module, for saving values as text and reading them
+ * back. See serialize.go for the format.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("serialize")
+	module.Define("deserialize", 1, deserializeNative)
+	module.Define("serialize", 1, serializeNative)
+	RegisterNativeModule(module)
+}
+
+// deserializeNative rebuilds a value from the text serialize() gave for it
+func deserializeNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	text, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("deserialize() expects a string.")
+	}
+	return deserialize(text, interpreter)
+}
+
+// serializeNative writes a value, and everything in it, as text
+func serializeNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	return serialize(args[0])
+}
@@ -0,0 +1,176 @@
+package lang
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "strings" native module. Strings are indexed by character, the same
+ * way len() counts them and for-in walks through them, starting at 0.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("strings")
+	module.Define("StringBuilder", 0, stringBuilderNative)
+	module.Define("diff", 2, diffNative)
+	module.Define("indexOf", 2, indexOfNative)
+	module.Define("replace", 3, replaceNative)
+	module.Define("split", 2, splitNative)
+	module.Define("substring", 3, substringNative)
+	module.Define("toLower", 1, toLowerNative)
+	module.Define("toUpper", 1, toUpperNative)
+	module.Define("trim", 1, trimNative)
+	RegisterNativeModule(module)
+}
+
+func stringBuilderNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	return &stringBuilder{}, nil
+}
+
+// stringArgs checks that every argument is a string and returns them as strings
+func stringArgs(name string, args []runtime.Value) ([]string, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, isString := arg.(string)
+		if !isString {
+			return nil, errors.New(name + "() expects string arguments.")
+		}
+		strs[i] = str
+	}
+	return strs, nil
+}
+
+// diffNative returns a unified diff of two texts, line by line, or nil if they are the same
+func diffNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	strs, err := stringArgs("diff", args)
+	if err != nil {
+		return nil, err
+	}
+	if strs[0] == strs[1] {
+		return nil, nil
+	}
+	return unifiedDiff(strs[0], strs[1]), nil
+}
+
+// indexOfNative returns the index of the character where a string first appears in another, or -1 if it doesn't
+func indexOfNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	strs, err := stringArgs("indexOf", args)
+	if err != nil {
+		return nil, err
+	}
+	index := strings.Index(strs[0], strs[1])
+	if index < 0 {
+		return int64(-1), nil
+	}
+	return int64(utf8.RuneCountInString(strs[0][:index])), nil
+}
+
+// replaceNative replaces every occurrence of one string in another
+func replaceNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	strs, err := stringArgs("replace", args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ReplaceAll(strs[0], strs[1], strs[2]), nil
+}
+
+// splitNative returns a list of the parts of a string between separators
+func splitNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	strs, err := stringArgs("split", args)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strs[0], strs[1])
+	elements := make([]runtime.Value, len(parts))
+	for i, part := range parts {
+		elements[i] = part
+	}
+	return runtime.NewList(elements), nil
+}
+
+// substringNative returns the characters of a string from start up to, but not including, end
+func substringNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	str, isString := args[0].(string)
+	if !isString || !runtime.IsNumber(args[1]) || !runtime.IsNumber(args[2]) {
+		return nil, errors.New("substring() expects a string, a start, and an end.")
+	}
+	start, isStartWhole := runtime.ToInteger(args[1])
+	end, isEndWhole := runtime.ToInteger(args[2])
+	if !isStartWhole || !isEndWhole {
+		return nil, errors.New("substring() expects whole number indexes.")
+	}
+	// indexes count characters, the same ones a for-in loop walks through
+	characters := []rune(str)
+	if start < 0 || end < start || end > int64(len(characters)) {
+		return nil, errors.New("substring() indexes out of range.")
+	}
+	return string(characters[start:end]), nil
+}
+
+func toLowerNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	strs, err := stringArgs("toLower", args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToLower(strs[0]), nil
+}
+
+func toUpperNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	strs, err := stringArgs("toUpper", args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(strs[0]), nil
+}
+
+// trimNative removes whitespace from both ends of a string
+func trimNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	strs, err := stringArgs("trim", args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.TrimSpace(strs[0]), nil
+}
+
+/******************************************************************************
+ * A stringBuilder collects text in one growing buffer, so building a long
+ * string a piece at a time takes time in proportion to its length rather
+ * than its length squared. append() takes any value, writing it the way
+ * print would, and returns the builder so calls can be chained.
+ *****************************************************************************/
+
+type stringBuilder struct {
+	builder strings.Builder
+}
+
+func (b *stringBuilder) Get(name string) (runtime.Value, bool) {
+	switch name {
+	case "append":
+		return runtime.NewNativeFunction("append", 1, func(args []runtime.Value) (runtime.Value, error) {
+			b.builder.WriteString(runtime.Stringify(args[0]))
+			return b, nil
+		}), true
+	case "len":
+		return runtime.NewNativeFunction("len", 0, func(args []runtime.Value) (runtime.Value, error) {
+			return int64(utf8.RuneCountInString(b.builder.String())), nil
+		}), true
+	case "clear":
+		return runtime.NewNativeFunction("clear", 0, func(args []runtime.Value) (runtime.Value, error) {
+			b.builder.Reset()
+			return nil, nil
+		}), true
+	case "toString":
+		return runtime.NewNativeFunction("toString", 0, func(args []runtime.Value) (runtime.Value, error) {
+			return b.builder.String(), nil
+		}), true
+	}
+	return nil, false
+}
+
+func (b *stringBuilder) String() string {
+	return "<string builder>"
+}
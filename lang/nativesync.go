@@ -0,0 +1,53 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "sync" native module, mutexes and atomic counters for workers that
+ * share state. See sync.go.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("sync")
+	module.Define("atomicCounter", 1, atomicCounterNative)
+	module.Define("lock", 1, lockNative)
+	module.Define("mutex", 0, mutexNative)
+	module.Define("unlock", 1, unlockNative)
+	RegisterNativeModule(module)
+}
+
+// atomicCounterNative returns a counter starting at a whole number, with get, add, set, and compareAndSet methods
+func atomicCounterNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	initial, err := counterArg("atomicCounter", args[0])
+	if err != nil {
+		return nil, err
+	}
+	counter := &atomicCounter{}
+	counter.value.Store(initial)
+	return counter, nil
+}
+
+// lockNative waits until the mutex is free and then locks it
+func lockNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	m, isMutex := args[0].(*loxMutex)
+	if !isMutex {
+		return nil, errors.New("lock() expects a mutex.")
+	}
+	return nil, m.lock(interpreter)
+}
+
+func mutexNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	return &loxMutex{}, nil
+}
+
+func unlockNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	m, isMutex := args[0].(*loxMutex)
+	if !isMutex {
+		return nil, errors.New("unlock() expects a mutex.")
+	}
+	return nil, m.unlock(interpreter)
+}
@@ -0,0 +1,135 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "terminal" native module, for sizing output to the terminal, coloring
+ * it, and moving the cursor to redraw it.
+ *
+ * termColor only adds color when stdout is a terminal and the NO_COLOR
+ * environment variable isn't set, so a script's output stays plain text
+ * when it is piped to a file or another program. The cursor natives write
+ * their escape codes to the same output as print, wherever it goes.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("terminal")
+	module.Define("clearLine", 0, clearLineNative)
+	module.Define("clearScreen", 0, clearScreenNative)
+	module.Define("moveCursor", 2, moveCursorNative)
+	module.Define("moveCursorTo", 2, moveCursorToNative)
+	module.Define("termColor", 2, termColorNative)
+	module.Define("termHeight", 0, termHeightNative)
+	module.Define("termWidth", 0, termWidthNative)
+	RegisterNativeModule(module)
+}
+
+// the SGR codes termColor accepts, by name
+var terminalStyles = map[string]int{
+	"bold": 1, "dim": 2, "italic": 3, "underline": 4,
+	"black": 30, "red": 31, "green": 32, "yellow": 33, "blue": 34, "magenta": 35, "cyan": 36, "white": 37,
+	"gray": 90,
+}
+
+// clearLineNative erases the line the cursor is on and moves the cursor to its start
+func clearLineNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	io.WriteString(interpreter.output, "\r\x1b[2K")
+	return nil, nil
+}
+
+// clearScreenNative erases the terminal and moves the cursor to the top left corner
+func clearScreenNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	io.WriteString(interpreter.output, "\x1b[2J\x1b[H")
+	return nil, nil
+}
+
+// moveCursorNative moves the cursor by a number of columns right and rows down, negative for left and up
+func moveCursorNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	columns, isColumnsWhole := runtime.ToInteger(args[0])
+	rows, isRowsWhole := runtime.ToInteger(args[1])
+	if !isColumnsWhole || !isRowsWhole {
+		return nil, errors.New("moveCursor() expects whole numbers of columns and rows.")
+	}
+	var codes strings.Builder
+	if columns > 0 {
+		fmt.Fprintf(&codes, "\x1b[%dC", columns)
+	} else if columns < 0 {
+		fmt.Fprintf(&codes, "\x1b[%dD", -columns)
+	}
+	if rows > 0 {
+		fmt.Fprintf(&codes, "\x1b[%dB", rows)
+	} else if rows < 0 {
+		fmt.Fprintf(&codes, "\x1b[%dA", -rows)
+	}
+	io.WriteString(interpreter.output, codes.String())
+	return nil, nil
+}
+
+// moveCursorToNative moves the cursor to a column and row, counting from 1 at the top left corner
+func moveCursorToNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	column, isColumnWhole := runtime.ToInteger(args[0])
+	row, isRowWhole := runtime.ToInteger(args[1])
+	if !isColumnWhole || !isRowWhole || column < 1 || row < 1 {
+		return nil, errors.New("moveCursorTo() expects a column and row of 1 or more.")
+	}
+	fmt.Fprintf(interpreter.output, "\x1b[%d;%dH", row, column)
+	return nil, nil
+}
+
+// termColorNative returns text in a color or style, like "red" or "bold", when stdout shows colors
+func termColorNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	name, isString := args[0].(string)
+	code, isStyle := terminalStyles[name]
+	if !isString || !isStyle {
+		return nil, errors.New("termColor() expects one of " + styleNames() + ".")
+	}
+	text := runtime.Stringify(args[1])
+	if os.Getenv("NO_COLOR") != "" || !isTerminal(os.Stdout) {
+		return text, nil
+	}
+	return "\x1b[" + strconv.Itoa(code) + "m" + text + "\x1b[0m", nil
+}
+
+// termHeightNative returns how many rows the terminal has, from LINES or 24 if that can't be found out
+func termHeightNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	_, rows, known := terminalSize(os.Stdout)
+	if !known {
+		rows = sizeFromEnvironment("LINES", 24)
+	}
+	return int64(rows), nil
+}
+
+// termWidthNative returns how many columns the terminal has, from COLUMNS or 80 if that can't be found out
+func termWidthNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	columns, _, known := terminalSize(os.Stdout)
+	if !known {
+		columns = sizeFromEnvironment("COLUMNS", 80)
+	}
+	return int64(columns), nil
+}
+
+func sizeFromEnvironment(name string, fallback int) int {
+	if size, err := strconv.Atoi(os.Getenv(name)); err == nil && size > 0 {
+		return size
+	}
+	return fallback
+}
+
+func styleNames() string {
+	names := make([]string, 0, len(terminalStyles))
+	for name := range terminalStyles {
+		names = append(names, "\""+name+"\"")
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
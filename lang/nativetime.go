@@ -0,0 +1,43 @@
+package lang
+
+import (
+	"errors"
+	"time"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "time" native module.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("time")
+	module.Define("clock", 0, clock)
+	module.Define("withTimeout", 2, withTimeout)
+	RegisterNativeModule(module)
+}
+
+// clock returns the number of seconds since the Unix epoch
+func clock(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	return float64(time.Now().UnixNano()) / float64(time.Second), nil
+}
+
+/******************************************************************************
+ * withTimeout calls fn, which takes no arguments, and returns what it
+ * returns. If fn is still running after ms milliseconds it is stopped with a
+ * runtime error, so a script can't get stuck in one of its own callbacks.
+ *****************************************************************************/
+
+func withTimeout(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	ms, isNumber := runtime.ToFloat(args[0])
+	if !isNumber || ms < 0 {
+		return nil, errors.New("withTimeout() expects a time limit of zero or more milliseconds.")
+	}
+	fn, isCallable := args[1].(runtime.Callable)
+	if !isCallable || runtime.CheckArity(fn, 0) != nil {
+		return nil, errors.New("withTimeout() expects a function that takes no arguments.")
+	}
+	defer interpreter.startTimeout(time.Duration(ms * float64(time.Millisecond)))()
+	return fn.Call(nil)
+}
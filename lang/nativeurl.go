@@ -0,0 +1,168 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "url" native module, for taking URLs apart and building query strings
+ * when talking to web APIs. Encoding follows query strings, where a space
+ * is written as +.
+ *
+ * Query parameters are read into a map in the order they first appear. A
+ * name given once maps to its value, and a name given more than once maps
+ * to a list of its values. queryString() writes the same shape back out, so
+ * a list repeats its name for each value.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("url")
+	module.Define("queryParse", 1, queryParseNative)
+	module.Define("queryString", 1, queryStringNative)
+	module.Define("urlDecode", 1, urlDecodeNative)
+	module.Define("urlEncode", 1, urlEncodeNative)
+	module.Define("urlParse", 1, urlParseNative)
+	RegisterNativeModule(module)
+}
+
+/******************************************************************************
+ * urlParseNative returns a map of a URL's parts: scheme, user, password,
+ * host, port, path, query, params, and fragment. Parts the URL doesn't have
+ * are nil, or "" for the path and query, the port is a number, and params
+ * is the query read by queryParse().
+ *****************************************************************************/
+
+func urlParseNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	str, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("urlParse() expects a string.")
+	}
+	parsed, err := url.Parse(str)
+	if err != nil {
+		return nil, fmt.Errorf("urlParse() can't parse '%s': %v.", str, errors.Unwrap(err))
+	}
+	params, err := parseQuery("urlParse", parsed.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+	parts := runtime.NewMap()
+	parts.Set("scheme", optionalString(parsed.Scheme))
+	var user, password runtime.Value
+	if parsed.User != nil {
+		user = parsed.User.Username()
+		if secret, hasPassword := parsed.User.Password(); hasPassword {
+			password = secret
+		}
+	}
+	parts.Set("user", user)
+	parts.Set("password", password)
+	parts.Set("host", optionalString(parsed.Hostname()))
+	var port runtime.Value
+	if number, err := strconv.ParseInt(parsed.Port(), 10, 64); err == nil {
+		port = number
+	}
+	parts.Set("port", port)
+	parts.Set("path", parsed.Path)
+	parts.Set("query", parsed.RawQuery)
+	parts.Set("params", params)
+	parts.Set("fragment", optionalString(parsed.Fragment))
+	return parts, nil
+}
+
+// optionalString returns nil in place of an empty string, for parts that weren't given
+func optionalString(str string) runtime.Value {
+	if str == "" {
+		return nil
+	}
+	return str
+}
+
+// urlEncodeNative escapes a string to be used as part of a query string
+func urlEncodeNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	str, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("urlEncode() expects a string.")
+	}
+	return url.QueryEscape(str), nil
+}
+
+// urlDecodeNative undoes urlEncode(), turning %XX escapes and + back into what they stand for
+func urlDecodeNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	str, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("urlDecode() expects a string.")
+	}
+	decoded, err := url.QueryUnescape(str)
+	if err != nil {
+		return nil, fmt.Errorf("urlDecode() found an invalid escape in '%s'.", str)
+	}
+	return decoded, nil
+}
+
+// queryParseNative reads a query string, with or without its leading ?, into a map of parameters
+func queryParseNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	str, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("queryParse() expects a string.")
+	}
+	return parseQuery("queryParse", strings.TrimPrefix(str, "?"))
+}
+
+func parseQuery(native string, query string) (*runtime.Map, error) {
+	params := runtime.NewMap()
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		rawName, rawValue, _ := strings.Cut(pair, "=")
+		name, nameErr := url.QueryUnescape(rawName)
+		value, valueErr := url.QueryUnescape(rawValue)
+		if nameErr != nil || valueErr != nil {
+			return nil, fmt.Errorf("%s() found an invalid escape in '%s'.", native, pair)
+		}
+		existing, exists := params.Get(name)
+		if list, isList := existing.(*runtime.List); isList {
+			list.Append(value)
+		} else if exists {
+			params.Set(name, runtime.NewList([]runtime.Value{existing, value}))
+		} else {
+			params.Set(name, value)
+		}
+	}
+	return params, nil
+}
+
+// queryStringNative writes a map of parameters as a query string, without a leading ?
+func queryStringNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	params, isMap := args[0].(*runtime.Map)
+	if !isMap {
+		return nil, errors.New("queryString() expects a map.")
+	}
+	var pairs []string
+	for _, key := range params.Keys() {
+		name, isString := key.(string)
+		if !isString {
+			return nil, errors.New("queryString() expects the names of parameters to be strings.")
+		}
+		value, _ := params.Get(key)
+		values := []runtime.Value{value}
+		if list, isList := value.(*runtime.List); isList {
+			values = list.Elements()
+		}
+		for _, value := range values {
+			switch value.(type) {
+			case string, bool, int64, float64:
+			default:
+				return nil, fmt.Errorf("queryString() can't write %s as the value of '%s'.", runtime.Stringify(value), name)
+			}
+			pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(runtime.Stringify(value)))
+		}
+	}
+	return strings.Join(pairs, "&"), nil
+}
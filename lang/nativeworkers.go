@@ -0,0 +1,52 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The "workers" native module. Worker starts a script on its own goroutine,
+ * see worker.go. The send and receive natives are for the script running in
+ * the worker, they talk to the program that started it.
+ *****************************************************************************/
+
+func init() {
+	module := NewNativeModule("workers")
+	module.Define("Worker", 1, workerNative)
+	module.Define("receive", 0, receiveNative)
+	module.Define("send", 1, sendNative)
+	RegisterNativeModule(module)
+}
+
+// workerNative starts the script at a path, relative to the running script, and returns its worker
+func workerNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	path, isString := args[0].(string)
+	if !isString {
+		return nil, errors.New("Worker() expects the path of a script.")
+	}
+	return interpreter.startWorker(path)
+}
+
+// receiveNative waits for the next message from the program that started this worker
+func receiveNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	if interpreter.worker == nil {
+		return nil, errors.New("receive() can only be called from a worker.")
+	}
+	message, _ := interpreter.worker.inbox.take()
+	return message, nil
+}
+
+// sendNative sends a message to the program that started this worker
+func sendNative(interpreter *Interpreter, args []runtime.Value) (runtime.Value, error) {
+	if interpreter.worker == nil {
+		return nil, errors.New("send() can only be called from a worker.")
+	}
+	message, err := copyMessage(args[0], make(map[runtime.Value]runtime.Value))
+	if err != nil {
+		return nil, err
+	}
+	interpreter.worker.outbox.put(message)
+	return nil, nil
+}
@@ -0,0 +1,104 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * Warnings for code that runs but can't do anything useful, which is usually
+ * a typo. Comparing an expression to itself, as in "x == x", always gives the
+ * same answer, and "a - a" is always zero, so one side was probably meant to
+ * be something else. Only operators where that holds are checked, "x + x"
+ * and "x * x" are fine.
+ *
+ * An expression statement with no side effects, like "x + 1;" or "a == b;",
+ * computes a value and throws it away. Calls and assignments count as side
+ * effects, so "f();" and "x = 1;" are fine. So does reading a property,
+ * since it might be a getter, so "c.tick;" and "c.tick == c.tick" are fine.
+ *****************************************************************************/
+
+var selfOperators = map[TokenType]bool{
+	tokenTypeEqualEqual: true, tokenTypeBangEqual: true, tokenTypeGreater: true, tokenTypeGreaterEqual: true,
+	tokenTypeLess: true, tokenTypeLessEqual: true, tokenTypeMinus: true, tokenTypeSlash: true, tokenTypeMod: true,
+	tokenTypeAmpersand: true, tokenTypePipe: true, tokenTypeCaret: true, tokenTypeAnd: true, tokenTypeOr: true,
+}
+
+func (r *Resolver) checkSelfOperation(left Expr, operator Token, right Expr) {
+	if selfOperators[operator.tokenType] && isPure(left) && sameExpr(left, right) {
+		err := errors.New("Both sides of '" + operator.lexeme + "' are the same expression.")
+		r.warn(diag.SelfComparison, operator.span, err)
+	}
+}
+
+func (r *Resolver) checkUnusedExpression(stmt ExprStmt) {
+	if isPure(stmt.expr) {
+		err := errors.New("Expression value is unused and it has no side effects.")
+		r.warn(diag.UnusedExpression, stmt.expr.Span(), err)
+	}
+}
+
+// isPure reports whether evaluating an expression can't change anything
+func isPure(expr Expr) bool {
+	pure := true
+	walkExpr(expr, func(node any) bool {
+		switch node.(type) {
+		case AssignExpr, CallExpr, SetExpr, SubscriptSetExpr:
+			pure = false
+		case GetExpr, SuperExpr:
+			pure = false // the property might be a getter, which runs code
+		case FunctionExpr:
+			return false // its body only runs when it's called
+		}
+		return pure
+	})
+	return pure
+}
+
+// sameExpr reports whether two expressions are written the same way, ignoring parentheses
+func sameExpr(a, b Expr) bool {
+	a, b = withoutGrouping(a), withoutGrouping(b)
+	switch a := a.(type) {
+	case VariableExpr:
+		b, isSame := b.(VariableExpr)
+		return isSame && a.name.lexeme == b.name.lexeme
+	case LiteralExpr:
+		b, isSame := b.(LiteralExpr)
+		return isSame && a.value == b.value
+	case ThisExpr:
+		_, isSame := b.(ThisExpr)
+		return isSame
+	case SuperExpr:
+		b, isSame := b.(SuperExpr)
+		return isSame && a.method.lexeme == b.method.lexeme
+	case GetExpr:
+		b, isSame := b.(GetExpr)
+		return isSame && a.name.lexeme == b.name.lexeme && sameExpr(a.object, b.object)
+	case SubscriptExpr:
+		b, isSame := b.(SubscriptExpr)
+		return isSame && sameExpr(a.object, b.object) && sameExpr(a.index, b.index)
+	case UnaryExpr:
+		b, isSame := b.(UnaryExpr)
+		return isSame && a.operator.tokenType == b.operator.tokenType && sameExpr(a.right, b.right)
+	case BinaryExpr:
+		b, isSame := b.(BinaryExpr)
+		return isSame && a.operator.tokenType == b.operator.tokenType && sameExpr(a.left, b.left) &&
+			sameExpr(a.right, b.right)
+	case LogicalExpr:
+		b, isSame := b.(LogicalExpr)
+		return isSame && a.operator.tokenType == b.operator.tokenType && sameExpr(a.left, b.left) &&
+			sameExpr(a.right, b.right)
+	}
+	return false
+}
+
+func withoutGrouping(expr Expr) Expr {
+	for {
+		grouping, isGrouping := expr.(GroupingExpr)
+		if !isGrouping {
+			return expr
+		}
+		expr = grouping.expression
+	}
+}
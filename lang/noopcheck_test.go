@@ -0,0 +1,44 @@
+package lang
+
+import (
+	"io"
+	"testing"
+
+	"github.com/skusel/glox/diag"
+)
+
+// TestCheckNoOp checks which expressions are reported as comparing something to itself or having no effect
+func TestCheckNoOp(t *testing.T) {
+	const counter = "class Counter { init() { this.count = 0; } tick { this.count = this.count + 1; return this.count; } }\n" +
+		"var c = Counter();\n"
+	tests := []struct {
+		name   string
+		source string
+		codes  []diag.Code
+	}{
+		{"self comparison", "var x = 1;\nprint x == x;\n", []diag.Code{diag.SelfComparison}},
+		{"unused expression", "var x = 1;\nx + 1;\n", []diag.Code{diag.UnusedExpression}},
+		{"call", "fun f() {}\nf();\n", nil},
+		{"getter read as a statement", counter + "c.tick;\n", nil},
+		{"getter compared to itself", counter + "print c.tick == c.tick;\n", nil},
+		{"super getter", "class A { size { return 1; } }\nclass B < A { size { return super.size == super.size; } }\n", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errorHandler := &ErrorHandler{Output: io.Discard}
+			NewFrontEnd(errorHandler).Analyze(test.source)
+			codes := make([]diag.Code, 0)
+			for _, diagnostic := range errorHandler.Diagnostics {
+				codes = append(codes, diagnostic.Code)
+			}
+			if len(codes) != len(test.codes) {
+				t.Fatalf("reported %v, expected %v", codes, test.codes)
+			}
+			for i := range codes {
+				if codes[i] != test.codes[i] {
+					t.Errorf("reported %v, expected %v", codes, test.codes)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package lang
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+/******************************************************************************
+ * BufferedOutput collects what print writes and hands it to the underlying
+ * writer in large pieces, instead of making a system call for every line.
+ * Workers share their parent's output, so writes are locked.
+ *
+ * Nothing reaches the underlying writer until the buffer fills up or Flush
+ * is called. The flush() native calls it from a script, and the command
+ * line calls it when a script ends and before every REPL prompt. Writers
+ * made with Before flush it first, so errors and debugger prompts written
+ * to them show up after the output that came before them. When the
+ * underlying writer is a terminal, someone is watching, so every complete
+ * line is flushed as soon as it is written. FlushOnExitSignals keeps output
+ * from being lost when the process is stopped with Ctrl-C.
+ *****************************************************************************/
+
+type BufferedOutput struct {
+	mu           sync.Mutex
+	writer       *bufio.Writer
+	lineBuffered bool // flush after every newline, for terminals
+}
+
+func NewBufferedOutput(w io.Writer) *BufferedOutput {
+	file, isFile := w.(*os.File)
+	return &BufferedOutput{writer: bufio.NewWriterSize(w, 64*1024), lineBuffered: isFile && isTerminal(file)}
+}
+
+func (o *BufferedOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n, err := o.writer.Write(p)
+	if err == nil && o.lineBuffered && bytes.IndexByte(p, '\n') >= 0 {
+		err = o.writer.Flush()
+	}
+	return n, err
+}
+
+func (o *BufferedOutput) Flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.writer.Flush()
+}
+
+// Before returns a writer that flushes the buffer before each write to w
+func (o *BufferedOutput) Before(w io.Writer) io.Writer {
+	return flushingWriter{output: o, writer: w}
+}
+
+type flushingWriter struct {
+	output *BufferedOutput
+	writer io.Writer
+}
+
+func (w flushingWriter) Write(p []byte) (int, error) {
+	w.output.Flush()
+	return w.writer.Write(p)
+}
+
+// flushOutput flushes print's output if it is buffered
+func (interpreter *Interpreter) flushOutput() error {
+	if flusher, isFlusher := interpreter.output.(interface{ Flush() error }); isFlusher {
+		return flusher.Flush()
+	}
+	return nil
+}
@@ -2,7 +2,11 @@ package lang
 
 import (
 	"errors"
-	"os"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/skusel/glox/diag"
 )
 
 /******************************************************************************
@@ -20,9 +24,12 @@ import (
  * program     -> statement* EOF ;
  * declaration -> classDecl
  *              | funDecl
+ *              | importDecl
  *              | varDecl
  *              | statement ;
  * statement   -> exprStmt
+ *              | breakStmt
+ *              | continueStmt
  *              | forStmt
  *              | ifStmt
  *              | printStmt
@@ -30,13 +37,21 @@ import (
  *              | whileStmt
  *              | block ;
  * exprStmt    -> expression ";" ;
+ * breakStmt   -> "break" ";" ;
+ * continueStmt -> "continue" ";" ;
  * forStmt     -> "for" "(" ( varDecl | exprStmt | ";" )
  *                expression? ";"
- *                expression? ")" statement ;
- * classDecl   -> "class" IDENTIFIER ( "<" IDENTIFIER )? "{" function* "}" ;
+ *                expression? ")" statement
+ *              | "for" "(" "var" IDENTIFIER "in" expression ")" statement ;
+ * classDecl   -> "class" IDENTIFIER ( "<" IDENTIFIER )?
+ *                ( "with" IDENTIFIER ( "," IDENTIFIER )* )? "{" function* "}" ;
+ * traitDecl   -> "trait" IDENTIFIER "{" function* "}" ;
  * funDecl     -> "fun" function ;
- * function    -> IDENTIFIER "(" parameters? ")" block ;
- * parameters  -> IDENTIFIER ( "," IDENTIFIER )* ;
+ * importDecl  -> "import" STRING ( "as" IDENTIFIER )? ";" ;
+ * function    -> IDENTIFIER functionBody ;
+ * functionBody -> "(" parameters? ")" block ;
+ * parameters  -> "..." IDENTIFIER
+ *              | IDENTIFIER ( "," IDENTIFIER )* ( "," "..." IDENTIFIER )? ;
  * ifStmt      -> "if" "(" expression ")" statement ( "else" statement )? ;
  * printStmt   -> "print" expression ";" ;
  * returnStmt  -> "return" expression? ";" ;
@@ -44,7 +59,9 @@ import (
  * block       -> "{" + declaration* + "}" ;
  * varDecl     -> "var" IDENTIFIER ( "=" expression )? ";" ;
  * expression  -> assignment ;
- * assignment  -> ( call "." )? IDENTIFIER "=" assignment | logic_or ;
+ * assignment  -> ( call "." )? IDENTIFIER "=" assignment
+ *              | call "[" expression "]" "=" assignment
+ *              | logic_or ;
  * logic_or    -> logic_and ( "or" logic_and )* ;
  * logic_and   -> equality ( "and" equality )* ;
  * equality    -> comparison ( ("!=" | "==") comparision)* ;
@@ -52,25 +69,66 @@ import (
  * term        -> factor ( ( "-" | "+" ) factor )* ;
  * factor      -> unary ( ( "/" | "*") unary )* ;
  * unary       -> ( "!" | "-" ) unary | call ;
- * call        -> primary ( "(" arguments? ")" | "." IDENTIFIER )* ;
- * arguments   -> expression ( "," expression )* ;
+ * call        -> primary ( "(" arguments? ")" | "." IDENTIFIER | "[" expression "]" )* ;
+ * arguments   -> expression ( "," expression )* ( "," named )*
+ *              | named ( "," named )* ;
+ * named       -> IDENTIFIER ":" expression ;
  * primary     -> "true" | "false" | "nil"
  *              | NUMBER | STRING
  *			    | "(" expression ")"
- *              | IDENTIFIER | "super" . IDENTIFIER ;
+ *              | "[" arguments? "]"
+ *              | "{" ( entry ( "," entry )* )? "}"
+ *              | IDENTIFIER | "super" . IDENTIFIER
+ *              | "fun" functionBody ;
+ * entry       -> expression ":" expression ;
  *****************************************************************************/
 
 type Parser struct {
 	tokens       []Token
 	current      int
 	nextExprId   int
+	depth        int
+	errorAtEnd   bool // whether an error was reported because the tokens ran out
+	replMode     bool
+	partialMode  bool
+	blocks       int // how many blocks the parser is inside of
 	errorHandler *ErrorHandler
 }
 
+// deeper nesting is rejected before recursing into it could exhaust the Go stack
+const maxNestingDepth = 1000
+
 func NewParser(tokens []Token, errorHandler *ErrorHandler) *Parser {
 	return &Parser{tokens: tokens, current: 0, errorHandler: errorHandler}
 }
 
+/******************************************************************************
+ * SetREPLMode makes the parser accept input the way a REPL does. An
+ * expression at the very end of the input may leave off its ';', and is
+ * parsed as a print statement so its value is shown.
+ *****************************************************************************/
+
+func (p *Parser) SetREPLMode(replMode bool) {
+	p.replMode = replMode
+}
+
+/******************************************************************************
+ * SetPartialMode makes the parser recover from syntax errors with tools like
+ * an editor in mind rather than a person reading error output. A declaration
+ * with a syntax error always becomes an ErrorStmt holding the tokens skipped
+ * over, so the rest of the file still has a tree the resolver can check. By
+ * default the parser skips ahead the way jlox does, which keeps its error
+ * output the same as the reference implementation's. In partial mode it also
+ * skips the rest of any block the broken declaration opened, and stops at
+ * the '}' ending the block it is in, so the statements around the error keep
+ * the shape they were written with instead of leaking into the scope
+ * outside.
+ *****************************************************************************/
+
+func (p *Parser) SetPartialMode(partialMode bool) {
+	p.partialMode = partialMode
+}
+
 func (p *Parser) Parse() []Stmt {
 	statements := make([]Stmt, 0, 0)
 	for !p.isAtEnd() {
@@ -79,7 +137,39 @@ func (p *Parser) Parse() []Stmt {
 	return statements
 }
 
+/******************************************************************************
+ * ParseProgram scans and parses source for code that embeds the parser, like
+ * a language server, and can't have a bad file bring the process down.
+ * Nothing is printed and no panic gets out: syntax errors come back as
+ * diagnostics along with the partial tree (see SetPartialMode), and if a bug
+ * in the scanner or parser panics, the panic is returned as an
+ * InternalParserError diagnostic instead, with no statements.
+ *****************************************************************************/
+
+func ParseProgram(source string) (statements []Stmt, diagnostics []diag.Diagnostic) {
+	errorHandler := silentErrorHandler()
+	var parser *Parser
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			line := 0
+			if parser != nil {
+				line = parser.peek().line
+			}
+			statements = nil
+			diagnostics = append(errorHandler.Diagnostics, diag.Diagnostic{Code: diag.InternalParserError,
+				Severity: diag.SeverityError, Line: line, Message: fmt.Sprintf("Internal parser error: %v", recovered)})
+		}
+	}()
+
+	parser = NewParser(NewScanner(source, errorHandler).ScanTokens(), errorHandler)
+	parser.SetPartialMode(true)
+	statements = parser.Parse()
+	return statements, errorHandler.Diagnostics
+}
+
 func (p *Parser) declaration() (stmt Stmt) {
+	start := p.current
 	defer func() {
 		/**********************************************************************
 		 * Recover from a static error if one occurred. ErrorHandler "panics"
@@ -90,22 +180,33 @@ func (p *Parser) declaration() (stmt Stmt) {
 		 *********************************************************************/
 		err := recover()
 		if err != nil {
-			staticError, isStaticError := err.(staticError)
+			_, isStaticError := err.(staticError)
 			if isStaticError {
-				os.Stderr.WriteString(staticError.msg)
-				p.synchronize()
-				stmt = nil
+				// the error handler has already reported the error
+				p.synchronize(start)
+				stmt = p.errorStatement(start)
 			} else {
 				// this is not a panic thrown by us - pass it on
 				panic(err)
 			}
 		}
 	}()
+	defer p.nest()()
 
 	if p.match(tokenTypeClass) {
 		stmt = p.classDeclaration()
-	} else if p.match(tokenTypeFun) {
-		stmt = p.function("function")
+	} else if p.check(tokenTypeIdentifier) && p.peek().lexeme == "trait" && p.checkNext(tokenTypeIdentifier) {
+		// "trait" is only a keyword at the start of a declaration, so it can still name variables
+		p.advance()
+		stmt = p.traitDeclaration()
+	} else if p.check(tokenTypeFun) && p.checkNext(tokenTypeIdentifier) {
+		// "fun" without a name starts an expression statement with an anonymous function
+		keyword := p.advance()
+		function := p.function("function")
+		function.span.Start = keyword.span.Start // function() starts its span at the name
+		stmt = function
+	} else if p.match(tokenTypeImport) {
+		stmt = p.importDeclaration()
 	} else if p.match(tokenTypeVar) {
 		stmt = p.varDeclaration()
 	} else {
@@ -115,42 +216,108 @@ func (p *Parser) declaration() (stmt Stmt) {
 }
 
 func (p *Parser) classDeclaration() Stmt {
+	start := p.previous()
 	name := p.consume(tokenTypeIdentifier, "Expect class name.")
 	var superclass VariableExpr
 	if p.match(tokenTypeLess) {
 		p.consume(tokenTypeIdentifier, "Expect superclass name.")
-		superclass = VariableExpr{id: p.getNextExprId(), name: p.previous()}
+		superclass = VariableExpr{id: p.getNextExprId(), span: p.previous().span, name: p.previous()}
+	}
+	traits := make([]Expr, 0, 0)
+	if p.check(tokenTypeIdentifier) && p.peek().lexeme == "with" {
+		p.advance()
+		for {
+			trait := p.consume(tokenTypeIdentifier, "Expect trait name.")
+			traits = append(traits, VariableExpr{id: p.getNextExprId(), span: trait.span, name: trait})
+			if !p.match(tokenTypeComma) {
+				break
+			}
+		}
 	}
 	p.consume(tokenTypeLeftBrace, "Expect '{' before class body.")
+	methods := p.methods("class")
+	return ClassStmt{span: p.spanFrom(start), name: name, superclass: superclass, traits: traits, methods: methods}
+}
+
+func (p *Parser) traitDeclaration() Stmt {
+	start := p.previous()
+	name := p.consume(tokenTypeIdentifier, "Expect trait name.")
+	p.consume(tokenTypeLeftBrace, "Expect '{' before trait body.")
+	methods := p.methods("trait")
+	return TraitStmt{span: p.spanFrom(start), name: name, methods: methods}
+}
+
+// methods parses the methods of a class or trait body up to and including its closing '}'
+func (p *Parser) methods(kind string) []FunctionStmt {
 	methods := make([]FunctionStmt, 0, 0)
 	for !p.check(tokenTypeRightBrace) && !p.isAtEnd() {
 		methods = append(methods, p.function("method"))
 	}
-	p.consume(tokenTypeRightBrace, "Expect '}' after class body.")
-	return ClassStmt{name: name, superclass: superclass, methods: methods}
+	p.consume(tokenTypeRightBrace, "Expect '}' after "+kind+" body.")
+	return methods
 }
 
 func (p *Parser) function(kind string) FunctionStmt {
+	start := p.peek()
 	name := p.consume(tokenTypeIdentifier, "Expect "+kind+" name.")
+	if kind == "method" && p.match(tokenTypeLeftBrace) {
+		// a method without a parameter list is a getter
+		body := p.blockStatement()
+		return FunctionStmt{span: p.spanFrom(start), name: name, params: []Token{}, body: body, isGetter: true}
+	}
+	params, variadic, body := p.functionBody(kind)
+	return FunctionStmt{span: p.spanFrom(start), name: name, params: params, body: body, variadic: variadic}
+}
+
+// functionBody parses the parameter list and body shared by named and anonymous functions
+func (p *Parser) functionBody(kind string) ([]Token, bool, []Stmt) {
 	p.consume(tokenTypeLeftParen, "Expect '(' after "+kind+" name.")
 	params := make([]Token, 0, 0)
+	variadic := false
 	if !p.check(tokenTypeRightParen) {
-		params = append(params, p.consume(tokenTypeIdentifier, "Expect parameter name."))
-		for p.match(tokenTypeComma) {
+		for {
 			if len(params) >= 255 {
-				p.createError(p.peek(), "Can't have more than 255 parameters.", false) // don't need to sync
+				p.createError(p.peek(), diag.TooManyParameters, "Can't have more than 255 parameters.", false) // don't need to sync
 			}
+			// a rest parameter collects the extra arguments into a list, so it has to come last
+			variadic = p.match(tokenTypeDotDotDot)
 			params = append(params, p.consume(tokenTypeIdentifier, "Expect parameter name."))
+			if variadic || !p.match(tokenTypeComma) {
+				break
+			}
 		}
 	}
-	p.consume(tokenTypeRightParen, "Expect ')' after parameters.")
+	if variadic {
+		p.consume(tokenTypeRightParen, "Expect ')' after rest parameter.")
+	} else {
+		p.consume(tokenTypeRightParen, "Expect ')' after parameters.")
+	}
 	// blockStatement expects '{' has already been matched
 	p.consume(tokenTypeLeftBrace, "Expect '{' before "+kind+" body.")
-	body := p.blockStatement()
-	return FunctionStmt{name: name, params: params, body: body}
+	return params, variadic, p.blockStatement()
+}
+
+func (p *Parser) importDeclaration() Stmt {
+	keyword := p.previous()
+	path := p.consume(tokenTypeString, "Expect module path after 'import'.")
+	var name Token
+	if p.check(tokenTypeIdentifier) && p.peek().lexeme == "as" {
+		p.advance()
+		name = p.consume(tokenTypeIdentifier, "Expect module name after 'as'.")
+	} else {
+		// without "as" the module is bound to its file name, e.g. "lib/strings.lox" to strings
+		base := strings.TrimSuffix(filepath.Base(path.literal.(string)), filepath.Ext(path.literal.(string)))
+		if !isIdentifier(base) {
+			p.createError(path, diag.ExpectedToken, "Expect 'as' and a name for the module.", true)
+		}
+		name = Token{tokenType: tokenTypeIdentifier, lexeme: base, literal: base, line: path.line, span: path.span}
+	}
+	p.consume(tokenTypeSemicolon, "Expect ';' after import.")
+	return ImportStmt{span: p.spanFrom(keyword), keyword: keyword, path: path, name: name}
 }
 
 func (p *Parser) varDeclaration() Stmt {
+	start := p.previous()
 	name := p.consume(tokenTypeIdentifier, "Expect variable name.")
 	var initializer Expr
 	if p.match(tokenTypeEqual) {
@@ -159,11 +326,16 @@ func (p *Parser) varDeclaration() Stmt {
 		initializer = nil
 	}
 	p.consume(tokenTypeSemicolon, "Expect ';' after variable declaration.")
-	return VarStmt{name: name, initializer: initializer}
+	return VarStmt{span: p.spanFrom(start), name: name, initializer: initializer}
 }
 
 func (p *Parser) statement() Stmt {
-	if p.match(tokenTypeFor) {
+	defer p.nest()()
+	if p.match(tokenTypeBreak) {
+		return p.breakStatement()
+	} else if p.match(tokenTypeContinue) {
+		return p.continueStatement()
+	} else if p.match(tokenTypeFor) {
 		return p.forStatement()
 	} else if p.match(tokenTypeIf) {
 		return p.ifStatement()
@@ -174,21 +346,46 @@ func (p *Parser) statement() Stmt {
 	} else if p.match(tokenTypeWhile) {
 		return p.whileStatment()
 	} else if p.match(tokenTypeLeftBrace) {
-		return BlockStmt{statements: p.blockStatement()}
+		start := p.previous()
+		statements := p.blockStatement()
+		return BlockStmt{span: p.spanFrom(start), statements: statements}
 	} else {
 		return p.expressionStatment()
 	}
 }
 
 func (p *Parser) expressionStatment() Stmt {
+	start := p.peek()
 	expr := p.expression()
+	if p.replMode && p.isAtEnd() {
+		// a REPL prints the value of an expression typed without a ';'
+		return PrintStmt{span: p.spanFrom(start), expr: expr}
+	}
 	p.consume(tokenTypeSemicolon, "Expect ';' after expression.")
-	return ExprStmt{expr: expr}
+	return ExprStmt{span: p.spanFrom(start), expr: expr}
+}
+
+func (p *Parser) breakStatement() Stmt {
+	keyword := p.previous()
+	p.consume(tokenTypeSemicolon, "Expect ';' after 'break'.")
+	return BreakStmt{span: p.spanFrom(keyword), keyword: keyword}
+}
+
+func (p *Parser) continueStatement() Stmt {
+	keyword := p.previous()
+	p.consume(tokenTypeSemicolon, "Expect ';' after 'continue'.")
+	return ContinueStmt{span: p.spanFrom(keyword), keyword: keyword}
 }
 
 func (p *Parser) forStatement() Stmt {
 	// desugar for statements into while statements
+	start := p.previous()
 	p.consume(tokenTypeLeftParen, "Expect '(' after 'for'.")
+	// "in" is only a keyword right after the loop variable, so it can still name variables
+	if p.check(tokenTypeVar) && p.checkNext(tokenTypeIdentifier) && p.current+2 < len(p.tokens) &&
+		p.tokens[p.current+2].tokenType == tokenTypeIdentifier && p.tokens[p.current+2].lexeme == "in" {
+		return p.forEachStatement(start)
+	}
 	var initializer Stmt
 	if p.match(tokenTypeSemicolon) {
 		initializer = nil
@@ -201,29 +398,40 @@ func (p *Parser) forStatement() Stmt {
 	if !p.check(tokenTypeSemicolon) {
 		condition = p.expression()
 	}
-	p.consume(tokenTypeSemicolon, "Expect ';' after loop condition.")
+	conditionEnd := p.consume(tokenTypeSemicolon, "Expect ';' after loop condition.")
 	var increment Expr
-	if !p.check(tokenTypeSemicolon) {
+	if !p.check(tokenTypeRightParen) {
 		increment = p.expression()
 	}
 	p.consume(tokenTypeRightParen, "Expect ')' after for clauses.")
 	body := p.statement()
-	if increment != nil {
-		statements := []Stmt{body, ExprStmt{expr: increment}}
-		body = BlockStmt{statements: statements}
-	}
+	span := p.spanFrom(start)
 	if condition == nil {
-		condition = LiteralExpr{id: p.getNextExprId(), value: true}
+		// an omitted condition sits right before the ';' that ends it
+		emptySpan := Span{Start: conditionEnd.span.Start, End: conditionEnd.span.Start, source: conditionEnd.span.source}
+		condition = LiteralExpr{id: p.getNextExprId(), span: emptySpan, value: true}
 	}
-	body = WhileStmt{condition: condition, body: body}
+	// the increment runs after every iteration, including ones cut short by continue
+	body = WhileStmt{span: span, condition: condition, body: body, increment: increment}
 	if initializer != nil {
 		statements := []Stmt{initializer, body}
-		body = BlockStmt{statements: statements}
+		body = BlockStmt{span: span, statements: statements}
 	}
 	return body
 }
 
+func (p *Parser) forEachStatement(start Token) Stmt {
+	p.advance() // var
+	name := p.advance()
+	p.advance() // in
+	collection := p.expression()
+	p.consume(tokenTypeRightParen, "Expect ')' after loop collection.")
+	body := p.statement()
+	return ForEachStmt{span: p.spanFrom(start), keyword: start, name: name, collection: collection, body: body}
+}
+
 func (p *Parser) ifStatement() Stmt {
+	start := p.previous()
 	p.consume(tokenTypeLeftParen, "Expect '(' after 'if'.")
 	condition := p.expression()
 	p.consume(tokenTypeRightParen, "Expect ')' after if condition")
@@ -232,13 +440,14 @@ func (p *Parser) ifStatement() Stmt {
 	if p.match(tokenTypeElse) {
 		elseBranch = p.statement()
 	}
-	return IfStmt{condition: condition, thenBranch: thenBranch, elseBranch: elseBranch}
+	return IfStmt{span: p.spanFrom(start), condition: condition, thenBranch: thenBranch, elseBranch: elseBranch}
 }
 
 func (p *Parser) printStatement() Stmt {
+	start := p.previous()
 	value := p.expression()
 	p.consume(tokenTypeSemicolon, "Expect ';' after value.")
-	return PrintStmt{expr: value}
+	return PrintStmt{span: p.spanFrom(start), expr: value}
 }
 
 func (p *Parser) returnStatement() Stmt {
@@ -248,18 +457,21 @@ func (p *Parser) returnStatement() Stmt {
 		value = p.expression()
 	}
 	p.consume(tokenTypeSemicolon, "Expect ';' after return value.")
-	return ReturnStmt{keyword: keyword, value: value}
+	return ReturnStmt{span: p.spanFrom(keyword), keyword: keyword, value: value}
 }
 
 func (p *Parser) whileStatment() Stmt {
+	start := p.previous()
 	p.consume(tokenTypeLeftParen, "Expect '(' after 'while'.")
 	condition := p.expression()
 	p.consume(tokenTypeRightParen, "Expect ')' after while condition")
 	body := p.statement()
-	return WhileStmt{condition: condition, body: body}
+	return WhileStmt{span: p.spanFrom(start), condition: condition, body: body}
 }
 
 func (p *Parser) blockStatement() []Stmt {
+	p.blocks++
+	defer func() { p.blocks-- }()
 	statements := make([]Stmt, 0, 0)
 	for !p.check(tokenTypeRightBrace) && !p.isAtEnd() {
 		statements = append(statements, p.declaration())
@@ -273,20 +485,41 @@ func (p *Parser) expression() Expr {
 }
 
 func (p *Parser) assignment() Expr {
-	expr := p.or()
+	defer p.nest()()
+	expr := p.conditional()
 	if p.match(tokenTypeEqual) {
 		equals := p.previous()
 		value := p.assignment()
 
+		span := joinSpans(expr.Span(), value.Span())
 		variableExpr, isVariableExpr := expr.(VariableExpr)
 		if isVariableExpr {
-			return AssignExpr{id: p.getNextExprId(), name: variableExpr.name, value: value}
+			return AssignExpr{id: p.getNextExprId(), span: span, name: variableExpr.name, value: value}
 		}
 		getExpr, isGetExpr := expr.(GetExpr)
 		if isGetExpr {
-			return SetExpr{id: p.getNextExprId(), object: getExpr.object, name: getExpr.name, value: value}
+			return SetExpr{id: p.getNextExprId(), span: span, object: getExpr.object, name: getExpr.name,
+				value: value}
 		}
-		p.createError(equals, "Invalid assignment target.", false) // don't need to sync
+		subscriptExpr, isSubscriptExpr := expr.(SubscriptExpr)
+		if isSubscriptExpr {
+			return SubscriptSetExpr{id: p.getNextExprId(), span: span, object: subscriptExpr.object,
+				bracket: subscriptExpr.bracket, index: subscriptExpr.index, value: value}
+		}
+		p.createError(equals, diag.InvalidAssignmentTarget, "Invalid assignment target.", false) // don't need to sync
+	}
+	return expr
+}
+
+func (p *Parser) conditional() Expr {
+	expr := p.or()
+	if p.match(tokenTypeQuestion) {
+		thenBranch := p.expression()
+		p.consume(tokenTypeColon, "Expect ':' after then branch of conditional expression.")
+		// right associative, so a ? b : c ? d : e groups as a ? b : (c ? d : e)
+		elseBranch := p.conditional()
+		return ConditionalExpr{id: p.getNextExprId(), span: joinSpans(expr.Span(), elseBranch.Span()), condition: expr,
+			thenBranch: thenBranch, elseBranch: elseBranch}
 	}
 	return expr
 }
@@ -296,7 +529,8 @@ func (p *Parser) or() Expr {
 	for p.match(tokenTypeOr) {
 		operator := p.previous()
 		right := p.and()
-		expr = LogicalExpr{id: p.getNextExprId(), left: expr, operator: operator, right: right}
+		expr = LogicalExpr{id: p.getNextExprId(), span: joinSpans(expr.Span(), right.Span()), left: expr,
+			operator: operator, right: right}
 	}
 	return expr
 }
@@ -306,7 +540,8 @@ func (p *Parser) and() Expr {
 	for p.match(tokenTypeAnd) {
 		operator := p.previous()
 		right := p.equality()
-		expr = LogicalExpr{id: p.getNextExprId(), left: expr, operator: operator, right: right}
+		expr = LogicalExpr{id: p.getNextExprId(), span: joinSpans(expr.Span(), right.Span()), left: expr,
+			operator: operator, right: right}
 	}
 	return expr
 }
@@ -316,17 +551,53 @@ func (p *Parser) equality() Expr {
 	for p.match(tokenTypeBangEqual, tokenTypeEqualEqual) {
 		operator := p.previous()
 		right := p.comparison()
-		expr = BinaryExpr{id: p.getNextExprId(), left: expr, operator: operator, right: right}
+		expr = BinaryExpr{id: p.getNextExprId(), span: joinSpans(expr.Span(), right.Span()), left: expr,
+			operator: operator, right: right}
 	}
 	return expr
 }
 
 func (p *Parser) comparison() Expr {
-	expr := p.term()
+	expr := p.bitwiseOr()
 	for p.match(tokenTypeGreater, tokenTypeGreaterEqual, tokenTypeLess, tokenTypeLessEqual) {
 		operator := p.previous()
-		right := p.term()
-		expr = BinaryExpr{id: p.getNextExprId(), left: expr, operator: operator, right: right}
+		right := p.bitwiseOr()
+		expr = BinaryExpr{id: p.getNextExprId(), span: joinSpans(expr.Span(), right.Span()), left: expr,
+			operator: operator, right: right}
+	}
+	return expr
+}
+
+/******************************************************************************
+ * The bitwise operators bind tighter than comparisons, unlike in C, so
+ * "flags & mask == 0" tests the masked bits the way it reads. From loosest
+ * to tightest they go |, ^, &, then the shifts, all above + and -.
+ *****************************************************************************/
+
+func (p *Parser) bitwiseOr() Expr {
+	return p.binaryLevel(p.bitwiseXor, tokenTypePipe)
+}
+
+func (p *Parser) bitwiseXor() Expr {
+	return p.binaryLevel(p.bitwiseAnd, tokenTypeCaret)
+}
+
+func (p *Parser) bitwiseAnd() Expr {
+	return p.binaryLevel(p.shift, tokenTypeAmpersand)
+}
+
+func (p *Parser) shift() Expr {
+	return p.binaryLevel(p.term, tokenTypeLessLess, tokenTypeGreaterGreater)
+}
+
+// binaryLevel parses a left associative chain of operands joined by any of the operators
+func (p *Parser) binaryLevel(operand func() Expr, operators ...TokenType) Expr {
+	expr := operand()
+	for p.match(operators...) {
+		operator := p.previous()
+		right := operand()
+		expr = BinaryExpr{id: p.getNextExprId(), span: joinSpans(expr.Span(), right.Span()), left: expr,
+			operator: operator, right: right}
 	}
 	return expr
 }
@@ -336,7 +607,8 @@ func (p *Parser) term() Expr {
 	for p.match(tokenTypeMinus, tokenTypePlus) {
 		operator := p.previous()
 		right := p.factor()
-		expr = BinaryExpr{id: p.getNextExprId(), left: expr, operator: operator, right: right}
+		expr = BinaryExpr{id: p.getNextExprId(), span: joinSpans(expr.Span(), right.Span()), left: expr,
+			operator: operator, right: right}
 	}
 	return expr
 }
@@ -346,16 +618,19 @@ func (p *Parser) factor() Expr {
 	for p.match(tokenTypeSlash, tokenTypeStar, tokenTypeMod) {
 		operator := p.previous()
 		right := p.unary()
-		expr = BinaryExpr{id: p.getNextExprId(), left: expr, operator: operator, right: right}
+		expr = BinaryExpr{id: p.getNextExprId(), span: joinSpans(expr.Span(), right.Span()), left: expr,
+			operator: operator, right: right}
 	}
 	return expr
 }
 
 func (p *Parser) unary() Expr {
 	if p.match(tokenTypeBang, tokenTypeMinus) {
+		defer p.nest()()
 		operator := p.previous()
-		right := p.primary()
-		return UnaryExpr{id: p.getNextExprId(), operator: operator, right: right}
+		right := p.unary()
+		return UnaryExpr{id: p.getNextExprId(), span: joinSpans(operator.span, right.Span()), operator: operator,
+			right: right}
 	}
 	return p.call()
 }
@@ -368,7 +643,13 @@ func (p *Parser) call() Expr {
 			expr = p.finishCall(expr)
 		} else if p.match(tokenTypeDot) {
 			name := p.consume(tokenTypeIdentifier, "Expect property name after '.'.")
-			expr = GetExpr{id: p.getNextExprId(), object: expr, name: name}
+			expr = GetExpr{id: p.getNextExprId(), span: joinSpans(expr.Span(), name.span), object: expr, name: name}
+		} else if p.match(tokenTypeLeftBracket) {
+			bracket := p.previous()
+			index := p.expression()
+			end := p.consume(tokenTypeRightBracket, "Expect ']' after index.")
+			expr = SubscriptExpr{id: p.getNextExprId(), span: joinSpans(expr.Span(), end.span), object: expr,
+				bracket: bracket, index: index}
 		} else {
 			break
 		}
@@ -379,46 +660,101 @@ func (p *Parser) call() Expr {
 
 func (p *Parser) finishCall(callee Expr) Expr {
 	args := make([]Expr, 0, 0)
+	names := make([]Token, 0, 0)
 	if !p.check(tokenTypeRightParen) {
-		args = append(args, p.expression())
-		for p.match(tokenTypeComma) {
+		for {
 			if len(args) >= 255 {
-				p.createError(p.peek(), "Can't have more than 255 arguments.", false) // don't need to sync
+				p.createError(p.peek(), diag.TooManyArguments, "Can't have more than 255 arguments.", false) // don't need to sync
+			}
+			if p.check(tokenTypeIdentifier) && p.checkNext(tokenTypeColon) {
+				names = append(names, p.advance())
+				p.advance()
+			} else if len(names) > 0 {
+				p.createError(p.peek(), diag.PositionalAfterNamed, "Expect named argument after named arguments.",
+					false) // don't need to sync
 			}
 			args = append(args, p.expression())
+			if !p.match(tokenTypeComma) {
+				break
+			}
 		}
 	}
 	paren := p.consume(tokenTypeRightParen, "Expect ')' after arguments.")
-	return CallExpr{id: p.getNextExprId(), callee: callee, paren: paren, args: args}
+	return CallExpr{id: p.getNextExprId(), span: joinSpans(callee.Span(), paren.span), callee: callee, paren: paren,
+		args: args, names: names}
 }
 
 func (p *Parser) primary() Expr {
 	if p.match(tokenTypeFalse) {
-		return LiteralExpr{id: p.getNextExprId(), value: false}
+		return LiteralExpr{id: p.getNextExprId(), span: p.previous().span, value: false}
 	} else if p.match(tokenTypeTrue) {
-		return LiteralExpr{id: p.getNextExprId(), value: true}
+		return LiteralExpr{id: p.getNextExprId(), span: p.previous().span, value: true}
 	} else if p.match(tokenTypeNil) {
-		return LiteralExpr{id: p.getNextExprId(), value: nil}
+		return LiteralExpr{id: p.getNextExprId(), span: p.previous().span, value: nil}
 	} else if p.match(tokenTypeNumber, tokenTypeString) {
-		return LiteralExpr{id: p.getNextExprId(), value: p.previous().literal}
+		return LiteralExpr{id: p.getNextExprId(), span: p.previous().span, value: p.previous().literal}
 	} else if p.match(tokenTypeSuper) {
 		keyword := p.previous()
 		p.consume(tokenTypeDot, "Expect '.' after 'super'.")
 		method := p.consume(tokenTypeIdentifier, "Expect superclass method name.")
-		return SuperExpr{id: p.getNextExprId(), keyword: keyword, method: method}
+		return SuperExpr{id: p.getNextExprId(), span: p.spanFrom(keyword), keyword: keyword, method: method}
+	} else if p.match(tokenTypeFun) {
+		keyword := p.previous()
+		params, variadic, body := p.functionBody("function")
+		return FunctionExpr{id: p.getNextExprId(), span: p.spanFrom(keyword), keyword: keyword, params: params,
+			body: body, variadic: variadic}
 	} else if p.match(tokenTypeThis) {
-		return ThisExpr{id: p.getNextExprId(), keyword: p.previous()}
+		return ThisExpr{id: p.getNextExprId(), span: p.previous().span, keyword: p.previous()}
 	} else if p.match(tokenTypeIdentifier) {
-		return VariableExpr{id: p.getNextExprId(), name: p.previous()}
+		return VariableExpr{id: p.getNextExprId(), span: p.previous().span, name: p.previous()}
 	} else if p.match(tokenTypeLeftParen) {
+		start := p.previous()
 		expr := p.expression()
 		p.consume(tokenTypeRightParen, "Expect ')' after expression.")
-		return GroupingExpr{id: p.getNextExprId(), expression: expr}
+		return GroupingExpr{id: p.getNextExprId(), span: p.spanFrom(start), expression: expr}
+	} else if p.match(tokenTypeLeftBracket) {
+		bracket := p.previous()
+		elements := make([]Expr, 0)
+		if !p.check(tokenTypeRightBracket) {
+			elements = append(elements, p.expression())
+			for p.match(tokenTypeComma) {
+				elements = append(elements, p.expression())
+			}
+		}
+		p.consume(tokenTypeRightBracket, "Expect ']' after list elements.")
+		return ListExpr{id: p.getNextExprId(), span: p.spanFrom(bracket), bracket: bracket, elements: elements}
+	} else if p.match(tokenTypeLeftBrace) {
+		// blocks are statements, so a brace in an expression always starts a map
+		brace := p.previous()
+		keys := make([]Expr, 0)
+		values := make([]Expr, 0)
+		if !p.check(tokenTypeRightBrace) {
+			for {
+				keys = append(keys, p.expression())
+				p.consume(tokenTypeColon, "Expect ':' after map key.")
+				values = append(values, p.expression())
+				if !p.match(tokenTypeComma) {
+					break
+				}
+			}
+		}
+		p.consume(tokenTypeRightBrace, "Expect '}' after map entries.")
+		return MapExpr{id: p.getNextExprId(), span: p.spanFrom(brace), brace: brace, keys: keys, values: values}
 	}
-	p.createError(p.peek(), "Expect expression.", true)
+	p.createError(p.peek(), diag.ExpectedExpression, "Expect expression.", true)
 	return nil
 }
 
+// nest enters one more level of nesting and returns the function that leaves it again
+func (p *Parser) nest() func() {
+	p.depth++
+	if p.depth > maxNestingDepth {
+		p.depth--
+		p.createError(p.peek(), diag.TooDeeplyNested, "Too much nesting.", true)
+	}
+	return func() { p.depth-- }
+}
+
 func (p *Parser) match(tokenTypes ...TokenType) bool {
 	for _, tokenType := range tokenTypes {
 		if p.check(tokenType) {
@@ -433,7 +769,7 @@ func (p *Parser) consume(tokenType TokenType, msg string) Token {
 	if p.check(tokenType) {
 		return p.advance()
 	}
-	p.createError(p.peek(), msg, true)
+	p.createError(p.peek(), diag.ExpectedToken, msg, true)
 	return p.peek()
 }
 
@@ -444,6 +780,13 @@ func (p *Parser) check(tokenType TokenType) bool {
 	return p.peek().tokenType == tokenType
 }
 
+func (p *Parser) checkNext(tokenType TokenType) bool {
+	if p.isAtEnd() {
+		return false
+	}
+	return p.tokens[p.current+1].tokenType == tokenType
+}
+
 func (p *Parser) advance() Token {
 	if !p.isAtEnd() {
 		p.current++
@@ -463,16 +806,77 @@ func (p *Parser) previous() Token {
 	return p.tokens[p.current-1]
 }
 
+func (p *Parser) spanFrom(start Token) Span {
+	// spans the tokens from start up to and including the last consumed token
+	return joinSpans(start.span, p.previous().span)
+}
+
 func (p *Parser) getNextExprId() int {
 	p.nextExprId++
 	return p.nextExprId
 }
 
-func (p *Parser) createError(token Token, msg string, synchronize bool) {
-	p.errorHandler.reportStaticError(token.line, token.lexeme, errors.New(msg), synchronize)
+func (p *Parser) createError(token Token, code diag.Code, msg string, synchronize bool) {
+	if token.tokenType == tokenTypeEndOfFile {
+		p.errorAtEnd = true
+	}
+	p.errorHandler.reportStaticErrorAt(code, token, errors.New(msg), synchronize)
+}
+
+// errorStatement is the placeholder for a declaration that started at start and had a syntax error
+func (p *Parser) errorStatement(start int) ErrorStmt {
+	tokens := p.tokens[start:p.current]
+	if len(tokens) == 0 {
+		return ErrorStmt{span: p.peek().span, tokens: tokens}
+	}
+	return ErrorStmt{span: joinSpans(tokens[0].span, tokens[len(tokens)-1].span), tokens: tokens}
 }
 
-func (p *Parser) synchronize() {
+/******************************************************************************
+ * declaredName returns the name a broken declaration was going to declare,
+ * if it got as far as the name. The resolver still declares it so uses of
+ * the name further on resolve the same way they would have.
+ *****************************************************************************/
+
+func (stmt ErrorStmt) declaredName() (Token, string, bool) {
+	if len(stmt.tokens) < 2 || stmt.tokens[1].tokenType != tokenTypeIdentifier {
+		return Token{}, "", false
+	}
+	switch first := stmt.tokens[0]; {
+	case first.tokenType == tokenTypeVar:
+		return stmt.tokens[1], "variable", true
+	case first.tokenType == tokenTypeFun:
+		return stmt.tokens[1], "function", true
+	case first.tokenType == tokenTypeClass:
+		return stmt.tokens[1], "class", true
+	case first.tokenType == tokenTypeIdentifier && first.lexeme == "trait":
+		return stmt.tokens[1], "trait", true
+	}
+	return Token{}, "", false
+}
+
+func (p *Parser) synchronize(start int) {
+	if p.partialMode {
+		// the broken declaration ends with the blocks it opened, and their insides aren't declarations of their own
+		open := 0
+		for _, token := range p.tokens[start:p.current] {
+			if token.tokenType == tokenTypeLeftBrace {
+				open++
+			} else if token.tokenType == tokenTypeRightBrace && open > 0 {
+				open--
+			}
+		}
+		if open > 0 {
+			p.skipBraces(open)
+			p.match(tokenTypeSemicolon)
+			return
+		}
+		if p.check(tokenTypeRightBrace) && p.blocks > 0 {
+			// leave the '}' for the block the declaration is in
+			return
+		}
+	}
+
 	p.advance()
 
 	for !p.isAtEnd() {
@@ -481,8 +885,22 @@ func (p *Parser) synchronize() {
 		}
 
 		switch p.peek().tokenType {
+		case tokenTypeLeftBrace:
+			if p.partialMode {
+				p.advance()
+				p.skipBraces(1)
+				continue
+			}
+		case tokenTypeRightBrace:
+			if p.partialMode && p.blocks > 0 {
+				return
+			}
+		case tokenTypeBreak:
+			fallthrough
 		case tokenTypeClass:
 			fallthrough
+		case tokenTypeContinue:
+			fallthrough
 		case tokenTypeFor:
 			fallthrough
 		case tokenTypeFun:
@@ -502,3 +920,15 @@ func (p *Parser) synchronize() {
 		p.advance()
 	}
 }
+
+// skipBraces skips tokens until open more '}' than '{' have gone by
+func (p *Parser) skipBraces(open int) {
+	for open > 0 && !p.isAtEnd() {
+		switch p.advance().tokenType {
+		case tokenTypeLeftBrace:
+			open++
+		case tokenTypeRightBrace:
+			open--
+		}
+	}
+}
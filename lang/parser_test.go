@@ -0,0 +1,74 @@
+package lang
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/parse with what the parser gives now")
+
+/******************************************************************************
+ * TestParseGolden parses every testdata/parse/*.lox file and compares its
+ * tree, encoded with EncodeAST, to the .json file next to it. The decoded
+ * golden has to encode back to the same JSON too, so a change to either the
+ * parser or the encoding shows up as a failure. After a change that is
+ * meant, run "go test ./lang -run TestParseGolden -update" and review the
+ * diff of the goldens.
+ *****************************************************************************/
+
+func TestParseGolden(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "parse", "*.lox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no sources found in testdata/parse")
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			errorHandler := silentErrorHandler()
+			statements := NewParser(NewScanner(string(source), errorHandler).ScanTokens(), errorHandler).Parse()
+			if errorHandler.HadError {
+				t.Fatalf("parse error: %v", errorHandler.Diagnostics)
+			}
+			encoded, err := EncodeAST(statements)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded = append(encoded, '\n')
+			goldenPath := strings.TrimSuffix(path, ".lox") + ".json"
+			if *update {
+				if err := os.WriteFile(goldenPath, encoded, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			golden, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%v, run with -update to create it", err)
+			}
+			if !bytes.Equal(encoded, golden) {
+				t.Errorf("the tree doesn't match %s, run with -update if the change is meant:\n%s", goldenPath, encoded)
+			}
+			decoded, err := DecodeAST(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reencoded, err := EncodeAST(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(append(reencoded, '\n'), golden) {
+				t.Errorf("%s doesn't encode back to itself once decoded", goldenPath)
+			}
+		})
+	}
+}
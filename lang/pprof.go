@@ -0,0 +1,170 @@
+package lang
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sort"
+	"strings"
+)
+
+/******************************************************************************
+ * WritePprof writes a call profile in the format read by pprof, a gzipped
+ * protocol buffer (see profile.proto in github.com/google/pprof). There is a
+ * sample for each distinct chain of calls with two values, the number of
+ * calls made along it and the time spent at its end, so pprof can rebuild
+ * both the totals and the call graph:
+ *
+ *   go tool pprof -top profile.pb.gz
+ *   go tool pprof -http=: profile.pb.gz
+ *
+ * Each function becomes a single location, so pprof shows which functions
+ * called which but not from which line. pprof drops angle brackets from
+ * names, so <script> is written as script.
+ *****************************************************************************/
+
+// field numbers from profile.proto
+const (
+	pprofSampleType        = 1
+	pprofSample            = 2
+	pprofLocation          = 4
+	pprofFunction          = 5
+	pprofStringTable       = 6
+	pprofTimeNanos         = 9
+	pprofDurationNanos     = 10
+	pprofDefaultSampleType = 14
+
+	pprofValueTypeType = 1
+	pprofValueTypeUnit = 2
+
+	pprofSampleLocationId = 1
+	pprofSampleValue      = 2
+
+	pprofLocationId   = 1
+	pprofLocationLine = 4
+
+	pprofLineFunctionId = 1
+
+	pprofFunctionId         = 1
+	pprofFunctionName       = 2
+	pprofFunctionSystemName = 3
+	pprofFunctionFilename   = 4
+)
+
+func (profile *CallProfile) WritePprof(w io.Writer) error {
+	indexes := map[string]int{"": 0}
+	stringTable := []string{""}
+	index := func(str string) uint64 {
+		if i, seen := indexes[str]; seen {
+			return uint64(i)
+		}
+		indexes[str] = len(stringTable)
+		stringTable = append(stringTable, str)
+		return uint64(len(stringTable) - 1)
+	}
+
+	var out protoBuffer
+	for _, valueType := range [][2]string{{"calls", "count"}, {"wall", "nanoseconds"}} {
+		var message protoBuffer
+		message.uintField(pprofValueTypeType, index(valueType[0]))
+		message.uintField(pprofValueTypeUnit, index(valueType[1]))
+		out.bytesField(pprofSampleType, message.Bytes())
+	}
+
+	// functions are numbered from 1 in name order, each with a location of the same number
+	names := make([]string, 0, len(profile.functions))
+	for name := range profile.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ids := make(map[*profiledFunction]uint64)
+	for i, name := range names {
+		function := profile.functions[name]
+		id := uint64(i + 1)
+		ids[function] = id
+		var message protoBuffer
+		message.uintField(pprofFunctionId, id)
+		// pprof drops anything in angle brackets from a name, which would leave <script> with none
+		pprofName := strings.TrimSuffix(strings.TrimPrefix(name, "<"), ">")
+		message.uintField(pprofFunctionName, index(pprofName))
+		message.uintField(pprofFunctionSystemName, index(pprofName))
+		message.uintField(pprofFunctionFilename, index(function.file))
+		out.bytesField(pprofFunction, message.Bytes())
+
+		var line protoBuffer
+		line.uintField(pprofLineFunctionId, id)
+		message.Reset()
+		message.uintField(pprofLocationId, id)
+		message.bytesField(pprofLocationLine, line.Bytes())
+		out.bytesField(pprofLocation, message.Bytes())
+	}
+
+	keys := make([]string, 0, len(profile.stacks))
+	for key := range profile.stacks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		stack := profile.stacks[key]
+		var locations protoBuffer
+		for i := len(stack.functions) - 1; i >= 0; i-- {
+			// pprof lists locations innermost first
+			locations.varint(ids[stack.functions[i]])
+		}
+		var values protoBuffer
+		values.varint(uint64(stack.calls))
+		values.varint(uint64(stack.self.Nanoseconds()))
+		var message protoBuffer
+		message.bytesField(pprofSampleLocationId, locations.Bytes())
+		message.bytesField(pprofSampleValue, values.Bytes())
+		out.bytesField(pprofSample, message.Bytes())
+	}
+
+	if !profile.started.IsZero() {
+		out.uintField(pprofTimeNanos, uint64(profile.started.UnixNano()))
+	}
+	out.uintField(pprofDurationNanos, uint64(profile.elapsed.Nanoseconds()))
+	out.uintField(pprofDefaultSampleType, index("wall"))
+	for _, str := range stringTable {
+		out.bytesField(pprofStringTable, []byte(str))
+	}
+
+	compressed := gzip.NewWriter(w)
+	if _, err := compressed.Write(out.Bytes()); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+/******************************************************************************
+ * protoBuffer writes the parts of the protocol buffer wire format pprof
+ * uses: varints, and length delimited fields for strings, nested messages,
+ * and packed lists of varints.
+ *****************************************************************************/
+
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (b *protoBuffer) varint(value uint64) {
+	for value >= 0x80 {
+		b.WriteByte(byte(value) | 0x80)
+		value >>= 7
+	}
+	b.WriteByte(byte(value))
+}
+
+// uintField writes a varint field, leaving it out when it is 0 like protocol buffers do
+func (b *protoBuffer) uintField(field int, value uint64) {
+	if value == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(value)
+}
+
+func (b *protoBuffer) bytesField(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.Write(data)
+}
@@ -0,0 +1,93 @@
+package lang
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+/******************************************************************************
+ * The profiler samples the Lox call stack at a fixed interval while Run is
+ * executing. A timer asks for a sample the same way Cancel asks the program
+ * to stop, by raising the flag the interpreter checks before every
+ * statement, so the call stack is only ever read by the goroutine running
+ * the program. A sample is only taken once the statement that was running
+ * when the timer fired has finished, which can be a while for a long call to
+ * a native or when the timer itself ran late, so each sample counts once for
+ * every interval that has passed since the last one. That keeps the totals
+ * proportional to wall time.
+ *
+ * Samples are written in the folded stack format read by flamegraph.pl and
+ * speedscope, one line per distinct stack followed by how many samples saw
+ * it. Each frame is a Lox function and the line it was on, for example:
+ *
+ *     <script>:12;fib:4;fib:4 57
+ *****************************************************************************/
+
+type Profile struct {
+	interval time.Duration
+	last     time.Time // when the last sample was taken
+	stacks   map[string]int64
+}
+
+// Profile samples the call stack every interval while the interpreter runs a program.
+func (interpreter *Interpreter) Profile(interval time.Duration) *Profile {
+	profile := &Profile{interval: interval, stacks: make(map[string]int64)}
+	interpreter.watch().profile = profile
+	return profile
+}
+
+// start begins sampling, call the returned function to stop
+func (profile *Profile) start(i *interrupts) func() {
+	profile.last = time.Now()
+	ticker := time.NewTicker(profile.interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				i.sample.Store(true)
+				i.raised.Store(true)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		i.sample.Store(false)
+	}
+}
+
+func (profile *Profile) sample(stack *callStack) {
+	now := time.Now()
+	count := int64(now.Sub(profile.last) / profile.interval)
+	if count == 0 {
+		return
+	}
+	profile.last = profile.last.Add(time.Duration(count) * profile.interval)
+	profile.stacks[stack.folded()] += count
+}
+
+// WriteFolded writes the samples in folded stack format, most sampled stacks first.
+func (profile *Profile) WriteFolded(w io.Writer) error {
+	stacks := make([]string, 0, len(profile.stacks))
+	for stack := range profile.stacks {
+		stacks = append(stacks, stack)
+	}
+	sort.Slice(stacks, func(a, b int) bool {
+		countA, countB := profile.stacks[stacks[a]], profile.stacks[stacks[b]]
+		if countA != countB {
+			return countA > countB
+		}
+		return stacks[a] < stacks[b]
+	})
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, profile.stacks[stack]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package lang
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+/******************************************************************************
+ * Reading answers from the user for the prompt natives. Input comes from
+ * stdin unless SetInput gives the interpreter something else. The REPL
+ * passes in the reader it reads lines with, so the two don't buffer stdin
+ * out from under each other.
+ *
+ * The question is written to the same output as print and flushed, so it is
+ * on screen before anything is read.
+ *****************************************************************************/
+
+// stdin is shared by every interpreter reading from stdin, so none of them buffers input another one needed
+var stdin = sync.OnceValue(func() *bufio.Reader {
+	return bufio.NewReader(os.Stdin)
+})
+
+// SetInput changes where the prompt natives read answers from, which is stdin by default.
+func (interpreter *Interpreter) SetInput(input io.Reader) {
+	if reader, isBuffered := input.(*bufio.Reader); isBuffered {
+		interpreter.input = reader
+	} else {
+		interpreter.input = bufio.NewReader(input)
+	}
+}
+
+// ask writes a question and reads the line typed in answer, without its line ending, false at the end of input
+func (interpreter *Interpreter) ask(question string) (string, bool, error) {
+	io.WriteString(interpreter.output, question)
+	if err := interpreter.flushOutput(); err != nil {
+		return "", false, err
+	}
+	input := interpreter.input
+	if input == nil {
+		input = stdin()
+	}
+	line, err := input.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", false, nil
+	} else if err != nil && err != io.EOF {
+		return "", false, err
+	}
+	return strings.TrimRight(line, "\r\n"), true, nil
+}
+
+// askSecret is ask without showing what is typed, when reading from a terminal
+func (interpreter *Interpreter) askSecret(question string) (string, bool, error) {
+	restore, disabled := disableEcho(os.Stdin)
+	defer restore()
+	answer, answered, err := interpreter.ask(question)
+	if disabled {
+		// the newline that ended the answer wasn't shown either
+		io.WriteString(interpreter.output, "\n")
+		interpreter.flushOutput()
+	}
+	return answer, answered, err
+}
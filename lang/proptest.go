@@ -0,0 +1,400 @@
+package lang
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+/******************************************************************************
+ * Property based testing for the front end. GenerateProgram builds a random
+ * program straight from AST nodes, exercising every kind of statement and
+ * expression in combinations nobody would think to write by hand, and
+ * RoundTrip checks the property that printing a tree with PrintSource and
+ * parsing the output gives back the same tree. Any failure is a bug in the
+ * scanner, the parser, or the printer.
+ *
+ * Generated programs are only guaranteed to parse. They use names that were
+ * never declared, return from the top level, and so on, which the resolver
+ * would reject. The same seed always generates the same program, so a
+ * failure can be reproduced from its seed. go test round trips the
+ * programs generated from the first thousand seeds, or the first hundred
+ * with -short.
+ *
+ * Trees are compared by shape: node types, tokens, and literal values must
+ * match, while source locations are ignored and grouping parentheses are
+ * looked through, since the printer adds its own.
+ *****************************************************************************/
+
+const (
+	maxGeneratedStmtDepth = 4
+	maxGeneratedExprDepth = 4
+)
+
+var generatedNames = []string{"a", "b", "c", "n", "item", "total", "_tmp", "x1", "Node", "value"}
+
+// GenerateProgram returns a random program that parses, the same one for the same seed.
+func GenerateProgram(seed int64) []Stmt {
+	g := &programGenerator{rand: rand.New(rand.NewSource(seed))}
+	statements := make([]Stmt, 1+g.rand.Intn(8))
+	for i := range statements {
+		statements[i] = g.declaration()
+	}
+	return statements
+}
+
+// RoundTrip prints a tree as source and parses it again, returning an error describing any difference.
+func RoundTrip(statements []Stmt) error {
+	source := PrintSource(statements)
+	errorHandler := silentErrorHandler()
+	reparsed := NewParser(NewScanner(source, errorHandler).ScanTokens(), errorHandler).Parse()
+	if errorHandler.HadError {
+		return fmt.Errorf("the printed source doesn't parse: %s\n%s", errorHandler.Diagnostics[0], source)
+	}
+	before, err := astShape(statements)
+	if err != nil {
+		return err
+	}
+	after, err := astShape(reparsed)
+	if err != nil {
+		return err
+	}
+	if before != after {
+		return fmt.Errorf("the printed source parses into a different tree\n%s\n%s", shapeDifference(before, after),
+			source)
+	}
+	if reprinted := PrintSource(reparsed); reprinted != source {
+		return fmt.Errorf("printing the reparsed tree gives different source\n%s\n%s", source, reprinted)
+	}
+	return nil
+}
+
+// CheckRoundTrip parses source and checks that its tree survives RoundTrip.
+func CheckRoundTrip(source string) error {
+	errorHandler := silentErrorHandler()
+	statements := NewParser(NewScanner(source, errorHandler).ScanTokens(), errorHandler).Parse()
+	if errorHandler.HadError {
+		return errors.New(errorHandler.Diagnostics[0].String())
+	}
+	return RoundTrip(statements)
+}
+
+// astShape encodes a tree without its source locations and grouping nodes
+func astShape(statements []Stmt) (string, error) {
+	encoded, err := EncodeAST(statements)
+	if err != nil {
+		return "", err
+	}
+	var tree any
+	if err := json.Unmarshal(encoded, &tree); err != nil {
+		return "", err
+	}
+	shape, err := json.Marshal(withoutLocations(tree))
+	return string(shape), err
+}
+
+// shapeDifference shows where two shapes part ways
+func shapeDifference(before string, after string) string {
+	start := 0
+	for start < len(before) && start < len(after) && before[start] == after[start] {
+		start++
+	}
+	start = max(0, start-60)
+	excerpt := func(shape string) string {
+		return shape[min(start, len(shape)):min(start+160, len(shape))]
+	}
+	return "tree:     ..." + excerpt(before) + "\nreparsed: ..." + excerpt(after)
+}
+
+func withoutLocations(node any) any {
+	switch node := node.(type) {
+	case map[string]any:
+		if node["type"] == "GroupingExpr" {
+			return withoutLocations(node["expression"])
+		}
+		delete(node, "span")
+		delete(node, "line")
+		for key, value := range node {
+			node[key] = withoutLocations(value)
+		}
+	case []any:
+		for i, value := range node {
+			node[i] = withoutLocations(value)
+		}
+	}
+	return node
+}
+
+type programGenerator struct {
+	rand      *rand.Rand
+	stmtDepth int
+	exprDepth int
+	nextId    int
+}
+
+func (g *programGenerator) id() int {
+	g.nextId++
+	return g.nextId
+}
+
+func (g *programGenerator) chance(percent int) bool {
+	return g.rand.Intn(100) < percent
+}
+
+func (g *programGenerator) token(tokenType TokenType, lexeme string) Token {
+	return generatedToken(tokenType, lexeme)
+}
+
+// generatedToken makes a token the way the scanner would, which gives identifiers and keywords their text as a literal
+func generatedToken(tokenType TokenType, lexeme string) Token {
+	if tokenType == tokenTypeIdentifier || tokenType >= tokenTypeAnd && tokenType < tokenTypeEndOfFile {
+		return Token{tokenType: tokenType, lexeme: lexeme, literal: lexeme}
+	}
+	return Token{tokenType: tokenType, lexeme: lexeme}
+}
+
+func (g *programGenerator) name() Token {
+	return g.token(tokenTypeIdentifier, generatedNames[g.rand.Intn(len(generatedNames))])
+}
+
+func (g *programGenerator) declaration() Stmt {
+	switch g.rand.Intn(12) {
+	case 0:
+		return g.function()
+	case 1:
+		return g.class()
+	case 2:
+		return TraitStmt{name: g.name(), methods: g.methods()}
+	case 3:
+		if g.chance(20) {
+			path := generatedNames[g.rand.Intn(len(generatedNames))] + ".lox"
+			return ImportStmt{keyword: g.token(tokenTypeImport, "import"),
+				path: Token{tokenType: tokenTypeString, lexeme: "\"" + path + "\"", literal: path}, name: g.name()}
+		}
+		fallthrough
+	case 4, 5:
+		var initializer Expr
+		if g.chance(70) {
+			initializer = g.expr()
+		}
+		return VarStmt{name: g.name(), initializer: initializer}
+	}
+	return g.statement()
+}
+
+func (g *programGenerator) statement() Stmt {
+	if g.stmtDepth >= maxGeneratedStmtDepth {
+		return g.simpleStatement()
+	}
+	g.stmtDepth++
+	defer func() { g.stmtDepth-- }()
+	switch g.rand.Intn(10) {
+	case 0:
+		return BlockStmt{statements: g.statements()}
+	case 1:
+		thenBranch := g.statement()
+		var elseBranch Stmt
+		if g.chance(50) {
+			elseBranch = g.statement()
+			if _, isBlock := thenBranch.(BlockStmt); !isBlock {
+				// an else after an unbraced statement could attach to an if nested inside it
+				thenBranch = BlockStmt{statements: []Stmt{thenBranch}}
+			}
+		}
+		return IfStmt{condition: g.expr(), thenBranch: thenBranch, elseBranch: elseBranch}
+	case 2:
+		return WhileStmt{condition: g.expr(), body: g.statement()}
+	case 4:
+		return ForEachStmt{keyword: g.token(tokenTypeFor, "for"), name: g.name(), collection: g.expr(),
+			body: g.statement()}
+	case 3:
+		var loop Stmt = WhileStmt{condition: g.expr(), body: g.statement(), increment: g.expr()}
+		if g.chance(50) {
+			loop = BlockStmt{statements: []Stmt{VarStmt{name: g.name(), initializer: g.expr()}, loop}}
+		}
+		return loop
+	}
+	return g.simpleStatement()
+}
+
+func (g *programGenerator) simpleStatement() Stmt {
+	switch g.rand.Intn(8) {
+	case 0:
+		return BreakStmt{keyword: g.token(tokenTypeBreak, "break")}
+	case 1:
+		return ContinueStmt{keyword: g.token(tokenTypeContinue, "continue")}
+	case 2:
+		var value Expr
+		if g.chance(70) {
+			value = g.expr()
+		}
+		return ReturnStmt{keyword: g.token(tokenTypeReturn, "return"), value: value}
+	case 3, 4:
+		return PrintStmt{expr: g.expr()}
+	}
+	return ExprStmt{expr: g.expr()}
+}
+
+func (g *programGenerator) statements() []Stmt {
+	statements := make([]Stmt, g.rand.Intn(4))
+	for i := range statements {
+		statements[i] = g.declaration()
+	}
+	return statements
+}
+
+// params generates a parameter list, the last of which is sometimes a rest parameter
+func (g *programGenerator) params() ([]Token, bool) {
+	params := make([]Token, g.rand.Intn(4))
+	for i := range params {
+		params[i] = g.name()
+	}
+	return params, len(params) > 0 && g.chance(20)
+}
+
+// body generates the statements of a function, which are never nested as deep as the function itself
+func (g *programGenerator) body() []Stmt {
+	stmtDepth, exprDepth := g.stmtDepth, g.exprDepth
+	g.stmtDepth, g.exprDepth = maxGeneratedStmtDepth-1, maxGeneratedExprDepth-1
+	defer func() { g.stmtDepth, g.exprDepth = stmtDepth, exprDepth }()
+	return g.statements()
+}
+
+func (g *programGenerator) function() FunctionStmt {
+	function := FunctionStmt{name: g.name()}
+	function.params, function.variadic = g.params()
+	function.body = g.body()
+	return function
+}
+
+func (g *programGenerator) methods() []FunctionStmt {
+	methods := make([]FunctionStmt, g.rand.Intn(3))
+	for i := range methods {
+		methods[i] = g.function()
+		if g.chance(20) {
+			methods[i].params = []Token{}
+			methods[i].variadic = false
+			methods[i].isGetter = true
+		}
+	}
+	return methods
+}
+
+func (g *programGenerator) class() ClassStmt {
+	class := ClassStmt{name: g.name(), traits: make([]Expr, 0)}
+	if g.chance(40) {
+		class.superclass = VariableExpr{id: g.id(), name: g.name()}
+	}
+	for i := g.rand.Intn(3); i > 0 && g.chance(40); i-- {
+		class.traits = append(class.traits, VariableExpr{id: g.id(), name: g.name()})
+	}
+	class.methods = g.methods()
+	return class
+}
+
+var (
+	generatedBinaryOperators = []Token{
+		generatedToken(tokenTypePlus, "+"), generatedToken(tokenTypeMinus, "-"),
+		generatedToken(tokenTypeStar, "*"), generatedToken(tokenTypeSlash, "/"),
+		generatedToken(tokenTypeMod, "%"), generatedToken(tokenTypeEqualEqual, "=="),
+		generatedToken(tokenTypeBangEqual, "!="), generatedToken(tokenTypeLess, "<"),
+		generatedToken(tokenTypeLessEqual, "<="), generatedToken(tokenTypeGreater, ">"),
+		generatedToken(tokenTypeGreaterEqual, ">="), generatedToken(tokenTypeAmpersand, "&"),
+		generatedToken(tokenTypePipe, "|"), generatedToken(tokenTypeCaret, "^"),
+		generatedToken(tokenTypeLessLess, "<<"), generatedToken(tokenTypeGreaterGreater, ">>"),
+	}
+	generatedLogicalOperators = []Token{generatedToken(tokenTypeAnd, "and"), generatedToken(tokenTypeOr, "or")}
+	generatedUnaryOperators   = []Token{generatedToken(tokenTypeBang, "!"), generatedToken(tokenTypeMinus, "-")}
+)
+
+func (g *programGenerator) expr() Expr {
+	if g.exprDepth >= maxGeneratedExprDepth || g.chance(30) {
+		return g.leaf()
+	}
+	g.exprDepth++
+	defer func() { g.exprDepth-- }()
+	switch g.rand.Intn(16) {
+	case 0:
+		return AssignExpr{id: g.id(), name: g.name(), value: g.expr()}
+	case 1, 2:
+		operator := generatedBinaryOperators[g.rand.Intn(len(generatedBinaryOperators))]
+		return BinaryExpr{id: g.id(), left: g.expr(), operator: operator, right: g.expr()}
+	case 3:
+		operator := generatedLogicalOperators[g.rand.Intn(len(generatedLogicalOperators))]
+		return LogicalExpr{id: g.id(), left: g.expr(), operator: operator, right: g.expr()}
+	case 4:
+		operator := generatedUnaryOperators[g.rand.Intn(len(generatedUnaryOperators))]
+		return UnaryExpr{id: g.id(), operator: operator, right: g.expr()}
+	case 5:
+		return ConditionalExpr{id: g.id(), condition: g.expr(), thenBranch: g.expr(), elseBranch: g.expr()}
+	case 6:
+		call := CallExpr{id: g.id(), callee: g.expr(), paren: g.token(tokenTypeRightParen, ")"), args: g.exprs(),
+			names: make([]Token, 0)}
+		if len(call.args) > 0 && g.chance(30) {
+			// some of the last arguments are passed by name
+			for range g.rand.Intn(len(call.args)) + 1 {
+				call.names = append(call.names, g.name())
+			}
+		}
+		return call
+	case 7:
+		return GetExpr{id: g.id(), object: g.expr(), name: g.name()}
+	case 8:
+		return SetExpr{id: g.id(), object: g.expr(), name: g.name(), value: g.expr()}
+	case 9:
+		return SubscriptExpr{id: g.id(), object: g.expr(), bracket: g.token(tokenTypeLeftBracket, "["), index: g.expr()}
+	case 10:
+		return SubscriptSetExpr{id: g.id(), object: g.expr(), bracket: g.token(tokenTypeLeftBracket, "["), index: g.expr(),
+			value: g.expr()}
+	case 11:
+		return ListExpr{id: g.id(), bracket: g.token(tokenTypeLeftBracket, "["), elements: g.exprs()}
+	case 12:
+		keys := g.exprs()
+		values := make([]Expr, len(keys))
+		for i := range values {
+			values[i] = g.expr()
+		}
+		return MapExpr{id: g.id(), brace: g.token(tokenTypeLeftBrace, "{"), keys: keys, values: values}
+	case 13:
+		return GroupingExpr{id: g.id(), expression: g.expr()}
+	case 14:
+		params, variadic := g.params()
+		return FunctionExpr{id: g.id(), keyword: g.token(tokenTypeFun, "fun"), params: params, body: g.body(),
+			variadic: variadic}
+	}
+	return g.leaf()
+}
+
+func (g *programGenerator) exprs() []Expr {
+	exprs := make([]Expr, g.rand.Intn(4))
+	for i := range exprs {
+		exprs[i] = g.expr()
+	}
+	return exprs
+}
+
+func (g *programGenerator) leaf() Expr {
+	switch g.rand.Intn(10) {
+	case 0:
+		return LiteralExpr{id: g.id(), value: nil}
+	case 1:
+		return LiteralExpr{id: g.id(), value: g.chance(50)}
+	case 2:
+		return LiteralExpr{id: g.id(), value: g.rand.Int63n(1 << uint(g.rand.Intn(63)))}
+	case 3:
+		return LiteralExpr{id: g.id(), value: float64(g.rand.Intn(100000)) / 64}
+	case 4:
+		words := make([]string, g.rand.Intn(3))
+		for i := range words {
+			words[i] = generatedNames[g.rand.Intn(len(generatedNames))]
+		}
+		return LiteralExpr{id: g.id(), value: strings.Join(words, " ")}
+	case 5:
+		return ThisExpr{id: g.id(), keyword: g.token(tokenTypeThis, "this")}
+	case 6:
+		return SuperExpr{id: g.id(), keyword: g.token(tokenTypeSuper, "super"), method: g.name()}
+	}
+	return VariableExpr{id: g.id(), name: g.name()}
+}
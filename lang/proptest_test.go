@@ -0,0 +1,16 @@
+package lang
+
+import "testing"
+
+// TestRoundTripGenerated checks that programs generated from a range of seeds survive being printed and parsed again
+func TestRoundTripGenerated(t *testing.T) {
+	count := int64(1000)
+	if testing.Short() {
+		count = 100
+	}
+	for seed := int64(1); seed <= count; seed++ {
+		if err := RoundTrip(GenerateProgram(seed)); err != nil {
+			t.Errorf("seed %d: %s", seed, err)
+		}
+	}
+}
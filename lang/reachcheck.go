@@ -0,0 +1,56 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * A warning for statements that can never run because the one before them
+ * always leaves first. That is a return, break, or continue, a block that
+ * ends with one, or an if whose branches both do. Only the first of the
+ * unreachable statements is reported, the rest of them are dead for the
+ * same reason.
+ *****************************************************************************/
+
+// checkReachable warns about stmt and returns false if the statement before it always leaves
+func (r *Resolver) checkReachable(previous Stmt, stmt Stmt) bool {
+	keyword, leaves := alwaysLeaves(previous)
+	if leaves {
+		err := errors.New("Unreachable code, the '" + keyword + "' before it always leaves first.")
+		r.warn(diag.UnreachableCode, stmt.Span(), err)
+	}
+	return !leaves
+}
+
+// alwaysLeaves reports whether a statement always returns, breaks, or continues, and with which keyword
+func alwaysLeaves(stmt Stmt) (string, bool) {
+	switch stmt := stmt.(type) {
+	case ReturnStmt:
+		return stmt.keyword.lexeme, true
+	case BreakStmt:
+		return stmt.keyword.lexeme, true
+	case ContinueStmt:
+		return stmt.keyword.lexeme, true
+	case BlockStmt:
+		for _, inner := range stmt.statements {
+			if keyword, leaves := alwaysLeaves(inner); leaves {
+				return keyword, true
+			}
+		}
+	case IfStmt:
+		if stmt.elseBranch == nil {
+			return "", false
+		}
+		thenKeyword, thenLeaves := alwaysLeaves(stmt.thenBranch)
+		elseKeyword, elseLeaves := alwaysLeaves(stmt.elseBranch)
+		if thenLeaves && elseLeaves {
+			if thenKeyword != elseKeyword {
+				return "if", true
+			}
+			return thenKeyword, true
+		}
+	}
+	return "", false
+}
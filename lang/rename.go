@@ -0,0 +1,229 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+/******************************************************************************
+ * Rename gives a variable, function, class, trait, parameter, or import a new
+ * name, changing its declaration and every reference to it found by the
+ * cross reference. Only the one source file is changed, so renaming a global
+ * of a module doesn't update the scripts that import it.
+ *
+ * A rename is refused if the new name would collide with or shadow another
+ * one: if it is already declared in the same scope or in any scope enclosing
+ * the symbol's, if it is a native, or if it is used inside the symbol's
+ * scope to mean something declared outside it. That holds even when the
+ * program would still mean the same thing, since a name hidden today is
+ * easily used by mistake tomorrow. Past that, a rename is refused if it
+ * would change what any name refers to. Rather than working out every way
+ * that can happen, the renamed source is resolved again and its cross
+ * reference is compared with the original, name for name.
+ *****************************************************************************/
+
+// Rename renames the symbol declared or used at a byte offset in source and returns the new source.
+func Rename(source string, offset int, newName string) (string, error) {
+	if !isPlainIdentifier(newName) {
+		return "", fmt.Errorf("'%s' isn't a valid name.", newName)
+	}
+	xref := BuildCrossReference(source, silentErrorHandler())
+	if xref == nil {
+		return "", errors.New("The source has errors, fix them before renaming.")
+	}
+	symbol := xref.SymbolAt(offset)
+	if symbol == nil {
+		return "", errors.New("There is no variable, function, class, or trait there to rename.")
+	}
+	if symbol.Kind == "undeclared" {
+		return "", fmt.Errorf("'%s' isn't declared in this file, so it can't be renamed here.", symbol.Name)
+	}
+	spans := append([]Span{symbol.Declared}, referenceSpans(symbol)...)
+	for _, span := range spans {
+		if source[span.Start.Offset:span.End.Offset] != symbol.Name {
+			// an import without "as" is named after its path
+			return "", fmt.Errorf("'%s' on line %d isn't written out by name, so it can't be renamed.",
+				symbol.Name, span.Start.Line)
+		}
+	}
+	if symbol.Name == newName {
+		return source, nil
+	}
+	if err := xref.checkShadowing(symbol, newName, len(source)); err != nil {
+		return "", err
+	}
+
+	renamed := replaceSpans(source, spans, newName)
+	shift := func(offset int) int {
+		shifted := offset
+		for _, span := range spans {
+			if span.Start.Offset < offset {
+				shifted += len(newName) - len(symbol.Name)
+			}
+		}
+		return shifted
+	}
+	errorHandler := silentErrorHandler()
+	renamedXref := BuildCrossReference(renamed, errorHandler)
+	if renamedXref == nil {
+		if len(errorHandler.Diagnostics) > 0 {
+			diagnostic := errorHandler.Diagnostics[0]
+			return "", fmt.Errorf("Renaming '%s' to '%s' would cause an error on line %d: %s", symbol.Name, newName,
+				diagnostic.Line, diagnostic.Message)
+		}
+		return "", fmt.Errorf("Renaming '%s' to '%s' would cause an error.", symbol.Name, newName)
+	}
+	before := xref.bindings(shift)
+	after := renamedXref.bindings(func(offset int) int { return offset })
+	if line, changed := firstChange(before, after); changed {
+		return "", fmt.Errorf("Renaming '%s' to '%s' would change what the name on line %d refers to.",
+			symbol.Name, newName, line)
+	}
+	return renamed, nil
+}
+
+// checkShadowing refuses a new name for symbol that is already bound where the symbol is declared or used inside its scope
+func (x *CrossReference) checkShadowing(symbol *Symbol, newName string, sourceLength int) error {
+	start, end := 0, sourceLength // a global's scope is the whole program
+	if symbol.scope != nil {
+		start, end = symbol.scope.start, symbol.scope.end
+	}
+	for _, other := range x.Symbols {
+		if other == symbol || other.Name != newName {
+			continue
+		}
+		if other.Kind != "undeclared" {
+			if other.scope == symbol.scope {
+				return fmt.Errorf("Renaming '%s' to '%s' would collide with the %s '%s' declared in the same scope on line %d.",
+					symbol.Name, newName, other.Kind, newName, other.Declared.Start.Line)
+			}
+			if other.Global ||
+				(other.scope.within(symbol.scope) && other.Declared.Start.Offset < symbol.Declared.Start.Offset) {
+				return fmt.Errorf("Renaming '%s' to '%s' would shadow the %s '%s' declared on line %d.",
+					symbol.Name, newName, other.Kind, newName, other.Declared.Start.Line)
+			}
+		}
+		if other.scope != nil && (symbol.scope == nil || symbol.scope.within(other.scope)) {
+			continue // declared inside the symbol's scope, so its uses aren't free there
+		}
+		for _, reference := range other.References {
+			if reference.Span.Start.Offset >= start && reference.Span.Start.Offset < end {
+				return fmt.Errorf("Renaming '%s' to '%s' would shadow the '%s' used on line %d.",
+					symbol.Name, newName, newName, reference.Span.Start.Line)
+			}
+		}
+	}
+	if isNativeName(newName) {
+		return fmt.Errorf("Renaming '%s' to '%s' would shadow the native '%s'.", symbol.Name, newName, newName)
+	}
+	return nil
+}
+
+// SymbolAt finds the symbol declared or referenced at a byte offset, nil if there isn't one.
+func (x *CrossReference) SymbolAt(offset int) *Symbol {
+	for _, symbol := range x.Symbols {
+		if symbol.Kind != "undeclared" && symbol.Declared.contains(offset) {
+			return symbol
+		}
+		for _, reference := range symbol.References {
+			if reference.Span.contains(offset) {
+				return symbol
+			}
+		}
+	}
+	return nil
+}
+
+// SymbolsNamed returns the declared symbols with a name, in the order they were declared.
+func (x *CrossReference) SymbolsNamed(name string) []*Symbol {
+	symbols := make([]*Symbol, 0)
+	for _, symbol := range x.Symbols {
+		if symbol.Name == name && symbol.Kind != "undeclared" {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+type binding struct {
+	line        int
+	declaration string // where the declaration it refers to is, or the name of an undeclared symbol
+}
+
+// bindings maps the offset of every declaration and reference, moved by shift, to what it refers to
+func (x *CrossReference) bindings(shift func(int) int) map[int]binding {
+	bindings := make(map[int]binding)
+	for _, symbol := range x.Symbols {
+		declaration := "undeclared " + symbol.Name
+		if symbol.Kind != "undeclared" {
+			declaration = symbol.Kind + " at " + strconv.Itoa(shift(symbol.Declared.Start.Offset))
+			bindings[shift(symbol.Declared.Start.Offset)] = binding{symbol.Declared.Start.Line, declaration}
+		}
+		for _, reference := range symbol.References {
+			bindings[shift(reference.Span.Start.Offset)] = binding{reference.Span.Start.Line, declaration}
+		}
+	}
+	return bindings
+}
+
+// firstChange returns the line of the first name that refers to something else after a rename
+func firstChange(before map[int]binding, after map[int]binding) (int, bool) {
+	offsets := make([]int, 0, len(before)+len(after))
+	for offset := range before {
+		offsets = append(offsets, offset)
+	}
+	for offset := range after {
+		if _, found := before[offset]; !found {
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Ints(offsets)
+	for _, offset := range offsets {
+		old, hadBinding := before[offset]
+		renamed, hasBinding := after[offset]
+		if !hadBinding {
+			return renamed.line, true
+		}
+		if !hasBinding || old.declaration != renamed.declaration {
+			return old.line, true
+		}
+	}
+	return 0, false
+}
+
+func referenceSpans(symbol *Symbol) []Span {
+	spans := make([]Span, 0, len(symbol.References))
+	for _, reference := range symbol.References {
+		spans = append(spans, reference.Span)
+	}
+	return spans
+}
+
+// replaceSpans replaces the text at each span, which must not overlap, with replacement
+func replaceSpans(source string, spans []Span, replacement string) string {
+	sorted := make([]Span, len(spans))
+	copy(sorted, spans)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a].Start.Offset < sorted[b].Start.Offset })
+	replaced := ""
+	last := 0
+	for _, span := range sorted {
+		replaced += source[last:span.Start.Offset] + replacement
+		last = span.End.Offset
+	}
+	return replaced + source[last:]
+}
+
+// isPlainIdentifier reports whether text scans as a single identifier, which rules out keywords
+func isPlainIdentifier(text string) bool {
+	tokens := NewScanner(text, silentErrorHandler()).ScanTokens()
+	return len(tokens) == 2 && tokens[0].tokenType == tokenTypeIdentifier && tokens[0].lexeme == text
+}
+
+func silentErrorHandler() *ErrorHandler {
+	errorHandler := NewErrorHandler()
+	errorHandler.Output = io.Discard
+	return errorHandler
+}
@@ -0,0 +1,47 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRename checks which renames are made and which are refused for colliding with or shadowing another name
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		old     string // the first place this text appears is renamed
+		newName string
+		renamed string // empty when the rename is refused
+	}{
+		{"local", "fun f() {\n  var total = 2;\n  print total;\n}\n", "total", "count",
+			"fun f() {\n  var count = 2;\n  print count;\n}\n"},
+		{"global", "var total = 1;\nfun f() { print total; }\n", "total", "count",
+			"var count = 1;\nfun f() { print count; }\n"},
+		{"local in a sibling scope", "{ var count = 1; print count; }\n{ var total = 2; print total; }\n",
+			"total", "count", "{ var count = 1; print count; }\n{ var count = 2; print count; }\n"},
+		{"global named like an inner local", "var total = 1;\nfun f() { var count = 2; print count; }\nprint total;\n",
+			"total", "count", "var count = 1;\nfun f() { var count = 2; print count; }\nprint count;\n"},
+		{"same scope", "var total = 1;\nvar count = 2;\nprint total + count;\n", "total", "count", ""},
+		{"global used in an inner scope", "var count = 1;\nfun f() {\n  { print count; }\n  var total = 2;\n  print total;\n}\n",
+			"total", "count", ""},
+		{"local of an enclosing scope", "fun f() {\n  var count = 1;\n  {\n    var total = 2;\n    print total;\n  }\n}\n",
+			"total", "count", ""},
+		{"native", "fun f() {\n  var total = 2;\n  print total;\n}\n", "total", "clock", ""},
+		{"undeclared name used inside", "fun f() {\n  var total = 2;\n  print total + count;\n}\n", "total", "count", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			renamed, err := Rename(test.source, strings.Index(test.source, test.old), test.newName)
+			if test.renamed == "" {
+				if err == nil {
+					t.Errorf("renamed to %q, expected the rename to be refused", renamed)
+				}
+				return
+			}
+			if err != nil || renamed != test.renamed {
+				t.Errorf("renamed to %q, error %v, expected %q", renamed, err, test.renamed)
+			}
+		})
+	}
+}
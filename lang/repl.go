@@ -0,0 +1,35 @@
+package lang
+
+import (
+	"io"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * IsIncomplete reports whether source typed into a REPL stops partway
+ * through a declaration, so the REPL should read another line before running
+ * it. That's the case when a string is left open or when parsing fails only
+ * because the tokens ran out, e.g. an unclosed brace or a missing semicolon.
+ * Any other error means more input won't help, so the source is complete
+ * and running it will report the error. The source is parsed in REPL mode,
+ * so an expression without a ';' is complete.
+ *****************************************************************************/
+
+func IsIncomplete(source string) bool {
+	scratch := &ErrorHandler{Output: io.Discard}
+	scanner := NewScanner(source, scratch)
+	tokens := scanner.ScanTokens()
+	for _, diagnostic := range scratch.Diagnostics {
+		if diagnostic.Code == diag.UnterminatedString {
+			return true
+		}
+	}
+	if scratch.HadError {
+		return false
+	}
+	parser := NewParser(tokens, scratch)
+	parser.SetREPLMode(true)
+	parser.Parse()
+	return parser.errorAtEnd
+}
@@ -2,6 +2,8 @@ package lang
 
 import (
 	"errors"
+
+	"github.com/skusel/glox/diag"
 )
 
 /******************************************************************************
@@ -28,64 +30,123 @@ const (
 	ctNone ClassType = iota
 	ctClass
 	ctSubClass
+	ctTrait
 )
 
 type Resolver struct {
-	interpreter         *Interpreter
 	scopes              []map[string]bool
+	locals              map[int]int
+	tailCalls           map[int]bool // IDs of the calls whose result is returned as is
 	currentFunctionType FunctionType
 	currentClassType    ClassType
+	loopDepth           int
 	errorHandler        *ErrorHandler
+	xref                *CrossReference       // only set when building a cross reference
+	traitMethods        map[string][]string   // method names of the traits declared so far, by trait name
+	directives          *Directives           // glox-lint comments in the source, nil if it had none
+	signatures          []map[string][]string // parameter names of the functions and classes in each scope
+	globalSignatures    map[string][]string
+	variables           []map[string]*localVariable // the locals declared with var in each scope, see unusedcheck.go
+	functionDepth       int                         // how many function bodies the resolver is inside
+	scopeFunctionDepths []int                       // the function depth each scope was opened at
+	closureAssigned     []map[string]bool           // the locals of each scope a closure assigns to, see loopcheck.go
+}
+
+func NewResolver(errorHandler *ErrorHandler) *Resolver {
+	return &Resolver{scopes: make([]map[string]bool, 0, 0), locals: make(map[int]int),
+		tailCalls: make(map[int]bool), currentFunctionType: ftNone, currentClassType: ctNone, errorHandler: errorHandler,
+		traitMethods: make(map[string][]string), globalSignatures: make(map[string][]string)}
 }
 
-func NewResolver(interpreter *Interpreter) *Resolver {
-	return &Resolver{interpreter: interpreter, scopes: make([]map[string]bool, 0, 0),
-		currentFunctionType: ftNone, currentClassType: ctNone, errorHandler: interpreter.errorHandler}
+// SetDirectives has the resolver leave out the warnings disabled by glox-lint comments.
+func (r *Resolver) SetDirectives(directives *Directives) {
+	r.directives = directives
+}
+
+// warn reports a warning unless a glox-lint comment disables it
+func (r *Resolver) warn(code diag.Code, span Span, err error) {
+	if !r.directives.Suppressed(code, span.Start.Line) {
+		r.errorHandler.reportWarningAt(code, span, err)
+	}
 }
 
 func (r *Resolver) ResolveStatements(statements []Stmt) {
-	for _, stmt := range statements {
+	reachable := true
+	for i, stmt := range statements {
+		if reachable && i > 0 {
+			reachable = r.checkReachable(statements[i-1], stmt)
+		}
 		r.resolveStatement(stmt)
 	}
 }
 
 func (r *Resolver) resolveStatement(stmt Stmt) {
-	stmt.accept(r)
+	acceptStmt(stmt, r)
+}
+
+// ResolveExpression resolves an expression that stands on its own rather than in a statement
+func (r *Resolver) ResolveExpression(expr Expr) {
+	r.resolveExpression(expr)
 }
 
 func (r *Resolver) resolveExpression(expr Expr) {
-	expr.accept(r)
+	acceptExpr(expr, r)
 }
 
-func (r *Resolver) resolveFunction(function FunctionStmt, functionType FunctionType) {
+func (r *Resolver) resolveFunction(params []Token, body []Stmt, functionType FunctionType) {
 	enclosingFunctionType := r.currentFunctionType
+	enclosingLoopDepth := r.loopDepth
 	r.currentFunctionType = functionType
+	r.loopDepth = 0 // a function body can't break out of a loop it was declared in
+	r.functionDepth++
 	r.beginScope()
-	for _, param := range function.params {
-		r.declare(param)
+	for _, param := range params {
+		r.declare(param, "parameter")
 		r.define(param)
 	}
-	r.ResolveStatements(function.body)
+	r.ResolveStatements(body)
 	r.endScope()
+	r.functionDepth--
 	r.currentFunctionType = enclosingFunctionType
+	r.loopDepth = enclosingLoopDepth
 }
 
 func (r *Resolver) beginScope() {
 	r.scopes = append(r.scopes, make(map[string]bool))
+	r.variables = append(r.variables, make(map[string]*localVariable))
+	r.signatures = append(r.signatures, make(map[string][]string))
+	r.scopeFunctionDepths = append(r.scopeFunctionDepths, r.functionDepth)
+	r.closureAssigned = append(r.closureAssigned, make(map[string]bool))
+	if r.xref != nil {
+		r.xref.beginScope()
+	}
 }
 
 func (r *Resolver) endScope() {
+	r.checkUnusedVariables()
 	r.scopes = r.scopes[:len(r.scopes)-1]
+	r.variables = r.variables[:len(r.variables)-1]
+	r.signatures = r.signatures[:len(r.signatures)-1]
+	r.scopeFunctionDepths = r.scopeFunctionDepths[:len(r.scopeFunctionDepths)-1]
+	r.closureAssigned = r.closureAssigned[:len(r.closureAssigned)-1]
+	if r.xref != nil {
+		r.xref.endScope()
+	}
 }
 
-func (r *Resolver) declare(name Token) {
+// declare adds a name to the innermost scope, kind says what declared it for cross references
+func (r *Resolver) declare(name Token, kind string) {
+	if r.xref != nil {
+		r.xref.declare(name, kind)
+	}
+	delete(r.currentSignatures(), name.lexeme)
 	if len(r.scopes) == 0 {
 		return
 	}
 	scope := r.scopes[len(r.scopes)-1]
 	_, hasVar := scope[name.lexeme]
 	if hasVar {
-		r.errorHandler.reportStaticError(name.line, name.lexeme,
+		r.errorHandler.reportStaticErrorAt(diag.AlreadyDeclared, name,
 			errors.New("Already a variable with this name is this scope."), false)
 	}
 	scope[name.lexeme] = false
@@ -99,194 +160,396 @@ func (r *Resolver) define(name Token) {
 }
 
 func (r *Resolver) resolveLocal(expr Expr, name Token) {
+	if r.xref != nil {
+		_, isAssign := expr.(AssignExpr)
+		r.xref.reference(name, isAssign)
+	}
 	for i := len(r.scopes) - 1; i >= 0; i-- {
 		_, hasVar := r.scopes[i][name.lexeme]
 		if hasVar {
-			r.interpreter.resolve(expr, len(r.scopes)-1-i)
+			r.locals[expr.getId()] = len(r.scopes) - 1 - i
+			if _, isAssign := expr.(AssignExpr); !isAssign {
+				r.readVariable(i, name)
+			} else if r.scopeFunctionDepths[i] < r.functionDepth {
+				r.closureAssigned[i][name.lexeme] = true
+			}
 			return
 		}
 	}
 }
 
-func (r *Resolver) visitBlockStmt(stmt BlockStmt) any {
+func (r *Resolver) visitBlockStmt(stmt BlockStmt) none {
 	r.beginScope()
 	r.ResolveStatements(stmt.statements)
 	r.endScope()
-	return nil
+	return none{}
+}
+
+func (r *Resolver) visitBreakStmt(stmt BreakStmt) none {
+	if r.loopDepth == 0 {
+		r.errorHandler.reportStaticErrorAt(diag.BreakOutsideLoop, stmt.keyword,
+			errors.New("Can't use 'break' outside of a loop."), false)
+	}
+	return none{}
 }
 
-func (r *Resolver) visitClassStmt(stmt ClassStmt) any {
+func (r *Resolver) visitClassStmt(stmt ClassStmt) none {
 	enclosingClassType := r.currentClassType
 	r.currentClassType = ctClass
-	r.declare(stmt.name)
+	r.declare(stmt.name, "class")
 	r.define(stmt.name)
+	r.classSignature(stmt)
 	if stmt.superclass.getId() != 0 { // id will be unset if there is not superclass
 		if stmt.name.lexeme == stmt.superclass.name.lexeme {
-			r.errorHandler.reportStaticError(stmt.superclass.name.line,
-				stmt.superclass.name.lexeme,
+			r.errorHandler.reportStaticErrorAt(diag.InheritFromSelf, stmt.superclass.name,
 				errors.New("A class can't inherit from itself."), false)
 		}
 		r.currentClassType = ctSubClass
 		r.resolveExpression(stmt.superclass)
+	}
+	// traits are looked up where the class is declared, outside the scope holding "super"
+	for _, trait := range stmt.traits {
+		r.resolveExpression(trait)
+	}
+	r.checkTraitConflicts(stmt)
+	if stmt.superclass.getId() != 0 {
 		r.beginScope()
 		r.scopes[len(r.scopes)-1]["super"] = true
 	}
+	r.resolveMethods(stmt.methods)
+	if stmt.superclass.getId() != 0 {
+		r.endScope()
+	}
+	r.currentClassType = enclosingClassType
+	return none{}
+}
+
+// resolveMethods resolves the methods of a class or trait in a scope holding "this"
+func (r *Resolver) resolveMethods(methods []FunctionStmt) {
 	r.beginScope()
 	r.scopes[len(r.scopes)-1]["this"] = true
-	for _, method := range stmt.methods {
+	for _, method := range methods {
 		declaration := ftMethod
 		if method.name.lexeme == "init" {
 			declaration = ftInitializer
+			if method.isGetter {
+				r.errorHandler.reportStaticErrorAt(diag.InitializerGetter, method.name,
+					errors.New("An initializer can't be a getter."), false)
+			}
 		}
-		r.resolveFunction(method, declaration)
+		r.resolveFunction(method.params, method.body, declaration)
 	}
 	r.endScope()
-	if stmt.superclass.getId() != 0 {
-		r.endScope()
+}
+
+// checkTraitConflicts reports methods defined by more than one of a class's traits that the class doesn't settle
+func (r *Resolver) checkTraitConflicts(stmt ClassStmt) {
+	own := make(map[string]bool)
+	for _, method := range stmt.methods {
+		own[method.name.lexeme] = true
 	}
-	r.currentClassType = enclosingClassType
-	return nil
+	from := make(map[string]string)
+	for _, trait := range stmt.traits {
+		name := trait.(VariableExpr).name
+		for _, method := range r.traitMethods[name.lexeme] {
+			if other, conflict := from[method]; conflict && other != name.lexeme && !own[method] {
+				r.errorHandler.reportStaticErrorAt(diag.TraitMethodConflict, name,
+					traitConflict(method, other, name.lexeme), false)
+			}
+			from[method] = name.lexeme
+		}
+	}
+}
+
+func (r *Resolver) visitContinueStmt(stmt ContinueStmt) none {
+	if r.loopDepth == 0 {
+		r.errorHandler.reportStaticErrorAt(diag.ContinueOutsideLoop, stmt.keyword,
+			errors.New("Can't use 'continue' outside of a loop."), false)
+	}
+	return none{}
+}
+
+func (r *Resolver) visitErrorStmt(stmt ErrorStmt) none {
+	if name, kind, found := stmt.declaredName(); found {
+		r.declare(name, kind)
+		r.define(name)
+	}
+	return none{}
 }
 
-func (r *Resolver) visitExprStmt(stmt ExprStmt) any {
+func (r *Resolver) visitExprStmt(stmt ExprStmt) none {
+	r.checkUnusedExpression(stmt)
 	r.resolveExpression(stmt.expr)
-	return nil
+	return none{}
+}
+
+func (r *Resolver) visitForEachStmt(stmt ForEachStmt) none {
+	r.resolveExpression(stmt.collection)
+	// each step of the loop gets a fresh variable, in a scope of its own
+	r.beginScope()
+	r.declare(stmt.name, "variable")
+	r.define(stmt.name)
+	r.loopDepth++
+	r.resolveStatement(stmt.body)
+	r.loopDepth--
+	r.endScope()
+	return none{}
 }
 
-func (r *Resolver) visitFunctionStmt(stmt FunctionStmt) any {
+func (r *Resolver) visitFunctionStmt(stmt FunctionStmt) none {
 	// declare and define immediately to allow self recursion
-	r.declare(stmt.name)
+	r.declare(stmt.name, "function")
 	r.define(stmt.name)
-	r.resolveFunction(stmt, ftFunction)
-	return nil
+	r.setSignature(stmt.name, stmt.params, stmt.variadic)
+	r.resolveFunction(stmt.params, stmt.body, ftFunction)
+	return none{}
 }
 
-func (r *Resolver) visitIfStmt(stmt IfStmt) any {
+func (r *Resolver) visitIfStmt(stmt IfStmt) none {
 	// don't consider condition - check both branches regardless
+	r.checkCondition(stmt.condition)
+	r.checkIfCondition(stmt)
 	r.resolveExpression(stmt.condition)
 	r.resolveStatement(stmt.thenBranch)
 	if stmt.elseBranch != nil {
 		r.resolveStatement(stmt.elseBranch)
 	}
-	return nil
+	return none{}
 }
 
-func (r *Resolver) visitPrintStmt(stmt PrintStmt) any {
+func (r *Resolver) visitPrintStmt(stmt PrintStmt) none {
 	r.resolveExpression(stmt.expr)
-	return nil
+	return none{}
 }
 
-func (r *Resolver) visitReturnStmt(stmt ReturnStmt) any {
+func (r *Resolver) visitReturnStmt(stmt ReturnStmt) none {
 	if r.currentFunctionType == ftNone {
-		r.errorHandler.reportStaticError(stmt.keyword.line, stmt.keyword.lexeme,
+		r.errorHandler.reportStaticErrorAt(diag.ReturnAtTopLevel, stmt.keyword,
 			errors.New("Can't return from top level code."), false)
 	}
 	if stmt.value != nil {
 		if r.currentFunctionType == ftInitializer {
-			r.errorHandler.reportStaticError(stmt.keyword.line, stmt.keyword.lexeme,
+			r.errorHandler.reportStaticErrorAt(diag.ReturnFromInitializer, stmt.keyword,
 				errors.New("Can't return a vlaue from an intializer."), false)
+		} else if r.currentFunctionType != ftNone {
+			r.markTailCalls(stmt.value)
 		}
 		r.resolveExpression(stmt.value)
 	}
-	return nil
+	return none{}
+}
+
+/******************************************************************************
+ * markTailCalls finds the calls in a returned expression whose result is
+ * the function's result, with nothing left to do after them. The
+ * interpreter runs those calls in place of the function that made them
+ * rather than on top of it, see function.Call, so tail recursion doesn't
+ * grow the stack.
+ *****************************************************************************/
+
+func (r *Resolver) markTailCalls(expr Expr) {
+	switch expr := expr.(type) {
+	case CallExpr:
+		r.tailCalls[expr.getId()] = true
+	case ConditionalExpr:
+		r.markTailCalls(expr.thenBranch)
+		r.markTailCalls(expr.elseBranch)
+	case GroupingExpr:
+		r.markTailCalls(expr.expression)
+	case LogicalExpr:
+		// the left operand is tested after it is evaluated, only the right one is returned untouched
+		r.markTailCalls(expr.right)
+	}
+}
+
+func (r *Resolver) visitImportStmt(stmt ImportStmt) none {
+	r.declare(stmt.name, "import")
+	r.define(stmt.name)
+	return none{}
+}
+
+func (r *Resolver) visitTraitStmt(stmt TraitStmt) none {
+	enclosingClassType := r.currentClassType
+	r.currentClassType = ctTrait
+	r.declare(stmt.name, "trait")
+	r.define(stmt.name)
+	methods := make([]string, 0, len(stmt.methods))
+	for _, method := range stmt.methods {
+		methods = append(methods, method.name.lexeme)
+	}
+	r.traitMethods[stmt.name.lexeme] = methods
+	r.resolveMethods(stmt.methods)
+	r.currentClassType = enclosingClassType
+	return none{}
 }
 
-func (r *Resolver) visitVarStmt(stmt VarStmt) any {
-	r.declare(stmt.name)
+func (r *Resolver) visitVarStmt(stmt VarStmt) none {
+	r.declare(stmt.name, "variable")
+	r.declareVariable(stmt.name)
 	if stmt.initializer != nil {
 		r.resolveExpression(stmt.initializer)
 	}
 	r.define(stmt.name)
-	return nil
+	return none{}
 }
 
-func (r *Resolver) visitWhileStmt(stmt WhileStmt) any {
+func (r *Resolver) visitWhileStmt(stmt WhileStmt) none {
+	r.checkCondition(stmt.condition)
+	r.checkLoop(stmt)
 	r.resolveExpression(stmt.condition)
+	r.loopDepth++
 	r.resolveStatement(stmt.body)
-	return nil
+	r.loopDepth--
+	if stmt.increment != nil {
+		r.resolveExpression(stmt.increment)
+	}
+	return none{}
 }
 
-func (r *Resolver) visitAssignExpr(expr AssignExpr) any {
+func (r *Resolver) visitAssignExpr(expr AssignExpr) none {
 	r.resolveExpression(expr.value)
 	r.resolveLocal(expr, expr.name)
-	return nil
+	r.forgetSignature(expr.name)
+	return none{}
 }
 
-func (r *Resolver) visitBinaryExpr(expr BinaryExpr) any {
+func (r *Resolver) visitBinaryExpr(expr BinaryExpr) none {
+	r.checkSelfOperation(expr.left, expr.operator, expr.right)
 	r.resolveExpression(expr.left)
 	r.resolveExpression(expr.right)
-	return nil
+	return none{}
 }
 
-func (r *Resolver) visitCallExpr(expr CallExpr) any {
+func (r *Resolver) visitCallExpr(expr CallExpr) none {
 	r.resolveExpression(expr.callee)
 	for _, arg := range expr.args {
 		r.resolveExpression(arg)
 	}
-	return nil
+	r.checkNamedArguments(expr)
+	return none{}
+}
+
+func (r *Resolver) visitConditionalExpr(expr ConditionalExpr) none {
+	r.checkCondition(expr.condition)
+	r.resolveExpression(expr.condition)
+	r.resolveExpression(expr.thenBranch)
+	r.resolveExpression(expr.elseBranch)
+	return none{}
 }
 
-func (r *Resolver) visitGetExpr(expr GetExpr) any {
+func (r *Resolver) visitFunctionExpr(expr FunctionExpr) none {
+	r.resolveFunction(expr.params, expr.body, ftFunction)
+	return none{}
+}
+
+func (r *Resolver) visitGetExpr(expr GetExpr) none {
 	r.resolveExpression(expr.object)
-	return nil
+	return none{}
 }
 
-func (r *Resolver) visitGroupingExpr(expr GroupingExpr) any {
+func (r *Resolver) visitGroupingExpr(expr GroupingExpr) none {
 	r.resolveExpression(expr.expression)
-	return nil
+	return none{}
+}
+
+func (r *Resolver) visitListExpr(expr ListExpr) none {
+	for _, element := range expr.elements {
+		r.resolveExpression(element)
+	}
+	return none{}
 }
 
-func (r *Resolver) visitLiteralExpr(expr LiteralExpr) any {
-	return nil
+func (r *Resolver) visitLiteralExpr(expr LiteralExpr) none {
+	return none{}
 }
 
-func (r *Resolver) visitLogicalExpr(expr LogicalExpr) any {
+func (r *Resolver) visitLogicalExpr(expr LogicalExpr) none {
+	r.checkSelfOperation(expr.left, expr.operator, expr.right)
 	r.resolveExpression(expr.left)
 	r.resolveExpression(expr.right)
-	return nil
+	return none{}
 }
 
-func (r *Resolver) visitSetExpr(expr SetExpr) any {
+func (r *Resolver) visitMapExpr(expr MapExpr) none {
+	for i := range expr.keys {
+		r.resolveExpression(expr.keys[i])
+		r.resolveExpression(expr.values[i])
+	}
+	return none{}
+}
+
+func (r *Resolver) visitSetExpr(expr SetExpr) none {
 	r.resolveExpression(expr.value)
 	r.resolveExpression(expr.object)
-	return nil
+	return none{}
+}
+
+func (r *Resolver) visitSubscriptExpr(expr SubscriptExpr) none {
+	r.resolveExpression(expr.object)
+	r.resolveExpression(expr.index)
+	return none{}
 }
 
-func (r *Resolver) visitSuperExpr(expr SuperExpr) any {
+func (r *Resolver) visitSubscriptSetExpr(expr SubscriptSetExpr) none {
+	r.resolveExpression(expr.object)
+	r.resolveExpression(expr.index)
+	r.resolveExpression(expr.value)
+	return none{}
+}
+
+func (r *Resolver) visitSuperExpr(expr SuperExpr) none {
 	if r.currentClassType == ctNone {
-		r.errorHandler.reportStaticError(expr.keyword.line, expr.keyword.lexeme,
+		r.errorHandler.reportStaticErrorAt(diag.SuperOutsideClass, expr.keyword,
 			errors.New("Can't use 'super' outside of a class."), false)
 	}
-	if r.currentClassType != ctSubClass {
-		r.errorHandler.reportStaticError(expr.keyword.line, expr.keyword.lexeme,
+	if r.currentClassType == ctTrait {
+		r.errorHandler.reportStaticErrorAt(diag.SuperWithoutSuperclass, expr.keyword,
+			errors.New("Can't use 'super' in a trait."), false)
+	} else if r.currentClassType != ctSubClass {
+		r.errorHandler.reportStaticErrorAt(diag.SuperWithoutSuperclass, expr.keyword,
 			errors.New("Can't user 'super' in a class with no superclass."), false)
 	}
 	r.resolveLocal(expr, expr.keyword)
-	return nil
+	return none{}
 }
 
-func (r *Resolver) visitThisExpr(expr ThisExpr) any {
+func (r *Resolver) visitThisExpr(expr ThisExpr) none {
 	if r.currentClassType == ctNone {
-		r.errorHandler.reportStaticError(expr.keyword.line, expr.keyword.lexeme,
+		r.errorHandler.reportStaticErrorAt(diag.ThisOutsideClass, expr.keyword,
 			errors.New("Can't use 'this' outside of a class."), false)
 	}
 	r.resolveLocal(expr, expr.keyword)
-	return nil
+	return none{}
 }
 
-func (r *Resolver) visitUnaryExpr(expr UnaryExpr) any {
+func (r *Resolver) visitUnaryExpr(expr UnaryExpr) none {
 	r.resolveExpression(expr.right)
-	return nil
+	return none{}
 }
 
-func (r *Resolver) visitVariableExpr(expr VariableExpr) any {
+func (r *Resolver) visitVariableExpr(expr VariableExpr) none {
 	if len(r.scopes) != 0 {
 		varDefined, hasVar := r.scopes[len(r.scopes)-1][expr.name.lexeme]
 		if hasVar && !varDefined {
-			r.errorHandler.reportStaticError(expr.name.line, expr.name.lexeme,
+			r.errorHandler.reportStaticErrorAt(diag.ReadInOwnInitializer, expr.name,
 				errors.New("Can't read local variable in its own initializer."), false)
 		}
 	}
 	r.resolveLocal(expr, expr.name)
-	return nil
+	return none{}
+}
+
+/******************************************************************************
+ * An assignment used directly as a condition, like "if (x = 5)", is almost
+ * always a comparison missing an '='. The grammar allows it, so it is only a
+ * warning. Wrapping the assignment in its own parentheses, as in
+ * "while ((line = next()))", says it is meant and silences the warning.
+ *****************************************************************************/
+
+func (r *Resolver) checkCondition(condition Expr) {
+	switch condition.(type) {
+	case AssignExpr, SetExpr, SubscriptSetExpr:
+		err := errors.New("Assignment used as a condition, did you mean '=='? Wrap it in parentheses if not.")
+		r.warn(diag.AssignmentInCondition, condition.Span(), err)
+	}
 }
@@ -1,53 +1,146 @@
 package lang
 
 import (
-	"errors"
 	"strconv"
+	"strings"
 	"unicode"
+
+	"github.com/skusel/glox/diag"
 )
 
 /******************************************************************************
  * The scanner takes in source code an transforms it into a list of tokens.
  * We are also able to catch a few static errors in the scanner. For example,
  * unterminated strings.
+ *
+ * Comments are normally thrown away. Tools that need to re-emit source code,
+ * like a formatter, can call PreserveComments before scanning to have them
+ * attached to the surrounding tokens as trivia instead.
  *****************************************************************************/
 
 type Scanner struct {
 	source       string
 	tokens       []Token
 	start        int
+	startPos     Position
 	current      int
+	end          int // offset scanning stops at, the end of the source unless scanning a range
 	line         int
+	lineStart    int // offset of the first byte of the current line
 	errorHandler *ErrorHandler
+	// comment preservation
+	keepComments    bool
+	pendingComments []Comment
+	directives      *Directives
 }
 
 func NewScanner(source string, errorHandler *ErrorHandler) *Scanner {
-	return &Scanner{source: source, start: 0, current: 0, line: 1, errorHandler: errorHandler}
+	return &Scanner{source: source, start: 0, current: 0, end: len(source), line: 1, errorHandler: errorHandler,
+		directives: newDirectives()}
 }
 
-func (s *Scanner) ScanTokens() []Token {
-	for !s.isAtEnd() {
+// scanRange scans only the part of the source from start up to the end offset
+func (s *Scanner) scanRange(start Position, end int) []Token {
+	s.startAt(start)
+	s.end = end
+	return s.ScanTokens()
+}
+
+// startAt moves the scanner to a position in the source, which has to be between tokens
+func (s *Scanner) startAt(start Position) {
+	s.current = start.Offset
+	s.line = start.Line
+	s.lineStart = start.Offset - start.Column + 1
+}
+
+/******************************************************************************
+ * scanUntil scans on from where the scanner is until it reaches the stop
+ * offset. It doesn't stop partway through a token or a comment, so it
+ * returns an offset past stop if one runs on past it. finish ends the
+ * tokens scanned so far with an end of file token.
+ *****************************************************************************/
+
+func (s *Scanner) scanUntil(stop int) int {
+	for s.current < stop && !s.isAtEnd() {
 		s.start = s.current
+		s.startPos = s.position()
 		s.scanToken()
 	}
-	s.tokens = append(s.tokens, Token{tokenType: tokenTypeEndOfFile, lexeme: "", literal: nil, line: s.line})
+	return s.current
+}
+
+func (s *Scanner) finish() []Token {
+	end := s.position()
+	s.appendToken(Token{tokenType: tokenTypeEndOfFile, lexeme: "", literal: nil, line: s.line,
+		span: Span{Start: end, End: end, source: s.source}})
 	return s.tokens
 }
 
+func (s *Scanner) PreserveComments() {
+	s.keepComments = true
+}
+
+// Directives returns the glox-lint and glox-fmt comments found by ScanTokens.
+func (s *Scanner) Directives() *Directives {
+	return s.directives
+}
+
+func (s *Scanner) ScanTokens() []Token {
+	s.scanUntil(s.end)
+	return s.finish()
+}
+
+func (s *Scanner) appendToken(token Token) {
+	if len(s.directives.pending) > 0 && token.tokenType != tokenTypeEndOfFile {
+		s.directives.disabled[token.line] = append(s.directives.disabled[token.line], s.directives.pending...)
+		s.directives.pending = nil
+	}
+	if len(s.pendingComments) > 0 {
+		token.leadingComments = s.pendingComments
+		s.pendingComments = nil
+	}
+	s.tokens = append(s.tokens, token)
+}
+
+func (s *Scanner) addComment() {
+	comment := Comment{Text: s.source[s.start:s.current], Span: Span{Start: s.startPos, End: s.position(), source: s.source}}
+	if len(s.tokens) > 0 && len(s.pendingComments) == 0 {
+		previous := &s.tokens[len(s.tokens)-1]
+		if previous.span.End.Line == comment.Span.Start.Line && previous.trailingComment == nil {
+			previous.trailingComment = &comment
+			return
+		}
+	}
+	s.pendingComments = append(s.pendingComments, comment)
+}
+
+func (s *Scanner) position() Position {
+	return Position{Offset: s.current, Line: s.line, Column: s.current - s.lineStart + 1}
+}
+
+func (s *Scanner) newLine() {
+	s.line++
+	s.lineStart = s.current
+}
+
 func (s *Scanner) addToken(t TokenType) {
 	s.addGenericToken(t, nil)
 }
 
 func (s *Scanner) addStringToken() {
 	for s.peek() != '"' && !s.isAtEnd() {
-		if s.peek() == '\n' {
-			s.line++
-		}
 		s.advance()
+		if s.previous() == '\n' {
+			s.newLine()
+		}
 	}
 
 	if s.isAtEnd() {
-		s.errorHandler.reportStaticError(s.line, "", errors.New("Unterminated string."), false)
+		if s.startPos.Line != s.line {
+			// the error is reported where the source ran out, so that is where it is shown
+			s.startPos = s.position()
+		}
+		s.error(diag.UnterminatedString, "Unterminated string.")
 		return
 	}
 
@@ -71,9 +164,17 @@ func (s *Scanner) addNumberToken() {
 		}
 	}
 
-	value, err := strconv.ParseFloat(s.source[s.start:s.current], 64)
+	text := s.source[s.start:s.current]
+	if !strings.Contains(text, ".") {
+		// integer literals too large for an int64 fall back to floats
+		if integer, err := strconv.ParseInt(text, 10, 64); err == nil {
+			s.addGenericToken(tokenTypeNumber, integer)
+			return
+		}
+	}
+	value, err := strconv.ParseFloat(text, 64)
 	if err != nil {
-		s.errorHandler.reportStaticError(s.line, "", errors.New("Invalid number."), false)
+		s.error(diag.InvalidNumber, "Invalid number.")
 	} else {
 		s.addGenericToken(tokenTypeNumber, value)
 	}
@@ -87,8 +188,12 @@ func (s *Scanner) addIdentifierToken() {
 	text := s.source[s.start:s.current]
 	if text == "and" {
 		s.addGenericToken(tokenTypeAnd, text)
+	} else if text == "break" {
+		s.addGenericToken(tokenTypeBreak, text)
 	} else if text == "class" {
 		s.addGenericToken(tokenTypeClass, text)
+	} else if text == "continue" {
+		s.addGenericToken(tokenTypeContinue, text)
 	} else if text == "else" {
 		s.addGenericToken(tokenTypeElse, text)
 	} else if text == "false" {
@@ -99,6 +204,8 @@ func (s *Scanner) addIdentifierToken() {
 		s.addGenericToken(tokenTypeFun, text)
 	} else if text == "if" {
 		s.addGenericToken(tokenTypeIf, text)
+	} else if text == "import" {
+		s.addGenericToken(tokenTypeImport, text)
 	} else if text == "nil" {
 		s.addGenericToken(tokenTypeNil, text)
 	} else if text == "or" {
@@ -124,7 +231,8 @@ func (s *Scanner) addIdentifierToken() {
 
 func (s *Scanner) addGenericToken(tokenType TokenType, literal any) {
 	text := s.source[s.start:s.current]
-	s.tokens = append(s.tokens, Token{tokenType: tokenType, lexeme: text, literal: literal, line: s.line})
+	s.appendToken(Token{tokenType: tokenType, lexeme: text, literal: literal, line: s.line,
+		span: Span{Start: s.startPos, End: s.position(), source: s.source}})
 }
 
 func (s *Scanner) scanToken() {
@@ -141,10 +249,22 @@ func (s *Scanner) scanToken() {
 		s.addToken(tokenTypeLeftBrace)
 	case '}':
 		s.addToken(tokenTypeRightBrace)
+	case '[':
+		s.addToken(tokenTypeLeftBracket)
+	case ']':
+		s.addToken(tokenTypeRightBracket)
+	case ':':
+		s.addToken(tokenTypeColon)
 	case ',':
 		s.addToken(tokenTypeComma)
 	case '.':
-		s.addToken(tokenTypeDot)
+		if s.peek() == '.' && s.peekNext() == '.' {
+			s.advance()
+			s.advance()
+			s.addToken(tokenTypeDotDotDot)
+		} else {
+			s.addToken(tokenTypeDot)
+		}
 	case '-':
 		s.addToken(tokenTypeMinus)
 	case '+':
@@ -155,6 +275,14 @@ func (s *Scanner) scanToken() {
 		s.addToken(tokenTypeStar)
 	case '%':
 		s.addToken(tokenTypeMod)
+	case '?':
+		s.addToken(tokenTypeQuestion)
+	case '&':
+		s.addToken(tokenTypeAmpersand)
+	case '|':
+		s.addToken(tokenTypePipe)
+	case '^':
+		s.addToken(tokenTypeCaret)
 	case '!':
 		if s.match('=') {
 			s.addToken(tokenTypeBangEqual)
@@ -170,12 +298,16 @@ func (s *Scanner) scanToken() {
 	case '<':
 		if s.match('=') {
 			s.addToken(tokenTypeLessEqual)
+		} else if s.match('<') {
+			s.addToken(tokenTypeLessLess)
 		} else {
 			s.addToken(tokenTypeLess)
 		}
 	case '>':
 		if s.match('=') {
 			s.addToken(tokenTypeGreaterEqual)
+		} else if s.match('>') {
+			s.addToken(tokenTypeGreaterGreater)
 		} else {
 			s.addToken(tokenTypeGreater)
 		}
@@ -185,11 +317,18 @@ func (s *Scanner) scanToken() {
 			for s.peek() != '\n' && !s.isAtEnd() {
 				s.advance()
 			}
+			if text := s.source[s.start:s.current]; strings.HasPrefix(strings.TrimSpace(text[2:]), "glox-") {
+				trailing := len(s.tokens) > 0 && s.tokens[len(s.tokens)-1].span.End.Line == s.line
+				s.directive(text, s.line, trailing)
+			}
+			if s.keepComments {
+				s.addComment()
+			}
 		} else {
 			s.addToken(tokenTypeSlash)
 		}
 	case '\n':
-		s.line++
+		s.newLine()
 	case '"':
 		s.addStringToken()
 	default:
@@ -198,13 +337,13 @@ func (s *Scanner) scanToken() {
 		} else if unicode.IsLetter(rune(c)) || c == '_' {
 			s.addIdentifierToken()
 		} else {
-			s.errorHandler.reportStaticError(s.line, "", errors.New("Unexpected character."), false)
+			s.error(diag.UnexpectedCharacter, "Unexpected character.")
 		}
 	}
 }
 
 func (s *Scanner) isAtEnd() bool {
-	return s.current >= len(s.source)
+	return s.current >= s.end
 }
 
 func (s *Scanner) advance() byte {
@@ -213,6 +352,10 @@ func (s *Scanner) advance() byte {
 	return nextC
 }
 
+func (s *Scanner) previous() byte {
+	return s.source[s.current-1]
+}
+
 func (s *Scanner) match(expected byte) bool {
 	if s.isAtEnd() {
 		return false
@@ -224,6 +367,13 @@ func (s *Scanner) match(expected byte) bool {
 	return true
 }
 
+// error reports a problem with the lexeme being scanned
+func (s *Scanner) error(code diag.Code, msg string) {
+	span := Span{Start: s.startPos, End: s.position(), source: s.source}
+	s.errorHandler.reportStatic(locate(diag.Diagnostic{Code: code, Severity: diag.SeverityError, Line: s.line,
+		Message: msg}, span), false)
+}
+
 func (s *Scanner) peek() byte {
 	// this scanner has a lookahead of 1
 	if s.isAtEnd() {
@@ -234,9 +384,22 @@ func (s *Scanner) peek() byte {
 }
 
 func (s *Scanner) peekNext() byte {
-	if s.current+1 >= len(s.source) {
+	if s.current+1 >= s.end {
 		return 0
 	} else {
 		return s.source[s.current+1]
 	}
 }
+
+// isIdentifier reports whether text would scan as a single identifier or keyword
+func isIdentifier(text string) bool {
+	if len(text) == 0 || unicode.IsDigit(rune(text[0])) {
+		return false
+	}
+	for i := 0; i < len(text); i++ {
+		if !unicode.IsDigit(rune(text[i])) && !unicode.IsLetter(rune(text[i])) && text[i] != '_' {
+			return false
+		}
+	}
+	return true
+}
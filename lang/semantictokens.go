@@ -0,0 +1,162 @@
+package lang
+
+import "unicode/utf16"
+
+/******************************************************************************
+ * Semantic tokens let an editor highlight Lox with glox's own scanner instead
+ * of a grammar of regular expressions that drifts out of date. ClassifyTokens
+ * scans source, comments included, and sorts each token into one of the
+ * categories of SemanticTokenLegend. Punctuation like parentheses and
+ * semicolons is left out, editors draw it in the default color. The words
+ * "trait", "with", "as", and "in" are only keywords where the parser treats
+ * them as one, anywhere else they are identifiers.
+ *
+ * Scanning never stops at an error, so source that is in the middle of being
+ * typed is classified as far as it can be. Characters the scanner can't make
+ * sense of, like the rest of an unterminated string, are left out.
+ *
+ * EncodeSemanticTokens packs the tokens into the array of integers an LSP
+ * textDocument/semanticTokens response carries. Each token is five integers:
+ * the line relative to the previous token, the start character relative to
+ * the previous token if they're on the same line, the length, the index of
+ * its category in the legend, and a modifier bitset that is always 0.
+ * Positions there count from 0 and in UTF-16 code units, and a token can't
+ * span lines, so a multi-line string is split into one token per line.
+ *****************************************************************************/
+
+type TokenCategory int
+
+const (
+	CategoryKeyword TokenCategory = iota
+	CategoryString
+	CategoryNumber
+	CategoryIdentifier
+	CategoryComment
+	CategoryOperator
+)
+
+// SemanticTokenLegend names the categories with the standard LSP token types, in TokenCategory order.
+var SemanticTokenLegend = []string{"keyword", "string", "number", "variable", "comment", "operator"}
+
+func (c TokenCategory) String() string {
+	if c == CategoryIdentifier {
+		return "identifier"
+	}
+	return SemanticTokenLegend[c]
+}
+
+type SemanticToken struct {
+	Category TokenCategory
+	Span     Span
+}
+
+// ClassifyTokens returns the tokens and comments in source that get highlighted, in source order.
+func ClassifyTokens(source string) []SemanticToken {
+	scanner := NewScanner(source, silentErrorHandler())
+	scanner.PreserveComments()
+	tokens := scanner.ScanTokens()
+	classified := make([]SemanticToken, 0, len(tokens))
+	comment := func(comment Comment) {
+		classified = append(classified, SemanticToken{Category: CategoryComment, Span: comment.Span})
+	}
+	for i, token := range tokens {
+		for _, leading := range token.leadingComments {
+			comment(leading)
+		}
+		if category, highlighted := tokenCategory(tokens, i); highlighted {
+			classified = append(classified, SemanticToken{Category: category, Span: token.span})
+		}
+		if token.trailingComment != nil {
+			comment(*token.trailingComment)
+		}
+	}
+	return classified
+}
+
+func tokenCategory(tokens []Token, i int) (TokenCategory, bool) {
+	switch tokens[i].tokenType {
+	case tokenTypeString:
+		return CategoryString, true
+	case tokenTypeNumber:
+		return CategoryNumber, true
+	case tokenTypeIdentifier:
+		if contextualKeyword(tokens, i) {
+			return CategoryKeyword, true
+		}
+		return CategoryIdentifier, true
+	case tokenTypeMinus, tokenTypePlus, tokenTypeSlash, tokenTypeStar, tokenTypeMod, tokenTypeQuestion,
+		tokenTypeColon, tokenTypeAmpersand, tokenTypePipe, tokenTypeCaret, tokenTypeBang, tokenTypeBangEqual,
+		tokenTypeEqual, tokenTypeEqualEqual, tokenTypeGreater, tokenTypeGreaterEqual, tokenTypeLess,
+		tokenTypeLessEqual, tokenTypeLessLess, tokenTypeGreaterGreater, tokenTypeDotDotDot:
+		return CategoryOperator, true
+	case tokenTypeLeftParen, tokenTypeRightParen, tokenTypeLeftBrace, tokenTypeRightBrace, tokenTypeLeftBracket,
+		tokenTypeRightBracket, tokenTypeComma, tokenTypeDot, tokenTypeSemicolon, tokenTypeEndOfFile:
+		return 0, false
+	}
+	return CategoryKeyword, true
+}
+
+// contextualKeyword reports whether an identifier is used as a keyword, following the parser's rules
+func contextualKeyword(tokens []Token, i int) bool {
+	next := func(tokenType TokenType) bool {
+		return i+1 < len(tokens) && tokens[i+1].tokenType == tokenType
+	}
+	switch tokens[i].lexeme {
+	case "trait":
+		return next(tokenTypeIdentifier) && (i == 0 || startsDeclaration(tokens[i-1].tokenType))
+	case "in":
+		return i >= 4 && tokens[i-1].tokenType == tokenTypeIdentifier && tokens[i-2].tokenType == tokenTypeVar &&
+			tokens[i-3].tokenType == tokenTypeLeftParen && tokens[i-4].tokenType == tokenTypeFor
+	case "as":
+		return i >= 2 && tokens[i-1].tokenType == tokenTypeString && tokens[i-2].tokenType == tokenTypeImport
+	case "with":
+		// class Name ( "<" Name )? with
+		j := i - 1
+		if j >= 2 && tokens[j-1].tokenType == tokenTypeLess {
+			j -= 2
+		}
+		return j >= 1 && tokens[j].tokenType == tokenTypeIdentifier && tokens[j-1].tokenType == tokenTypeClass
+	}
+	return false
+}
+
+func startsDeclaration(previous TokenType) bool {
+	return previous == tokenTypeSemicolon || previous == tokenTypeLeftBrace || previous == tokenTypeRightBrace
+}
+
+// EncodeSemanticTokens packs classified tokens into the LSP semantic tokens format.
+func EncodeSemanticTokens(source string, tokens []SemanticToken) []uint32 {
+	data := make([]uint32, 0, len(tokens)*5)
+	previousLine, previousStart := 0, 0
+	emit := func(line int, lineStart int, start int, end int, category TokenCategory) {
+		character := utf16Length(source[lineStart:start])
+		length := utf16Length(source[start:end])
+		if length == 0 {
+			return
+		}
+		deltaStart := character
+		if line == previousLine {
+			deltaStart -= previousStart
+		}
+		data = append(data, uint32(line-previousLine), uint32(deltaStart), uint32(length), uint32(category), 0)
+		previousLine, previousStart = line, character
+	}
+	for _, token := range tokens {
+		line := token.Span.Start.Line - 1
+		lineStart := token.Span.Start.Offset - token.Span.Start.Column + 1
+		start := token.Span.Start.Offset
+		for offset := start; offset < token.Span.End.Offset; offset++ {
+			if source[offset] == '\n' {
+				emit(line, lineStart, start, offset, token.Category)
+				line++
+				lineStart, start = offset+1, offset+1
+			}
+		}
+		emit(line, lineStart, start, token.Span.End.Offset, token.Category)
+	}
+	return data
+}
+
+func utf16Length(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
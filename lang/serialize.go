@@ -0,0 +1,388 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * serialize() and deserialize() turn values into text and back. The text
+ * reads like the Lox that would build the value, with instances written as
+ * their class name followed by their fields:
+ *
+ *   [1, 2.5, "three", {"origin": Point {x: 0, y: 0}}]
+ *
+ * Integers and floats are told apart by the decimal point, so a value comes
+ * back with the same type it went out with, and fields and map entries are
+ * written in the order they were added, so the same value always gives the
+ * same text.
+ *
+ * A class can choose its own representation by defining a serialize()
+ * method. Whatever it returns is written in place of the fields, as
+ * Name(value), and deserialize() makes a blank instance, without running
+ * init, and passes the value to its deserialize(data) method to restore it.
+ * Instances without the hook are restored the same way, with their fields
+ * set directly.
+ *
+ * Values are written out in full wherever they appear. A value reachable
+ * twice is read back as two copies, and a value that contains itself can't
+ * be serialized at all.
+ *****************************************************************************/
+
+type serializer struct {
+	builder strings.Builder
+	path    map[runtime.Value]bool // the lists, maps, and instances being written around the current value
+}
+
+func serialize(value runtime.Value) (string, error) {
+	s := &serializer{path: make(map[runtime.Value]bool)}
+	if err := s.write(value); err != nil {
+		return "", err
+	}
+	return s.builder.String(), nil
+}
+
+func (s *serializer) write(value runtime.Value) error {
+	switch value := value.(type) {
+	case nil, bool, int64:
+		s.builder.WriteString(runtime.Stringify(value))
+		return nil
+	case float64:
+		s.builder.WriteString(formatFloat(value))
+		return nil
+	case string:
+		s.builder.WriteString(strconv.Quote(value))
+		return nil
+	case *runtime.List, *runtime.Map, *runtime.Instance:
+		if s.path[value] {
+			return errors.New("serialize() can't serialize a value that contains itself.")
+		}
+		s.path[value] = true
+		defer delete(s.path, value)
+	default:
+		return fmt.Errorf("serialize() can't serialize %s.", runtime.Stringify(value))
+	}
+
+	switch value := value.(type) {
+	case *runtime.List:
+		s.builder.WriteString("[")
+		for i, element := range value.Elements() {
+			if i > 0 {
+				s.builder.WriteString(", ")
+			}
+			if err := s.write(element); err != nil {
+				return err
+			}
+		}
+		s.builder.WriteString("]")
+	case *runtime.Map:
+		s.builder.WriteString("{")
+		for i, key := range value.Keys() {
+			if i > 0 {
+				s.builder.WriteString(", ")
+			}
+			entry, _ := value.Get(key)
+			if err := s.write(key); err != nil {
+				return err
+			}
+			s.builder.WriteString(": ")
+			if err := s.write(entry); err != nil {
+				return err
+			}
+		}
+		s.builder.WriteString("}")
+	case *runtime.Instance:
+		return s.writeInstance(value)
+	}
+	return nil
+}
+
+func (s *serializer) writeInstance(instance *runtime.Instance) error {
+	s.builder.WriteString(instance.Class().Name())
+	if hook, hasHook := instance.Class().FindMethod("serialize"); hasHook {
+		data, err := hook.Bind(instance).Call(nil)
+		if err != nil {
+			return err
+		}
+		s.builder.WriteString("(")
+		if err := s.write(data); err != nil {
+			return err
+		}
+		s.builder.WriteString(")")
+		return nil
+	}
+	s.builder.WriteString(" {")
+	for i, name := range instance.FieldNames() {
+		if i > 0 {
+			s.builder.WriteString(", ")
+		}
+		if isIdentifier(name) {
+			s.builder.WriteString(name)
+		} else {
+			s.builder.WriteString(strconv.Quote(name))
+		}
+		s.builder.WriteString(": ")
+		field, _ := instance.Field(name)
+		if err := s.write(field); err != nil {
+			return err
+		}
+	}
+	s.builder.WriteString("}")
+	return nil
+}
+
+// formatFloat writes a float so that it reads back as a float, even when it has an integer value
+func formatFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "nan"
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	}
+	text := strconv.FormatFloat(value, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".e") {
+		text += ".0"
+	}
+	return text
+}
+
+/******************************************************************************
+ * deserializer reads the text serialize() writes. Classes are looked up by
+ * name among the globals of the script calling deserialize(), the same way
+ * classNamed() finds them.
+ *****************************************************************************/
+
+type deserializer struct {
+	text        string
+	pos         int
+	interpreter *Interpreter
+}
+
+func deserialize(text string, interpreter *Interpreter) (runtime.Value, error) {
+	d := &deserializer{text: text, interpreter: interpreter}
+	value, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.skipSpace(); d.pos < len(d.text) {
+		return nil, d.errorf("the end of the text")
+	}
+	return value, nil
+}
+
+func (d *deserializer) value() (runtime.Value, error) {
+	d.skipSpace()
+	if d.pos >= len(d.text) {
+		return nil, d.errorf("a value")
+	}
+	switch c := d.text[d.pos]; {
+	case c == '"':
+		return d.string()
+	case c == '[':
+		return d.list()
+	case c == '{':
+		return d.mapValue()
+	case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return d.number()
+	}
+	word := d.word()
+	switch word {
+	case "nil":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf":
+		return math.Inf(1), nil
+	case "nan":
+		return math.NaN(), nil
+	case "":
+		return nil, d.errorf("a value")
+	}
+	return d.instance(word)
+}
+
+func (d *deserializer) string() (string, error) {
+	start := d.pos
+	for d.pos++; d.pos < len(d.text) && d.text[d.pos] != '"'; d.pos++ {
+		if d.text[d.pos] == '\\' {
+			d.pos++
+		}
+	}
+	if d.pos >= len(d.text) {
+		return "", fmt.Errorf("deserialize() found an unterminated string at offset %d.", start)
+	}
+	d.pos++
+	str, err := strconv.Unquote(d.text[start:d.pos])
+	if err != nil {
+		return "", fmt.Errorf("deserialize() found an invalid string at offset %d.", start)
+	}
+	return str, nil
+}
+
+func (d *deserializer) number() (runtime.Value, error) {
+	start := d.pos
+	if d.text[d.pos] == '-' {
+		d.pos++
+		if d.word() == "inf" {
+			return math.Inf(-1), nil
+		}
+		d.pos = start + 1
+	}
+	for d.pos < len(d.text) && strings.IndexByte("0123456789.eE+-", d.text[d.pos]) >= 0 {
+		d.pos++
+	}
+	text := d.text[start:d.pos]
+	if !strings.ContainsAny(text, ".eE") {
+		if integer, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return integer, nil
+		}
+	} else if float, err := strconv.ParseFloat(text, 64); err == nil {
+		return float, nil
+	}
+	return nil, fmt.Errorf("deserialize() found an invalid number at offset %d.", start)
+}
+
+func (d *deserializer) list() (runtime.Value, error) {
+	elements := make([]runtime.Value, 0)
+	err := d.sequence('[', ']', func() error {
+		element, err := d.value()
+		elements = append(elements, element)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return runtime.NewList(elements), nil
+}
+
+func (d *deserializer) mapValue() (runtime.Value, error) {
+	m := runtime.NewMap()
+	err := d.sequence('{', '}', func() error {
+		key, err := d.value()
+		if err != nil {
+			return err
+		}
+		if err := d.expect(':'); err != nil {
+			return err
+		}
+		entry, err := d.value()
+		m.Set(key, entry)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (d *deserializer) instance(className string) (runtime.Value, error) {
+	class, _ := d.interpreter.globalValue(className)
+	if _, isClass := class.(*runtime.Class); !isClass {
+		return nil, fmt.Errorf("deserialize() can't find a class named '%s'.", className)
+	}
+	instance := runtime.NewInstance(class.(*runtime.Class))
+	if d.skipSpace(); d.pos < len(d.text) && d.text[d.pos] == '(' {
+		d.pos++
+		data, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := d.expect(')'); err != nil {
+			return nil, err
+		}
+		hook, hasHook := instance.Class().FindMethod("deserialize")
+		if !hasHook {
+			return nil, fmt.Errorf("deserialize() needs class '%s' to have a deserialize(data) method.", className)
+		}
+		if _, err := hook.Bind(instance).Call([]runtime.Value{data}); err != nil {
+			return nil, err
+		}
+		return instance, nil
+	}
+	err := d.sequence('{', '}', func() error {
+		d.skipSpace()
+		var name string
+		if d.pos < len(d.text) && d.text[d.pos] == '"' {
+			quoted, err := d.string()
+			if err != nil {
+				return err
+			}
+			name = quoted
+		} else if name = d.word(); name == "" {
+			return d.errorf("a field name")
+		}
+		if err := d.expect(':'); err != nil {
+			return err
+		}
+		field, err := d.value()
+		instance.Set(name, field)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+// sequence reads comma separated items between open and close, calling item for each one
+func (d *deserializer) sequence(open byte, close byte, item func() error) error {
+	if err := d.expect(open); err != nil {
+		return err
+	}
+	if d.skipSpace(); d.pos < len(d.text) && d.text[d.pos] == close {
+		d.pos++
+		return nil
+	}
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		d.skipSpace()
+		if d.pos < len(d.text) && d.text[d.pos] == ',' {
+			d.pos++
+			continue
+		}
+		return d.expect(close)
+	}
+}
+
+func (d *deserializer) expect(c byte) error {
+	if d.skipSpace(); d.pos < len(d.text) && d.text[d.pos] == c {
+		d.pos++
+		return nil
+	}
+	return d.errorf("'" + string(c) + "'")
+}
+
+// word reads an identifier, or returns "" if there isn't one
+func (d *deserializer) word() string {
+	start := d.pos
+	for d.pos < len(d.text) && (d.text[d.pos] == '_' || unicode.IsLetter(rune(d.text[d.pos])) ||
+		(d.pos > start && d.text[d.pos] >= '0' && d.text[d.pos] <= '9')) {
+		d.pos++
+	}
+	return d.text[start:d.pos]
+}
+
+func (d *deserializer) skipSpace() {
+	for d.pos < len(d.text) && strings.IndexByte(" \t\r\n", d.text[d.pos]) >= 0 {
+		d.pos++
+	}
+}
+
+func (d *deserializer) errorf(expected string) error {
+	if d.pos >= len(d.text) {
+		return fmt.Errorf("deserialize() expected %s but the text ended.", expected)
+	}
+	return fmt.Errorf("deserialize() expected %s at offset %d.", expected, d.pos)
+}
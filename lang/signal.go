@@ -0,0 +1,169 @@
+package lang
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * onSignal lets a script handle a signal from the operating system, like
+ * Ctrl-C sending INT, instead of being killed by it. Signals arrive on
+ * another goroutine, so they can't call into the script directly. They are
+ * queued and raise the interrupt flag the engines already check, and the
+ * handlers run at the next check, between statements for the tree-walker
+ * and at the next call or loop for the VM. A handler can tidy up and carry
+ * on, set a flag the script's main loop reads, or call exit().
+ *
+ * Handlers belong to the script and the modules it imports, workers can't
+ * set them. Passing nil for the handler puts the signal's default behavior
+ * back.
+ *****************************************************************************/
+
+/******************************************************************************
+ * FlushOnExitSignals flushes output when INT or TERM arrives and then exits
+ * the way the signal would have, with 128 plus its number, so what a script
+ * printed before it was stopped isn't lost in the buffer. A signal some
+ * script handles with onSignal is left to the script.
+ *****************************************************************************/
+
+var exitSignals struct {
+	mutex    sync.Mutex
+	incoming chan os.Signal // nil until FlushOnExitSignals is called
+	handled  map[os.Signal]int
+}
+
+func (o *BufferedOutput) FlushOnExitSignals() {
+	exitSignals.mutex.Lock()
+	defer exitSignals.mutex.Unlock()
+	if exitSignals.incoming != nil {
+		return
+	}
+	exitSignals.incoming = make(chan os.Signal, 1)
+	signal.Notify(exitSignals.incoming, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for sig := range exitSignals.incoming {
+			exitSignals.mutex.Lock()
+			handled := exitSignals.handled[sig] > 0
+			exitSignals.mutex.Unlock()
+			if !handled {
+				o.Flush()
+				os.Exit(128 + int(sig.(syscall.Signal)))
+			}
+		}
+	}()
+}
+
+// trackSignalHandler counts the scripts handling a signal, so FlushOnExitSignals leaves it to them
+func trackSignalHandler(sig os.Signal, delta int) {
+	exitSignals.mutex.Lock()
+	defer exitSignals.mutex.Unlock()
+	if exitSignals.handled == nil {
+		exitSignals.handled = make(map[os.Signal]int)
+	}
+	exitSignals.handled[sig] += delta
+	if delta < 0 && exitSignals.incoming != nil && (sig == syscall.SIGINT || sig == syscall.SIGTERM) {
+		signal.Notify(exitSignals.incoming, sig) // signal.Reset stopped it too
+	}
+}
+
+var signalsByName = map[string]os.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+}
+
+type signalHandlers struct {
+	mutex    sync.Mutex
+	handlers map[string]runtime.Callable
+	pending  []string // names of the signals that arrived and haven't been handled yet
+	incoming chan os.Signal
+}
+
+func (interpreter *Interpreter) setSignalHandler(name string, handler runtime.Callable) error {
+	sig, known := signalsByName[name]
+	if !known {
+		return errors.New("onSignal() expects one of " + signalNames() + ".")
+	}
+	if interpreter.worker != nil {
+		return errors.New("onSignal() can't be used in a worker.")
+	}
+	i := interpreter.interrupts
+	s := &i.signals
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[string]runtime.Callable)
+		s.incoming = make(chan os.Signal, len(signalsByName))
+		go s.receive(i)
+	}
+	_, hadHandler := s.handlers[name]
+	if handler == nil {
+		if hadHandler {
+			delete(s.handlers, name)
+			signal.Reset(sig)
+			trackSignalHandler(sig, -1)
+		}
+		return nil
+	}
+	if !hadHandler {
+		trackSignalHandler(sig, 1)
+	}
+	s.handlers[name] = handler
+	signal.Notify(s.incoming, sig)
+	return nil
+}
+
+// receive queues signals as they arrive and raises the interrupt flag so they get handled
+func (s *signalHandlers) receive(i *interrupts) {
+	for sig := range s.incoming {
+		for name, known := range signalsByName {
+			if known == sig {
+				s.mutex.Lock()
+				s.pending = append(s.pending, name)
+				s.mutex.Unlock()
+			}
+		}
+		i.signalled.Store(true)
+		i.raised.Store(true)
+		wakeLockWaiters()
+	}
+}
+
+// handleSignals runs the handlers for the signals that have arrived since it last ran
+func (interpreter *Interpreter) handleSignals() {
+	s := &interpreter.interrupts.signals
+	s.mutex.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mutex.Unlock()
+	for _, name := range pending {
+		s.mutex.Lock()
+		handler := s.handlers[name]
+		s.mutex.Unlock()
+		if handler == nil {
+			continue
+		}
+		if _, err := handler.Call(nil); err != nil {
+			stack := interpreter.stack
+			interpreter.errorHandler.reportRuntimeError(diag.NativeError, stack.frames[len(stack.frames)-1].line, err)
+		}
+	}
+}
+
+func signalNames() string {
+	names := make([]string, 0, len(signalsByName))
+	for name := range signalsByName {
+		names = append(names, "\""+name+"\"")
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
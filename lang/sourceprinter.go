@@ -0,0 +1,321 @@
+package lang
+
+import (
+	"strconv"
+	"strings"
+)
+
+/******************************************************************************
+ * PrintSource turns an AST back into Lox source code that parses into the
+ * same tree. The output is plain: one statement per line, blocks indented by
+ * four spaces, and comments lost. Operands that are themselves operators are
+ * always wrapped in parentheses, so the result never depends on precedence
+ * rules. Those extra parentheses are the one way reparsing the output can
+ * give a different tree, it picks up grouping nodes that weren't there.
+ *
+ * for loops come back as a while statement with an increment, which prints as
+ * for (; condition; increment), inside a block holding the initializer.
+ * Trees the parser can't produce may not survive the trip, like an if with
+ * an else whose then branch is an if without one, which would reparse with
+ * the else on the inner if.
+ *****************************************************************************/
+
+func PrintSource(statements []Stmt) string {
+	var sb strings.Builder
+	for _, stmt := range statements {
+		sb.WriteString(sourcePrinter{}.stmt(stmt))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+type sourcePrinter struct {
+	indent int
+}
+
+func (p sourcePrinter) stmt(stmt Stmt) string {
+	return strings.Repeat("    ", p.indent) + acceptStmt(stmt, p)
+}
+
+// block prints statements between braces, the opening brace going on the current line
+func (p sourcePrinter) block(statements []Stmt) string {
+	if len(statements) == 0 {
+		return "{}"
+	}
+	inner := sourcePrinter{indent: p.indent + 1}
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for _, stmt := range statements {
+		sb.WriteString(inner.stmt(stmt))
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(strings.Repeat("    ", p.indent) + "}")
+	return sb.String()
+}
+
+// body prints the statement controlled by an if or a loop, on the same line if it is a block
+func (p sourcePrinter) body(stmt Stmt) string {
+	if block, isBlock := stmt.(BlockStmt); isBlock {
+		return " " + p.block(block.statements)
+	}
+	return "\n" + sourcePrinter{indent: p.indent + 1}.stmt(stmt)
+}
+
+func (p sourcePrinter) function(name string, params []Token, variadic bool, body []Stmt, isGetter bool) string {
+	if isGetter {
+		return name + " " + p.block(body)
+	}
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.lexeme
+	}
+	if variadic {
+		names[len(names)-1] = "..." + names[len(names)-1]
+	}
+	return name + "(" + strings.Join(names, ", ") + ") " + p.block(body)
+}
+
+func (p sourcePrinter) methods(methods []FunctionStmt) string {
+	if len(methods) == 0 {
+		return "{}"
+	}
+	inner := sourcePrinter{indent: p.indent + 1}
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for _, method := range methods {
+		sb.WriteString(strings.Repeat("    ", inner.indent))
+		sb.WriteString(inner.function(method.name.lexeme, method.params, method.variadic, method.body, method.isGetter))
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(strings.Repeat("    ", p.indent) + "}")
+	return sb.String()
+}
+
+func (p sourcePrinter) visitBlockStmt(stmt BlockStmt) string {
+	return p.block(stmt.statements)
+}
+
+func (p sourcePrinter) visitBreakStmt(stmt BreakStmt) string {
+	return "break;"
+}
+
+func (p sourcePrinter) visitClassStmt(stmt ClassStmt) string {
+	header := "class " + stmt.name.lexeme
+	if stmt.superclass.getId() != 0 {
+		header += " < " + stmt.superclass.name.lexeme
+	}
+	if len(stmt.traits) > 0 {
+		header += " with " + p.list(stmt.traits)
+	}
+	return header + " " + p.methods(stmt.methods)
+}
+
+func (p sourcePrinter) visitContinueStmt(stmt ContinueStmt) string {
+	return "continue;"
+}
+
+func (p sourcePrinter) visitErrorStmt(stmt ErrorStmt) string {
+	// the tokens that didn't parse are printed as they were written
+	lexemes := make([]string, len(stmt.tokens))
+	for i, token := range stmt.tokens {
+		lexemes[i] = token.lexeme
+	}
+	return strings.Join(lexemes, " ")
+}
+
+func (p sourcePrinter) visitExprStmt(stmt ExprStmt) string {
+	expr := p.expr(stmt.expr)
+	// at the start of a statement these would begin a block or a function declaration
+	if strings.HasPrefix(expr, "{") || strings.HasPrefix(expr, "fun(") {
+		expr = "(" + expr + ")"
+	}
+	return expr + ";"
+}
+
+func (p sourcePrinter) visitForEachStmt(stmt ForEachStmt) string {
+	return "for (var " + stmt.name.lexeme + " in " + p.expr(stmt.collection) + ")" + p.body(stmt.body)
+}
+
+func (p sourcePrinter) visitFunctionStmt(stmt FunctionStmt) string {
+	return "fun " + p.function(stmt.name.lexeme, stmt.params, stmt.variadic, stmt.body, false)
+}
+
+func (p sourcePrinter) visitIfStmt(stmt IfStmt) string {
+	source := "if (" + p.expr(stmt.condition) + ")" + p.body(stmt.thenBranch)
+	if stmt.elseBranch == nil {
+		return source
+	}
+	if _, isBlock := stmt.thenBranch.(BlockStmt); isBlock {
+		source += " else"
+	} else {
+		source += "\n" + strings.Repeat("    ", p.indent) + "else"
+	}
+	if _, isIf := stmt.elseBranch.(IfStmt); isIf {
+		return source + " " + acceptStmt(stmt.elseBranch, p)
+	}
+	return source + p.body(stmt.elseBranch)
+}
+
+func (p sourcePrinter) visitImportStmt(stmt ImportStmt) string {
+	return "import " + stmt.path.lexeme + " as " + stmt.name.lexeme + ";"
+}
+
+func (p sourcePrinter) visitPrintStmt(stmt PrintStmt) string {
+	return "print " + p.expr(stmt.expr) + ";"
+}
+
+func (p sourcePrinter) visitReturnStmt(stmt ReturnStmt) string {
+	if stmt.value == nil {
+		return "return;"
+	}
+	return "return " + p.expr(stmt.value) + ";"
+}
+
+func (p sourcePrinter) visitTraitStmt(stmt TraitStmt) string {
+	return "trait " + stmt.name.lexeme + " " + p.methods(stmt.methods)
+}
+
+func (p sourcePrinter) visitVarStmt(stmt VarStmt) string {
+	if stmt.initializer == nil {
+		return "var " + stmt.name.lexeme + ";"
+	}
+	return "var " + stmt.name.lexeme + " = " + p.expr(stmt.initializer) + ";"
+}
+
+func (p sourcePrinter) visitWhileStmt(stmt WhileStmt) string {
+	if stmt.increment != nil {
+		return "for (; " + p.expr(stmt.condition) + "; " + p.expr(stmt.increment) + ")" + p.body(stmt.body)
+	}
+	return "while (" + p.expr(stmt.condition) + ")" + p.body(stmt.body)
+}
+
+func (p sourcePrinter) expr(expr Expr) string {
+	return acceptExpr(expr, p)
+}
+
+func (p sourcePrinter) list(exprs []Expr) string {
+	printed := make([]string, len(exprs))
+	for i, expr := range exprs {
+		printed[i] = p.expr(expr)
+	}
+	return strings.Join(printed, ", ")
+}
+
+// operand prints an operand of an operator, in parentheses if it is an operator too
+func (p sourcePrinter) operand(expr Expr) string {
+	switch expr.(type) {
+	case AssignExpr, BinaryExpr, ConditionalExpr, LogicalExpr, SetExpr, SubscriptSetExpr:
+		return "(" + p.expr(expr) + ")"
+	}
+	return p.expr(expr)
+}
+
+// postfix prints the expression a call, property, or subscript applies to
+func (p sourcePrinter) postfix(expr Expr) string {
+	switch expr.(type) {
+	case CallExpr, GetExpr, GroupingExpr, ListExpr, LiteralExpr, MapExpr, SubscriptExpr, SuperExpr, ThisExpr,
+		VariableExpr, FunctionExpr:
+		return p.expr(expr)
+	}
+	return "(" + p.expr(expr) + ")"
+}
+
+func (p sourcePrinter) visitAssignExpr(expr AssignExpr) string {
+	return expr.name.lexeme + " = " + p.expr(expr.value)
+}
+
+func (p sourcePrinter) visitBinaryExpr(expr BinaryExpr) string {
+	return p.operand(expr.left) + " " + expr.operator.lexeme + " " + p.operand(expr.right)
+}
+
+func (p sourcePrinter) visitCallExpr(expr CallExpr) string {
+	printed := make([]string, len(expr.args))
+	positional := len(expr.args) - len(expr.names)
+	for i, arg := range expr.args {
+		printed[i] = p.expr(arg)
+		if i >= positional {
+			printed[i] = expr.names[i-positional].lexeme + ": " + printed[i]
+		}
+	}
+	return p.postfix(expr.callee) + "(" + strings.Join(printed, ", ") + ")"
+}
+
+func (p sourcePrinter) visitConditionalExpr(expr ConditionalExpr) string {
+	return p.operand(expr.condition) + " ? " + p.expr(expr.thenBranch) + " : " + p.operand(expr.elseBranch)
+}
+
+func (p sourcePrinter) visitFunctionExpr(expr FunctionExpr) string {
+	return p.function("fun", expr.params, expr.variadic, expr.body, false)
+}
+
+func (p sourcePrinter) visitGetExpr(expr GetExpr) string {
+	return p.postfix(expr.object) + "." + expr.name.lexeme
+}
+
+func (p sourcePrinter) visitGroupingExpr(expr GroupingExpr) string {
+	return "(" + p.expr(expr.expression) + ")"
+}
+
+func (p sourcePrinter) visitListExpr(expr ListExpr) string {
+	return "[" + p.list(expr.elements) + "]"
+}
+
+func (p sourcePrinter) visitLiteralExpr(expr LiteralExpr) string {
+	switch value := expr.value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		source := strconv.FormatFloat(value, 'f', -1, 64)
+		if !strings.Contains(source, ".") {
+			source += ".0"
+		}
+		return source
+	case string:
+		return "\"" + value + "\""
+	}
+	return "nil"
+}
+
+func (p sourcePrinter) visitLogicalExpr(expr LogicalExpr) string {
+	return p.operand(expr.left) + " " + expr.operator.lexeme + " " + p.operand(expr.right)
+}
+
+func (p sourcePrinter) visitMapExpr(expr MapExpr) string {
+	entries := make([]string, len(expr.keys))
+	for i := range expr.keys {
+		entries[i] = p.operand(expr.keys[i]) + ": " + p.operand(expr.values[i])
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+func (p sourcePrinter) visitSetExpr(expr SetExpr) string {
+	return p.postfix(expr.object) + "." + expr.name.lexeme + " = " + p.expr(expr.value)
+}
+
+func (p sourcePrinter) visitSubscriptExpr(expr SubscriptExpr) string {
+	return p.postfix(expr.object) + "[" + p.expr(expr.index) + "]"
+}
+
+func (p sourcePrinter) visitSubscriptSetExpr(expr SubscriptSetExpr) string {
+	return p.postfix(expr.object) + "[" + p.expr(expr.index) + "] = " + p.expr(expr.value)
+}
+
+func (p sourcePrinter) visitSuperExpr(expr SuperExpr) string {
+	return "super." + expr.method.lexeme
+}
+
+func (p sourcePrinter) visitThisExpr(expr ThisExpr) string {
+	return "this"
+}
+
+func (p sourcePrinter) visitUnaryExpr(expr UnaryExpr) string {
+	return expr.operator.lexeme + p.operand(expr.right)
+}
+
+func (p sourcePrinter) visitVariableExpr(expr VariableExpr) string {
+	return expr.name.lexeme
+}
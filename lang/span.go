@@ -0,0 +1,71 @@
+package lang
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * Spans record where a token or AST node sits in the source code. Offsets are
+ * byte offsets into the source. Lines and columns both start at 1, and
+ * columns are counted in bytes from the start of the line. The end of a span
+ * is exclusive. Spans made by the scanner also remember the source they are
+ * in, so a diagnostic can show the line it is about.
+ *****************************************************************************/
+
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type Span struct {
+	Start  Position `json:"start"`
+	End    Position `json:"end"`
+	source string   // empty when the span wasn't scanned from source, e.g. it was read from an artifact
+}
+
+// String formats a span as line:column-line:column
+func (s Span) String() string {
+	return fmt.Sprintf("%d:%d-%d:%d", s.Start.Line, s.Start.Column, s.End.Line, s.End.Column)
+}
+
+func joinSpans(start Span, end Span) Span {
+	return Span{Start: start.Start, End: end.End, source: start.source}
+}
+
+func (s Span) contains(offset int) bool {
+	return s.Start.Offset <= offset && offset < s.End.Offset
+}
+
+/******************************************************************************
+ * locate points a diagnostic at a span: it gets the text of the line the
+ * span starts on and the columns the span covers on it, which the error
+ * handler shows under the message with a caret. A span that runs past the
+ * end of its first line is underlined to the end of that line.
+ *****************************************************************************/
+
+func locate(diagnostic diag.Diagnostic, span Span) diag.Diagnostic {
+	if span.source == "" || span.Start.Column < 1 || span.Start.Offset > len(span.source) {
+		return diagnostic
+	}
+	lineStart := span.Start.Offset - (span.Start.Column - 1)
+	lineEnd := strings.IndexByte(span.source[span.Start.Offset:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(span.source)
+	} else {
+		lineEnd += span.Start.Offset
+	}
+	if lineStart < 0 {
+		return diagnostic
+	}
+	diagnostic.SourceLine = strings.TrimRight(span.source[lineStart:lineEnd], "\r")
+	diagnostic.Column = span.Start.Column
+	diagnostic.Width = 1
+	if span.End.Offset > span.Start.Offset {
+		diagnostic.Width = min(span.End.Offset, lineStart+len(diagnostic.SourceLine)) - span.Start.Offset
+	}
+	return diagnostic
+}
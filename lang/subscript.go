@@ -0,0 +1,58 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * Subscripting, the object[index] syntax, shared by both engines so they
+ * agree on which values can be indexed and on the errors they report.
+ *
+ * Lists are indexed by whole numbers starting at 0. Maps can be indexed by
+ * any value, and reading a key that isn't in the map gives nil.
+ *****************************************************************************/
+
+func getSubscript(object runtime.Value, index runtime.Value) (runtime.Value, diag.Code, error) {
+	switch object := object.(type) {
+	case *runtime.List:
+		i, code, err := listIndex(object, index)
+		if err != nil {
+			return nil, code, err
+		}
+		return object.Get(i), "", nil
+	case *runtime.Map:
+		value, _ := object.Get(index)
+		return value, "", nil
+	}
+	return nil, diag.NotSubscriptable, errors.New("Only lists and maps can be subscripted.")
+}
+
+func setSubscript(object runtime.Value, index runtime.Value, value runtime.Value) (diag.Code, error) {
+	switch object := object.(type) {
+	case *runtime.List:
+		i, code, err := listIndex(object, index)
+		if err != nil {
+			return code, err
+		}
+		object.Set(i, value)
+		return "", nil
+	case *runtime.Map:
+		object.Set(index, value)
+		return "", nil
+	}
+	return diag.NotSubscriptable, errors.New("Only lists and maps can be subscripted.")
+}
+
+func listIndex(list *runtime.List, index runtime.Value) (int, diag.Code, error) {
+	number, isWhole := runtime.ToInteger(index)
+	if !isWhole {
+		return 0, diag.InvalidIndex, errors.New("List index must be a whole number.")
+	}
+	if number < 0 || number >= int64(list.Len()) {
+		return 0, diag.IndexOutOfRange, errors.New("List index out of range.")
+	}
+	return int(number), "", nil
+}
@@ -0,0 +1,151 @@
+package lang
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * Mutexes and atomic counters are the only values workers share. Sending
+ * one to a worker passes the same mutex or counter along instead of a copy,
+ * so scripts that need shared state can coordinate through them.
+ *
+ * Each mutex knows which worker holds it. That lets locking detect the
+ * deadlocks it can: locking a mutex you already hold, unlocking one you
+ * don't, and waiting for a mutex held by a worker that is itself waiting,
+ * directly or through others, for a mutex you hold. Each of these is a
+ * runtime error rather than a program that hangs forever.
+ *
+ * Workers are told apart by their interrupts, which every interpreter
+ * running on the same goroutine shares (a script and the modules it
+ * imports), and which no two workers share.
+ *****************************************************************************/
+
+type lockOwner = *interrupts
+
+var (
+	// one lock and condition guard every mutex so the wait-for graph can be checked as a whole
+	lockState  sync.Mutex
+	lockChange = sync.NewCond(&lockState)
+	waitingFor = make(map[lockOwner]*loxMutex)
+)
+
+type loxMutex struct {
+	owner lockOwner // nil when unlocked
+}
+
+func (m *loxMutex) lock(interpreter *Interpreter) error {
+	me := interpreter.interrupts
+	lockState.Lock()
+	defer lockState.Unlock()
+	if m.owner == me {
+		return errors.New("Deadlock: the mutex is already locked by this worker.")
+	}
+	for m.owner != nil {
+		for owner := m.owner; owner != nil; {
+			if owner == me {
+				return errors.New("Deadlock: the mutex is held by a worker that is waiting for a mutex this worker holds.")
+			}
+			next := waitingFor[owner]
+			if next == nil {
+				break
+			}
+			owner = next.owner
+		}
+		waitingFor[me] = m
+		lockChange.Wait()
+		delete(waitingFor, me)
+		// signal handlers can lock mutexes too, so let go while they run and check the mutex again after
+		err := func() error {
+			lockState.Unlock()
+			defer lockState.Lock()
+			_, err := interpreter.interruption()
+			return err
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	m.owner = me
+	return nil
+}
+
+func (m *loxMutex) unlock(interpreter *Interpreter) error {
+	lockState.Lock()
+	defer lockState.Unlock()
+	if m.owner != interpreter.interrupts {
+		return errors.New("The mutex isn't locked by this worker.")
+	}
+	m.owner = nil
+	lockChange.Broadcast()
+	return nil
+}
+
+// wakeLockWaiters lets workers waiting for a mutex check whether they have been interrupted
+func wakeLockWaiters() {
+	lockState.Lock()
+	lockChange.Broadcast()
+	lockState.Unlock()
+}
+
+func (m *loxMutex) String() string {
+	return "<mutex>"
+}
+
+type atomicCounter struct {
+	value atomic.Int64
+}
+
+func (c *atomicCounter) Get(name string) (runtime.Value, bool) {
+	switch name {
+	case "get":
+		return runtime.NewNativeFunction("get", 0, func(args []runtime.Value) (runtime.Value, error) {
+			return c.value.Load(), nil
+		}), true
+	case "add":
+		return runtime.NewNativeFunction("add", 1, func(args []runtime.Value) (runtime.Value, error) {
+			delta, err := counterArg("add", args[0])
+			if err != nil {
+				return nil, err
+			}
+			return c.value.Add(delta), nil
+		}), true
+	case "set":
+		return runtime.NewNativeFunction("set", 1, func(args []runtime.Value) (runtime.Value, error) {
+			value, err := counterArg("set", args[0])
+			if err != nil {
+				return nil, err
+			}
+			c.value.Store(value)
+			return nil, nil
+		}), true
+	case "compareAndSet":
+		return runtime.NewNativeFunction("compareAndSet", 2, func(args []runtime.Value) (runtime.Value, error) {
+			old, err := counterArg("compareAndSet", args[0])
+			if err != nil {
+				return nil, err
+			}
+			replacement, err := counterArg("compareAndSet", args[1])
+			if err != nil {
+				return nil, err
+			}
+			return c.value.CompareAndSwap(old, replacement), nil
+		}), true
+	}
+	return nil, false
+}
+
+func (c *atomicCounter) String() string {
+	return "<atomic counter>"
+}
+
+func counterArg(name string, value runtime.Value) (int64, error) {
+	number, isWhole := runtime.ToInteger(value)
+	if !isWhole {
+		return 0, errors.New(name + "() expects a whole number.")
+	}
+	return number, nil
+}
@@ -0,0 +1,20 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package lang
+
+import "os"
+
+// disableEcho is only supported on Unix terminals, elsewhere what is typed is still shown
+func disableEcho(file *os.File) (restore func(), disabled bool) {
+	return func() {}, false
+}
+
+// isTerminal can't tell terminals apart from other files here, so it assumes they aren't
+func isTerminal(file *os.File) bool {
+	return false
+}
+
+// terminalSize is only supported on Unix terminals
+func terminalSize(file *os.File) (int, int, bool) {
+	return 0, 0, false
+}
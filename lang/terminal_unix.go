@@ -0,0 +1,52 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package lang
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+/******************************************************************************
+ * Terminal control for the prompt and terminal natives, through the ioctls
+ * Unix terminals share. The requests differ in name between Linux and the
+ * BSDs, see terminal_linux.go and terminal_bsd.go, and other systems get the
+ * stand-ins in terminal_other.go.
+ *****************************************************************************/
+
+// disableEcho stops a terminal showing what is typed, it does nothing and returns false for anything else
+func disableEcho(file *os.File) (restore func(), disabled bool) {
+	var saved syscall.Termios
+	fd := file.Fd()
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, getTermios, uintptr(unsafe.Pointer(&saved))); errno != 0 {
+		return func() {}, false
+	}
+	quiet := saved
+	quiet.Lflag &^= syscall.ECHO
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, setTermios, uintptr(unsafe.Pointer(&quiet))); errno != 0 {
+		return func() {}, false
+	}
+	return func() {
+		syscall.Syscall(syscall.SYS_IOCTL, fd, setTermios, uintptr(unsafe.Pointer(&saved)))
+	}, true
+}
+
+// isTerminal reports whether a file is a terminal rather than a file or pipe
+func isTerminal(file *os.File) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), getTermios, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
+
+// terminalSize returns the columns and rows of a terminal, false if the file isn't one
+func terminalSize(file *os.File) (int, int, bool) {
+	var size struct {
+		rows, columns, xPixels, yPixels uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&size)))
+	if errno != 0 || size.columns == 0 {
+		return 0, 0, false
+	}
+	return int(size.columns), int(size.rows), true
+}
@@ -14,14 +14,22 @@ const (
 	tokenTypeRightParen
 	tokenTypeLeftBrace
 	tokenTypeRightBrace
+	tokenTypeLeftBracket
+	tokenTypeRightBracket
+	tokenTypeColon
 	tokenTypeComma
 	tokenTypeDot
+	tokenTypeDotDotDot
 	tokenTypeMinus
 	tokenTypePlus
 	tokenTypeSemicolon
 	tokenTypeSlash
 	tokenTypeStar
 	tokenTypeMod
+	tokenTypeQuestion
+	tokenTypeAmpersand
+	tokenTypePipe
+	tokenTypeCaret
 	// comparison operator tokens
 	tokenTypeBang
 	tokenTypeBangEqual
@@ -31,18 +39,24 @@ const (
 	tokenTypeGreaterEqual
 	tokenTypeLess
 	tokenTypeLessEqual
+	// shift operator tokens
+	tokenTypeLessLess
+	tokenTypeGreaterGreater
 	// literals
 	tokenTypeIdentifier
 	tokenTypeString
 	tokenTypeNumber
 	// keywords
 	tokenTypeAnd
+	tokenTypeBreak
 	tokenTypeClass
+	tokenTypeContinue
 	tokenTypeElse
 	tokenTypeFalse
 	tokenTypeFun
 	tokenTypeFor
 	tokenTypeIf
+	tokenTypeImport
 	tokenTypeNil
 	tokenTypeOr
 	tokenTypePrint
@@ -56,11 +70,105 @@ const (
 	tokenTypeEndOfFile
 )
 
+var tokenTypeNames = [...]string{
+	tokenTypeLeftParen:      "LeftParen",
+	tokenTypeRightParen:     "RightParen",
+	tokenTypeLeftBrace:      "LeftBrace",
+	tokenTypeRightBrace:     "RightBrace",
+	tokenTypeLeftBracket:    "LeftBracket",
+	tokenTypeRightBracket:   "RightBracket",
+	tokenTypeColon:          "Colon",
+	tokenTypeComma:          "Comma",
+	tokenTypeDot:            "Dot",
+	tokenTypeDotDotDot:      "DotDotDot",
+	tokenTypeMinus:          "Minus",
+	tokenTypePlus:           "Plus",
+	tokenTypeSemicolon:      "Semicolon",
+	tokenTypeSlash:          "Slash",
+	tokenTypeStar:           "Star",
+	tokenTypeMod:            "Mod",
+	tokenTypeQuestion:       "Question",
+	tokenTypeAmpersand:      "Ampersand",
+	tokenTypePipe:           "Pipe",
+	tokenTypeCaret:          "Caret",
+	tokenTypeBang:           "Bang",
+	tokenTypeBangEqual:      "BangEqual",
+	tokenTypeEqual:          "Equal",
+	tokenTypeEqualEqual:     "EqualEqual",
+	tokenTypeGreater:        "Greater",
+	tokenTypeGreaterEqual:   "GreaterEqual",
+	tokenTypeLess:           "Less",
+	tokenTypeLessEqual:      "LessEqual",
+	tokenTypeLessLess:       "LessLess",
+	tokenTypeGreaterGreater: "GreaterGreater",
+	tokenTypeIdentifier:     "Identifier",
+	tokenTypeString:         "String",
+	tokenTypeNumber:         "Number",
+	tokenTypeAnd:            "And",
+	tokenTypeBreak:          "Break",
+	tokenTypeClass:          "Class",
+	tokenTypeContinue:       "Continue",
+	tokenTypeElse:           "Else",
+	tokenTypeFalse:          "False",
+	tokenTypeFun:            "Fun",
+	tokenTypeFor:            "For",
+	tokenTypeIf:             "If",
+	tokenTypeImport:         "Import",
+	tokenTypeNil:            "Nil",
+	tokenTypeOr:             "Or",
+	tokenTypePrint:          "Print",
+	tokenTypeReturn:         "Return",
+	tokenTypeSuper:          "Super",
+	tokenTypeThis:           "This",
+	tokenTypeTrue:           "True",
+	tokenTypeVar:            "Var",
+	tokenTypeWhile:          "While",
+	tokenTypeEndOfFile:      "EndOfFile",
+}
+
+func (t TokenType) String() string {
+	if int(t) < len(tokenTypeNames) {
+		return tokenTypeNames[t]
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
 type Token struct {
 	tokenType TokenType
 	lexeme    string
 	literal   any
 	line      int
+	span      Span
+	// comment trivia, only populated when the scanner preserves comments
+	leadingComments []Comment
+	trailingComment *Comment
+}
+
+/******************************************************************************
+ * A comment found in the source. Comments are trivia, they never reach the
+ * parser as tokens. When the scanner is asked to preserve them, comments are
+ * attached to the token they sit next to. A comment that follows a token on
+ * the same line trails that token, every other comment leads the next token.
+ *****************************************************************************/
+
+type Comment struct {
+	Text string // including the leading "//"
+	Span Span
+}
+
+func (t Token) Span() Span {
+	return t.span
+}
+
+func (t Token) LeadingComments() []Comment {
+	return t.leadingComments
+}
+
+func (t Token) TrailingComment() (Comment, bool) {
+	if t.trailingComment == nil {
+		return Comment{}, false
+	}
+	return *t.trailingComment, true
 }
 
 func (t Token) ToString() string {
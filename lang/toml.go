@@ -0,0 +1,524 @@
+package lang
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * tomlParse() reads a TOML document into maps and lists. Tables become maps,
+ * with keys in the order they appear, and arrays become lists. Integers and
+ * floats keep their types, and dates and times, which Lox has no value for,
+ * are returned as the strings they were written as.
+ *
+ * The rules TOML has about where tables can be defined are kept: a key can't
+ * be given two values, a table can't be defined twice, and an inline table
+ * can't be added to once it is closed. [[name]] adds a table to the array of
+ * tables called name, and headers after it add to the last one.
+ *****************************************************************************/
+
+type tomlParser struct {
+	text        string
+	pos         int
+	current     *runtime.Map
+	defined     map[*runtime.Map]bool  // tables made by a header or a dotted key, which a header can't define again
+	closed      map[*runtime.Map]bool  // inline tables, which can't be added to
+	arrayTables map[*runtime.List]bool // lists made by [[name]], the only ones headers can add to
+}
+
+func parseTOML(text string) (runtime.Value, error) {
+	root := runtime.NewMap()
+	p := &tomlParser{text: text, current: root, defined: make(map[*runtime.Map]bool),
+		closed: make(map[*runtime.Map]bool), arrayTables: make(map[*runtime.List]bool)}
+	for {
+		p.skipBlankLines()
+		if p.pos >= len(p.text) {
+			return root, nil
+		}
+		var err error
+		if p.text[p.pos] == '[' {
+			err = p.header(root)
+		} else {
+			err = p.keyValue(p.current)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// header reads [table] or [[array of tables]] and makes what follows go into that table
+func (p *tomlParser) header(root *runtime.Map) error {
+	p.pos++
+	array := p.pos < len(p.text) && p.text[p.pos] == '['
+	if array {
+		p.pos++
+	}
+	line := p.line()
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	if err := p.expect(']'); err != nil {
+		return err
+	}
+	if array {
+		if err := p.expectNext(']'); err != nil {
+			return err
+		}
+	}
+	table := root
+	for _, key := range keys[:len(keys)-1] {
+		if table, err = p.descend(table, key, line, true); err != nil {
+			return err
+		}
+	}
+	last := keys[len(keys)-1]
+	existing, exists := table.Get(last)
+	if array {
+		list, isList := existing.(*runtime.List)
+		if !exists {
+			list = runtime.NewList(nil)
+			p.arrayTables[list] = true
+			table.Set(last, list)
+		} else if !isList || !p.arrayTables[list] {
+			return fmt.Errorf("tomlParse() found '%s' defined twice on line %d.", strings.Join(keys, "."), line)
+		}
+		p.current = runtime.NewMap()
+		list.Append(p.current)
+		return nil
+	}
+	if !exists {
+		p.current = runtime.NewMap()
+		table.Set(last, p.current)
+	} else if existingTable, isTable := existing.(*runtime.Map); isTable && !p.defined[existingTable] && !p.closed[existingTable] {
+		p.current = existingTable
+	} else {
+		return fmt.Errorf("tomlParse() found '%s' defined twice on line %d.", strings.Join(keys, "."), line)
+	}
+	p.defined[p.current] = true
+	return nil
+}
+
+// descend returns the table key names in table, making it if it doesn't exist yet
+func (p *tomlParser) descend(table *runtime.Map, key string, line int, header bool) (*runtime.Map, error) {
+	existing, exists := table.Get(key)
+	if !exists {
+		next := runtime.NewMap()
+		if !header {
+			p.defined[next] = true
+		}
+		table.Set(key, next)
+		return next, nil
+	}
+	switch existing := existing.(type) {
+	case *runtime.Map:
+		if !p.closed[existing] {
+			return existing, nil
+		}
+	case *runtime.List:
+		if header && p.arrayTables[existing] {
+			return existing.Get(existing.Len() - 1).(*runtime.Map), nil
+		}
+	}
+	return nil, fmt.Errorf("tomlParse() can't add to '%s' on line %d, it already has a value.", key, line)
+}
+
+// keyValue reads key = value into table
+func (p *tomlParser) keyValue(table *runtime.Map) error {
+	line := p.line()
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	if err := p.expect('='); err != nil {
+		return err
+	}
+	for _, key := range keys[:len(keys)-1] {
+		if table, err = p.descend(table, key, line, false); err != nil {
+			return err
+		}
+	}
+	last := keys[len(keys)-1]
+	if _, exists := table.Get(last); exists {
+		return fmt.Errorf("tomlParse() found '%s' defined twice on line %d.", strings.Join(keys, "."), line)
+	}
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	table.Set(last, value)
+	return nil
+}
+
+// key reads a key, which is a list of names when it is dotted
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.text) {
+			return nil, p.errorf("a key")
+		}
+		switch p.text[p.pos] {
+		case '"':
+			key, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		case '\'':
+			key, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		default:
+			start := p.pos
+			for p.pos < len(p.text) && isBareKeyCharacter(p.text[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, p.errorf("a key")
+			}
+			keys = append(keys, p.text[start:p.pos])
+		}
+		if p.skipSpace(); p.pos >= len(p.text) || p.text[p.pos] != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyCharacter(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *tomlParser) value() (runtime.Value, error) {
+	p.skipSpace()
+	if p.pos >= len(p.text) {
+		return nil, p.errorf("a value")
+	}
+	switch rest := p.text[p.pos:]; {
+	case strings.HasPrefix(rest, `"""`):
+		return p.multilineString(`"""`)
+	case strings.HasPrefix(rest, "'''"):
+		return p.multilineString("'''")
+	case rest[0] == '"':
+		return p.basicString()
+	case rest[0] == '\'':
+		return p.literalString()
+	case rest[0] == '[':
+		return p.array()
+	case rest[0] == '{':
+		return p.inlineTable()
+	}
+	start := p.pos
+	for p.pos < len(p.text) && (isBareKeyCharacter(p.text[p.pos]) || strings.IndexByte("+.:", p.text[p.pos]) >= 0) {
+		p.pos++
+	}
+	word := p.text[start:p.pos]
+	// a date and a time can be separated by a space
+	if isTOMLDate(word) && p.pos+1 < len(p.text) && p.text[p.pos] == ' ' && p.text[p.pos+1] >= '0' && p.text[p.pos+1] <= '9' {
+		for p.pos++; p.pos < len(p.text) && (isBareKeyCharacter(p.text[p.pos]) || strings.IndexByte("+.:", p.text[p.pos]) >= 0); p.pos++ {
+		}
+		word = p.text[start:p.pos]
+	}
+	if value, valid := tomlScalar(word); valid {
+		return value, nil
+	}
+	p.pos = start
+	return nil, p.errorf("a value")
+}
+
+// tomlScalar reads a boolean, number, date, or time
+func tomlScalar(word string) (runtime.Value, bool) {
+	switch word {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	case "nan", "+nan", "-nan":
+		return math.NaN(), true
+	case "":
+		return nil, false
+	}
+	if isTOMLDate(word) || (len(word) >= 8 && word[2] == ':' && word[5] == ':') {
+		return word, true
+	}
+	if !validUnderscores(word) {
+		return nil, false
+	}
+	digits := strings.ReplaceAll(word, "_", "")
+	if len(digits) > 2 && digits[0] == '0' && strings.IndexByte("xob", digits[1]) >= 0 {
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[digits[1]]
+		integer, err := strconv.ParseInt(digits[2:], base, 64)
+		return integer, err == nil && digits[2] != '+' && digits[2] != '-'
+	}
+	unsigned := strings.TrimLeft(digits, "+-")
+	if len(unsigned) > 1 && unsigned[0] == '0' && unsigned[1] != '.' && unsigned[1] != 'e' && unsigned[1] != 'E' {
+		return nil, false // leading zeros aren't allowed
+	}
+	if !strings.ContainsAny(digits, ".eE") {
+		integer, err := strconv.ParseInt(digits, 10, 64)
+		return integer, err == nil
+	}
+	// a decimal point needs digits on both sides
+	if dot := strings.IndexByte(unsigned, '.'); dot >= 0 && (dot == 0 || dot+1 >= len(unsigned) ||
+		unsigned[dot+1] < '0' || unsigned[dot+1] > '9') {
+		return nil, false
+	}
+	float, err := strconv.ParseFloat(digits, 64)
+	return float, err == nil
+}
+
+func isTOMLDate(word string) bool {
+	return len(word) >= 10 && word[4] == '-' && word[7] == '-' && strings.Trim(word[:4]+word[5:7]+word[8:10], "0123456789") == ""
+}
+
+// validUnderscores reports whether every underscore in a number is between two digits
+func validUnderscores(word string) bool {
+	for i := 0; i < len(word); i++ {
+		if word[i] == '_' && (i == 0 || i == len(word)-1 || !isHexDigit(word[i-1]) || !isHexDigit(word[i+1])) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func (p *tomlParser) array() (runtime.Value, error) {
+	p.pos++
+	elements := make([]runtime.Value, 0)
+	for {
+		p.skipBlankLines()
+		if p.pos < len(p.text) && p.text[p.pos] == ']' {
+			p.pos++
+			return runtime.NewList(elements), nil
+		}
+		element, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		p.skipBlankLines()
+		if p.pos < len(p.text) && p.text[p.pos] == ',' {
+			p.pos++
+		} else if err := p.expect(']'); err != nil {
+			return nil, err
+		} else {
+			return runtime.NewList(elements), nil
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (runtime.Value, error) {
+	p.pos++
+	table := runtime.NewMap()
+	if p.skipSpace(); p.pos < len(p.text) && p.text[p.pos] == '}' {
+		p.pos++
+		p.closed[table] = true
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		if p.skipSpace(); p.pos < len(p.text) && p.text[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect('}'); err != nil {
+			return nil, err
+		}
+		p.closed[table] = true
+		// tables made by dotted keys inside it can't be added to either
+		for _, value := range table.Values() {
+			if inner, isTable := value.(*runtime.Map); isTable && p.defined[inner] {
+				p.closed[inner] = true
+			}
+		}
+		return table, nil
+	}
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	line := p.line()
+	start := p.pos
+	for p.pos++; p.pos < len(p.text) && p.text[p.pos] != '"' && p.text[p.pos] != '\n'; p.pos++ {
+		if p.text[p.pos] == '\\' {
+			p.pos++
+		}
+	}
+	if p.pos >= len(p.text) || p.text[p.pos] != '"' {
+		return "", fmt.Errorf("tomlParse() found an unterminated string on line %d.", line)
+	}
+	p.pos++
+	return p.unescape(p.text[start+1:p.pos-1], line)
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	line := p.line()
+	end := strings.IndexAny(p.text[p.pos+1:], "'\n")
+	if end < 0 || p.text[p.pos+1+end] != '\'' {
+		return "", fmt.Errorf("tomlParse() found an unterminated string on line %d.", line)
+	}
+	str := p.text[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return str, nil
+}
+
+// multilineString reads a string in triple quotes, where a newline right after the opening quotes is left out
+func (p *tomlParser) multilineString(quotes string) (string, error) {
+	line := p.line()
+	p.pos += 3
+	end := strings.Index(p.text[p.pos:], quotes)
+	if end < 0 {
+		return "", fmt.Errorf("tomlParse() found an unterminated string on line %d.", line)
+	}
+	end += p.pos
+	// up to two more quotes can end the string, like """"a"""" for "a" in quotes
+	run := 3
+	for run < 5 && end+run < len(p.text) && p.text[end+run] == quotes[0] {
+		run++
+	}
+	end += run - 3
+	str := p.text[p.pos:end]
+	p.pos = end + 3
+	str = strings.TrimPrefix(strings.TrimPrefix(str, "\r"), "\n")
+	if quotes == "'''" {
+		return str, nil
+	}
+	return p.unescape(str, line)
+}
+
+/******************************************************************************
+ * unescape replaces the escape sequences in a basic string. A backslash at
+ * the end of a line, only possible in a multiline string, joins the line to
+ * the next one, leaving out the whitespace in between.
+ *****************************************************************************/
+
+func (p *tomlParser) unescape(str string, line int) (string, error) {
+	var builder strings.Builder
+	for i := 0; i < len(str); i++ {
+		if str[i] != '\\' {
+			builder.WriteByte(str[i])
+			continue
+		}
+		i++
+		if rest := strings.TrimLeft(str[i:], " \t\r"); strings.HasPrefix(rest, "\n") {
+			i = len(str) - len(strings.TrimLeft(rest, " \t\r\n")) - 1
+			continue
+		}
+		if i >= len(str) {
+			return "", fmt.Errorf("tomlParse() found an invalid escape sequence on line %d.", line)
+		}
+		if replacement, simple := configEscapes[str[i]]; simple && str[i] != '/' {
+			builder.WriteString(replacement)
+			continue
+		}
+		r, size := unescapeUnicode(str[i:])
+		if size == 0 {
+			return "", fmt.Errorf("tomlParse() found an invalid escape sequence on line %d.", line)
+		}
+		builder.WriteRune(r)
+		i += size - 1
+	}
+	return builder.String(), nil
+}
+
+// configEscapes are the escape sequences TOML and YAML have in common, with YAML adding '/'
+var configEscapes = map[byte]string{'b': "\b", 't': "\t", 'n': "\n", 'f': "\f", 'r': "\r", 'e': "\x1b", '"': "\"",
+	'\\': "\\", '/': "/"}
+
+// unescapeUnicode reads an escape like uXXXX or UXXXXXXXX, returning how many bytes it took or 0 if it isn't valid
+func unescapeUnicode(str string) (rune, int) {
+	digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[str[0]]
+	if digits == 0 || len(str) < digits+1 {
+		return 0, 0
+	}
+	code, err := strconv.ParseUint(str[1:digits+1], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, 0
+	}
+	return rune(code), digits + 1
+}
+
+func (p *tomlParser) skipSpace() {
+	for p.pos < len(p.text) && (p.text[p.pos] == ' ' || p.text[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// skipBlankLines skips whitespace, newlines, and comments
+func (p *tomlParser) skipBlankLines() {
+	for p.pos < len(p.text) {
+		switch p.text[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	for p.pos < len(p.text) && p.text[p.pos] != '\n' {
+		p.pos++
+	}
+}
+
+// endOfLine checks that nothing but a comment follows a header or a key and value
+func (p *tomlParser) endOfLine() error {
+	if p.skipSpace(); p.pos < len(p.text) && p.text[p.pos] == '#' {
+		p.skipComment()
+	}
+	if p.pos < len(p.text) && p.text[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.text) && p.text[p.pos] != '\n' {
+		return p.errorf("the end of the line")
+	}
+	return nil
+}
+
+func (p *tomlParser) expect(c byte) error {
+	p.skipSpace()
+	return p.expectNext(c)
+}
+
+// expectNext is expect without skipping whitespace first
+func (p *tomlParser) expectNext(c byte) error {
+	if p.pos < len(p.text) && p.text[p.pos] == c {
+		p.pos++
+		return nil
+	}
+	return p.errorf("'" + string(c) + "'")
+}
+
+func (p *tomlParser) line() int {
+	return 1 + strings.Count(p.text[:p.pos], "\n")
+}
+
+func (p *tomlParser) errorf(expected string) error {
+	if p.pos >= len(p.text) {
+		return fmt.Errorf("tomlParse() expected %s but the text ended.", expected)
+	}
+	return fmt.Errorf("tomlParse() expected %s on line %d.", expected, p.line())
+}
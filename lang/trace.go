@@ -0,0 +1,79 @@
+package lang
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * A trace is a recording of a program run by the tree-walk interpreter. It
+ * has a step for every statement executed, in the order they started, along
+ * with the variables the statement read and wrote and the values they had at
+ * the time. Statements nested in blocks, loops, and function calls get their
+ * own steps, so each step also records how deeply it was nested.
+ *
+ * Traces are saved as JSON so a run can be stepped through, backwards and
+ * forwards, after the fact.
+ *****************************************************************************/
+
+type Trace struct {
+	Source string      `json:"source"`
+	Steps  []TraceStep `json:"steps"`
+}
+
+type TraceStep struct {
+	Line      int             `json:"line"`
+	Depth     int             `json:"depth"`
+	Variables []TraceVariable `json:"variables,omitempty"`
+}
+
+type TraceVariable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Write bool   `json:"write,omitempty"`
+}
+
+func WriteTrace(w io.Writer, trace *Trace) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(trace)
+}
+
+func ReadTrace(r io.Reader) (*Trace, error) {
+	var trace Trace
+	if err := json.NewDecoder(r).Decode(&trace); err != nil {
+		return nil, err
+	}
+	return &trace, nil
+}
+
+type recorder struct {
+	trace  *Trace
+	active []int // indexes of the steps whose statements are still executing
+}
+
+// begin adds a step for a statement and returns a function to call once it has finished executing
+func (r *recorder) begin(line int) func() {
+	r.trace.Steps = append(r.trace.Steps, TraceStep{Line: line, Depth: len(r.active)})
+	r.active = append(r.active, len(r.trace.Steps)-1)
+	return func() {
+		r.active = r.active[:len(r.active)-1]
+	}
+}
+
+// touch records a variable access against the innermost statement being executed
+func (r *recorder) touch(name string, value runtime.Value, isWrite bool) {
+	if len(r.active) == 0 {
+		return
+	}
+	str, isString := value.(string)
+	formatted := runtime.Stringify(value)
+	if isString {
+		formatted = strconv.Quote(str)
+	}
+	step := &r.trace.Steps[r.active[len(r.active)-1]]
+	step.Variables = append(step.Variables, TraceVariable{Name: name, Value: formatted, Write: isWrite})
+}
@@ -0,0 +1,119 @@
+package lang
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * A tracer logs what the tree-walk interpreter does as it does it: every
+ * statement as it starts, then every expression in it with the value it
+ * came to, in the order they were evaluated. Each line says where the code
+ * is and which function is running it, and is indented by how deeply the
+ * statement is nested in the blocks and calls being traced:
+ *
+ *   [line 2 in fib] if (n < 2) return n;
+ *   [line 2 in fib]   n => 1
+ *   [line 2 in fib]   n < 2 => true
+ *
+ * Statements are shown by their first line and expressions by their source,
+ * both cut short when they are long. Literals aren't logged, nor are
+ * parentheses, since their values are already in the line above.
+ *
+ * A tracer can be limited to some functions by name, in which case only the
+ * statements and expressions in their bodies are logged. Calls they make to
+ * other functions still show up as the value of the call.
+ *****************************************************************************/
+
+// how much of a statement or expression is shown before it is cut short
+const traceSourceWidth = 60
+
+type Tracer struct {
+	output    io.Writer
+	functions map[string]bool // the functions to log, all of them when empty
+	depth     int             // how many traced statements are executing
+}
+
+// NewTracer makes a tracer that writes to output, logging only the named functions if any are given.
+func NewTracer(output io.Writer, functions []string) *Tracer {
+	tracer := &Tracer{output: output, functions: make(map[string]bool)}
+	for _, function := range functions {
+		tracer.functions[function] = true
+	}
+	return tracer
+}
+
+func (interpreter *Interpreter) SetTracer(tracer *Tracer) {
+	interpreter.watch().tracer = tracer
+}
+
+// statement logs a statement about to execute and returns a function to call once it has finished
+func (t *Tracer) statement(stmt Stmt, stack *callStack) func() {
+	frame, traced := t.traced(stack)
+	if !traced {
+		return func() {}
+	}
+	span := stmt.Span()
+	text, _, _ := strings.Cut(traceSource(span), "\n")
+	t.log(span.Start.Line, frame, t.depth, shorten(strings.TrimSpace(text)))
+	t.depth++
+	return func() {
+		t.depth--
+	}
+}
+
+// expression logs an expression that has just been evaluated, and returns its value
+func (t *Tracer) expression(expr Expr, value runtime.Value, stack *callStack) runtime.Value {
+	switch expr.(type) {
+	case LiteralExpr, GroupingExpr:
+		return value
+	}
+	if frame, traced := t.traced(stack); traced {
+		span := expr.Span()
+		text := strings.Join(strings.Fields(traceSource(span)), " ")
+		t.log(span.Start.Line, frame, t.depth, shorten(text)+" => "+traceValue(value))
+	}
+	return value
+}
+
+// traced reports whether the innermost frame is one being traced, returning its name
+func (t *Tracer) traced(stack *callStack) (string, bool) {
+	frame := stack.frames[len(stack.frames)-1].name
+	return frame, len(t.functions) == 0 || t.functions[frame]
+}
+
+func (t *Tracer) log(line int, frame string, depth int, text string) {
+	fmt.Fprintf(t.output, "[line %d in %s] %s%s\n", line, frame, strings.Repeat("  ", depth), text)
+}
+
+// traceSource returns the source a span covers, or a placeholder when it wasn't scanned from source
+func traceSource(span Span) string {
+	if span.source == "" || span.End.Offset > len(span.source) {
+		return "<unknown>"
+	}
+	return span.source[span.Start.Offset:span.End.Offset]
+}
+
+// shorten cuts source text that is too long to show in full
+func shorten(text string) string {
+	if len(text) <= traceSourceWidth {
+		return text
+	}
+	cut := traceSourceWidth - 3
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "..."
+}
+
+func traceValue(value runtime.Value) string {
+	if str, isString := value.(string); isString {
+		return strconv.Quote(str)
+	}
+	return runtime.Stringify(value)
+}
@@ -0,0 +1,55 @@
+package lang
+
+import (
+	"errors"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * Traits are mixed into a class by copying their methods into the class's
+ * own method table, so a method lookup never has to search them. The class's
+ * own methods win over its traits' methods, and its traits' methods win over
+ * anything inherited from its superclass. Two traits defining the same method
+ * is an error unless the class defines that method itself to settle which
+ * one it wants. The resolver catches that for traits it can see declared,
+ * mixTraits catches it for the rest when the class is created.
+ *
+ * Both execution engines build classes with mixTraits so they agree on which
+ * method wins.
+ *****************************************************************************/
+
+func mixTraits(traits []runtime.Value, methods map[string]runtime.Function) (map[string]runtime.Function, diag.Code,
+	error) {
+	if len(traits) == 0 {
+		return methods, "", nil
+	}
+	mixed := make(map[string]runtime.Function)
+	from := make(map[string]string) // the trait each mixed in method came from
+	for _, value := range traits {
+		trait, isTrait := value.(*runtime.Trait)
+		if !isTrait {
+			return nil, diag.NotATrait, errors.New("Only traits can be used after 'with'.")
+		}
+		for name, method := range trait.Methods() {
+			if _, overridden := methods[name]; overridden {
+				continue
+			}
+			if other, conflict := from[name]; conflict && other != trait.Name() {
+				return nil, diag.TraitMethodConflict, traitConflict(name, other, trait.Name())
+			}
+			mixed[name] = method
+			from[name] = trait.Name()
+		}
+	}
+	for name, method := range methods {
+		mixed[name] = method
+	}
+	return mixed, "", nil
+}
+
+func traitConflict(method string, trait string, other string) error {
+	return errors.New("Traits '" + trait + "' and '" + other + "' both define '" + method +
+		"', the class must define it to choose between them.")
+}
@@ -0,0 +1,53 @@
+package lang
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/skusel/glox/diag"
+)
+
+/******************************************************************************
+ * A warning for local variables that are declared and never read, which
+ * usually means the code meant to use them and uses something else, or is
+ * left over from an edit. Assigning to a variable doesn't count as reading
+ * it. Only variables declared with var are checked, parameters often go
+ * unused on purpose, and so does anything named with a leading "_".
+ * Globals aren't checked, another script or a later REPL line can read them.
+ *****************************************************************************/
+
+type localVariable struct {
+	name Token
+	read bool
+}
+
+// declareVariable starts tracking whether a local declared with var is read
+func (r *Resolver) declareVariable(name Token) {
+	if len(r.variables) == 0 || strings.HasPrefix(name.lexeme, "_") {
+		return
+	}
+	r.variables[len(r.variables)-1][name.lexeme] = &localVariable{name: name}
+}
+
+// readVariable records that the variable found in the given scope was read
+func (r *Resolver) readVariable(scope int, name Token) {
+	if variable, tracked := r.variables[scope][name.lexeme]; tracked {
+		variable.read = true
+	}
+}
+
+// checkUnusedVariables warns about the locals of the innermost scope that were never read, in source order
+func (r *Resolver) checkUnusedVariables() {
+	unused := make([]*localVariable, 0)
+	for _, variable := range r.variables[len(r.variables)-1] {
+		if !variable.read {
+			unused = append(unused, variable)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i].name.span.Start.Offset < unused[j].name.span.Start.Offset })
+	for _, variable := range unused {
+		err := errors.New("Local variable '" + variable.name.lexeme + "' is never read.")
+		r.warn(diag.UnusedVariable, variable.name.span, err)
+	}
+}
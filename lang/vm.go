@@ -0,0 +1,771 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * The VM is an Engine that runs bytecode produced by the Compiler on a value
+ * stack, instead of walking the AST like the Interpreter. It is much faster
+ * for hot loops and is meant to behave identically otherwise: same output,
+ * same runtime errors, reported on the same lines.
+ *
+ * Numbers, strings, booleans, nil, classes, and instances are the shared
+ * runtime values. Functions have their own representation (vmFunction,
+ * vmClosure, and vmUpvalue) because they are compiled to bytecode, but they
+ * still implement runtime.Function so natives can call them.
+ *
+ * Natives are written against the Interpreter, so the VM keeps one around as
+ * the host for them. Both engines share the same native modules and filters.
+ *****************************************************************************/
+
+// vmFunction is the compiled form of a function declaration or expression
+type vmFunction struct {
+	name         string // empty for anonymous functions and the top level script
+	arity        int
+	upvalueCount int
+	isGetter     bool
+	variadic     bool     // whether the last parameter collects the extra arguments, it isn't counted in arity
+	paramNames   []string // for named arguments, leaving out a rest parameter
+	chunk        chunk
+}
+
+type vmClosure struct {
+	function *vmFunction
+	upvalues []*vmUpvalue
+	vm       *VM
+}
+
+type vmBoundMethod struct {
+	receiver *runtime.Instance
+	method   *vmClosure
+}
+
+/******************************************************************************
+ * An upvalue is a variable captured by a closure. It points at the variable's
+ * stack slot while the variable is still on the stack (open), and holds the
+ * value itself once the variable has gone out of scope (closed).
+ *****************************************************************************/
+
+type vmUpvalue struct {
+	slot   int
+	isOpen bool
+	closed runtime.Value
+	next   *vmUpvalue // open upvalues are kept in a list sorted by slot, highest first
+}
+
+type callFrame struct {
+	closure *vmClosure
+	ip      int
+	slots   int // stack index of the frame's slot zero
+}
+
+// the VM's call depth limit unless SetMaxCallDepth changes it
+const defaultMaxFrames = 1 << 16
+
+/******************************************************************************
+ * MaxVMCallDepth is the highest limit SetMaxCallDepth accepts for the VM,
+ * higher ones are lowered to it. VM calls don't nest Go calls, so the limit
+ * can be far higher than the tree-walker's, only a native calling back into
+ * Lox does. No more than MaxCallDepth of those can be active at once.
+ *****************************************************************************/
+
+const MaxVMCallDepth = 1 << 22
+
+type VM struct {
+	script       *vmFunction
+	stack        []runtime.Value
+	frames       []callFrame
+	openUpvalues *vmUpvalue
+	globals      map[string]runtime.Value
+	host         *Interpreter
+	errorHandler *ErrorHandler
+	maxCallDepth int
+	goCalls      int // calls from Go code, like natives, that are active
+}
+
+func NewVM(errorHandler *ErrorHandler) *VM {
+	host := NewInterpreter(errorHandler)
+	host.hostsVM = true
+	host.vmGlobals = make(map[string]runtime.Value)
+	return &VM{globals: host.vmGlobals, host: host, errorHandler: errorHandler, maxCallDepth: defaultMaxFrames}
+}
+
+func (vm *VM) Compile(program *Program) error {
+	script, err := NewCompiler(vm.errorHandler).Compile(program.Statements)
+	vm.script = script
+	return err
+}
+
+func (vm *VM) Run() (err error) {
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			runtimeError, isRuntimeError := recovered.(runtimeError)
+			exit, isExit := recovered.(ExitError)
+			if isRuntimeError || isExit {
+				if isRuntimeError {
+					vm.errorHandler.report(runtimeError.diagnostic)
+					err = runtimeError
+				} else {
+					err = exit
+				}
+				// leave the VM ready for the next program, e.g. the next line typed into the REPL
+				vm.truncate(0)
+				vm.frames = vm.frames[:0]
+				vm.openUpvalues = nil
+			} else {
+				// this is not a panic thrown by us - pass it on
+				panic(recovered)
+			}
+		}
+	}()
+
+	closure := &vmClosure{function: vm.script, vm: vm}
+	vm.push(closure)
+	vm.call(closure, 0)
+	vm.run(0)
+	vm.pop() // the script's nil return value
+	return nil
+}
+
+// RunExitHooks runs the functions registered with atExit, see Interpreter.RunExitHooks.
+func (vm *VM) RunExitHooks() error {
+	return vm.host.RunExitHooks()
+}
+
+func (vm *VM) SetNativeFilter(filter func(module string, name string) bool) {
+	vm.host.SetNativeFilter(filter)
+}
+
+func (vm *VM) SetOutput(output io.Writer) {
+	vm.host.SetOutput(output)
+}
+
+func (vm *VM) SetInput(input io.Reader) {
+	vm.host.SetInput(input)
+}
+
+// SetScriptPath tells the VM which file it is running, see Interpreter.SetScriptPath.
+func (vm *VM) SetScriptPath(path string) {
+	vm.host.SetScriptPath(path)
+}
+
+// SetMaxCallDepth limits how many calls can be active at once, see Interpreter.SetMaxCallDepth.
+func (vm *VM) SetMaxCallDepth(depth int) {
+	vm.maxCallDepth = min(depth, MaxVMCallDepth)
+}
+
+// Cancel stops the running program, see Interpreter.Cancel.
+func (vm *VM) Cancel() {
+	vm.host.Cancel()
+}
+
+// Assertions returns how many assertions have passed and failed so far, see Interpreter.Assertions.
+func (vm *VM) Assertions() AssertionCounts {
+	return vm.host.Assertions()
+}
+
+// RestoreMocks undoes the replacements made with mock() and mockMethod(), see Interpreter.RestoreMocks.
+func (vm *VM) RestoreMocks() {
+	vm.host.RestoreMocks()
+}
+
+func (vm *VM) Natives() []NativeInfo {
+	return vm.host.Natives()
+}
+
+func (vm *VM) push(value runtime.Value) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() runtime.Value {
+	value := vm.stack[len(vm.stack)-1]
+	vm.truncate(len(vm.stack) - 1)
+	return value
+}
+
+// truncate shrinks the stack, clearing the slots it drops so the values in them can be garbage collected
+func (vm *VM) truncate(size int) {
+	clear(vm.stack[size:])
+	vm.stack = vm.stack[:size]
+}
+
+func (vm *VM) peek(distance int) runtime.Value {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+// runtimeError reports an error on the line of the instruction being executed, with a backtrace if it is in a call
+func (vm *VM) runtimeError(code diag.Code, err error) {
+	frame := &vm.frames[len(vm.frames)-1]
+	chunk := &frame.closure.function.chunk
+	diagnostic := diag.Diagnostic{Code: code, Severity: diag.SeverityError, Line: chunk.lines[frame.ip-1],
+		Message: err.Error()}
+	if len(vm.frames) > 1 {
+		diagnostic.Trace = vm.backtrace()
+	}
+	vm.errorHandler.raise(locate(diagnostic, chunk.spans[frame.ip-1]))
+}
+
+// backtrace describes the active call frames innermost first, see formatBacktrace
+func (vm *VM) backtrace() []string {
+	frames := make([]traceFrame, 0, len(vm.frames))
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		name := frame.closure.function.name
+		if i == 0 {
+			name = "<script>"
+		} else if name == "" {
+			name = "<fun>"
+		}
+		line := 0
+		if frame.ip > 0 {
+			line = frame.closure.function.chunk.lines[frame.ip-1]
+		}
+		frames = append(frames, traceFrame{name: name, line: line})
+	}
+	return formatBacktrace(frames)
+}
+
+/******************************************************************************
+ * run executes instructions until the number of active call frames drops
+ * back to exitDepth and returns the value returned by the last frame. A
+ * depth other than zero is used when Go code (e.g. a native) calls back into
+ * a Lox function.
+ *****************************************************************************/
+
+func (vm *VM) run(exitDepth int) runtime.Value {
+	frame := &vm.frames[len(vm.frames)-1]
+	chunk := &frame.closure.function.chunk
+
+	readByte := func() byte {
+		frame.ip++
+		return chunk.code[frame.ip-1]
+	}
+	readShort := func() int {
+		frame.ip += 2
+		return chunk.readShort(frame.ip - 2)
+	}
+	readString := func() string {
+		return chunk.constants[readShort()].(string)
+	}
+	// readMethods pops the closures a class or trait's methods left on the stack, naming them from the operands
+	readMethods := func() map[string]runtime.Function {
+		methodCount := readShort()
+		methods := make(map[string]runtime.Function, methodCount)
+		base := len(vm.stack) - methodCount
+		for i := 0; i < methodCount; i++ {
+			methods[readString()] = vm.stack[base+i].(*vmClosure)
+		}
+		vm.truncate(base)
+		return methods
+	}
+
+	for {
+		switch opCode(readByte()) {
+		case opConstant:
+			vm.push(chunk.constants[readShort()])
+		case opNil:
+			vm.push(nil)
+		case opTrue:
+			vm.push(true)
+		case opFalse:
+			vm.push(false)
+		case opPop:
+			vm.pop()
+		case opGetLocal:
+			vm.push(vm.stack[frame.slots+int(readByte())])
+		case opSetLocal:
+			vm.stack[frame.slots+int(readByte())] = vm.peek(0)
+		case opGetGlobal:
+			name := readString()
+			value, found := vm.globals[name]
+			if !found {
+				value, found = vm.host.lookUpNative(name)
+				if !found {
+					vm.runtimeError(diag.UndefinedVariable, errors.New("Undefined variable '"+name+"'."))
+				}
+				vm.globals[name] = value
+			}
+			vm.push(value)
+		case opDefineGlobal:
+			vm.globals[readString()] = vm.pop()
+		case opSetGlobal:
+			name := readString()
+			if _, found := vm.globals[name]; !found {
+				if _, isNative := vm.host.lookUpNative(name); !isNative {
+					vm.runtimeError(diag.UndefinedVariable, errors.New("Undefined variable '"+name+"'."))
+				}
+			}
+			vm.globals[name] = vm.peek(0)
+		case opGetUpvalue:
+			upvalue := frame.closure.upvalues[readByte()]
+			if upvalue.isOpen {
+				vm.push(vm.stack[upvalue.slot])
+			} else {
+				vm.push(upvalue.closed)
+			}
+		case opSetUpvalue:
+			upvalue := frame.closure.upvalues[readByte()]
+			if upvalue.isOpen {
+				vm.stack[upvalue.slot] = vm.peek(0)
+			} else {
+				upvalue.closed = vm.peek(0)
+			}
+		case opGetProperty:
+			name := readString()
+			object, isObject := vm.peek(0).(runtime.Object)
+			if !isObject {
+				vm.runtimeError(diag.OnlyInstancesHaveFields, errors.New("Only instances have properties."))
+			}
+			value, found := object.Get(name)
+			if !found {
+				vm.runtimeError(diag.UndefinedProperty, errors.New("Undefined property '"+name+"'."))
+			}
+			vm.pop()
+			vm.push(value)
+			vm.callGetter(value)
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+		case opSetProperty:
+			name := readString()
+			instance, isInstance := vm.peek(1).(*runtime.Instance)
+			if !isInstance {
+				vm.runtimeError(diag.OnlyInstancesHaveFields, errors.New("Only instances have fields."))
+			}
+			value := vm.pop()
+			instance.Set(name, value)
+			vm.pop()
+			vm.push(value)
+		case opGetSuper:
+			name := readString()
+			superclass := vm.pop().(*runtime.Class)
+			instance := vm.pop().(*runtime.Instance)
+			method, found := superclass.FindMethod(name)
+			if !found {
+				vm.runtimeError(diag.UndefinedProperty, errors.New("Undefined property '"+name+"'."))
+			}
+			vm.push(method.Bind(instance))
+			vm.callGetter(vm.peek(0))
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+		case opGetSubscript:
+			index := vm.pop()
+			object := vm.pop()
+			value, code, err := getSubscript(object, index)
+			if err != nil {
+				vm.runtimeError(code, err)
+			}
+			vm.push(value)
+		case opSetSubscript:
+			value := vm.pop()
+			index := vm.pop()
+			object := vm.pop()
+			code, err := setSubscript(object, index, value)
+			if err != nil {
+				vm.runtimeError(code, err)
+			}
+			vm.push(value)
+		case opEqual:
+			right := vm.pop()
+			left := vm.pop()
+			vm.push(runtime.Equal(left, right))
+		case opGreater, opGreaterEqual, opLess, opLessEqual, opAdd, opSubtract, opMultiply, opDivide, opModulo:
+			right := vm.pop()
+			left := vm.pop()
+			value, code, err := arithmetic(arithmeticOperators[opCode(chunk.code[frame.ip-1])], left, right)
+			if err != nil {
+				vm.runtimeError(code, err)
+			}
+			vm.push(value)
+		case opBitAnd, opBitOr, opBitXor, opShiftLeft, opShiftRight:
+			right := vm.pop()
+			left := vm.pop()
+			value, code, err := bitwise(bitwiseOperators[opCode(chunk.code[frame.ip-1])], left, right)
+			if err != nil {
+				vm.runtimeError(code, err)
+			}
+			vm.push(value)
+		case opNot:
+			vm.push(!runtime.IsTruthy(vm.pop()))
+		case opNegate:
+			value, code, err := negate(vm.peek(0))
+			if err != nil {
+				vm.runtimeError(code, err)
+			}
+			vm.stack[len(vm.stack)-1] = value
+		case opPrint:
+			fmt.Fprintln(vm.host.output, runtime.Stringify(vm.pop()))
+		case opJump:
+			offset := readShort()
+			frame.ip += offset
+		case opJumpIfFalse:
+			offset := readShort()
+			if !runtime.IsTruthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case opIterator:
+			iterator, code, err := newIterator(vm.peek(0))
+			if err != nil {
+				vm.runtimeError(code, err)
+			}
+			vm.stack[len(vm.stack)-1] = iterator
+		case opIterate:
+			offset := readShort()
+			value, more, err := vm.peek(0).(*iterator).next()
+			// an iterator instance's methods run on the VM, which can move the frames
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+			if err != nil {
+				vm.runtimeError(diag.NativeError, err)
+			}
+			if more {
+				vm.push(value)
+			} else {
+				frame.ip += offset
+			}
+		case opLoop:
+			offset := readShort()
+			if code, err := vm.host.interruption(); err != nil {
+				vm.runtimeError(code, err)
+			}
+			// a signal handler runs on the VM, which can move the frames
+			frame = &vm.frames[len(vm.frames)-1]
+			frame.ip -= offset
+		case opCall:
+			argCount := int(readByte())
+			if code, err := vm.host.interruption(); err != nil {
+				vm.runtimeError(code, err)
+			}
+			vm.callValue(vm.peek(argCount), argCount)
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+		case opCallNamed:
+			argCount := int(readByte())
+			names := chunk.constants[readShort()].([]string)
+			if code, err := vm.host.interruption(); err != nil {
+				vm.runtimeError(code, err)
+			}
+			// put the arguments in parameter order, then call as if they had all been passed by position
+			callee := vm.peek(argCount)
+			args, code, err := bindNamedArguments(callee, vm.stack[len(vm.stack)-argCount:], names)
+			if err != nil {
+				vm.runtimeError(code, err)
+			}
+			vm.truncate(len(vm.stack) - argCount)
+			for _, arg := range args {
+				vm.push(arg)
+			}
+			vm.callValue(callee, len(args))
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+		case opClosure:
+			function := chunk.constants[readShort()].(*vmFunction)
+			closure := &vmClosure{function: function, upvalues: make([]*vmUpvalue, function.upvalueCount), vm: vm}
+			for i := range closure.upvalues {
+				isLocal := readByte() == 1
+				index := int(readByte())
+				if isLocal {
+					closure.upvalues[i] = vm.captureUpvalue(frame.slots + index)
+				} else {
+					closure.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(closure)
+		case opCloseUpvalue:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.pop()
+		case opReturn:
+			result := vm.pop()
+			vm.closeUpvalues(frame.slots)
+			vm.truncate(frame.slots)
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == exitDepth {
+				vm.push(result)
+				return result
+			}
+			vm.push(result)
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+		case opList:
+			count := readShort()
+			elements := make([]runtime.Value, count)
+			copy(elements, vm.stack[len(vm.stack)-count:])
+			vm.truncate(len(vm.stack) - count)
+			vm.push(runtime.NewList(elements))
+		case opMap:
+			count := readShort()
+			m := runtime.NewMap()
+			base := len(vm.stack) - 2*count
+			for i := base; i < len(vm.stack); i += 2 {
+				m.Set(vm.stack[i], vm.stack[i+1])
+			}
+			vm.truncate(base)
+			vm.push(m)
+		case opClass:
+			name := readString()
+			hasSuperclass := readByte() == 1
+			traitCount := readShort()
+			methods := readMethods()
+			traits := make([]runtime.Value, traitCount)
+			copy(traits, vm.stack[len(vm.stack)-traitCount:])
+			vm.truncate(len(vm.stack) - traitCount)
+			methods, code, err := mixTraits(traits, methods)
+			if err != nil {
+				vm.runtimeError(code, err)
+			}
+			var superclass *runtime.Class
+			if hasSuperclass {
+				class, isClass := vm.peek(0).(*runtime.Class)
+				if !isClass {
+					vm.runtimeError(diag.SuperclassNotClass, errors.New("Superclass must be a class."))
+				}
+				superclass = class
+			}
+			vm.push(runtime.NewClass(name, superclass, methods))
+		case opTrait:
+			name := readString()
+			vm.push(runtime.NewTrait(name, readMethods()))
+		}
+	}
+}
+
+var arithmeticOperators = map[opCode]string{
+	opGreater:      ">",
+	opGreaterEqual: ">=",
+	opLess:         "<",
+	opLessEqual:    "<=",
+	opAdd:          "+",
+	opSubtract:     "-",
+	opMultiply:     "*",
+	opDivide:       "/",
+	opModulo:       "%",
+}
+
+var bitwiseOperators = map[opCode]string{
+	opBitAnd:     "&",
+	opBitOr:      "|",
+	opBitXor:     "^",
+	opShiftLeft:  "<<",
+	opShiftRight: ">>",
+}
+
+/******************************************************************************
+ * Calls
+ *****************************************************************************/
+
+func (vm *VM) callValue(callee runtime.Value, argCount int) {
+	switch callee := callee.(type) {
+	case *vmClosure:
+		vm.call(callee, argCount)
+		return
+	case *vmBoundMethod:
+		vm.stack[len(vm.stack)-argCount-1] = callee.receiver
+		vm.call(callee.method, argCount)
+		return
+	case *runtime.Class:
+		initializer, hasInitializer := callee.FindMethod("init")
+		if closure, isClosure := initializer.(*vmClosure); isClosure {
+			vm.stack[len(vm.stack)-argCount-1] = runtime.NewInstance(callee)
+			vm.call(closure, argCount)
+			return
+		} else if !hasInitializer {
+			vm.checkArity(callee, argCount)
+			vm.stack[len(vm.stack)-1] = runtime.NewInstance(callee)
+			return
+		}
+	}
+
+	callable, isCallable := callee.(runtime.Callable)
+	if !isCallable {
+		vm.runtimeError(diag.NotCallable, errors.New("Can only call functions and classes."))
+	}
+	vm.checkArity(callable, argCount)
+	args := make([]runtime.Value, argCount)
+	copy(args, vm.stack[len(vm.stack)-argCount:])
+	result, err := callable.Call(args)
+	if err != nil {
+		vm.runtimeError(nativeErrorCode(err), err)
+	}
+	vm.truncate(len(vm.stack) - argCount - 1)
+	vm.push(result)
+}
+
+// callGetter calls the value on top of the stack in its place if it is a getter read as a property
+func (vm *VM) callGetter(value runtime.Value) {
+	if getter, isGetter := value.(runtime.Getter); isGetter && getter.IsGetter() {
+		vm.callValue(value, 0)
+	}
+}
+
+func (vm *VM) checkArity(callable runtime.Callable, argCount int) {
+	if err := runtime.CheckArity(callable, argCount); err != nil {
+		vm.runtimeError(diag.ArityMismatch, err)
+	}
+}
+
+func (vm *VM) call(closure *vmClosure, argCount int) {
+	if len(vm.frames) > 0 {
+		vm.checkArity(closure, argCount)
+	}
+	if closure.function.variadic {
+		// the extra arguments on the stack are replaced with a list of them, in the rest parameter's slot
+		extra := argCount - closure.function.arity
+		rest := make([]runtime.Value, extra)
+		copy(rest, vm.stack[len(vm.stack)-extra:])
+		vm.truncate(len(vm.stack) - extra)
+		vm.push(runtime.NewList(rest))
+		argCount = closure.function.arity + 1
+	}
+	if len(vm.frames)-1 >= vm.maxCallDepth {
+		vm.runtimeError(diag.StackOverflow, errors.New("Stack overflow."))
+	}
+	vm.frames = append(vm.frames, callFrame{closure: closure, slots: len(vm.stack) - argCount - 1})
+}
+
+// callFromGo runs a Lox callable to completion on behalf of Go code, like a native
+func (vm *VM) callFromGo(callee runtime.Value, args []runtime.Value) runtime.Value {
+	if vm.goCalls >= MaxCallDepth {
+		vm.runtimeError(diag.StackOverflow, errors.New("Stack overflow."))
+	}
+	depth := len(vm.frames)
+	base := len(vm.stack)
+	vm.goCalls++
+	defer func() {
+		vm.goCalls--
+		if recovered := recover(); recovered != nil {
+			// unwind the frames of the call, in case the Go code recovers from the error and carries on
+			vm.closeUpvalues(base)
+			vm.truncate(base)
+			vm.frames = vm.frames[:depth]
+			panic(recovered)
+		}
+	}()
+	vm.push(callee)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	vm.callValue(callee, len(args))
+	if len(vm.frames) > depth {
+		vm.run(depth)
+	}
+	return vm.pop()
+}
+
+func (vm *VM) captureUpvalue(slot int) *vmUpvalue {
+	var previous *vmUpvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		previous = upvalue
+		upvalue = upvalue.next
+	}
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+	created := &vmUpvalue{slot: slot, isOpen: true, next: upvalue}
+	if previous == nil {
+		vm.openUpvalues = created
+	} else {
+		previous.next = created
+	}
+	return created
+}
+
+// closeUpvalues closes every open upvalue pointing at the given stack slot or above it
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= last {
+		upvalue := vm.openUpvalues
+		upvalue.closed = vm.stack[upvalue.slot]
+		upvalue.isOpen = false
+		vm.openUpvalues = upvalue.next
+	}
+}
+
+/******************************************************************************
+ * Functions implement runtime.Function so they can be stored as methods of
+ * runtime classes and called from natives.
+ *****************************************************************************/
+
+func (function *vmFunction) String() string {
+	if function.name == "" {
+		return "<fun>"
+	}
+	return "<fun " + function.name + ">"
+}
+
+func (closure *vmClosure) Arity() int {
+	return closure.function.arity
+}
+
+func (closure *vmClosure) IsVariadic() bool {
+	return closure.function.variadic
+}
+
+func (closure *vmClosure) ParameterNames() []string {
+	return closure.function.paramNames
+}
+
+func (closure *vmClosure) Call(args []runtime.Value) (runtime.Value, error) {
+	return closure.vm.callFromGo(closure, args), nil
+}
+
+func (closure *vmClosure) Bind(instance *runtime.Instance) runtime.Function {
+	return &vmBoundMethod{receiver: instance, method: closure}
+}
+
+func (closure *vmClosure) IsGetter() bool {
+	return closure.function.isGetter
+}
+
+func (closure *vmClosure) Name() string {
+	return closure.function.name
+}
+
+func (closure *vmClosure) String() string {
+	return closure.function.String()
+}
+
+func (bound *vmBoundMethod) Arity() int {
+	return bound.method.Arity()
+}
+
+func (bound *vmBoundMethod) IsVariadic() bool {
+	return bound.method.IsVariadic()
+}
+
+func (bound *vmBoundMethod) ParameterNames() []string {
+	return bound.method.ParameterNames()
+}
+
+func (bound *vmBoundMethod) Call(args []runtime.Value) (runtime.Value, error) {
+	return bound.method.vm.callFromGo(bound, args), nil
+}
+
+func (bound *vmBoundMethod) Bind(instance *runtime.Instance) runtime.Function {
+	return &vmBoundMethod{receiver: instance, method: bound.method}
+}
+
+func (bound *vmBoundMethod) IsGetter() bool {
+	return bound.method.IsGetter()
+}
+
+func (bound *vmBoundMethod) Receiver() *runtime.Instance {
+	return bound.receiver
+}
+
+func (bound *vmBoundMethod) Unbound() runtime.Function {
+	return bound.method
+}
+
+func (bound *vmBoundMethod) Name() string {
+	return bound.method.Name()
+}
+
+func (bound *vmBoundMethod) String() string {
+	return bound.method.String()
+}
@@ -0,0 +1,120 @@
+package lang
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+/******************************************************************************
+ * The VM is checked against the tree-walker on programs that lean on the
+ * parts of the compiler that are easy to get wrong: jumps patched over
+ * nested branches and loops, upvalues closed when the variables they
+ * capture go out of scope, and super calls up a chain of classes. Each
+ * program has to print the same thing on both engines, without errors.
+ *****************************************************************************/
+
+func TestEngines(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		output string
+	}{
+		{"closures captured in a while loop", `
+			var fns = [];
+			var i = 0;
+			while (i < 3) {
+			  var j = i;
+			  append(fns, fun () { return j; });
+			  i = i + 1;
+			}
+			for (var k = 0; k < 3; k = k + 1) print fns[k]();`, "0\n1\n2\n"},
+		// as in the book, every closure made in a for loop shares its one loop variable
+		{"closures captured in a for loop", `
+			var fns = [];
+			for (var i = 0; i < 3; i = i + 1) {
+			  append(fns, fun () { return i; });
+			}
+			print fns[0]() + fns[2]();`, "6\n"},
+		{"closures captured in a for-in loop", `
+			var fns = [];
+			for (var x in ["a", "b", "c"]) append(fns, fun () { return x; });
+			print fns[0]() + fns[1]() + fns[2]();`, "abc\n"},
+		{"closures sharing a variable", `
+			fun counter() {
+			  var count = 0;
+			  fun increment() { count = count + 1; return count; }
+			  fun get() { return count; }
+			  return [increment, get];
+			}
+			var c = counter();
+			c[0](); c[0]();
+			print c[1]();`, "2\n"},
+		{"upvalue closed by a break", `
+			var saved;
+			while (true) {
+			  var local = "kept";
+			  saved = fun () { return local; };
+			  break;
+			}
+			print saved();`, "kept\n"},
+		{"nested jumps", `
+			for (var i = 0; i < 6; i = i + 1) {
+			  if (i == 1) continue;
+			  if (i > 4) break;
+			  var j = 0;
+			  while (true) {
+			    if (j >= i) break; else j = j + 1;
+			  }
+			  print i == j and (i < 3 or i == 4) ? i : -i;
+			}`, "0\n2\n-3\n4\n"},
+		{"deep inheritance with super", `
+			class A {
+			  init(name) { this.name = name; }
+			  describe() { return "A"; }
+			}
+			class B < A { describe() { return super.describe() + "B"; } }
+			class C < B {
+			  init(name) { super.init(name + "!"); }
+			  describe() { return super.describe() + "C"; }
+			}
+			class D < C { describe() { return super.describe() + "D"; } }
+			var d = D("d");
+			print d.describe();
+			print d.name;`, "ABCD\nd!\n"},
+		{"super method captured in a closure", `
+			class Base { greet(who) { return "hi " + who; } }
+			class Derived < Base {
+			  greeter() { return fun (who) { return super.greet(who) + "!"; }; }
+			}
+			print Derived().greeter()("you");`, "hi you!\n"},
+	}
+	engines := []struct {
+		name      string
+		newEngine func(errorHandler *ErrorHandler, output io.Writer) Engine
+	}{
+		{"interpreter", func(errorHandler *ErrorHandler, output io.Writer) Engine {
+			interpreter := NewInterpreter(errorHandler)
+			interpreter.SetOutput(output)
+			return interpreter
+		}},
+		{"vm", func(errorHandler *ErrorHandler, output io.Writer) Engine {
+			vm := NewVM(errorHandler)
+			vm.SetOutput(output)
+			return vm
+		}},
+	}
+	for _, test := range tests {
+		for _, engine := range engines {
+			t.Run(test.name+"/"+engine.name, func(t *testing.T) {
+				var output strings.Builder
+				diagnostics := runOn(test.source, func(errorHandler *ErrorHandler) Engine {
+					return engine.newEngine(errorHandler, &output)
+				})
+				if len(diagnostics) > 0 || output.String() != test.output {
+					t.Errorf("printed %q with diagnostics %v, expected %q", output.String(), diagnostics, test.output)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package lang
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * Workers run a Lox script in an interpreter of its own on its own
+ * goroutine. A worker shares nothing with the program that started it, the
+ * two only talk by sending each other messages. Messages are deep copied on
+ * the way, so neither side can ever see the other change a value, and that
+ * is what makes running them in parallel safe.
+ *
+ * Only nil, booleans, numbers, strings, lists, and maps can be sent. Lists
+ * and maps are copied with their structure intact, including values that
+ * appear in them more than once. Mutexes and atomic counters (see sync.go)
+ * can be sent too, but they are shared rather than copied.
+ *****************************************************************************/
+
+// mailbox is an unbounded queue of messages, so sending never blocks
+type mailbox struct {
+	mutex    sync.Mutex
+	ready    *sync.Cond
+	messages []runtime.Value
+	closed   bool // set once the sending side has finished
+}
+
+func newMailbox() *mailbox {
+	m := &mailbox{}
+	m.ready = sync.NewCond(&m.mutex)
+	return m
+}
+
+func (m *mailbox) put(message runtime.Value) {
+	m.mutex.Lock()
+	m.messages = append(m.messages, message)
+	m.mutex.Unlock()
+	m.ready.Signal()
+}
+
+// take waits for the next message, it returns false if the mailbox is closed and empty
+func (m *mailbox) take() (runtime.Value, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for len(m.messages) == 0 && !m.closed {
+		m.ready.Wait()
+	}
+	if len(m.messages) == 0 {
+		return nil, false
+	}
+	message := m.messages[0]
+	m.messages[0] = nil
+	m.messages = m.messages[1:]
+	return message, true
+}
+
+func (m *mailbox) close() {
+	m.mutex.Lock()
+	m.closed = true
+	m.mutex.Unlock()
+	m.ready.Broadcast()
+}
+
+// workerLink is how a worker's interpreter reaches the program that started it
+type workerLink struct {
+	inbox  *mailbox
+	outbox *mailbox
+}
+
+type worker struct {
+	path        string
+	link        *workerLink
+	interpreter *Interpreter
+	done        chan struct{}
+	terminated  atomic.Bool
+}
+
+// workerErrors writes a worker's errors to stderr, except the one it gets for being terminated
+type workerErrors struct {
+	w *worker
+}
+
+func (e workerErrors) Write(p []byte) (int, error) {
+	if e.w.terminated.Load() {
+		return len(p), nil
+	}
+	return os.Stderr.Write(p)
+}
+
+func (interpreter *Interpreter) startWorker(path string) (*worker, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(interpreter.dir, path)
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &worker{path: path, done: make(chan struct{})}
+	errorHandler := NewErrorHandler()
+	errorHandler.Output = workerErrors{w: w}
+	workerInterpreter := NewInterpreter(errorHandler)
+	workerInterpreter.SetScriptPath(path)
+	workerInterpreter.output = interpreter.output
+	workerInterpreter.nativeFilter = interpreter.nativeFilter
+	if interpreter.hooks != nil && interpreter.hooks.stepBudget > 0 {
+		workerInterpreter.SetStepBudget(interpreter.hooks.stepBudget)
+	}
+	workerInterpreter.stack.limit = interpreter.stack.limit
+	workerInterpreter.worker = &workerLink{inbox: newMailbox(), outbox: newMailbox()}
+	w.link = workerInterpreter.worker
+	w.interpreter = workerInterpreter
+
+	go func() {
+		defer close(w.done)
+		defer w.link.outbox.close()
+		// errors are reported by the worker's own error handler, it just stops
+		program := NewFrontEnd(errorHandler).Analyze(string(source))
+		if program == nil {
+			return
+		}
+		workerInterpreter.Compile(program)
+		workerInterpreter.Run()
+		workerInterpreter.RunExitHooks()
+	}()
+	return w, nil
+}
+
+func (w *worker) Get(name string) (runtime.Value, bool) {
+	switch name {
+	case "send":
+		return runtime.NewNativeFunction("send", 1, func(args []runtime.Value) (runtime.Value, error) {
+			message, err := copyMessage(args[0], make(map[runtime.Value]runtime.Value))
+			if err != nil {
+				return nil, err
+			}
+			w.link.inbox.put(message)
+			return nil, nil
+		}), true
+	case "receive":
+		// waits for the worker's next message, or returns nil once it has finished and sent everything
+		return runtime.NewNativeFunction("receive", 0, func(args []runtime.Value) (runtime.Value, error) {
+			message, _ := w.link.outbox.take()
+			return message, nil
+		}), true
+	case "join":
+		return runtime.NewNativeFunction("join", 0, func(args []runtime.Value) (runtime.Value, error) {
+			<-w.done
+			return nil, nil
+		}), true
+	case "terminate":
+		return runtime.NewNativeFunction("terminate", 0, func(args []runtime.Value) (runtime.Value, error) {
+			w.terminated.Store(true)
+			w.interpreter.Cancel()
+			w.link.inbox.close()
+			<-w.done
+			return nil, nil
+		}), true
+	}
+	return nil, false
+}
+
+func (w *worker) String() string {
+	return "<worker " + filepath.Base(w.path) + ">"
+}
+
+// copyMessage deep copies a value being sent between workers
+func copyMessage(value runtime.Value, copies map[runtime.Value]runtime.Value) (runtime.Value, error) {
+	switch value := value.(type) {
+	case nil, bool, int64, float64, string, *loxMutex, *atomicCounter:
+		return value, nil
+	case *runtime.List:
+		if copied, found := copies[value]; found {
+			return copied, nil
+		}
+		copied := runtime.NewList(make([]runtime.Value, value.Len()))
+		copies[value] = copied
+		for i := 0; i < value.Len(); i++ {
+			element, err := copyMessage(value.Get(i), copies)
+			if err != nil {
+				return nil, err
+			}
+			copied.Set(i, element)
+		}
+		return copied, nil
+	case *runtime.Map:
+		if copied, found := copies[value]; found {
+			return copied, nil
+		}
+		copied := runtime.NewMap()
+		copies[value] = copied
+		for _, key := range value.Keys() {
+			copiedKey, err := copyMessage(key, copies)
+			if err != nil {
+				return nil, err
+			}
+			entry, _ := value.Get(key)
+			copiedEntry, err := copyMessage(entry, copies)
+			if err != nil {
+				return nil, err
+			}
+			copied.Set(copiedKey, copiedEntry)
+		}
+		return copied, nil
+	}
+	return nil, errors.New("Only nil, booleans, numbers, strings, lists, maps, mutexes, and atomic counters can be sent to a worker.")
+}
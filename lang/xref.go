@@ -0,0 +1,196 @@
+package lang
+
+import "sort"
+
+/******************************************************************************
+ * A cross reference lists every variable a program declares, along with
+ * everywhere it is used, for "glox xref" and tools built on it like rename
+ * and dead-code reports. It is built by the resolver, which already knows
+ * which declaration each name refers to. The cross reference keeps its own
+ * stack of scopes alongside the resolver's, holding the symbol for each name
+ * rather than whether it has been defined yet.
+ *
+ * Each local symbol remembers the scope it was declared in, and each scope
+ * how far through the source the names in it reach, so rename can tell
+ * whether a new name would hide one from an enclosing scope.
+ *
+ * Globals are late bound, a function can use one declared further down, so
+ * references that aren't to a local are only matched to global declarations
+ * once the whole program has been seen. Names that are never declared, like
+ * natives or typos, are collected as undeclared symbols.
+ *****************************************************************************/
+
+type Symbol struct {
+	Name       string
+	Kind       string // class, function, import, parameter, trait, variable, or undeclared
+	Global     bool
+	Declared   Span // the zero Span for undeclared symbols
+	References []Reference
+
+	scope *xrefScope // nil for globals and undeclared symbols
+}
+
+type Reference struct {
+	Span  Span
+	Write bool // an assignment, or a global declared again
+}
+
+type CrossReference struct {
+	Symbols []*Symbol // in the order they were declared, undeclared symbols last
+
+	scopes  []*xrefScope
+	globals map[string]*Symbol
+	pending []pendingReference // references to globals, matched up by finish
+}
+
+type xrefScope struct {
+	enclosing *xrefScope
+	symbols   map[string]*Symbol
+	start     int // offset of the first name declared or used in the scope, or in a scope inside it
+	end       int // offset just past the last one
+}
+
+// within reports whether scope is inner or one of the scopes enclosing it
+func (scope *xrefScope) within(inner *xrefScope) bool {
+	for ; inner != nil; inner = inner.enclosing {
+		if inner == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type pendingReference struct {
+	name      string
+	reference Reference
+}
+
+/******************************************************************************
+ * BuildCrossReference scans, parses, and resolves source and returns its
+ * cross reference. It returns nil if a static error was found, after
+ * reporting it through the error handler.
+ *****************************************************************************/
+
+func BuildCrossReference(source string, errorHandler *ErrorHandler) *CrossReference {
+	xref := buildCrossReference(source, false, errorHandler)
+	if errorHandler.HadError {
+		return nil
+	}
+	return xref
+}
+
+/******************************************************************************
+ * BuildPartialCrossReference is BuildCrossReference for source that might not
+ * parse, like a file in the middle of being edited. It parses in partial mode
+ * (see Parser.SetPartialMode) and always returns a cross reference, covering
+ * every declaration and reference outside of the parts with syntax errors.
+ *****************************************************************************/
+
+func BuildPartialCrossReference(source string, errorHandler *ErrorHandler) *CrossReference {
+	return buildCrossReference(source, true, errorHandler)
+}
+
+func buildCrossReference(source string, partial bool, errorHandler *ErrorHandler) *CrossReference {
+	scanner := NewScanner(source, errorHandler)
+	tokens := scanner.ScanTokens()
+	parser := NewParser(tokens, errorHandler)
+	parser.SetPartialMode(partial)
+	statements := parser.Parse()
+	if errorHandler.HadError && !partial {
+		return nil
+	}
+	return resolveCrossReference(statements, scanner.Directives(), errorHandler)
+}
+
+// resolveCrossReference builds the cross reference of statements that have already been parsed
+func resolveCrossReference(statements []Stmt, directives *Directives, errorHandler *ErrorHandler) *CrossReference {
+	xref := &CrossReference{globals: make(map[string]*Symbol)}
+	resolver := NewResolver(errorHandler)
+	resolver.xref = xref
+	resolver.SetDirectives(directives)
+	resolver.ResolveStatements(statements)
+	xref.finish()
+	return xref
+}
+
+func (x *CrossReference) beginScope() {
+	scope := &xrefScope{symbols: make(map[string]*Symbol), start: -1}
+	if len(x.scopes) > 0 {
+		scope.enclosing = x.scopes[len(x.scopes)-1]
+	}
+	x.scopes = append(x.scopes, scope)
+}
+
+func (x *CrossReference) endScope() {
+	x.scopes = x.scopes[:len(x.scopes)-1]
+}
+
+// extendScopes stretches every open scope to cover a name
+func (x *CrossReference) extendScopes(span Span) {
+	for _, scope := range x.scopes {
+		if scope.start < 0 || span.Start.Offset < scope.start {
+			scope.start = span.Start.Offset
+		}
+		if span.End.Offset > scope.end {
+			scope.end = span.End.Offset
+		}
+	}
+}
+
+func (x *CrossReference) declare(name Token, kind string) {
+	x.extendScopes(name.span)
+	if len(x.scopes) == 0 {
+		if symbol, declared := x.globals[name.lexeme]; declared {
+			symbol.References = append(symbol.References, Reference{Span: name.span, Write: true})
+			return
+		}
+	}
+	symbol := &Symbol{Name: name.lexeme, Kind: kind, Global: len(x.scopes) == 0, Declared: name.span}
+	x.Symbols = append(x.Symbols, symbol)
+	if symbol.Global {
+		x.globals[name.lexeme] = symbol
+	} else {
+		symbol.scope = x.scopes[len(x.scopes)-1]
+		symbol.scope.symbols[name.lexeme] = symbol
+	}
+}
+
+func (x *CrossReference) reference(name Token, write bool) {
+	if name.tokenType == tokenTypeThis || name.tokenType == tokenTypeSuper {
+		return
+	}
+	x.extendScopes(name.span)
+	reference := Reference{Span: name.span, Write: write}
+	for i := len(x.scopes) - 1; i >= 0; i-- {
+		if symbol, found := x.scopes[i].symbols[name.lexeme]; found {
+			symbol.References = append(symbol.References, reference)
+			return
+		}
+	}
+	x.pending = append(x.pending, pendingReference{name: name.lexeme, reference: reference})
+}
+
+// finish matches references to globals with their declarations, now that every declaration has been seen
+func (x *CrossReference) finish() {
+	undeclared := make(map[string]*Symbol)
+	for _, pending := range x.pending {
+		symbol, declared := x.globals[pending.name]
+		if !declared {
+			symbol, declared = undeclared[pending.name]
+			if !declared {
+				symbol = &Symbol{Name: pending.name, Kind: "undeclared", Global: true}
+				undeclared[pending.name] = symbol
+			}
+		}
+		symbol.References = append(symbol.References, pending.reference)
+	}
+	for _, name := range sortedNames(undeclared) {
+		x.Symbols = append(x.Symbols, undeclared[name])
+	}
+	for _, symbol := range x.Symbols {
+		sort.SliceStable(symbol.References, func(a, b int) bool {
+			return symbol.References[a].Span.Start.Offset < symbol.References[b].Span.Start.Offset
+		})
+	}
+	x.pending = nil
+}
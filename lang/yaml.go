@@ -0,0 +1,660 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/skusel/glox/runtime"
+)
+
+/******************************************************************************
+ * yamlParse() reads a YAML document into maps and lists. It covers what
+ * configuration files use: block mappings and sequences nested by
+ * indentation, flow collections like [a, b] and {a: 1}, plain, quoted, and
+ * block scalars (| and >, with - and + for how trailing newlines are kept),
+ * comments, anchors and aliases, and merge keys (<<: *defaults).
+ *
+ * Plain scalars are resolved with YAML 1.2's core schema, so null and ~ are
+ * nil, true and false are booleans, numbers are integers or floats, and
+ * everything else, yes and no included, is a string. Quoted scalars are
+ * always strings. An alias gives the same list or map as its anchor, not a
+ * copy.
+ *
+ * Only a single document is read, and tags, complex keys (? key), and
+ * quoted scalars that span lines aren't supported.
+ *****************************************************************************/
+
+type yamlParser struct {
+	lines   []string
+	row     int // the line being read, counting from 0
+	anchors map[string]runtime.Value
+}
+
+func parseYAML(text string) (runtime.Value, error) {
+	text = strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	p := &yamlParser{lines: strings.Split(text, "\n"), anchors: make(map[string]runtime.Value)}
+	p.startDocument()
+	var value runtime.Value
+	if indent, _, found := p.peek(); found {
+		var err error
+		if value, err = p.block(indent); err != nil {
+			return nil, err
+		}
+	}
+	for ; p.row < len(p.lines); p.row++ {
+		if line := p.lines[p.row]; strings.HasPrefix(line, "---") {
+			if p.row++; p.row < len(p.lines) {
+				if _, _, found := p.peek(); found {
+					return nil, fmt.Errorf("yamlParse() found a second document on line %d, it only reads one.", p.row+1)
+				}
+			}
+			return value, nil
+		} else if !isDocumentMarker(line) && strings.TrimSpace(stripYAMLComment(line)) != "" {
+			return nil, p.errorf("the end of the document")
+		}
+	}
+	return value, nil
+}
+
+// startDocument skips directives and the --- that starts the document, keeping anything after it on its line
+func (p *yamlParser) startDocument() {
+	for ; p.row < len(p.lines); p.row++ {
+		line := p.lines[p.row]
+		if strings.HasPrefix(line, "%") || strings.TrimSpace(stripYAMLComment(line)) == "" {
+			continue
+		}
+		if line == "---" || strings.HasPrefix(line, "--- ") {
+			p.lines[p.row] = strings.TrimLeft(line[3:], " ")
+		}
+		return
+	}
+}
+
+func isDocumentMarker(line string) bool {
+	for _, marker := range []string{"---", "..."} {
+		if line == marker || strings.HasPrefix(line, marker+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// peek returns the indentation and content, without any comment, of the next line that has some
+func (p *yamlParser) peek() (int, string, bool) {
+	for ; p.row < len(p.lines); p.row++ {
+		line := p.lines[p.row]
+		if isDocumentMarker(line) {
+			return 0, "", false
+		}
+		content := strings.TrimLeft(line, " ")
+		if content = strings.TrimSpace(stripYAMLComment(content)); content != "" {
+			return len(line) - len(strings.TrimLeft(line, " ")), content, true
+		}
+	}
+	return 0, "", false
+}
+
+// stripYAMLComment removes a comment from a line, which starts with a # after whitespace outside of quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[{,", line[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// block reads the mapping, sequence, or scalar whose first line is the next one, indented by indent
+func (p *yamlParser) block(indent int) (runtime.Value, error) {
+	_, content, _ := p.peek()
+	if isSequenceItem(content) {
+		return p.sequence(indent)
+	}
+	if _, _, isEntry, err := p.mappingEntry(content); err != nil {
+		return nil, err
+	} else if isEntry {
+		return p.mapping(indent)
+	}
+	p.row++
+	return p.value(content, indent-1, false)
+}
+
+func isSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ") || strings.HasPrefix(content, "-\t")
+}
+
+func (p *yamlParser) sequence(indent int) (runtime.Value, error) {
+	elements := make([]runtime.Value, 0)
+	for {
+		lineIndent, content, found := p.peek()
+		if !found || lineIndent < indent || (lineIndent == indent && !isSequenceItem(content)) {
+			return runtime.NewList(elements), nil
+		} else if lineIndent > indent {
+			return nil, p.errorf("'-' lined up with the item before it")
+		}
+		rest := strings.TrimLeft(content[1:], " \t")
+		var element runtime.Value
+		var err error
+		_, _, isEntry, _ := p.mappingEntry(rest)
+		if rest != "" && (isSequenceItem(rest) || isEntry) {
+			// an item that is itself a mapping or sequence starts on the same line, so read it as if the - were a space
+			line := p.lines[p.row]
+			p.lines[p.row] = line[:lineIndent] + " " + line[lineIndent+1:]
+			element, err = p.block(lineIndent + len(content) - len(rest))
+		} else {
+			p.row++
+			element, err = p.value(rest, indent, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+}
+
+func (p *yamlParser) mapping(indent int) (runtime.Value, error) {
+	m := runtime.NewMap()
+	var merges []runtime.Value
+	for {
+		lineIndent, content, found := p.peek()
+		if !found || lineIndent < indent {
+			break
+		} else if lineIndent > indent {
+			return nil, p.errorf("a key lined up with the one before it")
+		}
+		key, rest, isEntry, err := p.mappingEntry(content)
+		if err != nil {
+			return nil, err
+		} else if !isEntry {
+			return nil, p.errorf("a key")
+		}
+		line := p.row + 1
+		p.row++
+		value, err := p.value(rest, indent, true)
+		if err != nil {
+			return nil, err
+		}
+		if key == "<<" {
+			merges = append(merges, value)
+			continue
+		}
+		if _, exists := m.Get(key); exists {
+			return nil, fmt.Errorf("yamlParse() found '%s' defined twice on line %d.", runtime.Stringify(key), line)
+		}
+		m.Set(key, value)
+	}
+	return m, p.merge(m, merges)
+}
+
+// merge adds the entries of the maps given with <<, or of lists of them, that m doesn't already have
+func (p *yamlParser) merge(m *runtime.Map, merges []runtime.Value) error {
+	for _, merged := range merges {
+		sources := []runtime.Value{merged}
+		if list, isList := merged.(*runtime.List); isList {
+			sources = list.Elements()
+		}
+		for _, source := range sources {
+			sourceMap, isMap := source.(*runtime.Map)
+			if !isMap {
+				return errors.New("yamlParse() can only merge maps into a map with '<<'.")
+			}
+			for _, key := range sourceMap.Keys() {
+				if _, exists := m.Get(key); !exists {
+					value, _ := sourceMap.Get(key)
+					m.Set(key, value)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/******************************************************************************
+ * mappingEntry splits a line like "key: value" into its key and the text of
+ * its value. A plain key ends at the first colon followed by a space, and a
+ * quoted key must be followed by one. The merge key << is returned as the
+ * string "<<" for mapping to recognize.
+ *****************************************************************************/
+
+func (p *yamlParser) mappingEntry(content string) (runtime.Value, string, bool, error) {
+	if content == "" || strings.IndexByte("[{&*!|>%@`", content[0]) >= 0 || isSequenceItem(content) {
+		return nil, "", false, nil
+	}
+	if content[0] == '"' || content[0] == '\'' {
+		key, end, err := p.quoted(content, 0, p.row+1)
+		if err != nil {
+			return nil, "", false, err
+		}
+		rest := strings.TrimLeft(content[end:], " \t")
+		if rest != ":" && !strings.HasPrefix(rest, ": ") && !strings.HasPrefix(rest, ":\t") {
+			return nil, "", false, nil
+		}
+		return key, strings.TrimSpace(rest[1:]), true, nil
+	}
+	colon := strings.Index(content, ": ")
+	if tab := strings.Index(content, ":\t"); tab >= 0 && (colon < 0 || tab < colon) {
+		colon = tab
+	}
+	if colon < 0 {
+		if !strings.HasSuffix(content, ":") {
+			return nil, "", false, nil
+		}
+		colon = len(content) - 1
+	}
+	key := strings.TrimSpace(content[:colon])
+	if key == "<<" {
+		return key, strings.TrimSpace(content[colon+1:]), true, nil
+	}
+	return resolveYAMLScalar(key), strings.TrimSpace(content[colon+1:]), true, nil
+}
+
+/******************************************************************************
+ * value reads the value that starts with rest, the text after a key's colon
+ * or a sequence's dash, on a line indented by indent. If rest is empty the
+ * value is the block on the lines after, indented further, or nil if there
+ * isn't one. Under a key, a sequence may be indented as far as the key.
+ *****************************************************************************/
+
+func (p *yamlParser) value(rest string, indent int, underKey bool) (runtime.Value, error) {
+	line := p.row // the value's line, which has already been passed
+	switch {
+	case rest == "":
+		lineIndent, content, found := p.peek()
+		if found && (lineIndent > indent || (underKey && lineIndent == indent && isSequenceItem(content))) {
+			return p.block(lineIndent)
+		}
+		return nil, nil
+	case rest[0] == '&':
+		name, after, _ := strings.Cut(rest[1:], " ")
+		if name == "" {
+			return nil, fmt.Errorf("yamlParse() expected an anchor name on line %d.", line)
+		}
+		value, err := p.value(strings.TrimSpace(after), indent, underKey)
+		p.anchors[name] = value
+		return value, err
+	case rest[0] == '*':
+		value, defined := p.anchors[rest[1:]]
+		if !defined {
+			return nil, fmt.Errorf("yamlParse() found an alias to undefined anchor '%s' on line %d.", rest[1:], line)
+		}
+		return value, nil
+	case rest[0] == '!':
+		return nil, fmt.Errorf("yamlParse() doesn't support tags, found one on line %d.", line)
+	case rest[0] == '|' || rest[0] == '>':
+		return p.blockScalar(rest, indent, line)
+	case rest[0] == '[' || rest[0] == '{':
+		return p.flow(rest, line)
+	case rest[0] == '"' || rest[0] == '\'':
+		str, end, err := p.quoted(rest, 0, line)
+		if err != nil {
+			return nil, err
+		} else if end < len(rest) {
+			return nil, fmt.Errorf("yamlParse() expected the end of the line after a string on line %d.", line)
+		}
+		return str, nil
+	}
+	// a plain scalar continues on lines indented further, joined with spaces
+	for {
+		lineIndent, content, found := p.peek()
+		if !found || lineIndent <= indent {
+			break
+		}
+		if _, _, isEntry, _ := p.mappingEntry(content); isEntry {
+			return nil, fmt.Errorf("yamlParse() found a key indented under a value on line %d.", p.row+1)
+		}
+		rest += " " + content
+		p.row++
+	}
+	return resolveYAMLScalar(rest), nil
+}
+
+/******************************************************************************
+ * resolveYAMLScalar gives a plain scalar its type under YAML 1.2's core
+ * schema, a string if it doesn't look like anything else.
+ *****************************************************************************/
+
+func resolveYAMLScalar(text string) runtime.Value {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	}
+	if len(text) > 2 && text[0] == '0' && (text[1] == 'x' || text[1] == 'o') {
+		base := map[byte]int{'x': 16, 'o': 8}[text[1]]
+		if integer, err := strconv.ParseInt(text[2:], base, 64); err == nil && text[2] != '+' && text[2] != '-' {
+			return integer
+		}
+		return text
+	}
+	unsigned := strings.TrimLeft(text[:1], "+-") + text[1:]
+	if strings.Trim(unsigned, "0123456789.eE+-") != "" || !strings.ContainsAny(unsigned, "0123456789") {
+		return text
+	}
+	if strings.Trim(unsigned, "0123456789") == "" {
+		if integer, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return integer
+		}
+	}
+	if float, err := strconv.ParseFloat(text, 64); err == nil {
+		return float
+	}
+	return text
+}
+
+/******************************************************************************
+ * blockScalar reads a | or > scalar from the lines after its header, which
+ * are indented further than the line the header is on. Lines are kept as
+ * they are by |, and folded into one by >, except where a line is blank or
+ * indented further still. Trailing newlines are cut to one, or all taken
+ * off with -, or all kept with +.
+ *****************************************************************************/
+
+func (p *yamlParser) blockScalar(header string, indent int, line int) (runtime.Value, error) {
+	folded := header[0] == '>'
+	chomping := byte(0)
+	contentIndent := -1
+	for _, c := range []byte(header[1:]) {
+		switch {
+		case (c == '-' || c == '+') && chomping == 0:
+			chomping = c
+		case c >= '1' && c <= '9' && contentIndent < 0:
+			contentIndent = max(indent, 0) + int(c-'0')
+		default:
+			return nil, fmt.Errorf("yamlParse() found an invalid block scalar header on line %d.", line)
+		}
+	}
+	var lines []string
+	for ; p.row < len(p.lines) && !isDocumentMarker(p.lines[p.row]); p.row++ {
+		text := p.lines[p.row]
+		lineIndent := len(text) - len(strings.TrimLeft(text, " "))
+		if strings.TrimSpace(text) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if contentIndent < 0 {
+			contentIndent = lineIndent
+		}
+		if lineIndent < contentIndent || lineIndent <= indent {
+			break
+		}
+		lines = append(lines, text[contentIndent:])
+	}
+	text := 0 // the lines before the trailing blank ones
+	for i, content := range lines {
+		if content != "" {
+			text = i + 1
+		}
+	}
+	moreIndented := func(line string) bool { return line[0] == ' ' || line[0] == '\t' }
+	var builder strings.Builder
+	for i, content := range lines[:text] {
+		if i > 0 {
+			previous := lines[i-1]
+			if !folded || previous == "" || moreIndented(previous) {
+				builder.WriteByte('\n')
+			} else if content == "" {
+				// the break before a blank line is dropped, the blank line gives the newline
+			} else if moreIndented(content) {
+				builder.WriteByte('\n')
+			} else {
+				builder.WriteByte(' ')
+			}
+		}
+		builder.WriteString(content)
+	}
+	switch {
+	case chomping == '+':
+		builder.WriteString(strings.Repeat("\n", len(lines)-text+min(text, 1)))
+	case chomping == 0 && text > 0:
+		builder.WriteByte('\n')
+	}
+	return builder.String(), nil
+}
+
+// flow reads a flow collection, which continues onto the lines after until its brackets are closed
+func (p *yamlParser) flow(text string, line int) (runtime.Value, error) {
+	for !flowClosed(text) {
+		if p.row >= len(p.lines) || isDocumentMarker(p.lines[p.row]) {
+			return nil, fmt.Errorf("yamlParse() found an unclosed '%c' on line %d.", text[0], line)
+		}
+		text += " " + strings.TrimSpace(stripYAMLComment(strings.TrimLeft(p.lines[p.row], " ")))
+		p.row++
+	}
+	f := &yamlFlow{parser: p, text: text, line: line}
+	value, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	if f.skipSpace(); f.pos < len(f.text) {
+		return nil, f.errorf("the end of the line")
+	}
+	return value, nil
+}
+
+// flowClosed reports whether every bracket opened in text has been closed
+func flowClosed(text string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+/******************************************************************************
+ * quoted reads the quoted scalar starting at start in text, returning the
+ * string and where it ended, or an error mentioning line. Single quoted scalars escape a quote by
+ * doubling it, and double quoted ones use backslash escapes.
+ *****************************************************************************/
+
+func (p *yamlParser) quoted(text string, start int, line int) (string, int, error) {
+	quote := text[start]
+	var builder strings.Builder
+	for i := start + 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			builder.WriteByte('\'')
+			i++
+		case c == quote:
+			return builder.String(), i + 1, nil
+		case c == '\\' && quote == '"':
+			if i++; i >= len(text) {
+				break
+			}
+			if replacement, simple := configEscapes[text[i]]; simple {
+				builder.WriteString(replacement)
+			} else if replacement, simple := yamlEscapes[text[i]]; simple {
+				builder.WriteString(replacement)
+			} else if r, size := unescapeUnicode(text[i:]); size > 0 {
+				builder.WriteRune(r)
+				i += size - 1
+			} else {
+				return "", 0, fmt.Errorf("yamlParse() found an invalid escape sequence on line %d.", line)
+			}
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("yamlParse() found an unterminated string on line %d.", line)
+}
+
+// yamlEscapes are the escape sequences YAML has that TOML doesn't
+var yamlEscapes = map[byte]string{'0': "\x00", 'a': "\a", 'v': "\v", ' ': " ", '\t': "\t", 'N': "\u0085",
+	'_': "\u00a0", 'L': "\u2028", 'P': "\u2029"}
+
+func (p *yamlParser) errorf(expected string) error {
+	if p.row >= len(p.lines) {
+		return fmt.Errorf("yamlParse() expected %s but the text ended.", expected)
+	}
+	return fmt.Errorf("yamlParse() expected %s on line %d.", expected, p.row+1)
+}
+
+/******************************************************************************
+ * yamlFlow reads a flow collection, with all of its lines joined into one.
+ * In a flow collection a plain scalar ends at a comma, a bracket, or a colon
+ * followed by a space.
+ *****************************************************************************/
+
+type yamlFlow struct {
+	parser *yamlParser
+	text   string
+	pos    int
+	line   int // where the collection started, for errors
+}
+
+func (f *yamlFlow) value() (runtime.Value, error) {
+	f.skipSpace()
+	if f.pos >= len(f.text) {
+		return nil, f.errorf("a value")
+	}
+	switch c := f.text[f.pos]; c {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		str, end, err := f.parser.quoted(f.text, f.pos, f.line)
+		f.pos = end
+		return str, err
+	case '&':
+		start := f.pos + 1
+		for f.pos < len(f.text) && strings.IndexByte(" ,[]{}", f.text[f.pos]) < 0 {
+			f.pos++
+		}
+		value, err := f.value()
+		f.parser.anchors[f.text[start:f.pos]] = value
+		return value, err
+	case '*':
+		start := f.pos + 1
+		for f.pos < len(f.text) && strings.IndexByte(" ,[]{}", f.text[f.pos]) < 0 {
+			f.pos++
+		}
+		value, defined := f.parser.anchors[f.text[start:f.pos]]
+		if !defined {
+			return nil, fmt.Errorf("yamlParse() found an alias to undefined anchor '%s' on line %d.", f.text[start:f.pos], f.line)
+		}
+		return value, nil
+	case ',', ']', '}':
+		return nil, nil
+	}
+	start := f.pos
+	for f.pos < len(f.text) && strings.IndexByte(",[]{}", f.text[f.pos]) < 0 && !f.atColon() {
+		f.pos++
+	}
+	return resolveYAMLScalar(strings.TrimSpace(f.text[start:f.pos])), nil
+}
+
+// atColon reports whether the flow is at a colon that ends a key
+func (f *yamlFlow) atColon() bool {
+	return f.text[f.pos] == ':' && (f.pos+1 >= len(f.text) || strings.IndexByte(" ,[]{}", f.text[f.pos+1]) >= 0)
+}
+
+func (f *yamlFlow) sequence() (runtime.Value, error) {
+	elements := make([]runtime.Value, 0)
+	err := f.items(']', func() error {
+		element, err := f.value()
+		elements = append(elements, element)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return runtime.NewList(elements), nil
+}
+
+func (f *yamlFlow) mapping() (runtime.Value, error) {
+	m := runtime.NewMap()
+	err := f.items('}', func() error {
+		key, err := f.value()
+		if err != nil {
+			return err
+		}
+		var value runtime.Value
+		if f.skipSpace(); f.pos < len(f.text) && f.text[f.pos] == ':' {
+			f.pos++
+			if value, err = f.value(); err != nil {
+				return err
+			}
+		}
+		if _, exists := m.Get(key); exists {
+			return fmt.Errorf("yamlParse() found '%s' defined twice on line %d.", runtime.Stringify(key), f.line)
+		}
+		m.Set(key, value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// items reads comma separated items up to close, which may follow a trailing comma
+func (f *yamlFlow) items(close byte, item func() error) error {
+	f.pos++
+	for {
+		if f.skipSpace(); f.pos < len(f.text) && f.text[f.pos] == close {
+			f.pos++
+			return nil
+		}
+		if err := item(); err != nil {
+			return err
+		}
+		if f.skipSpace(); f.pos < len(f.text) && f.text[f.pos] == ',' {
+			f.pos++
+			continue
+		}
+		if f.pos < len(f.text) && f.text[f.pos] == close {
+			f.pos++
+			return nil
+		}
+		return f.errorf("',' or '" + string(close) + "'")
+	}
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.pos < len(f.text) && (f.text[f.pos] == ' ' || f.text[f.pos] == '\t') {
+		f.pos++
+	}
+}
+
+func (f *yamlFlow) errorf(expected string) error {
+	return fmt.Errorf("yamlParse() expected %s in the collection starting on line %d.", expected, f.line)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * `glox lint` runs the lint rules over each script, see lang/lint.go, and
+ * prints what they find as warnings, the way running the script would. The
+ * rules to run can be picked with --rules and a comma separated list, and
+ * --list prints every rule with what it looks for. The exit code is 65 if a
+ * script has errors and 1 if there were only warnings, so lint can fail a
+ * build.
+ *****************************************************************************/
+
+func runLint(args []string) {
+	if len(args) == 1 && args[0] == "--list" {
+		for _, rule := range lang.LintRules() {
+			fmt.Printf("%-20s %s\n", rule[0], rule[1])
+		}
+		return
+	}
+	var ruleNames []string
+	if len(args) >= 2 && args[0] == "--rules" {
+		ruleNames = strings.Split(args[1], ",")
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(64)
+	}
+	exitCode := 0
+	for _, path := range args {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		errorHandler := newErrorHandler(path)
+		if err := lang.Lint(string(content), ruleNames, errorHandler); err != nil {
+			fmt.Println(err)
+			os.Exit(64)
+		}
+		if errorHandler.HadError {
+			exitCode = 65
+		} else if len(errorHandler.Diagnostics) > 0 && exitCode == 0 {
+			exitCode = 1
+		}
+	}
+	os.Exit(exitCode)
+}
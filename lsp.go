@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+
+	"github.com/skusel/glox/diag"
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * `glox lsp` is a language server: an editor starts it and talks to it over
+ * stdin and stdout with the Language Server Protocol, JSON-RPC messages each
+ * after a Content-Length header. It keeps every open file as a
+ * lang.Document, applies the edits the editor sends as they are typed, and
+ * answers with:
+ *
+ *   - diagnostics, the errors and warnings glox would report for the file,
+ *     published after every change
+ *   - go-to-definition, the declaration of the name under the cursor
+ *   - hover, a description of the name under the cursor
+ *   - rename, the edits that give the name under the cursor a new name
+ *     everywhere in the file, refused when lang.Rename would refuse it
+ *
+ * Nothing else is offered, so editors don't ask. Logging goes to stderr,
+ * which editors show in their output panel.
+ *****************************************************************************/
+
+type lspMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // missing for notifications
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type lspResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+	Error   *lspError       `json:"error,omitempty"`
+}
+
+type lspNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type lspServer struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*lang.Document // by URI
+	shutDown  bool
+}
+
+func runLSP() {
+	server := &lspServer{in: bufio.NewReader(os.Stdin), out: os.Stdout, documents: make(map[string]*lang.Document)}
+	for {
+		message, err := server.read()
+		if err == io.EOF {
+			os.Exit(1) // the editor went away without asking the server to exit
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, "glox lsp:", err)
+			continue
+		}
+		server.handle(message)
+	}
+}
+
+// read reads the next message, which comes after headers giving its length
+func (s *lspServer) read() (*lspMessage, error) {
+	headers, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length header '%s'", headers.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	message := &lspMessage{}
+	if err := json.Unmarshal(body, message); err != nil {
+		return nil, fmt.Errorf("bad message: %v", err)
+	}
+	return message, nil
+}
+
+func (s *lspServer) write(message any) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glox lsp:", err)
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *lspServer) handle(message *lspMessage) {
+	var result any
+	var err *lspError
+	switch message.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   map[string]any{"openClose": true, "change": 2}, // 2 is incremental
+				"definitionProvider": true,
+				"hoverProvider":      true,
+				"renameProvider":     true,
+			},
+			"serverInfo": map[string]any{"name": "glox"},
+		}
+	case "shutdown":
+		s.shutDown = true
+	case "exit":
+		if s.shutDown {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if s.decode(message, &params) {
+			s.documents[params.TextDocument.URI] = lang.NewDocument(params.TextDocument.Text)
+			s.publishDiagnostics(params.TextDocument.URI)
+		}
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Range *lspRange `json:"range"` // missing when the change is the whole text
+				Text  string    `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if s.decode(message, &params) {
+			uri := params.TextDocument.URI
+			for _, change := range params.ContentChanges {
+				document := s.documents[uri]
+				if change.Range == nil || document == nil {
+					s.documents[uri] = lang.NewDocument(change.Text)
+					continue
+				}
+				start := document.Offset(change.Range.Start.Line, change.Range.Start.Character)
+				end := document.Offset(change.Range.End.Line, change.Range.End.Character)
+				document.Edit(lang.TextEdit{Start: start, End: max(start, end), Text: change.Text})
+			}
+			s.publishDiagnostics(uri)
+		}
+	case "textDocument/didClose":
+		var params lspTextDocumentPosition
+		if s.decode(message, &params) {
+			delete(s.documents, params.TextDocument.URI)
+			s.publishDiagnostics(params.TextDocument.URI)
+		}
+	case "textDocument/definition":
+		var params lspTextDocumentPosition
+		if s.decode(message, &params) {
+			uri := params.TextDocument.URI
+			if document, offset, found := s.documentAt(params); found {
+				if span, declared := document.Definition(offset); declared {
+					result = lspLocation{URI: uri, Range: spanRange(document, span)}
+				}
+			}
+		}
+	case "textDocument/hover":
+		var params lspTextDocumentPosition
+		if s.decode(message, &params) {
+			if document, offset, found := s.documentAt(params); found {
+				if text, span, hovered := document.Hover(offset); hovered {
+					result = map[string]any{
+						"contents": map[string]any{"kind": "markdown", "value": text},
+						"range":    spanRange(document, span),
+					}
+				}
+			}
+		}
+	case "textDocument/rename":
+		var params struct {
+			lspTextDocumentPosition
+			NewName string `json:"newName"`
+		}
+		if s.decode(message, &params) {
+			uri := params.TextDocument.URI
+			if document, offset, found := s.documentAt(params.lspTextDocumentPosition); found {
+				edits, renameErr := document.Rename(offset, params.NewName)
+				if renameErr != nil {
+					err = &lspError{Code: -32803, Message: renameErr.Error()} // -32803 is RequestFailed
+					break
+				}
+				changes := make([]lspTextEdit, len(edits))
+				for i, edit := range edits {
+					changes[i] = lspTextEdit{Range: offsetRange(document, edit.Start, edit.End), NewText: edit.Text}
+				}
+				result = map[string]any{"changes": map[string][]lspTextEdit{uri: changes}}
+			}
+		}
+	default:
+		err = &lspError{Code: -32601, Message: "glox doesn't support " + message.Method}
+	}
+	if message.ID != nil {
+		s.write(lspResponse{JSONRPC: "2.0", ID: message.ID, Result: result, Error: err})
+	}
+}
+
+// decode reads a message's params, answering a request with an error if they can't be read
+func (s *lspServer) decode(message *lspMessage, params any) bool {
+	if err := json.Unmarshal(message.Params, params); err != nil {
+		fmt.Fprintf(os.Stderr, "glox lsp: bad params for %s: %v\n", message.Method, err)
+		if message.ID != nil {
+			s.write(lspResponse{JSONRPC: "2.0", ID: message.ID, Error: &lspError{Code: -32602, Message: err.Error()}})
+			message.ID = nil
+		}
+		return false
+	}
+	return true
+}
+
+func (s *lspServer) documentAt(params lspTextDocumentPosition) (*lang.Document, int, bool) {
+	document, open := s.documents[params.TextDocument.URI]
+	if !open {
+		return nil, 0, false
+	}
+	return document, document.Offset(params.Position.Line, params.Position.Character), true
+}
+
+// publishDiagnostics sends a document's diagnostics, or clears them if it has been closed
+func (s *lspServer) publishDiagnostics(uri string) {
+	diagnostics := make([]lspDiagnostic, 0)
+	if document, open := s.documents[uri]; open {
+		for _, diagnostic := range document.Diagnostics {
+			severity := 1
+			if diagnostic.Severity == diag.SeverityWarning {
+				severity = 2
+			}
+			start, end := document.DiagnosticSpan(diagnostic)
+			diagnostics = append(diagnostics, lspDiagnostic{Range: offsetRange(document, start, end), Severity: severity,
+				Code: string(diagnostic.Code), Source: "glox", Message: diagnostic.Message})
+		}
+	}
+	s.write(lspNotification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics",
+		Params: map[string]any{"uri": uri, "diagnostics": diagnostics}})
+}
+
+func spanRange(document *lang.Document, span lang.Span) lspRange {
+	return offsetRange(document, span.Start.Offset, span.End.Offset)
+}
+
+func offsetRange(document *lang.Document, start int, end int) lspRange {
+	startLine, startCharacter := document.Position(start)
+	endLine, endCharacter := document.Position(end)
+	return lspRange{Start: lspPosition{startLine, startCharacter}, End: lspPosition{endLine, endCharacter}}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/skusel/glox/lang"
+)
+
+// lspExchange sends requests to a language server, numbering them from 1, and returns its responses by ID
+func lspExchange(t *testing.T, requests ...string) map[int]lspResponse {
+	var in bytes.Buffer
+	for i, request := range requests {
+		body := fmt.Sprintf(`{"jsonrpc": "2.0", "id": %d, %s}`, i+1, request)
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	var out bytes.Buffer
+	server := &lspServer{in: bufio.NewReader(&in), out: &out, documents: make(map[string]*lang.Document)}
+	for {
+		message, err := server.read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		server.handle(message)
+	}
+
+	// responses are read back as they were written, since lspMessage has no result or error
+	type response struct {
+		ID     *int      `json:"id"`
+		Result any       `json:"result"`
+		Error  *lspError `json:"error"`
+	}
+	responses := make(map[int]lspResponse)
+	written := bufio.NewReader(&out)
+	for {
+		headers, err := textproto.NewReader(written).ReadMIMEHeader()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		length, _ := strconv.Atoi(headers.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(written, body); err != nil {
+			t.Fatal(err)
+		}
+		var message response
+		if err := json.Unmarshal(body, &message); err != nil {
+			t.Fatalf("bad response %s", body)
+		}
+		if message.ID != nil { // notifications have no ID
+			responses[*message.ID] = lspResponse{Result: message.Result, Error: message.Error}
+		}
+	}
+	return responses
+}
+
+func TestLSPRename(t *testing.T) {
+	open := `"method": "textDocument/didOpen", "params": {"textDocument": {"uri": "file:///a.lox",
+		"text": "var count = 0;\nfun bump() { count = count + 1; }\nvar other = 1;\nprint count;\n"}}`
+	rename := func(line, character int, newName string) string {
+		return fmt.Sprintf(`"method": "textDocument/rename", "params": {"textDocument": {"uri": "file:///a.lox"},
+			"position": {"line": %d, "character": %d}, "newName": %q}`, line, character, newName)
+	}
+	responses := lspExchange(t, `"method": "initialize", "params": {}`, open,
+		rename(1, 22, "total"), rename(3, 6, "other"), rename(0, 0, "x"))
+
+	capabilities, _ := json.Marshal(responses[1].Result)
+	if !strings.Contains(string(capabilities), `"renameProvider":true`) {
+		t.Errorf("renameProvider isn't advertised: %s", capabilities)
+	}
+
+	renamed, _ := json.Marshal(responses[3].Result)
+	// the result is read back into maps, so its keys come out sorted
+	edit := func(line, start, end int) string {
+		return fmt.Sprintf(`{"newText":"total","range":{"end":{"character":%d,"line":%d},"start":{"character":%d,"line":%d}}}`,
+			end, line, start, line)
+	}
+	edits := `{"changes":{"file:///a.lox":[` + edit(0, 4, 9) + "," + edit(1, 13, 18) + "," + edit(1, 21, 26) + "," +
+		edit(3, 6, 11) + `]}}`
+	if responses[3].Error != nil || string(renamed) != edits {
+		t.Errorf("rename gave %s, error %v, expected %s", renamed, responses[3].Error, edits)
+	}
+
+	if responses[4].Error == nil || responses[4].Error.Code != -32803 {
+		t.Errorf("a rename onto another global gave %v, not an error", responses[4])
+	}
+	if responses[5].Error == nil {
+		t.Errorf("renaming a keyword gave %v, not an error", responses[5])
+	}
+}
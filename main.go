@@ -2,8 +2,12 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/skusel/glox/lang"
 )
@@ -14,27 +18,228 @@ import (
  * Robert Nystrom in his book Crafting Interpreters.
  *****************************************************************************/
 
+var useVM = flag.Bool("vm", false, "run programs on the bytecode VM instead of the tree-walk interpreter")
+var recordPath = flag.String("record", "", "record a trace of the script's execution to this file")
+var trace = flag.Bool("trace", false, "log every statement and expression to stderr as it runs, with the values expressions come to")
+var traceFunctions = flag.String("trace-functions", "", "only trace the bodies of these functions, a comma separated list of names")
+var flamegraphPath = flag.String("flamegraph", "", "write sampled call stacks in folded format to this file")
+var profileCalls = flag.Bool("profile", false, "count and time the calls to each function, printing a report to stderr at exit")
+var pprofPath = flag.String("pprof", "", "count and time the calls to each function, writing them to this file for pprof")
+var coveragePath = flag.String("coverage", "", "count which way each if, while, and for condition went, adding the counts to this file")
+var printAST = flag.Bool("print-ast", false, "print the script's syntax tree instead of running it")
+var debug = flag.Bool("debug", false, "run the script in the debugger, starting paused")
+var dapAddress = flag.String("dap", "", "wait for an editor to attach a debugger at this address, like localhost:4711")
+var diagnostics = flag.String("diagnostics", "text", "write errors and warnings as text or as json, one record per line")
+var werror = flag.Bool("werror", false, "treat warnings as errors, so a script with any doesn't run")
+var maxCallDepth = flag.Int("max-call-depth", 0, fmt.Sprintf("report a stack overflow once this many calls are active, at most %d (%d on the VM), 0 for the engine's default", lang.MaxCallDepth, lang.MaxVMCallDepth))
+
+// stdout buffers what scripts print, it is flushed at the end of each run
+var stdout = lang.NewBufferedOutput(os.Stdout)
+
+// engine is implemented by both of the lang package's execution engines
+type engine interface {
+	lang.Engine
+	Natives() []lang.NativeInfo
+	SetScriptPath(path string)
+	SetMaxCallDepth(depth int)
+	SetOutput(output io.Writer)
+	SetInput(input io.Reader)
+	RunExitHooks() error
+	Assertions() lang.AssertionCounts
+	RestoreMocks()
+	Cancel()
+}
+
 func main() {
-	numArgs := len(os.Args[1:])
-	if numArgs > 1 {
-		fmt.Println("Usage: glox [script]")
+	flag.Usage = func() {
+		fmt.Println("Usage: glox [--vm] [--debug] [--dap address] [--record trace] [--trace] [--trace-functions name,...] [--flamegraph stacks] [--profile] [--pprof profile] [--coverage counts] [--max-call-depth n] [--diagnostics text|json] [--werror] [--print-ast] [script]")
+		fmt.Println("       glox replay [trace]")
+		fmt.Println("       glox compile [module ...]")
+		fmt.Println("       glox ast [script]")
+		fmt.Println("       glox fmt [-w] [script ...]")
+		fmt.Println("       glox lint [--rules rule,...] [script ...] | --list")
+		fmt.Println("       glox metrics [script ...]")
+		fmt.Println("       glox lsp")
+		fmt.Println("       glox dap")
+		fmt.Println("       glox xref [script ...]")
+		fmt.Println("       glox rename [script] [old] [new]")
+		fmt.Println("       glox test [test file or directory ...]")
+		fmt.Println("       glox coverage [counts]")
+		fmt.Println("       glox conformance [--expected-failures file] [test directory]")
+		fmt.Println("       glox difftest [script or directory ...]")
+	}
+	flag.Parse()
+	numArgs := flag.NArg()
+	if *diagnostics != "text" && *diagnostics != "json" {
+		flag.Usage()
+		os.Exit(64)
+	} else if *maxCallDepth < 0 || *maxCallDepth > maxCallDepthLimit() {
+		fmt.Printf("--max-call-depth can be at most %d.\n", maxCallDepthLimit())
+		os.Exit(64)
+	} else if numArgs == 2 && flag.Arg(0) == "replay" {
+		runReplay(flag.Arg(1))
+	} else if numArgs >= 1 && flag.Arg(0) == "compile" {
+		runCompile(flag.Args()[1:])
+	} else if numArgs == 2 && flag.Arg(0) == "ast" {
+		runAST(flag.Arg(1))
+	} else if numArgs >= 1 && flag.Arg(0) == "fmt" {
+		runFmt(flag.Args()[1:])
+	} else if numArgs >= 1 && flag.Arg(0) == "lint" {
+		runLint(flag.Args()[1:])
+	} else if numArgs >= 1 && flag.Arg(0) == "metrics" {
+		runMetrics(flag.Args()[1:])
+	} else if numArgs >= 1 && flag.Arg(0) == "xref" {
+		runXref(flag.Args()[1:])
+	} else if numArgs == 4 && flag.Arg(0) == "rename" {
+		runRename(flag.Arg(1), flag.Arg(2), flag.Arg(3))
+	} else if numArgs >= 1 && flag.Arg(0) == "test" {
+		runTest(flag.Args()[1:])
+	} else if numArgs == 2 && flag.Arg(0) == "coverage" {
+		runCoverageReport(flag.Arg(1))
+	} else if numArgs >= 1 && flag.Arg(0) == "conformance" {
+		runConformance(flag.Args()[1:])
+	} else if numArgs >= 1 && flag.Arg(0) == "difftest" {
+		runDifftest(flag.Args()[1:])
+	} else if numArgs == 1 && flag.Arg(0) == "lsp" {
+		runLSP()
+	} else if numArgs == 1 && flag.Arg(0) == "dap" {
+		runDAP()
+	} else if numArgs > 1 || ((*recordPath != "" || *flamegraphPath != "" || tracing() || profiling() || *coveragePath != "" ||
+		*printAST || *dapAddress != "") && numArgs == 0) {
+		flag.Usage()
 		os.Exit(64)
+	} else if *recordPath != "" && *useVM {
+		fmt.Println("Recording is only supported by the tree-walk interpreter.")
+		os.Exit(64)
+	} else if tracing() && *useVM {
+		fmt.Println("Tracing is only supported by the tree-walk interpreter.")
+		os.Exit(64)
+	} else if (*flamegraphPath != "" || profiling()) && *useVM {
+		fmt.Println("Profiling is only supported by the tree-walk interpreter.")
+		os.Exit(64)
+	} else if *coveragePath != "" && *useVM {
+		fmt.Println("Coverage is only supported by the tree-walk interpreter.")
+		os.Exit(64)
+	} else if (*debug || *dapAddress != "") && *useVM {
+		fmt.Println("Debugging is only supported by the tree-walk interpreter.")
+		os.Exit(64)
+	} else if *dapAddress != "" {
+		runAttachedDAP(flag.Arg(0), *dapAddress)
+	} else if *printAST {
+		runPrintAST(flag.Arg(0))
 	} else if numArgs == 1 {
-		runFile(os.Args[1])
+		runFile(flag.Arg(0))
 	} else {
 		runPrompt()
 	}
 }
 
+// tracing reports whether --trace, or --trace-functions, asked for the script to be traced
+func tracing() bool {
+	return *trace || *traceFunctions != ""
+}
+
+func tracedFunctions() []string {
+	var functions []string
+	for _, function := range strings.Split(*traceFunctions, ",") {
+		if function = strings.TrimSpace(function); function != "" {
+			functions = append(functions, function)
+		}
+	}
+	return functions
+}
+
+// profiling reports whether --profile, or --pprof, asked for calls to be counted
+func profiling() bool {
+	return *profileCalls || *pprofPath != ""
+}
+
+// maxCallDepthLimit is the highest --max-call-depth the engine takes
+func maxCallDepthLimit() int {
+	if *useVM {
+		return lang.MaxVMCallDepth
+	}
+	return lang.MaxCallDepth
+}
+
+// newErrorHandler makes an error handler for the script at path that reports diagnostics as the flags ask
+func newErrorHandler(path string) *lang.ErrorHandler {
+	errorHandler := lang.NewErrorHandler()
+	errorHandler.JSON = *diagnostics == "json"
+	errorHandler.WarningsAsErrors = *werror
+	errorHandler.File = path
+	return errorHandler
+}
+
+func newEngine(errorHandler *lang.ErrorHandler) engine {
+	var e engine
+	if *useVM {
+		e = lang.NewVM(errorHandler)
+	} else {
+		e = lang.NewInterpreter(errorHandler)
+	}
+	if *maxCallDepth > 0 {
+		e.SetMaxCallDepth(*maxCallDepth)
+	}
+	e.SetOutput(stdout)
+	errorHandler.Output = stdout.Before(os.Stderr)
+	return e
+}
+
 func runFile(path string) {
 	source, readErr := os.ReadFile(path)
 	if readErr != nil {
 		fmt.Println(readErr)
 		os.Exit(2)
 	} else {
-		errorHandler := lang.NewErrorHandler()
-		interpreter := lang.NewInterpreter(errorHandler)
-		run(string(source), interpreter, errorHandler)
+		errorHandler := newErrorHandler(path)
+		frontEnd := lang.NewFrontEnd(errorHandler)
+		engine := newEngine(errorHandler)
+		engine.SetScriptPath(path)
+		stdout.FlushOnExitSignals()
+		var trace *lang.Trace
+		if *recordPath != "" {
+			trace = engine.(*lang.Interpreter).Record(string(source))
+		}
+		if *debug {
+			// start paused so breakpoints can be set before anything runs
+			debugger := lang.NewDebugger(bufio.NewReader(os.Stdin), stdout.Before(os.Stdout))
+			debugger.Step()
+			engine.(*lang.Interpreter).SetDebugger(debugger)
+		}
+		if tracing() {
+			engine.(*lang.Interpreter).SetTracer(lang.NewTracer(stdout.Before(os.Stderr), tracedFunctions()))
+		}
+		var profile *lang.Profile
+		if *flamegraphPath != "" {
+			profile = engine.(*lang.Interpreter).Profile(time.Millisecond)
+		}
+		var calls *lang.CallProfile
+		if profiling() {
+			calls = engine.(*lang.Interpreter).ProfileCalls()
+		}
+		var coverage *lang.Coverage
+		if *coveragePath != "" {
+			coverage = loadCoverage()
+			engine.(*lang.Interpreter).SetCoverage(coverage)
+		}
+		err := run(string(source), frontEnd, engine, errorHandler)
+		code, exited := finish(engine, err)
+		if trace != nil {
+			saveTrace(trace)
+		}
+		if profile != nil {
+			saveProfile(profile)
+		}
+		if calls != nil {
+			saveCallProfile(calls)
+		}
+		if coverage != nil {
+			saveCoverage(coverage)
+		}
+		if exited {
+			os.Exit(code)
+		}
 		if errorHandler.HadError {
 			os.Exit(65)
 		}
@@ -44,43 +249,31 @@ func runFile(path string) {
 	}
 }
 
-func runPrompt() {
-	errorHandler := lang.NewErrorHandler()
-	interpreter := lang.NewInterpreter(errorHandler)
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Print("> ")
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Println(err)
-		} else {
-			run(line, interpreter, errorHandler)
-			errorHandler.HadError = false
-			errorHandler.HadRuntimeError = false
-		}
-	}
-}
-
-func run(source string, interpreter *lang.Interpreter, errorHandler *lang.ErrorHandler) {
-	scanner := lang.NewScanner(source, errorHandler)
-	tokens := scanner.ScanTokens()
-	parser := lang.NewParser(tokens, errorHandler)
-	statements := parser.Parse()
+// run runs source, returning the engine's error if it ran and an ExitError if the script called exit()
+func run(source string, frontEnd *lang.FrontEnd, engine lang.Engine, errorHandler *lang.ErrorHandler) error {
+	defer stdout.Flush()
+	program := frontEnd.Analyze(source)
 
 	if errorHandler.HadError {
-		return
+		return nil
 	}
 
-	resolver := lang.NewResolver(interpreter)
-	resolver.ResolveStatements(statements)
-
-	if errorHandler.HadError {
-		return
+	if engine.Compile(program) != nil {
+		return nil
 	}
 
-	interpreter.Interpret(statements)
+	// runtime errors have already been reported by the engine
+	return engine.Run()
+}
 
-	if errorHandler.HadRuntimeError {
-		return
+// finish runs the atExit hooks and returns the code exit() was called with, by the script or a hook, if it was
+func finish(engine engine, err error) (int, bool) {
+	defer stdout.Flush()
+	if hookErr := engine.RunExitHooks(); hookErr != nil {
+		if _, isExit := hookErr.(lang.ExitError); isExit {
+			err = hookErr
+		}
 	}
+	exit, isExit := err.(lang.ExitError)
+	return exit.Code, isExit
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/******************************************************************************
+ * TestFixtures runs every .lox file under test/ on both engines, the same
+ * way glox test runs them: a file with test_ functions passes if each of
+ * them does, and any other file is checked against its // expect: comments,
+ * or has to run without an error if it has none. Every change to the
+ * interpreter or the VM is checked against the fixtures by go test.
+ *****************************************************************************/
+
+func TestFixtures(t *testing.T) {
+	var fixtures []string
+	err := filepath.WalkDir("test", func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && filepath.Ext(path) == ".lox" {
+			fixtures = append(fixtures, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures found in test/")
+	}
+	defer func(vm bool) { *useVM = vm }(*useVM)
+	for _, vm := range []bool{false, true} {
+		engineName := "interpreter"
+		if vm {
+			engineName = "vm"
+		}
+		t.Run(engineName, func(t *testing.T) {
+			*useVM = vm
+			for _, path := range fixtures {
+				t.Run(filepath.ToSlash(path), func(t *testing.T) {
+					source, err := os.ReadFile(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, isTest := parseConformanceTest(string(source)); !isTest {
+						t.Skip("marked // nontest")
+					}
+					var report strings.Builder
+					if _, failed := runTestFile(path, nil, &report); failed > 0 {
+						t.Error("\n" + report.String())
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * `glox metrics` prints the size and complexity of every function and class
+ * in each script, without running them. See lang/metrics.go for what each
+ * column means.
+ *****************************************************************************/
+
+func runMetrics(paths []string) {
+	if len(paths) == 0 {
+		flag.Usage()
+		os.Exit(64)
+	}
+	hadError := false
+	for i, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		errorHandler := lang.NewErrorHandler()
+		program := lang.NewFrontEnd(errorHandler).Analyze(string(source))
+		if program == nil {
+			hadError = true
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		printMetrics(path, lang.MeasureProgram(program))
+	}
+	if hadError {
+		os.Exit(65)
+	}
+}
+
+func printMetrics(path string, metrics *lang.Metrics) {
+	fmt.Println(path)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  function\tline\tstatements\tnesting\tcomplexity")
+	for _, f := range metrics.Functions {
+		fmt.Fprintf(w, "  %s\t%d\t%d\t%d\t%d\n", f.Name, f.Line, f.Statements, f.Nesting, f.Complexity)
+	}
+	w.Flush()
+	if len(metrics.Classes) > 0 {
+		fmt.Println()
+		fmt.Fprintln(w, "  class\tline\tmethods\tfields")
+		for _, c := range metrics.Classes {
+			fmt.Fprintf(w, "  %s\t%d\t%d\t%d\n", c.Name, c.Line, c.Methods, c.Fields)
+		}
+		w.Flush()
+	}
+}
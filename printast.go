@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * `glox --print-ast script` prints the tree the parser and resolver built
+ * for a script instead of running it, one form per top level statement.
+ * See lang/astprinter.go for how each node is written.
+ *****************************************************************************/
+
+func runPrintAST(path string) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	errorHandler := newErrorHandler(path)
+	program := lang.NewFrontEnd(errorHandler).Analyze(string(source))
+	if program == nil {
+		os.Exit(65)
+	}
+	fmt.Println(lang.AstPrinter{}.PrintProgram(program.Statements))
+}
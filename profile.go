@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * Call stacks sampled with --flamegraph are saved in folded format, ready to
+ * be turned into a flame graph by flamegraph.pl or opened in speedscope.
+ * Calls counted with --profile are reported on stderr, and with --pprof are
+ * saved for pprof.
+ *****************************************************************************/
+
+func saveProfile(profile *lang.Profile) {
+	file, err := os.Create(*flamegraphPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(74)
+	}
+	defer file.Close()
+	if err := profile.WriteFolded(file); err != nil {
+		fmt.Println(err)
+		os.Exit(74)
+	}
+}
+
+func saveCallProfile(calls *lang.CallProfile) {
+	if *profileCalls {
+		if err := calls.WriteReport(os.Stderr); err != nil {
+			fmt.Println(err)
+			os.Exit(74)
+		}
+	}
+	if *pprofPath == "" {
+		return
+	}
+	file, err := os.Create(*pprofPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(74)
+	}
+	defer file.Close()
+	if err := calls.WritePprof(file); err != nil {
+		fmt.Println(err)
+		os.Exit(74)
+	}
+}
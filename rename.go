@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * `glox rename` renames a variable, function, class, trait, parameter, or
+ * import in a script, along with every reference to it, and writes the
+ * script back. The old name is either the name itself, when only one thing
+ * in the script is declared with it, or the line:column of the declaration
+ * or of any use. Renames that would collide with or shadow another name, or
+ * change what some other name refers to, are refused and nothing is written.
+ *****************************************************************************/
+
+func runRename(path string, old string, newName string) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	source := string(content)
+	xref := lang.BuildCrossReference(source, lang.NewErrorHandler())
+	if xref == nil {
+		os.Exit(65)
+	}
+	symbol := renameSymbol(path, source, xref, old)
+	if symbol == nil {
+		os.Exit(65)
+	}
+	renamed, err := lang.Rename(source, symbol.Declared.Start.Offset, newName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(65)
+	}
+	if renamed == source {
+		fmt.Println("Nothing to rename.")
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if err := os.WriteFile(path, []byte(renamed), info.Mode().Perm()); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	fmt.Printf("Renamed '%s' to '%s' in %d places.\n", symbol.Name, newName, len(symbol.References)+1)
+}
+
+// renameSymbol finds the symbol to rename, reporting why when it can't
+func renameSymbol(path string, source string, xref *lang.CrossReference, old string) *lang.Symbol {
+	if line, column, isPosition := parsePosition(old); isPosition {
+		offset := 0
+		for ; line > 1; line-- {
+			next := strings.IndexByte(source[offset:], '\n')
+			if next < 0 {
+				fmt.Printf("%s has no line %s.\n", path, old[:strings.IndexByte(old, ':')])
+				return nil
+			}
+			offset += next + 1
+		}
+		symbol := xref.SymbolAt(offset + column - 1)
+		if symbol == nil || symbol.Kind == "undeclared" {
+			fmt.Printf("There is no variable, function, class, or trait declared in %s at %s.\n", path, old)
+			return nil
+		}
+		return symbol
+	}
+	symbols := xref.SymbolsNamed(old)
+	switch len(symbols) {
+	case 0:
+		fmt.Printf("Nothing named '%s' is declared in %s.\n", old, path)
+		return nil
+	case 1:
+		return symbols[0]
+	}
+	fmt.Printf("'%s' is declared more than once, give the line:column of the one to rename:\n", old)
+	for _, symbol := range symbols {
+		fmt.Printf("    %s (%s)\n", location(path, symbol.Declared), symbol.Kind)
+	}
+	return nil
+}
+
+func parsePosition(text string) (int, int, bool) {
+	lineText, columnText, found := strings.Cut(text, ":")
+	if !found {
+		return 0, 0, false
+	}
+	line, lineErr := strconv.Atoi(lineText)
+	column, columnErr := strconv.Atoi(columnText)
+	return line, column, lineErr == nil && columnErr == nil && line > 0 && column > 0
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	goruntime "runtime"
+	"strings"
+	"time"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * The REPL reads a declaration, runs it, and prints the prompt again. Input
+ * that stops partway through a declaration, like a function whose closing
+ * brace hasn't been typed yet, is continued on the next line under a "..."
+ * prompt for as long as it stays incomplete. Entering two blank lines in a
+ * row at that prompt, or Ctrl-D, throws away what was typed instead.
+ * An expression typed without a ';' has its value printed. Calling the
+ * breakpoint native pauses in the debugger, which reads from the same input.
+ *
+ * Lines starting with a colon are commands for the REPL itself rather than
+ * Lox code. :time and :memory measure how long code takes to run and how
+ * much it allocates. Either one can be followed by the code to measure, or
+ * typed on its own to measure whatever is entered next.
+ *
+ * Code runs under a watchdog, so a loop that never ends doesn't cost the
+ * session. Ctrl-C cancels whatever is running and returns to the prompt with
+ * every variable still defined. :timeout sets a time limit that cancels code
+ * on its own, and without one the watchdog says how to stop code that has
+ * been running for a while.
+ *****************************************************************************/
+
+type measurements struct {
+	time   bool
+	memory bool
+}
+
+// how long code runs before the watchdog tells the user how to stop it, when there is no time limit
+const watchdogHintDelay = 5 * time.Second
+
+type watchdog struct {
+	engine engine
+	limit  time.Duration // zero for no limit
+}
+
+func runPrompt() {
+	errorHandler := newErrorHandler("<stdin>")
+	frontEnd := lang.NewFrontEnd(errorHandler)
+	frontEnd.SetREPLMode(true)
+	engine := newEngine(errorHandler)
+	reader := bufio.NewReader(os.Stdin)
+	engine.SetInput(reader)
+	if interpreter, isInterpreter := engine.(*lang.Interpreter); isInterpreter {
+		interpreter.SetDebugger(lang.NewDebugger(reader, stdout.Before(os.Stdout)))
+	}
+	var pending measurements
+	watchdog := &watchdog{engine: engine}
+	runSource := func(source string) {
+		var err error
+		measure(pending, func() {
+			watchdog.run(func() { err = run(source, frontEnd, engine, errorHandler) })
+		})
+		pending = measurements{}
+		if _, isExit := err.(lang.ExitError); isExit {
+			code, _ := finish(engine, err)
+			os.Exit(code)
+		}
+	}
+	for {
+		fmt.Print("> ")
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				fmt.Println(err)
+			}
+			fmt.Println()
+			if code, exited := finish(engine, nil); exited {
+				os.Exit(code)
+			}
+			return
+		}
+		command, argument, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if command == ":time" || command == ":memory" {
+			pending.time = pending.time || command == ":time"
+			pending.memory = pending.memory || command == ":memory"
+			if strings.TrimSpace(argument) != "" {
+				if source, complete := readContinuation(argument, reader); complete {
+					runSource(source)
+				}
+			}
+			errorHandler.HadError = false
+			errorHandler.HadRuntimeError = false
+		} else if command == ":timeout" {
+			watchdog.setLimit(strings.TrimSpace(argument))
+		} else if strings.TrimSpace(line) == ":natives" {
+			printNatives(engine)
+		} else if source, isInspect := strings.CutPrefix(strings.TrimSpace(line), ":inspect "); isInspect {
+			runInspect(strings.TrimSpace(source), reader)
+		} else if source, complete := readContinuation(line, reader); complete {
+			runSource(source)
+			errorHandler.HadError = false
+			errorHandler.HadRuntimeError = false
+		}
+	}
+}
+
+// readContinuation keeps reading lines until the input forms complete declarations, reporting false if it was discarded
+func readContinuation(source string, reader *bufio.Reader) (string, bool) {
+	blank := false
+	for lang.IsIncomplete(source) {
+		fmt.Print("... ")
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Println()
+			return "", false
+		}
+		if strings.TrimSpace(line) == "" {
+			if blank {
+				return "", false
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		source += line
+	}
+	return source, true
+}
+
+/******************************************************************************
+ * run runs code while watching for Ctrl-C and the time limit, cancelling the
+ * engine when either comes first. Ctrl-C is only caught while code runs, at
+ * the prompt it still ends the REPL.
+ *****************************************************************************/
+
+func (w *watchdog) run(code func()) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var expired <-chan time.Time
+		if w.limit > 0 {
+			timer := time.NewTimer(w.limit)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		hint := time.NewTimer(watchdogHintDelay)
+		defer hint.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-interrupt:
+				w.engine.Cancel()
+				return
+			case <-expired:
+				fmt.Fprintf(stdout.Before(os.Stderr), "Stopped after the %v time limit, see :timeout.\n", w.limit)
+				w.engine.Cancel()
+				return
+			case <-hint.C:
+				if w.limit == 0 {
+					fmt.Fprintln(stdout.Before(os.Stderr), "Still running, press Ctrl-C to stop.")
+				}
+			}
+		}
+	}()
+	code()
+	close(done)
+	<-stopped
+}
+
+// setLimit handles the :timeout command, which shows, sets, or turns off the time limit
+func (w *watchdog) setLimit(argument string) {
+	switch argument {
+	case "":
+		if w.limit == 0 {
+			fmt.Println("No time limit.")
+		} else {
+			fmt.Printf("Time limit: %v\n", w.limit)
+		}
+	case "off":
+		w.limit = 0
+	default:
+		limit, err := time.ParseDuration(argument)
+		if err != nil || limit <= 0 {
+			fmt.Println("Usage: :timeout [duration like 500ms or 10s | off]")
+			return
+		}
+		w.limit = limit
+	}
+}
+
+// measure runs code and reports the measurements that were asked for
+func measure(m measurements, code func()) {
+	var before, after goruntime.MemStats
+	if m.memory {
+		goruntime.ReadMemStats(&before)
+	}
+	start := time.Now()
+	code()
+	elapsed := time.Since(start)
+	if m.memory {
+		goruntime.ReadMemStats(&after)
+	}
+	if m.time {
+		fmt.Printf("time: %v\n", elapsed)
+	}
+	if m.memory {
+		fmt.Printf("memory: %d bytes in %d allocations\n", after.TotalAlloc-before.TotalAlloc,
+			after.Mallocs-before.Mallocs)
+	}
+}
+
+func printNatives(engine engine) {
+	module := ""
+	for _, native := range engine.Natives() {
+		if native.Module != module {
+			module = native.Module
+			fmt.Println(module + ":")
+		}
+		if native.Arity < 0 {
+			fmt.Println("  " + native.Name)
+		} else {
+			fmt.Printf("  %s/%d\n", native.Name, native.Arity)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// TestReadContinuation checks that incomplete input keeps being read over blank lines until it is complete or thrown away
+func TestReadContinuation(t *testing.T) {
+	tests := []struct {
+		name     string
+		first    string
+		rest     string
+		source   string
+		complete bool
+	}{
+		{"complete", "print 1;\n", "", "print 1;\n", true},
+		{"continued", "fun f() {\n", "  return 1;\n}\n", "fun f() {\n  return 1;\n}\n", true},
+		{"blank line", "fun f() {\n", "\n  return 1;\n}\n", "fun f() {\n\n  return 1;\n}\n", true},
+		{"two blank lines", "fun f() {\n", "\n\n}\n", "", false},
+		{"end of input", "fun f() {\n", "  return 1;\n", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, complete := readContinuation(test.first, bufio.NewReader(strings.NewReader(test.rest)))
+			if source != test.source || complete != test.complete {
+				t.Errorf("got %q, %v, expected %q, %v", source, complete, test.source, test.complete)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * Traces recorded with --record are played back with `glox replay`. The
+ * viewer shows one step at a time: the line of source that ran and the
+ * variables it read (=) and wrote (<-). From there you can move forwards and
+ * backwards through the run, which makes it easy to find the point where a
+ * variable first took on a value it shouldn't have.
+ *****************************************************************************/
+
+const replayHelp = `Commands:
+  n, <enter>  step forwards
+  p           step backwards
+  g <step>    go to a step
+  w <name>    go to the next step that writes a variable
+  q           quit`
+
+func saveTrace(trace *lang.Trace) {
+	file, err := os.Create(*recordPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(74)
+	}
+	defer file.Close()
+	if err := lang.WriteTrace(file, trace); err != nil {
+		fmt.Println(err)
+		os.Exit(74)
+	}
+}
+
+func runReplay(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	trace, err := lang.ReadTrace(file)
+	file.Close()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(65)
+	}
+	if len(trace.Steps) == 0 {
+		fmt.Println("The trace is empty.")
+		return
+	}
+
+	lines := strings.Split(trace.Source, "\n")
+	current := 0
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println(replayHelp)
+	for {
+		printStep(trace, lines, current)
+		fmt.Print("replay> ")
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Println()
+			return
+		}
+		command, argument, _ := strings.Cut(strings.TrimSpace(input), " ")
+		switch command {
+		case "", "n":
+			if current < len(trace.Steps)-1 {
+				current++
+			} else {
+				fmt.Println("Already at the last step.")
+			}
+		case "p":
+			if current > 0 {
+				current--
+			} else {
+				fmt.Println("Already at the first step.")
+			}
+		case "g":
+			step, err := strconv.Atoi(argument)
+			if err != nil || step < 1 || step > len(trace.Steps) {
+				fmt.Printf("Expect a step between 1 and %d.\n", len(trace.Steps))
+			} else {
+				current = step - 1
+			}
+		case "w":
+			next := findWrite(trace, current+1, argument)
+			if next < 0 {
+				fmt.Printf("No later step writes '%s'.\n", argument)
+			} else {
+				current = next
+			}
+		case "q":
+			return
+		default:
+			fmt.Println(replayHelp)
+		}
+	}
+}
+
+func printStep(trace *lang.Trace, lines []string, current int) {
+	step := trace.Steps[current]
+	fmt.Printf("\nstep %d/%d\n", current+1, len(trace.Steps))
+	source := ""
+	if step.Line >= 1 && step.Line <= len(lines) {
+		source = strings.TrimSpace(lines[step.Line-1])
+	}
+	fmt.Printf("%4d | %s%s\n", step.Line, strings.Repeat("  ", step.Depth), source)
+	for _, variable := range step.Variables {
+		if variable.Write {
+			fmt.Printf("       %s <- %s\n", variable.Name, variable.Value)
+		} else {
+			fmt.Printf("       %s = %s\n", variable.Name, variable.Value)
+		}
+	}
+}
+
+func findWrite(trace *lang.Trace, from int, name string) int {
+	for i := from; i < len(trace.Steps); i++ {
+		for _, variable := range trace.Steps[i].Variables {
+			if variable.Write && variable.Name == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
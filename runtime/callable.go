@@ -0,0 +1,103 @@
+package runtime
+
+import "fmt"
+
+/******************************************************************************
+ * Any value that can be called with "()" implements Callable. Callables hold
+ * on to whatever they need to run (e.g. the interpreter that owns a Lox
+ * function), so calling one only requires its arguments. The caller is
+ * responsible for checking the argument count with CheckArity before
+ * calling.
+ *
+ * A returned error is reported by the interpreter as a runtime error at the
+ * call site.
+ *****************************************************************************/
+
+type Callable interface {
+	Arity() int
+	Call(args []Value) (Value, error)
+	// Name is the name the callable was declared with, empty for anonymous functions.
+	Name() string
+	String() string
+}
+
+/******************************************************************************
+ * A callable that is Variadic collects any arguments past its arity into a
+ * list for its last parameter, so it can be called with Arity() arguments or
+ * more. A Lox function is variadic when its last parameter is written as
+ * "...rest".
+ *****************************************************************************/
+
+type Variadic interface {
+	IsVariadic() bool
+}
+
+// CheckArity returns the error to report if callable can't be called with argCount arguments.
+func CheckArity(callable Callable, argCount int) error {
+	arity := callable.Arity()
+	if variadic, isVariadic := callable.(Variadic); isVariadic && variadic.IsVariadic() {
+		if argCount < arity {
+			return fmt.Errorf("Expected at least %d arguments but got %d.", arity, argCount)
+		}
+		return nil
+	}
+	if argCount != arity {
+		return fmt.Errorf("Expected %d arguments but got %d.", arity, argCount)
+	}
+	return nil
+}
+
+// A callable with NamedParameters can be passed arguments by name. The names leave out a rest parameter.
+type NamedParameters interface {
+	ParameterNames() []string
+}
+
+// A Function is a callable that can be bound to an instance as a method.
+type Function interface {
+	Callable
+	Bind(instance *Instance) Function
+}
+
+/******************************************************************************
+ * A BoundMethod is a method read from an instance, with "this" bound to that
+ * instance. Every read binds the method again, so two bound methods are equal
+ * when they bind the same method to the same instance, not only when they are
+ * the same value. Receiver is nil if the function isn't bound.
+ *****************************************************************************/
+
+type BoundMethod interface {
+	Receiver() *Instance
+	Unbound() Function
+}
+
+// A Getter is a method declared without a parameter list. Reading it from an instance calls it.
+type Getter interface {
+	Function
+	IsGetter() bool
+}
+
+type NativeFunction struct {
+	name  string
+	arity int
+	fn    func(args []Value) (Value, error)
+}
+
+func NewNativeFunction(name string, arity int, fn func(args []Value) (Value, error)) *NativeFunction {
+	return &NativeFunction{name: name, arity: arity, fn: fn}
+}
+
+func (n *NativeFunction) Name() string {
+	return n.name
+}
+
+func (n *NativeFunction) Arity() int {
+	return n.arity
+}
+
+func (n *NativeFunction) Call(args []Value) (Value, error) {
+	return n.fn(args)
+}
+
+func (n *NativeFunction) String() string {
+	return "<native fun>"
+}
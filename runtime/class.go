@@ -0,0 +1,116 @@
+package runtime
+
+import "sort"
+
+/******************************************************************************
+ * Class represents a Lox class. Classes are callable, calling one creates a
+ * new instance and runs its "init" method if it has one.
+ *****************************************************************************/
+
+type Class struct {
+	name       string
+	superclass *Class
+	methods    map[string]Function
+}
+
+func NewClass(name string, superclass *Class, methods map[string]Function) *Class {
+	return &Class{name: name, superclass: superclass, methods: methods}
+}
+
+func (c *Class) Name() string {
+	return c.name
+}
+
+// Superclass returns nil for classes that don't inherit from another class.
+func (c *Class) Superclass() *Class {
+	return c.superclass
+}
+
+// Methods returns a copy of the methods declared by the class itself, not the ones it inherits.
+func (c *Class) Methods() map[string]Function {
+	methods := make(map[string]Function, len(c.methods))
+	for name, method := range c.methods {
+		methods[name] = method
+	}
+	return methods
+}
+
+// MethodNames returns the names of every method instances of the class have, inherited ones included, sorted.
+func (c *Class) MethodNames() []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for class := c; class != nil; class = class.superclass {
+		for name := range class.methods {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetMethod declares a method on the class, replacing any it already declares by that name.
+func (c *Class) SetMethod(name string, method Function) {
+	c.methods[name] = method
+}
+
+// RemoveMethod takes away a method the class declares, so its instances go back to any it inherits.
+func (c *Class) RemoveMethod(name string) {
+	delete(c.methods, name)
+}
+
+// FindMethod looks for a method on the class and then up its superclass chain.
+func (c *Class) FindMethod(name string) (Function, bool) {
+	method, foundMethod := c.methods[name]
+	if foundMethod {
+		return method, true
+	} else if c.superclass != nil {
+		return c.superclass.FindMethod(name)
+	} else {
+		return nil, false
+	}
+}
+
+func (c *Class) Arity() int {
+	initializer, hasInitializer := c.FindMethod("init")
+	if hasInitializer {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+// IsVariadic reports whether the class's "init" method has a rest parameter.
+func (c *Class) IsVariadic() bool {
+	initializer, hasInitializer := c.FindMethod("init")
+	if variadic, isVariadic := initializer.(Variadic); hasInitializer && isVariadic {
+		return variadic.IsVariadic()
+	}
+	return false
+}
+
+// ParameterNames returns the names of the "init" method's parameters, or none if the class has no "init".
+func (c *Class) ParameterNames() []string {
+	initializer, hasInitializer := c.FindMethod("init")
+	if named, isNamed := initializer.(NamedParameters); hasInitializer && isNamed {
+		return named.ParameterNames()
+	}
+	return []string{}
+}
+
+func (c *Class) Call(args []Value) (Value, error) {
+	instance := NewInstance(c)
+	initializer, hasInitializer := c.FindMethod("init")
+	if hasInitializer {
+		_, err := initializer.Bind(instance).Call(args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return instance, nil
+}
+
+func (c *Class) String() string {
+	return c.name
+}
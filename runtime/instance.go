@@ -0,0 +1,84 @@
+package runtime
+
+/******************************************************************************
+ * Instance represents an instance of a Lox class. The state of objects is
+ * stored here. Fields remember the order they were first set in, so listing
+ * them is deterministic.
+ *****************************************************************************/
+
+type Instance struct {
+	class  *Class
+	fields map[string]Value
+	names  []string // field names in the order they were first set
+}
+
+func NewInstance(class *Class) *Instance {
+	return &Instance{class: class, fields: make(map[string]Value)}
+}
+
+func (inst *Instance) Class() *Class {
+	return inst.class
+}
+
+// Get looks up a field, falling back to a method bound to this instance.
+func (inst *Instance) Get(name string) (Value, bool) {
+	fieldValue, hasField := inst.fields[name]
+	if hasField {
+		return fieldValue, true
+	}
+	method, hasMethod := inst.class.FindMethod(name)
+	if hasMethod {
+		return method.Bind(inst), true
+	}
+	return nil, false
+}
+
+// Field looks up a field without falling back to methods.
+func (inst *Instance) Field(name string) (Value, bool) {
+	value, hasField := inst.fields[name]
+	return value, hasField
+}
+
+func (inst *Instance) Set(name string, value Value) {
+	if _, hasField := inst.fields[name]; !hasField {
+		inst.names = append(inst.names, name)
+	}
+	inst.fields[name] = value
+}
+
+// Delete removes a field and returns the value it had. Methods can't be deleted.
+func (inst *Instance) Delete(name string) (Value, bool) {
+	value, hasField := inst.fields[name]
+	if !hasField {
+		return nil, false
+	}
+	delete(inst.fields, name)
+	for i, fieldName := range inst.names {
+		if fieldName == name {
+			inst.names = append(inst.names[:i], inst.names[i+1:]...)
+			break
+		}
+	}
+	return value, true
+}
+
+// FieldNames returns the names of the instance's fields in the order they were first set.
+func (inst *Instance) FieldNames() []string {
+	names := make([]string, len(inst.names))
+	copy(names, inst.names)
+	return names
+}
+
+// Fields returns a copy of the instance's fields.
+func (inst *Instance) Fields() map[string]Value {
+	fields := make(map[string]Value, len(inst.fields))
+	for name, value := range inst.fields {
+		fields[name] = value
+	}
+	return fields
+}
+
+// String is how print shows an instance, the same as in the book. Pretty shows its fields.
+func (inst *Instance) String() string {
+	return inst.class.name + " instance"
+}
@@ -0,0 +1,63 @@
+package runtime
+
+import "strings"
+
+/******************************************************************************
+ * List is a Lox list, an ordered and growable sequence of values created
+ * with the [a, b, c] literal syntax. Lists are compared by identity, like
+ * instances.
+ *****************************************************************************/
+
+type List struct {
+	elements []Value
+}
+
+func NewList(elements []Value) *List {
+	return &List{elements: elements}
+}
+
+func (l *List) Len() int {
+	return len(l.elements)
+}
+
+// Get returns the element at index, which must be in range.
+func (l *List) Get(index int) Value {
+	return l.elements[index]
+}
+
+// Set replaces the element at index, which must be in range.
+func (l *List) Set(index int, value Value) {
+	l.elements[index] = value
+}
+
+func (l *List) Append(value Value) {
+	l.elements = append(l.elements, value)
+}
+
+// Elements returns a copy of the list's elements.
+func (l *List) Elements() []Value {
+	return append([]Value(nil), l.elements...)
+}
+
+func (l *List) String() string {
+	return l.format(make(map[Value]bool))
+}
+
+// format writes the list on one line, see stringifyElement for path
+func (l *List) format(path map[Value]bool) string {
+	if path[l] {
+		return "[...]"
+	}
+	path[l] = true
+	defer delete(path, l)
+	var builder strings.Builder
+	builder.WriteString("[")
+	for i, element := range l.elements {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(stringifyElement(element, path))
+	}
+	builder.WriteString("]")
+	return builder.String()
+}
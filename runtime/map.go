@@ -0,0 +1,95 @@
+package runtime
+
+import "strings"
+
+/******************************************************************************
+ * Map is a Lox map, created with the {key: value} literal syntax. Any value
+ * can be a key. Strings, numbers, booleans, and nil are compared by value,
+ * everything else by identity. A float with an integer value is stored as
+ * that integer, so m[1] and m[1.0] are the same entry. Maps remember the
+ * order keys were first added in, so iterating over one and printing one
+ * are both deterministic.
+ *****************************************************************************/
+
+type Map struct {
+	keys    []Value
+	entries map[Value]Value
+}
+
+func NewMap() *Map {
+	return &Map{entries: make(map[Value]Value)}
+}
+
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+func (m *Map) Get(key Value) (Value, bool) {
+	key = normalizeNumber(key)
+	value, found := m.entries[key]
+	return value, found
+}
+
+func (m *Map) Set(key Value, value Value) {
+	key = normalizeNumber(key)
+	if _, found := m.entries[key]; !found {
+		m.keys = append(m.keys, key)
+	}
+	m.entries[key] = value
+}
+
+// Delete removes a key and returns the value it had.
+func (m *Map) Delete(key Value) (Value, bool) {
+	key = normalizeNumber(key)
+	value, found := m.entries[key]
+	if !found {
+		return nil, false
+	}
+	delete(m.entries, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+	return value, true
+}
+
+// Keys returns the map's keys in insertion order.
+func (m *Map) Keys() []Value {
+	return append([]Value(nil), m.keys...)
+}
+
+// Values returns the map's values in the insertion order of their keys.
+func (m *Map) Values() []Value {
+	values := make([]Value, 0, len(m.keys))
+	for _, key := range m.keys {
+		values = append(values, m.entries[key])
+	}
+	return values
+}
+
+func (m *Map) String() string {
+	return m.format(make(map[Value]bool))
+}
+
+// format writes the map on one line, see stringifyElement for path
+func (m *Map) format(path map[Value]bool) string {
+	if path[m] {
+		return "{...}"
+	}
+	path[m] = true
+	defer delete(path, m)
+	var builder strings.Builder
+	builder.WriteString("{")
+	for i, key := range m.keys {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(stringifyElement(key, path))
+		builder.WriteString(": ")
+		builder.WriteString(stringifyElement(m.entries[key], path))
+	}
+	builder.WriteString("}")
+	return builder.String()
+}
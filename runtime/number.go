@@ -0,0 +1,97 @@
+package runtime
+
+import "math"
+
+/******************************************************************************
+ * Lox numbers come in two kinds. Integers are int64s and are exact, so large
+ * counts and IDs don't lose precision the way they would as floats. Every
+ * other number is a float64. Number literals without a decimal point are
+ * integers.
+ *
+ * Operators promote integers to floats when either operand is a float, and
+ * division always gives a float. Integer arithmetic that would overflow
+ * 64 bits gives a float rather than wrapping around, and so does arithmetic
+ * that gives negative zero, like -0 or 0 * -1, which only a float can hold.
+ * Integers and floats with the same value are equal, and are the same key in
+ * a map.
+ *****************************************************************************/
+
+// IsNumber reports whether a value is an integer or a float.
+func IsNumber(value Value) bool {
+	switch value.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+// ToFloat converts an integer or a float to a float.
+func ToFloat(value Value) (float64, bool) {
+	switch number := value.(type) {
+	case int64:
+		return float64(number), true
+	case float64:
+		return number, true
+	}
+	return 0, false
+}
+
+// ToInteger converts an integer, or a float with no fractional part that fits in an int64, to an integer.
+func ToInteger(value Value) (int64, bool) {
+	switch number := value.(type) {
+	case int64:
+		return number, true
+	case float64:
+		// 2^63 is exactly representable as a float64, but one past the largest int64
+		if number != math.Trunc(number) || number < -(1<<63) || number >= 1<<63 {
+			return 0, false
+		}
+		return int64(number), true
+	}
+	return 0, false
+}
+
+// normalizeNumber turns floats with an integer value into integers, so equal numbers are the same map key
+func normalizeNumber(value Value) Value {
+	if number, isFloat := value.(float64); isFloat {
+		if integer, isInteger := ToInteger(number); isInteger {
+			return integer
+		}
+	}
+	return value
+}
+
+// NegativeZero is the float -0, the result of negating the integer 0.
+var NegativeZero = math.Copysign(0, -1)
+
+// AddIntegers, SubtractIntegers, and MultiplyIntegers give a float if the result doesn't fit in an int64.
+
+func AddIntegers(a, b int64) Value {
+	sum := a + b
+	if (a > 0 && b > 0 && sum < 0) || (a < 0 && b < 0 && sum >= 0) {
+		return float64(a) + float64(b)
+	}
+	return sum
+}
+
+func SubtractIntegers(a, b int64) Value {
+	difference := a - b
+	if (a >= 0 && b < 0 && difference < 0) || (a < 0 && b > 0 && difference >= 0) {
+		return float64(a) - float64(b)
+	}
+	return difference
+}
+
+func MultiplyIntegers(a, b int64) Value {
+	if a == 0 || b == 0 {
+		if a < 0 || b < 0 {
+			return NegativeZero
+		}
+		return int64(0)
+	}
+	product := a * b
+	if product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return float64(a) * float64(b)
+	}
+	return product
+}
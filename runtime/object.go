@@ -0,0 +1,12 @@
+package runtime
+
+/******************************************************************************
+ * Any value with properties that can be read with "." implements Object.
+ * Instances are the most common, but natives can return their own objects,
+ * e.g. a weak reference with a get method. Only instances can have their
+ * properties set.
+ *****************************************************************************/
+
+type Object interface {
+	Get(name string) (Value, bool)
+}
@@ -0,0 +1,102 @@
+package runtime
+
+import (
+	"strings"
+)
+
+/******************************************************************************
+ * Pretty formats a value for a person to read, where Stringify formats it the
+ * way print shows it. Lists, maps, and instances show what is inside them,
+ * instances included, and a collection too long for one line gets one
+ * element per line, indented under it:
+ *
+ *   {
+ *     "origin": Point {x: 0, y: 0},
+ *     "path": [Point {x: 1, y: 2}, Point {x: 3, y: 4}]
+ *   }
+ *
+ * Collections nested deeper than MaxDepth, and collections that contain
+ * themselves where they come around again, are shortened to "[...]",
+ * "{...}", or "Point {...}".
+ *****************************************************************************/
+
+type PrettyOptions struct {
+	MaxDepth int    // how many levels of collections to show, zero for no limit
+	Indent   string // added once per level of nesting, two spaces if empty
+}
+
+// collections that fit in this many characters stay on one line
+const prettyWidth = 72
+
+func Pretty(value Value, options PrettyOptions) string {
+	if options.Indent == "" {
+		options.Indent = "  "
+	}
+	if _, isString := value.(string); isString {
+		return value.(string)
+	}
+	p := prettyPrinter{options: options, path: make(map[Value]bool)}
+	return p.format(value, 0)
+}
+
+type prettyPrinter struct {
+	options PrettyOptions
+	path    map[Value]bool // the collections being formatted around the current value
+}
+
+// format formats a value that is depth collections deep
+func (p *prettyPrinter) format(value Value, depth int) string {
+	var open, close string
+	switch value := value.(type) {
+	case *List:
+		open, close = "[", "]"
+	case *Map:
+		open, close = "{", "}"
+	case *Instance:
+		open, close = value.class.name+" {", "}"
+	default:
+		return stringifyElement(value, p.path)
+	}
+	if p.path[value] || (p.options.MaxDepth > 0 && depth >= p.options.MaxDepth) {
+		return open + "..." + close
+	}
+	p.path[value] = true
+	defer delete(p.path, value)
+
+	items := make([]string, 0)
+	switch value := value.(type) {
+	case *List:
+		for _, element := range value.elements {
+			items = append(items, p.format(element, depth+1))
+		}
+	case *Map:
+		for _, key := range value.keys {
+			items = append(items, p.format(key, depth+1)+": "+p.format(value.entries[key], depth+1))
+		}
+	case *Instance:
+		for _, name := range value.names {
+			items = append(items, name+": "+p.format(value.fields[name], depth+1))
+		}
+	}
+	return p.layout(open, close, items, depth)
+}
+
+// layout puts a collection's items on one line if they fit, or one per line if they don't
+func (p *prettyPrinter) layout(open string, close string, items []string, depth int) string {
+	inline := open + strings.Join(items, ", ") + close
+	if len(items) == 0 || (len(inline) <= prettyWidth && !strings.Contains(inline, "\n")) {
+		return inline
+	}
+	indent := strings.Repeat(p.options.Indent, depth)
+	var builder strings.Builder
+	builder.WriteString(open + "\n")
+	for i, item := range items {
+		builder.WriteString(indent + p.options.Indent + item)
+		if i < len(items)-1 {
+			builder.WriteString(",")
+		}
+		builder.WriteString("\n")
+	}
+	builder.WriteString(indent + close)
+	return builder.String()
+}
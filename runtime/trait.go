@@ -0,0 +1,33 @@
+package runtime
+
+/******************************************************************************
+ * Trait represents a Lox trait, a named set of methods that classes can mix
+ * in with "with". A trait can't be called or instantiated on its own, its
+ * methods only run once they have been copied into a class.
+ *****************************************************************************/
+
+type Trait struct {
+	name    string
+	methods map[string]Function
+}
+
+func NewTrait(name string, methods map[string]Function) *Trait {
+	return &Trait{name: name, methods: methods}
+}
+
+func (t *Trait) Name() string {
+	return t.name
+}
+
+// Methods returns a copy of the trait's methods.
+func (t *Trait) Methods() map[string]Function {
+	methods := make(map[string]Function, len(t.methods))
+	for name, method := range t.methods {
+		methods[name] = method
+	}
+	return methods
+}
+
+func (t *Trait) String() string {
+	return "<trait " + t.name + ">"
+}
@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+)
+
+/******************************************************************************
+ * Package runtime defines the values a Lox program works with. It is shared
+ * by everything that needs to create or inspect Lox values without reaching
+ * into the interpreter, such as native libraries, execution engines, and Go
+ * programs that embed glox.
+ *
+ * A Value is one of:
+ *   nil                  Lox nil
+ *   bool                 true and false
+ *   int64                integers, see number.go
+ *   float64              every other number
+ *   string               strings
+ *   Callable             functions, methods, native functions, and classes
+ *   *Instance            instances of classes
+ *   *List                lists
+ *   *Map                 maps
+ *   *WeakRef             weak references to instances, lists, and maps
+ *****************************************************************************/
+
+type Value = any
+
+// IsTruthy reports whether a value counts as true in a condition.
+func IsTruthy(value Value) bool {
+	if value == nil {
+		return false
+	}
+	boolVal, isBool := value.(bool)
+	if isBool {
+		return boolVal
+	}
+	strVal, isString := value.(string)
+	if isString {
+		return len(strVal) > 0
+	}
+	number, isNumber := value.(float64)
+	if isNumber {
+		return -1e-9 > number || number > 1e-9
+	}
+	integer, isInteger := value.(int64)
+	if isInteger {
+		return integer != 0
+	}
+	return false
+}
+
+// Equal implements Lox's == operator. Numbers are equal when their values are, objects only to themselves.
+func Equal(left, right Value) bool {
+	leftInteger, leftIsInteger := left.(int64)
+	rightInteger, rightIsInteger := right.(int64)
+	if leftIsInteger && rightIsInteger {
+		return leftInteger == rightInteger
+	}
+	if IsNumber(left) && IsNumber(right) {
+		return normalizeNumber(left) == normalizeNumber(right)
+	}
+	leftMethod, leftIsMethod := left.(BoundMethod)
+	rightMethod, rightIsMethod := right.(BoundMethod)
+	if leftIsMethod && rightIsMethod && leftMethod.Receiver() != nil {
+		return leftMethod.Receiver() == rightMethod.Receiver() && leftMethod.Unbound() == rightMethod.Unbound()
+	}
+	return left == right
+}
+
+// Stringify formats a value the way the print statement displays it.
+func Stringify(value Value) string {
+	if value == nil {
+		return "nil"
+	}
+	switch value := value.(type) {
+	case fmt.Stringer:
+		return value.String()
+	case bool, int64, float64, string:
+		return fmt.Sprint(value)
+	}
+	// a Go value an embedder stored in a variable, its fields are none of the script's business
+	return fmt.Sprintf("<%T>", value)
+}
+
+/******************************************************************************
+ * stringifyElement formats a value inside a list or map, where strings are
+ * quoted. path holds the lists and maps being formatted around the value, so
+ * a list or map that contains itself prints as "[...]" or "{...}" where it
+ * comes around again instead of recursing forever.
+ *****************************************************************************/
+
+func stringifyElement(value Value, path map[Value]bool) string {
+	switch value := value.(type) {
+	case string:
+		return strconv.Quote(value)
+	case *List:
+		return value.format(path)
+	case *Map:
+		return value.format(path)
+	}
+	return Stringify(value)
+}
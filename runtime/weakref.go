@@ -0,0 +1,57 @@
+package runtime
+
+import "weak"
+
+/******************************************************************************
+ * WeakRef refers to an instance, list, or map without keeping it alive. Once
+ * nothing else refers to the value, the garbage collector is free to collect
+ * it, and from then on the reference's get method returns nil. This is what
+ * lets a Lox program build a cache that doesn't hold on to everything it has
+ * ever seen.
+ *****************************************************************************/
+
+type WeakRef struct {
+	target func() Value
+}
+
+// NewWeakRef returns false for values that can't be weakly referenced, like numbers and strings.
+func NewWeakRef(value Value) (*WeakRef, bool) {
+	switch value := value.(type) {
+	case *Instance:
+		return &WeakRef{target: weakTarget(weak.Make(value))}, true
+	case *List:
+		return &WeakRef{target: weakTarget(weak.Make(value))}, true
+	case *Map:
+		return &WeakRef{target: weakTarget(weak.Make(value))}, true
+	}
+	return nil, false
+}
+
+func weakTarget[T any](pointer weak.Pointer[T]) func() Value {
+	return func() Value {
+		value := pointer.Value()
+		if value == nil {
+			// avoid returning a nil *T, which isn't Lox's nil
+			return nil
+		}
+		return value
+	}
+}
+
+// Value returns the referenced value, or nil if it has been collected.
+func (ref *WeakRef) Value() Value {
+	return ref.target()
+}
+
+func (ref *WeakRef) Get(name string) (Value, bool) {
+	if name == "get" {
+		return NewNativeFunction("get", 0, func(args []Value) (Value, error) {
+			return ref.target(), nil
+		}), true
+	}
+	return nil, false
+}
+
+func (ref *WeakRef) String() string {
+	return "<weakref>"
+}
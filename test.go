@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * `glox test` runs a project's Lox tests. Directories are searched for
+ * files whose names end in _test.lox, and files named directly are run
+ * whatever they are called. A test checks what it should with the assert
+ * natives, assertEqual, assertTrue, assertRaises, and expectRuntimeError,
+ * and fails if any assertion fails, it has a static or runtime error, or it
+ * calls exit() with anything but 0.
+ *
+ * A file can hold several tests as functions whose names start with test_,
+ * which take no arguments. Each test function, in the order they are
+ * declared, gets a run of the file to itself: the top level runs, then the
+ * test, then the atExit hooks. If the file declares functions called setup
+ * and teardown, setup is called before each test and teardown after it,
+ * even when the test fails. Anything a test replaced with mock() or
+ * mockMethod() is put back after teardown. Each test passes or fails on its
+ * own:
+ *
+ *   PASS tests/list_test.lox test_append (2 assertions)
+ *   FAIL tests/list_test.lox test_sort (3 passed, 1 failed)
+ *       [line 9] Error E0221: assertEqual() failed: sorted in place
+ *         expected: [1, 2, 3]
+ *           actual: [3, 1, 2]
+ *
+ * A file without test functions is a single test. It can also say what it
+ * should print with comments, the same way the tests glox conformance runs
+ * do. When it has any, what it prints, the errors it reports, and the way
+ * it exits are checked against them, so a test can expect a runtime error:
+ *
+ *   print len([1, 2]); // expect: 2
+ *   print -"text";     // expect runtime error: Operand must be a number.
+ *
+ * Each test function, or each file without any, gets an interpreter of its
+ * own and an empty stdin, so nothing one test defines or changes can leak
+ * into another, not even in the globals of the same file. What a test prints
+ * and the diagnostics it reports are only shown if it fails. With
+ * --coverage, the branches taken by every test are added to the one file,
+ * the top level's once for each test.
+ *****************************************************************************/
+
+const testFunctionPrefix = "test_"
+
+func runTest(paths []string) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findTests(paths)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if len(files) == 0 {
+		fmt.Printf("No tests found in %s.\n", strings.Join(paths, ", "))
+		os.Exit(2)
+	}
+	var coverage *lang.Coverage
+	if *coveragePath != "" {
+		if *useVM {
+			fmt.Println("Coverage is only supported by the tree-walk interpreter.")
+			os.Exit(64)
+		}
+		coverage = loadCoverage()
+	}
+	passed, failed := 0, 0
+	for _, path := range files {
+		filePassed, fileFailed := runTestFile(path, coverage, os.Stdout)
+		passed += filePassed
+		failed += fileFailed
+	}
+	if coverage != nil {
+		saveCoverage(coverage)
+	}
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// findTests expands directories into the _test.lox files inside them
+func findTests(paths []string) ([]string, error) {
+	tests := make([]string, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			tests = append(tests, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(path string, entry os.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() && strings.HasSuffix(path, "_test.lox") {
+				tests = append(tests, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tests, nil
+}
+
+// testFile is a test file being run, in an engine of its own
+type testFile struct {
+	path         string
+	output       io.Writer // where how each test went is reported
+	engine       engine
+	errorHandler *lang.ErrorHandler
+	frontEnd     *lang.FrontEnd
+	capture      *testCapture
+}
+
+// testCapture holds what a test printed and reported, together in transcript and apart to be checked
+type testCapture struct {
+	transcript, printed, reported bytes.Buffer
+}
+
+// runTestFile runs the tests in a file, reporting how each went to output, and returns how many passed and failed
+func runTestFile(path string, coverage *lang.Coverage, output io.Writer) (passed int, failed int) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(output, "FAIL %s\n    %v\n", path, err)
+		return 0, 1
+	}
+	file := newTestFile(path, coverage, output)
+	program := file.frontEnd.Analyze(string(source))
+	tests := make([]string, 0)
+	hasSetup, hasTeardown := false, false
+	if program != nil {
+		for _, name := range program.Functions() {
+			if strings.HasPrefix(name, testFunctionPrefix) {
+				tests = append(tests, name)
+			}
+			hasSetup = hasSetup || name == "setup"
+			hasTeardown = hasTeardown || name == "teardown"
+		}
+	}
+	if len(tests) == 0 {
+		exitCode, exited := file.run(program)
+		if hookCode, hookExited := file.runExitHooks(); hookExited || exitCode == 0 {
+			exitCode, exited = hookCode, exited || hookExited
+		}
+		failed, problem := exitCode != 0, ""
+		if expectations, _ := parseConformanceTest(string(source)); expectations.expectsAnything() {
+			problem = expectations.check(file.capture.printed.String(), file.capture.reported.String(), exitCode)
+			failed = problem != ""
+		} else if exited && exitCode != 0 {
+			problem = fmt.Sprintf("exit(%d) was called.", exitCode)
+		}
+		if file.report(path, lang.AssertionCounts{}, failed, problem) {
+			return 1, 0
+		}
+		return 0, 1
+	}
+
+	for i, test := range tests {
+		if i > 0 {
+			// every test starts from a fresh run of the top level, so nothing one test changes is seen by the next
+			file = newTestFile(path, coverage, output)
+			program = file.frontEnd.Analyze(string(source))
+		}
+		if exitCode, exited := file.run(program); exitCode != 0 || exited {
+			// the tests can't be run without the rest of the file
+			file.report(path, lang.AssertionCounts{}, true, "The file's top level didn't finish, so its tests weren't run.")
+			return passed, failed + 1
+		}
+		before := file.engine.Assertions()
+		exitCode, exited := 0, false
+		if hasSetup {
+			exitCode, exited = file.call("setup")
+		}
+		if exitCode == 0 && !exited {
+			exitCode, exited = file.call(test)
+		}
+		if hasTeardown {
+			if teardownCode, teardownExited := file.call("teardown"); exitCode == 0 && !exited {
+				exitCode, exited = teardownCode, teardownExited
+			}
+		}
+		file.engine.RestoreMocks()
+		if hookCode, hookExited := file.runExitHooks(); exitCode == 0 && !exited {
+			exitCode, exited = hookCode, hookExited
+		}
+		problem := ""
+		if exited && exitCode != 0 && !file.errorHandler.HadRuntimeError {
+			problem = fmt.Sprintf("exit(%d) was called.", exitCode)
+		}
+		if file.report(path+" "+test, before, exitCode != 0, problem) {
+			passed++
+		} else {
+			failed++
+		}
+	}
+	return passed, failed
+}
+
+// newTestFile makes a test file with an engine of its own, ready to run its first test
+func newTestFile(path string, coverage *lang.Coverage, output io.Writer) *testFile {
+	errorHandler := newErrorHandler(path)
+	file := &testFile{path: path, output: output, engine: newEngine(errorHandler), errorHandler: errorHandler,
+		frontEnd: lang.NewFrontEnd(errorHandler)}
+	file.engine.SetScriptPath(path)
+	file.engine.SetInput(strings.NewReader(""))
+	if coverage != nil {
+		file.engine.(*lang.Interpreter).SetCoverage(coverage)
+	}
+	file.startTest()
+	return file
+}
+
+// startTest gives the next test a capture of its own
+func (file *testFile) startTest() {
+	file.capture = &testCapture{}
+	file.engine.SetOutput(io.MultiWriter(&file.capture.transcript, &file.capture.printed))
+	file.errorHandler.Output = io.MultiWriter(&file.capture.transcript, &file.capture.reported)
+	file.errorHandler.HadError, file.errorHandler.HadRuntimeError = false, false
+}
+
+// run runs a program on the file's engine and returns the status glox would exit with, and whether exit() was called
+func (file *testFile) run(program *lang.Program) (int, bool) {
+	var err error
+	if program != nil && file.engine.Compile(program) == nil {
+		err = file.engine.Run()
+	}
+	return file.exitCode(err)
+}
+
+// call calls one of the file's functions, a test or setup or teardown
+func (file *testFile) call(function string) (int, bool) {
+	return file.run(file.frontEnd.Analyze(function + "();"))
+}
+
+func (file *testFile) runExitHooks() (int, bool) {
+	err := file.engine.RunExitHooks()
+	if _, isExit := err.(lang.ExitError); !isExit {
+		err = nil
+	}
+	return file.exitCode(err)
+}
+
+func (file *testFile) exitCode(err error) (int, bool) {
+	exit, exited := err.(lang.ExitError)
+	if file.errorHandler.HadError {
+		return 65, exited
+	} else if file.errorHandler.HadRuntimeError {
+		return 70, exited
+	}
+	return exit.Code, exited
+}
+
+/******************************************************************************
+ * report prints whether a test passed, along with what it printed and
+ * reported and the problem found with it if it didn't, and returns whether
+ * it passed. Only the assertions made since before count towards it.
+ *****************************************************************************/
+
+func (file *testFile) report(name string, before lang.AssertionCounts, failed bool, problem string) bool {
+	after := file.engine.Assertions()
+	passedAssertions, failedAssertions := after.Passed-before.Passed, after.Failed-before.Failed
+	if !failed && failedAssertions == 0 {
+		fmt.Fprintf(file.output, "PASS %s (%d assertions)\n", name, passedAssertions)
+		return true
+	}
+	fmt.Fprintf(file.output, "FAIL %s (%d passed, %d failed)\n", name, passedAssertions, failedAssertions)
+	for _, line := range lines(file.capture.transcript.String()) {
+		fmt.Fprintln(file.output, "    "+line)
+	}
+	if problem != "" {
+		fmt.Fprintln(file.output, "    "+problem)
+	}
+	return false
+}
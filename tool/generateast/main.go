@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/******************************************************************************
+ * generateast writes the AST node definitions (expr.go and stmt.go), their
+ * JSON encoding (astjsonnodes.go), their binary encoding
+ * (astbinarynodes.go), their rewriting (astrewritenodes.go), their
+ * conversion to browsable trees (astinspectnodes.go), and the walking of
+ * their children (astwalknodes.go) for the lang package. It is the Go equivalent of the GenerateAst tool from
+ * Crafting Interpreters. Each node is described by a single line in the
+ * specifications below. Adding a node type means adding a line here and
+ * running "go generate ./..." rather than hand-editing the node structs,
+ * the visitor interfaces, and the generic accept functions.
+ *
+ * Usage: go run ./tool/generateast <output directory>
+ *****************************************************************************/
+
+type baseType struct {
+	name        string
+	doc         string
+	hasId       bool
+	visitorName string
+	nodes       []string
+}
+
+/******************************************************************************
+ * Field types that may appear in a node specification, mapped to the name of
+ * the astEncoder/astDecoder (lang/astjson.go), binaryEncoder/binaryDecoder
+ * (lang/astbinary.go), astRewriter
+ * (lang/astrewrite.go), astInspector (lang/inspect.go), and astWalker
+ * (lang/astwalk.go) helpers that handle them.
+ *****************************************************************************/
+
+var fieldHelpers = map[string]string{
+	"Token":          "token",
+	"[]Token":        "tokens",
+	"Expr":           "expr",
+	"[]Expr":         "exprs",
+	"Stmt":           "stmt",
+	"[]Stmt":         "stmts",
+	"VariableExpr":   "variable",
+	"[]FunctionStmt": "functions",
+	"any":            "literal",
+	"bool":           "flag",
+}
+
+var exprBase = baseType{
+	name: "Expr",
+	doc: `Expresssion definitions. Expressions are nodes of the AST.
+
+Expression IDs are populated by the parser. They are uniquely assigned
+whenever any expression is created so that the resolver and interpreter are
+able to recognize when they are referring to the same expression.`,
+	hasId:       true,
+	visitorName: "exprVisitor",
+	nodes: []string{
+		"Assign   : name Token, value Expr",
+		"Binary   : left Expr, operator Token, right Expr",
+		"Call     : callee Expr, paren Token, args []Expr, names []Token",
+		"Conditional : condition Expr, thenBranch Expr, elseBranch Expr",
+		"Function : keyword Token, params []Token, body []Stmt, variadic bool",
+		"Get      : object Expr, name Token",
+		"Grouping : expression Expr",
+		"List     : bracket Token, elements []Expr",
+		"Literal  : value any",
+		"Logical  : left Expr, operator Token, right Expr",
+		"Map      : brace Token, keys []Expr, values []Expr",
+		"Set      : object Expr, name Token, value Expr",
+		"Subscript    : object Expr, bracket Token, index Expr",
+		"SubscriptSet : object Expr, bracket Token, index Expr, value Expr",
+		"Super    : keyword Token, method Token",
+		"This     : keyword Token",
+		"Unary    : operator Token, right Expr",
+		"Variable : name Token",
+	},
+}
+
+var stmtBase = baseType{
+	name:        "Stmt",
+	doc:         `Statement definitions. Statements are nodes of the AST.`,
+	hasId:       false,
+	visitorName: "stmtVisitor",
+	nodes: []string{
+		"Block    : statements []Stmt",
+		"Break    : keyword Token",
+		"Class    : name Token, superclass VariableExpr, traits []Expr, methods []FunctionStmt",
+		"Continue : keyword Token",
+		"Error    : tokens []Token",
+		"Expr     : expr Expr",
+		"ForEach  : keyword Token, name Token, collection Expr, body Stmt",
+		"Function : name Token, params []Token, body []Stmt, isGetter bool, variadic bool",
+		"If       : condition Expr, thenBranch Stmt, elseBranch Stmt",
+		"Import   : keyword Token, path Token, name Token",
+		"Print    : expr Expr",
+		"Return   : keyword Token, value Expr",
+		"Trait    : name Token, methods []FunctionStmt",
+		"Var      : name Token, initializer Expr",
+		"While    : condition Expr, body Stmt, increment Expr",
+	},
+}
+
+type field struct {
+	name     string
+	typeName string
+}
+
+type node struct {
+	name   string
+	fields []field
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: generateast <output directory>")
+		os.Exit(64)
+	}
+	outputDir := os.Args[1]
+	bases := []baseType{exprBase, stmtBase}
+	for _, base := range bases {
+		err := defineAst(outputDir, base)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	err := defineJSON(outputDir, bases)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = defineBinary(outputDir, bases)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = defineRewrite(outputDir, bases)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = defineInspect(outputDir, bases)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = defineWalk(outputDir, bases)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func defineAst(outputDir string, base baseType) error {
+	nodes, err := parseNodes(base)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by tool/generateast; DO NOT EDIT.\n\n")
+	buf.WriteString("package lang\n\n")
+	buf.WriteString("import \"fmt\"\n\n")
+	writeDocComment(&buf, base.doc)
+	defineBaseInterface(&buf, base)
+	defineVisitor(&buf, base, nodes)
+	defineAccept(&buf, base, nodes)
+	for _, n := range nodes {
+		defineType(&buf, base, n)
+	}
+
+	return writeSource(filepath.Join(outputDir, strings.ToLower(base.name)+".go"), buf.Bytes())
+}
+
+func writeSource(path string, unformatted []byte) error {
+	source, err := format.Source(unformatted)
+	if err != nil {
+		return fmt.Errorf("formatting generated %s: %w", path, err)
+	}
+	return os.WriteFile(path, source, 0644)
+}
+
+func parseNodes(base baseType) ([]node, error) {
+	nodes := make([]node, 0, len(base.nodes))
+	for _, spec := range base.nodes {
+		name, fieldList, found := strings.Cut(spec, ":")
+		if !found {
+			return nil, fmt.Errorf("malformed %s node specification %q", base.name, spec)
+		}
+		n := node{name: strings.TrimSpace(name) + base.name}
+		for _, f := range strings.Split(fieldList, ",") {
+			parts := strings.Fields(f)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("malformed field %q in %s", f, n.name)
+			}
+			n.fields = append(n.fields, field{name: parts[0], typeName: parts[1]})
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+func writeDocComment(buf *bytes.Buffer, doc string) {
+	buf.WriteString("/" + strings.Repeat("*", 78) + "\n")
+	for _, line := range strings.Split(doc, "\n") {
+		if len(line) == 0 {
+			buf.WriteString(" *\n")
+		} else {
+			buf.WriteString(" * " + line + "\n")
+		}
+	}
+	buf.WriteString(" " + strings.Repeat("*", 77) + "/\n\n")
+}
+
+func defineBaseInterface(buf *bytes.Buffer, base baseType) {
+	fmt.Fprintf(buf, "type %s interface {\n", base.name)
+	if base.hasId {
+		buf.WriteString("getId() int\n")
+	} else {
+		fmt.Fprintf(buf, "%sNode()\n", strings.ToLower(base.name))
+	}
+	buf.WriteString("Span() Span\n")
+	buf.WriteString("}\n\n")
+}
+
+func defineVisitor(buf *bytes.Buffer, base baseType, nodes []node) {
+	fmt.Fprintf(buf, "type %s[R any] interface {\n", base.visitorName)
+	for _, n := range nodes {
+		fmt.Fprintf(buf, "visit%s(%s %s) R\n", n.name, receiverName(base, n), n.name)
+	}
+	buf.WriteString("}\n\n")
+}
+
+func defineAccept(buf *bytes.Buffer, base baseType, nodes []node) {
+	/**************************************************************************
+	 * Go methods can't declare their own type parameters, so dispatch to the
+	 * visitor happens in a generic function instead of an accept method on
+	 * each node. This gives every visitor a compile time checked result type.
+	 *************************************************************************/
+	param := strings.ToLower(base.name)
+	fmt.Fprintf(buf, "func accept%s[R any](%s %s, visitor %s[R]) R {\n", base.name, param, base.name,
+		base.visitorName)
+	fmt.Fprintf(buf, "switch node := %s.(type) {\n", param)
+	for _, n := range nodes {
+		fmt.Fprintf(buf, "case %s:\nreturn visitor.visit%s(node)\n", n.name, n.name)
+	}
+	buf.WriteString("}\n")
+	fmt.Fprintf(buf, "panic(fmt.Sprintf(\"unexpected %s type %%T\", %s))\n}\n\n", strings.ToLower(base.name), param)
+}
+
+func defineType(buf *bytes.Buffer, base baseType, n node) {
+	receiver := receiverName(base, n)
+	fmt.Fprintf(buf, "type %s struct {\n", n.name)
+	if base.hasId {
+		buf.WriteString("id int\n")
+	}
+	buf.WriteString("span Span\n")
+	for _, f := range n.fields {
+		fmt.Fprintf(buf, "%s %s\n", f.name, f.typeName)
+	}
+	buf.WriteString("}\n\n")
+	if base.hasId {
+		fmt.Fprintf(buf, "func (%s %s) getId() int {\nreturn %s.id\n}\n\n", receiver, n.name, receiver)
+	} else {
+		fmt.Fprintf(buf, "func (%s %s) %sNode() {}\n\n", receiver, n.name, strings.ToLower(base.name))
+	}
+	fmt.Fprintf(buf, "func (%s %s) Span() Span {\nreturn %s.span\n}\n\n", receiver, n.name, receiver)
+}
+
+func receiverName(base baseType, n node) string {
+	// statements have always used "stmt" while expressions use their initial
+	if base.name == "Stmt" {
+		return "stmt"
+	}
+	return strings.ToLower(n.name[:1])
+}
+
+func defineJSON(outputDir string, bases []baseType) error {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by tool/generateast; DO NOT EDIT.\n\n")
+	buf.WriteString("package lang\n\n")
+	buf.WriteString("import (\n\"encoding/json\"\n\"fmt\"\n)\n\n")
+	writeDocComment(&buf, `JSON encoding and decoding of every AST node type. See astjson.go for the
+public entry points and the helpers used for each kind of field.`)
+	for _, base := range bases {
+		nodes, err := parseNodes(base)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			err = defineEncode(&buf, base, n)
+			if err != nil {
+				return err
+			}
+		}
+		defineDecode(&buf, base, nodes)
+	}
+	return writeSource(filepath.Join(outputDir, "astjsonnodes.go"), buf.Bytes())
+}
+
+func defineEncode(buf *bytes.Buffer, base baseType, n node) error {
+	receiver := receiverName(base, n)
+	fmt.Fprintf(buf, "func (e astEncoder) visit%s(%s %s) map[string]any {\n", n.name, receiver, n.name)
+	fmt.Fprintf(buf, "return map[string]any{\n\"type\": %q,\n\"span\": %s.span,\n", n.name, receiver)
+	for _, f := range n.fields {
+		helper, known := fieldHelpers[f.typeName]
+		if !known {
+			return fmt.Errorf("no JSON helper for field %s %s in %s", f.name, f.typeName, n.name)
+		}
+		fmt.Fprintf(buf, "%q: e.%s(%s.%s),\n", f.name, helper, receiver, f.name)
+	}
+	buf.WriteString("}\n}\n\n")
+	return nil
+}
+
+func defineDecode(buf *bytes.Buffer, base baseType, nodes []node) {
+	fmt.Fprintf(buf, "func (d *astDecoder) decode%s(nodeType string, fields map[string]json.RawMessage) %s {\n",
+		base.name, base.name)
+	buf.WriteString("switch nodeType {\n")
+	for _, n := range nodes {
+		fmt.Fprintf(buf, "case %q:\nreturn %s{", n.name, n.name)
+		if base.hasId {
+			buf.WriteString("id: d.nextId(), ")
+		}
+		buf.WriteString("span: d.span(fields[\"span\"])")
+		for _, f := range n.fields {
+			fmt.Fprintf(buf, ", %s: d.%s(fields[%q])", f.name, fieldHelpers[f.typeName], f.name)
+		}
+		buf.WriteString("}\n")
+	}
+	buf.WriteString("}\n")
+	fmt.Fprintf(buf, "d.fail(fmt.Errorf(\"unknown %s type %%q\", nodeType))\nreturn nil\n}\n\n",
+		strings.ToLower(base.name))
+}
+
+/******************************************************************************
+ * The binary encoding writes a node as its kind, a number from 1 in the
+ * order the specifications list the nodes (0 is a missing node), followed
+ * by its span and its fields in the order they are declared.
+ *****************************************************************************/
+
+func defineBinary(outputDir string, bases []baseType) error {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by tool/generateast; DO NOT EDIT.\n\n")
+	buf.WriteString("package lang\n\n")
+	buf.WriteString("import \"fmt\"\n\n")
+	writeDocComment(&buf, `Binary encoding and decoding of every AST node type. See astbinary.go for
+the entry points and the helpers used for each kind of field.`)
+	for _, base := range bases {
+		nodes, err := parseNodes(base)
+		if err != nil {
+			return err
+		}
+		for kind, n := range nodes {
+			receiver := receiverName(base, n)
+			fmt.Fprintf(&buf, "func (e *binaryEncoder) visit%s(%s %s) none {\n", n.name, receiver, n.name)
+			fmt.Fprintf(&buf, "e.kind(%d)\ne.span(%s.span)\n", kind+1, receiver)
+			for _, f := range n.fields {
+				helper, known := fieldHelpers[f.typeName]
+				if !known {
+					return fmt.Errorf("no binary helper for field %s %s in %s", f.name, f.typeName, n.name)
+				}
+				fmt.Fprintf(&buf, "e.%s(%s.%s)\n", helper, receiver, f.name)
+			}
+			buf.WriteString("return none{}\n}\n\n")
+		}
+		// the fields of a composite literal are decoded in the order they are written, left to right
+		fmt.Fprintf(&buf, "func (d *binaryDecoder) decode%s(kind uint64) %s {\n", base.name, base.name)
+		buf.WriteString("switch kind {\n")
+		for kind, n := range nodes {
+			fmt.Fprintf(&buf, "case %d:\nreturn %s{", kind+1, n.name)
+			if base.hasId {
+				buf.WriteString("id: d.nextId(), ")
+			}
+			buf.WriteString("span: d.span()")
+			for _, f := range n.fields {
+				fmt.Fprintf(&buf, ", %s: d.%s()", f.name, fieldHelpers[f.typeName])
+			}
+			buf.WriteString("}\n")
+		}
+		buf.WriteString("}\n")
+		fmt.Fprintf(&buf, "d.fail(fmt.Errorf(\"unknown %s kind %%d\", kind))\nreturn nil\n}\n\n",
+			strings.ToLower(base.name))
+	}
+	return writeSource(filepath.Join(outputDir, "astbinarynodes.go"), buf.Bytes())
+}
+
+func defineRewrite(outputDir string, bases []baseType) error {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by tool/generateast; DO NOT EDIT.\n\n")
+	buf.WriteString("package lang\n\n")
+	writeDocComment(&buf, `Rewriting of every AST node type. See astrewrite.go for the entry points
+and the helpers used for each kind of field.`)
+	for _, base := range bases {
+		nodes, err := parseNodes(base)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			receiver := receiverName(base, n)
+			fmt.Fprintf(&buf, "func (r astRewriter) visit%s(%s %s) %s {\n", n.name, receiver, n.name, base.name)
+			fmt.Fprintf(&buf, "%s.span = r.rewriteSpan(%s.span)\n", receiver, receiver)
+			for _, f := range n.fields {
+				helper, known := fieldHelpers[f.typeName]
+				if !known {
+					return fmt.Errorf("no rewrite helper for field %s %s in %s", f.name, f.typeName, n.name)
+				}
+				fmt.Fprintf(&buf, "%s.%s = r.%s(%s.%s)\n", receiver, f.name, helper, receiver, f.name)
+			}
+			fmt.Fprintf(&buf, "return %s\n}\n\n", receiver)
+		}
+	}
+	return writeSource(filepath.Join(outputDir, "astrewritenodes.go"), buf.Bytes())
+}
+
+func defineInspect(outputDir string, bases []baseType) error {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by tool/generateast; DO NOT EDIT.\n\n")
+	buf.WriteString("package lang\n\n")
+	writeDocComment(&buf, `Conversion of every AST node type to an InspectNode. See inspect.go for the
+entry points and the helpers used for each kind of field.`)
+	for _, base := range bases {
+		nodes, err := parseNodes(base)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			receiver := receiverName(base, n)
+			fmt.Fprintf(&buf, "func (i astInspector) visit%s(%s %s) *InspectNode {\n", n.name, receiver, n.name)
+			fmt.Fprintf(&buf, "node := i.node(%q, %s.span,\n", n.name, receiver)
+			for _, f := range n.fields {
+				helper, known := fieldHelpers[f.typeName]
+				if !known {
+					return fmt.Errorf("no inspect helper for field %s %s in %s", f.name, f.typeName, n.name)
+				}
+				fmt.Fprintf(&buf, "i.field(%q, i.%s(%s.%s)),\n", f.name, helper, receiver, f.name)
+			}
+			buf.WriteString(")\n")
+			if base.hasId {
+				fmt.Fprintf(&buf, "i.resolve(node, %s.id)\n", receiver)
+			}
+			buf.WriteString("return node\n}\n\n")
+		}
+	}
+	return writeSource(filepath.Join(outputDir, "astinspectnodes.go"), buf.Bytes())
+}
+
+func defineWalk(outputDir string, bases []baseType) error {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by tool/generateast; DO NOT EDIT.\n\n")
+	buf.WriteString("package lang\n\n")
+	writeDocComment(&buf, `Walking the children of every AST node type. See astwalk.go for the entry
+points and the helpers used for each kind of field.`)
+	for _, base := range bases {
+		nodes, err := parseNodes(base)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			receiver := receiverName(base, n)
+			fmt.Fprintf(&buf, "func (w astWalker) visit%s(%s %s) none {\n", n.name, receiver, n.name)
+			for _, f := range n.fields {
+				helper, known := fieldHelpers[f.typeName]
+				if !known {
+					return fmt.Errorf("no walk helper for field %s %s in %s", f.name, f.typeName, n.name)
+				}
+				// tokens, literal values, and flags have no children to walk
+				if helper == "token" || helper == "tokens" || helper == "literal" || helper == "flag" {
+					continue
+				}
+				fmt.Fprintf(&buf, "w.%s(%s.%s)\n", helper, receiver, f.name)
+			}
+			buf.WriteString("return none{}\n}\n\n")
+		}
+	}
+	return writeSource(filepath.Join(outputDir, "astwalknodes.go"), buf.Bytes())
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/skusel/glox/lang"
+)
+
+/******************************************************************************
+ * `glox xref` lists every variable, function, class, trait, parameter, and
+ * import each script declares, followed by every place it is used.
+ * Locations are printed as file:line:column, and assignments are marked.
+ * Names that are used but never declared, usually natives, are listed last.
+ *****************************************************************************/
+
+func runXref(paths []string) {
+	if len(paths) == 0 {
+		flag.Usage()
+		os.Exit(64)
+	}
+	hadError := false
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		errorHandler := lang.NewErrorHandler()
+		xref := lang.BuildCrossReference(string(source), errorHandler)
+		if xref == nil {
+			hadError = true
+			continue
+		}
+		for _, symbol := range xref.Symbols {
+			if symbol.Kind == "undeclared" {
+				fmt.Printf("%s (undeclared)\n", symbol.Name)
+			} else {
+				fmt.Printf("%s (%s) %s\n", symbol.Name, symbol.Kind, location(path, symbol.Declared))
+			}
+			for _, reference := range symbol.References {
+				if reference.Write {
+					fmt.Printf("    %s (assigned)\n", location(path, reference.Span))
+				} else {
+					fmt.Printf("    %s\n", location(path, reference.Span))
+				}
+			}
+		}
+	}
+	if hadError {
+		os.Exit(65)
+	}
+}
+
+func location(path string, span lang.Span) string {
+	return fmt.Sprintf("%s:%d:%d", path, span.Start.Line, span.Start.Column)
+}